@@ -41,10 +41,17 @@ extern "C" {
 #define PAGE_ERR_NULL_PTR    7
 #define PAGE_ERR_NO_PAGE     8
 #define PAGE_ERR_SELECTOR    9
+#define PAGE_ERR_INVALID_ARG 10
 
 /* Opaque handle */
 typedef struct ServoPage ServoPage;
 
+/* Opaque handle for a borrowed screenshot buffer */
+typedef struct ServoScreenshot ServoScreenshot;
+
+/* Opaque handle for an operation started by a page_*_async() function */
+typedef struct ServoJob ServoJob;
+
 /* ── Lifecycle ─────────────────────────────────────────────────────── */
 
 /**
@@ -61,6 +68,35 @@ typedef struct ServoPage ServoPage;
 ServoPage *page_new(uint32_t width, uint32_t height, uint64_t timeout,
                      double wait, int fullpage, const char *user_agent);
 
+/**
+ * Create a new page instance from a JSON configuration object, so new
+ * options do not change the signature. Every key is optional:
+ *
+ *   width, height, timeout, wait, fullpage, user_agent
+ *       As the page_new() parameters (fullpage is a boolean).
+ *   cache_dir          As for scraper_set_cache_dir(), which it overrides.
+ *   blocked_urls       Array of patterns, as for page_block_urls().
+ *   accept, accept_encoding, origin
+ *       Strings, as for page_set_accept() and friends.
+ *   connection         "wifi", "4g", "3g", "2g" or "offline".
+ *   allow_file_access  Boolean.
+ *   max_image_pixels   Integer, 0 = no limit (default 100000000).
+ *   popups             Boolean, as for page_set_popup_handling().
+ *
+ * Example: {"width": 1920, "height": 1080, "blocked_urls": [".png"]}
+ *
+ * The page is created with its first tab already active and configured, so
+ * the first page_open() navigates with these settings in place. Unknown keys
+ * are ignored with a warning in Servo's log (RUST_LOG=warn), written once
+ * the engine exists; a rejected config is reported by
+ * scraper_last_error_json() instead.
+ *
+ * @return Opaque handle, or NULL on failure (including malformed JSON, a key
+ *         of the wrong type, or an invalid setting). Must be freed with
+ *         page_free().
+ */
+ServoPage *page_new_json(const char *config_json);
+
 /**
  * Destroy a page instance. Safe to call with NULL.
  */
@@ -81,10 +117,181 @@ int page_reset(ServoPage *page);
 /**
  * Open a URL in the page (creates or navigates the WebView).
  *
+ * PAGE_ERR_TIMEOUT is a warning: the page stays open and reflects whatever
+ * had loaded and rendered before the deadline, so page_html(),
+ * page_evaluate() and page_screenshot() can still salvage it.
+ *
  * @return PAGE_OK on success, or an error code.
  */
 int page_open(ServoPage *page, const char *url);
 
+/**
+ * Load an HTML string as the page's document (e.g. rendered template output)
+ * and wait for it like page_open().
+ *
+ * With a base_url (http or https), the document is served as if it were the
+ * response for that URL — nothing is fetched for it — so it gets that origin
+ * and relative stylesheets, images and links resolve against it. With NULL,
+ * it is loaded as a data: URL and only absolute asset URLs work.
+ *
+ * @return PAGE_OK, PAGE_ERR_INVALID_ARG for a base_url that is not http(s),
+ *         or an error code as for page_open().
+ */
+int page_load_html(ServoPage *page, const char *html, const char *base_url);
+
+/**
+ * Change the current document's base URL without navigating, so relative
+ * URLs resolve against url in later calls such as page_links_detailed() and
+ * page_resources() — e.g. for content fetched through a proxy. The first
+ * <base href> is rewritten, or a <base> is inserted into <head> (visible in
+ * page_html()). Loaded resources are not refetched; the override lasts until
+ * the next navigation.
+ *
+ * @return PAGE_OK, PAGE_ERR_INVALID_ARG if url is not an absolute URL that
+ *         can be a base, or another error code.
+ */
+int page_set_base_url(ServoPage *page, const char *url);
+
+/**
+ * Allow or forbid file: URLs, for page_open() and for subresources of any
+ * page. Pass non-zero to allow. Off by default so untrusted pages cannot read
+ * local files; while disabled, page_open() on a file: URL returns
+ * PAGE_ERR_LOAD. http(s):, data: and about: URLs are always accepted.
+ */
+int page_set_allow_file_access(ServoPage *page, int enabled);
+
+/**
+ * Refuse to decode images larger than `pixels` (width x height), guarding
+ * against decompression bombs; oversized images render as broken. The
+ * default, also after page_reset(), is 100000000 (100 megapixels, about
+ * 400 MB once decoded). Pass 0 to disable.
+ *
+ * Only http(s): images are checked. Their dimensions are read from the file
+ * header, so while a limit is set every http(s): image is fetched outside
+ * Servo's HTTP cache and cookie jar; disable it for trusted sites whose
+ * images need cookies or caching.
+ */
+int page_set_max_image_pixels(ServoPage *page, uint64_t pixels);
+
+/**
+ * Allow at most `n` concurrent requests per host (host:port) for all pages,
+ * to be polite to origins or to load sites that reset connections under
+ * the default parallelism. Further requests wait for a free slot. Pass 0
+ * for no limit (the default).
+ *
+ * Enabling a limit disables the cookie jar for http(s) GET/HEAD requests:
+ * they are fetched outside Servo, so they send no cookies, cookies they set
+ * are not stored, and Servo's HTTP cache is bypassed. Requests with a body
+ * are not counted. page_reset() lifts the limit.
+ */
+int page_set_max_connections_per_host(ServoPage *page, size_t n);
+
+/**
+ * Navigation progress callback.
+ *
+ * @param userdata  The pointer passed to page_set_progress_callback().
+ * @param percent   Coarse estimate: 10 once loading has started, 50 after
+ *                  <head> is parsed, 90 at the load event, 100 once the
+ *                  post-load wait is over.
+ * @param requests  Requests started since the navigation began. Servo does
+ *                  not report completions, so this is not a pending count.
+ */
+typedef void (*page_progress_fn)(void *userdata, double percent,
+                                 uint32_t requests);
+
+/**
+ * Install a callback invoked whenever the progress estimate changes while
+ * page_open(), page_reload(), page_go_back() or page_go_forward() blocks,
+ * e.g. to drive a progress bar. Pass NULL as callback to remove it.
+ *
+ * The callback runs on the engine's background thread. Calling page_*
+ * functions from inside it returns PAGE_ERR_CHANNEL instead of deadlocking.
+ */
+int page_set_progress_callback(ServoPage *page, page_progress_fn callback,
+                               void *userdata);
+
+/**
+ * HTML stream callback.
+ *
+ * @param userdata  The pointer passed to page_set_html_stream_callback().
+ * @param chunk     NUL-terminated markup, valid only during the call.
+ * @param len       Length of chunk in bytes.
+ * @return 0 to keep receiving chunks, nonzero to stop until the next
+ *         navigation.
+ */
+typedef int (*page_html_stream_fn)(void *userdata, const char *chunk,
+                                   size_t len);
+
+/**
+ * Install a callback receiving a document's markup while it is parsed and
+ * scripts insert content: each chunk is the outerHTML of a batch of newly
+ * inserted nodes, in document order, so the top of a slow page can be
+ * processed before it finishes loading. page_open() returning still marks
+ * the end. Applies to documents loaded after the call, on every page. Pass
+ * NULL as callback to remove it.
+ *
+ * The callback runs on the engine's background thread. Calling page_*
+ * functions from inside it returns PAGE_ERR_CHANNEL instead of deadlocking.
+ */
+int page_set_html_stream_callback(ServoPage *page, page_html_stream_fn callback,
+                                  void *userdata);
+
+/* ── Async jobs ────────────────────────────────────────────────────── */
+
+/*
+ * Non-blocking variants for hosts that drive many pages from their own event
+ * loop instead of a thread per in-flight call. The operation is queued on the
+ * page's engine thread — operations on one page still run one at a time, in
+ * submission order — and the job handle collects its result.
+ *
+ * A job may outlive its page; it then finishes with PAGE_ERR_CHANNEL. Use a
+ * job from one thread at a time.
+ */
+
+/* Status of a job that has not finished yet */
+#define PAGE_JOB_PENDING (-1)
+
+/**
+ * Start page_open() without waiting for the load. On PAGE_OK, *out_job
+ * receives a handle to free with page_job_free().
+ */
+int page_open_async(ServoPage *page, const char *url, ServoJob **out_job);
+
+/**
+ * Start page_evaluate() without waiting for the result. On PAGE_OK, *out_job
+ * receives a handle to free with page_job_free(); read the JSON result with
+ * page_job_result().
+ */
+int page_evaluate_async(ServoPage *page, const char *script, ServoJob **out_job);
+
+/**
+ * Check a job without blocking: *out_status is set to PAGE_JOB_PENDING or,
+ * once finished, the operation's result code.
+ */
+int page_job_poll(ServoJob *job, int *out_status);
+
+/**
+ * Wait up to timeout_ms for a job.
+ *
+ * @return The operation's result code, or PAGE_JOB_PENDING if it is still
+ *         running.
+ */
+int page_job_wait(ServoJob *job, uint64_t timeout_ms);
+
+/**
+ * Get a job's result code and, for a successful page_evaluate_async() job, a
+ * copy of the JSON result (free with page_string_free()). *out_json is set to
+ * NULL otherwise.
+ *
+ * @return The operation's result code, or PAGE_JOB_PENDING.
+ */
+int page_job_result(ServoJob *job, char **out_json, size_t *out_len);
+
+/**
+ * Free a job handle. Does not cancel the operation. Safe to call with NULL.
+ */
+void page_job_free(ServoJob *job);
+
 /* ── Capture ───────────────────────────────────────────────────────── */
 
 /**
@@ -98,6 +305,43 @@ int page_open(ServoPage *page, const char *url);
 int page_evaluate(ServoPage *page, const char *script,
                    char **out_json, size_t *out_len);
 
+/* JavaScript worlds for page_evaluate_in_world() */
+#define PAGE_WORLD_MAIN     0  /* the page's global scope (page_evaluate) */
+#define PAGE_WORLD_ISOLATED 1  /* private scope (not a security boundary) */
+
+/**
+ * Evaluate JavaScript in the given world and return the result as JSON,
+ * like page_evaluate().
+ *
+ * PAGE_WORLD_ISOLATED keeps the script's top-level declarations out of the
+ * page's globals (and page code out of them). Values that must survive
+ * between isolated calls go on the per-document `world` object, e.g.
+ * "world.rows = () => [...document.querySelectorAll('tr')].length". Servo has
+ * no separate JS realms, so built-ins such as Array.prototype are still shared
+ * with the page.
+ *
+ * This isolates names only, not a security boundary: the script goes through
+ * the page's eval(), which the page may replace, page code can read `world`,
+ * and under a Content-Security-Policy without 'unsafe-eval' isolated calls
+ * fail with PAGE_ERR_JS.
+ *
+ * @return PAGE_OK, or PAGE_ERR_INVALID_ARG for an unknown world.
+ */
+int page_evaluate_in_world(ServoPage *page, const char *script, int world,
+                            char **out_json, size_t *out_len);
+
+/**
+ * Get details of the exception that made the last page_evaluate() call fail
+ * with PAGE_ERR_JS, as JSON:
+ *   {"kind": "CompilationFailure" | "EvaluationFailure" | ...,
+ *    "name": "TypeError" | null, "message": "...", "stack": "..." | null}
+ * "kind" tells syntax errors apart from thrown exceptions. The result is
+ * "null" if the last evaluation succeeded. Free with page_string_free().
+ *
+ * @return PAGE_OK on success, or an error code.
+ */
+int page_last_js_error(ServoPage *page, char **out_json, size_t *out_len);
+
 /**
  * Take a screenshot of the current viewport.
  *
@@ -108,6 +352,17 @@ int page_evaluate(ServoPage *page, const char *script,
  */
 int page_screenshot(ServoPage *page, uint8_t **out_data, size_t *out_len);
 
+/**
+ * Take a screenshot of exactly the viewport (above the fold). Unlike
+ * page_screenshot(), this first restores the viewport size if a previous
+ * page_screenshot_fullpage() left the page resized to the document height,
+ * so the PNG is always the page's width x height. Free with
+ * page_buffer_free().
+ *
+ * @return PAGE_OK on success, or an error code.
+ */
+int page_screenshot_viewport(ServoPage *page, uint8_t **out_data, size_t *out_len);
+
 /**
  * Take a full-page screenshot (captures full scrollable page).
  *
@@ -115,6 +370,131 @@ int page_screenshot(ServoPage *page, uint8_t **out_data, size_t *out_len);
  */
 int page_screenshot_fullpage(ServoPage *page, uint8_t **out_data, size_t *out_len);
 
+/**
+ * Screenshot a section of the page: the full-width band from the top of the
+ * first element matching start_selector to the bottom of the first match of
+ * end_selector, e.g. from one heading to the next. If the end element comes
+ * first, the band runs from its top to the bottom of the start element. The
+ * band may extend below the fold; like page_screenshot_fullpage(), the page
+ * is left resized to the document height. Free with page_buffer_free().
+ *
+ * @return PAGE_OK, PAGE_ERR_SELECTOR if either selector matches nothing, or
+ *         another error code.
+ */
+int page_screenshot_between(ServoPage *page, const char *start_selector,
+                            const char *end_selector, uint8_t **out_data,
+                            size_t *out_len);
+
+/**
+ * Take a screenshot of the current viewport as uncompressed pixels, skipping
+ * the PNG encode (and the caller's decode), e.g. for OpenCV or a custom diff.
+ *
+ * The format is RGBA with 8 bits per channel in that byte order, alpha not
+ * premultiplied (normally 255). The pixel at (x, y) starts at byte
+ * y * stride + x * 4, rows run top to bottom, and *out_stride is always
+ * width * 4 (no row padding), so *out_len == *out_stride * *out_height.
+ * Free *out_data with page_buffer_free(data, len).
+ *
+ * @return PAGE_OK on success, or an error code.
+ */
+int page_screenshot_raw(ServoPage *page, uint8_t **out_data, size_t *out_len,
+                        uint32_t *out_width, uint32_t *out_height, size_t *out_stride);
+
+/**
+ * Compute a 64-bit perceptual hash (DCT pHash) of what page_screenshot()
+ * would capture, without encoding or copying the image: the render is
+ * converted to greyscale and scaled to 32x32, and each of the 64
+ * lowest-frequency DCT coefficients sets a bit when it is above their median.
+ * Identical renders give identical hashes; compare pages by the Hamming
+ * distance (popcount of a ^ b) — a few bits apart means near-duplicates.
+ *
+ * @return PAGE_OK on success, or an error code.
+ */
+int page_screenshot_phash(ServoPage *page, uint64_t *out_hash);
+
+/**
+ * Take a viewport screenshot at each device-scale factor in factors[0..count]
+ * (e.g. {1, 2, 3}) and write them to dir as "<prefix>@<factor>x.png"
+ * (icon@1x.png, icon@2x.png, ...). dir is created if missing.
+ *
+ * The CSS viewport is unchanged, so every output has the same layout — only
+ * the raster scale differs. *out_written is set to the number of files
+ * written, also on failure. Factors outside (0, 8] return
+ * PAGE_ERR_INVALID_ARG. The previous scale and size are restored afterwards.
+ *
+ * @return PAGE_OK on success, or an error code.
+ */
+int page_screenshot_scales(ServoPage *page, const float *factors, size_t count,
+                           const char *dir, const char *prefix,
+                           size_t *out_written);
+
+/**
+ * Set the browser zoom of the active page, e.g. 1.25 or 1.5 for
+ * accessibility audits. Unlike the factors of page_screenshot_scales(), zoom
+ * shrinks the CSS viewport, so the page reflows and media queries
+ * re-evaluate; screenshots keep the page's pixel size. The zoom stays with
+ * the page across navigations.
+ *
+ * @return PAGE_OK, PAGE_ERR_NO_PAGE, or PAGE_ERR_INVALID_ARG outside 0.1-8.0.
+ */
+int page_set_zoom(ServoPage *page, double factor);
+
+/**
+ * Get the browser zoom of the active page (1.0 by default).
+ */
+int page_get_zoom(ServoPage *page, double *out_factor);
+
+/**
+ * Capture a filmstrip: scroll from the top of the page to the bottom in
+ * steps of step_px CSS pixels, taking a viewport screenshot at each stop,
+ * and write the frames to dir as "<prefix>-0001.png", "<prefix>-0002.png",
+ * ... (dir is created if missing). The last frame always shows the bottom of
+ * the page; the scroll position is restored afterwards.
+ *
+ * *out_written is set to the number of frames written, also on failure.
+ * A step_px of 0 returns PAGE_ERR_INVALID_ARG.
+ *
+ * @return PAGE_OK on success, or an error code.
+ */
+int page_screenshot_filmstrip(ServoPage *page, uint32_t step_px, const char *dir,
+                              const char *prefix, size_t *out_written);
+
+/**
+ * Export the viewport as four PNG layers in dir (created if missing):
+ * "<prefix>-background.png" (opaque backgrounds, borders and background
+ * images), "<prefix>-text.png", "<prefix>-images.png" (img, svg, video,
+ * canvas, iframe) and "<prefix>-overlays.png" (fixed and sticky elements).
+ * All but the background are transparent; stacked in that order they
+ * approximate page_screenshot().
+ *
+ * Each layer is a separate render, so pages animating between renders yield
+ * inconsistent layers.
+ *
+ * @return PAGE_OK on success, PAGE_ERR_SCREENSHOT if a layer cannot be
+ *         captured or written, or another error code.
+ */
+int page_export_layers(ServoPage *page, const char *dir, const char *prefix);
+
+/**
+ * Take a viewport screenshot without transferring ownership of the buffer.
+ *
+ * On success, *out_data / *out_len describe a PNG buffer owned by the library
+ * and *out_handle identifies it. Use the bytes directly (write them to a file
+ * or socket), then call page_screenshot_release(handle). The view is only
+ * guaranteed valid until the next render on that page — release it before
+ * taking the next screenshot. Do not pass *out_data to page_buffer_free().
+ *
+ * @return PAGE_OK on success, or an error code.
+ */
+int page_screenshot_borrow(ServoPage *page, const uint8_t **out_data,
+                           size_t *out_len, ServoScreenshot **out_handle);
+
+/**
+ * Release a screenshot borrowed with page_screenshot_borrow().
+ * Safe to call with NULL.
+ */
+void page_screenshot_release(ServoScreenshot *handle);
+
 /**
  * Capture the HTML content of the current page.
  *
@@ -125,6 +505,46 @@ int page_screenshot_fullpage(ServoPage *page, uint8_t **out_data, size_t *out_le
  */
 int page_html(ServoPage *page, char **out_html, size_t *out_len);
 
+/**
+ * Capture the document as a JSON tree for scraper_diff_dom(): elements are
+ * {"tag", "attrs", "children"}, text is {"text"} with whitespace collapsed;
+ * whitespace-only text and comments are skipped. "null" if there is no
+ * document element. Free the result with page_string_free().
+ *
+ * @return PAGE_OK on success, or an error code.
+ */
+int page_dom_snapshot(ServoPage *page, char **out_json, size_t *out_len);
+
+/**
+ * Export the current document as one self-contained HTML file, e.g. for
+ * archiving. The markup is the live DOM, with scripts removed and canvases
+ * turned into images; stylesheets (including @import), images and CSS
+ * assets such as fonts and backgrounds are inlined as data: URIs.
+ *
+ * Assets are fetched again without cookies, subject to blocked URLs,
+ * offline emulation and the request interceptor. Those that are refused,
+ * fail or are larger than max_asset_bytes (0 = no limit) keep their
+ * absolute URL, as do frames, media and links. Free the result with
+ * page_string_free().
+ *
+ * @return PAGE_OK on success, or an error code.
+ */
+int page_single_file(ServoPage *page, uint64_t max_asset_bytes, char **out_html, size_t *out_len);
+
+/**
+ * Capture the HTML content of the current page, gzip-compressed (RFC 1952,
+ * not null-terminated). level is 0 (store only) to 9 (smallest), or -1 for
+ * the default (6). Compression happens in Rust, off the engine thread.
+ *
+ * On success, *out_data is set to a heap-allocated buffer and *out_len to
+ * its size in bytes. Free with page_buffer_free().
+ *
+ * @return PAGE_OK on success, PAGE_ERR_INVALID_ARG for a bad level, or
+ *         another error code.
+ */
+int page_html_gzip(ServoPage *page, int level, uint8_t **out_data,
+                   size_t *out_len);
+
 /* ── Page info ─────────────────────────────────────────────────────── */
 
 /**
@@ -139,6 +559,70 @@ int page_url(ServoPage *page, char **out_url, size_t *out_len);
  */
 int page_title(ServoPage *page, char **out_title, size_t *out_len);
 
+/**
+ * Get the document's character encoding as detected by the engine from the
+ * Content-Type header, a BOM or <meta charset> (e.g. "UTF-8",
+ * "windows-1252"). Empty string if undetermined.
+ * Free the result with page_string_free().
+ */
+int page_charset(ServoPage *page, char **out_charset, size_t *out_len);
+
+/**
+ * Get paint milestones of the current document in milliseconds since
+ * navigation start: First Contentful Paint (*out_fcp_ms) and the latest
+ * Largest Contentful Paint candidate (*out_lcp_ms). A metric the engine has
+ * not reported yet is set to -1.
+ */
+int page_paint_timing(ServoPage *page, double *out_fcp_ms, double *out_lcp_ms);
+
+/**
+ * Enable (non-zero) or disable render mode tracking on every page. Off by
+ * default. While enabled, each document is measured at DOMContentLoaded for
+ * page_render_mode(); enable it before loading the page to classify.
+ *
+ * @return PAGE_OK.
+ */
+int page_set_render_mode_tracking(ServoPage *page, int enabled);
+
+/**
+ * Guess how the current document builds its content: "server-rendered",
+ * "client-rendered" (e.g. a single-page app) or "hybrid". Advisory only,
+ * e.g. to route pages to a plain HTTP fetch or a full render.
+ *
+ * Compares the content at DOMContentLoaded with the content now (call after
+ * the post-load wait): the share of visible body text, or of elements when
+ * there is under 200 characters of text. >= 80% present early is
+ * server-rendered, <= 25% client-rendered, anything between hybrid.
+ * Synchronous rendering before DOMContentLoaded looks server-rendered, and
+ * content still loading looks client-rendered.
+ *
+ * On success *out_mode is set to the label (free with page_string_free()).
+ * @return PAGE_OK, PAGE_ERR_INVALID_ARG while page_set_render_mode_tracking()
+ *         is off, or PAGE_ERR_JS for a document not measured at
+ *         DOMContentLoaded.
+ */
+int page_render_mode(ServoPage *page, char **out_mode, size_t *out_len);
+
+/**
+ * Enable (non-zero) or disable service worker tracking on every page. Off by
+ * default. While enabled, navigator.serviceWorker.register() calls are noted
+ * for page_has_service_worker(); enable it before the page registers.
+ *
+ * @return PAGE_OK.
+ */
+int page_set_service_worker_tracking(ServoPage *page, int enabled);
+
+/**
+ * Report whether the current document registered a service worker via
+ * navigator.serviceWorker.register(), or is controlled by one registered
+ * earlier (e.g. in a persistent profile). *out_registered is set to 1 if so,
+ * 0 otherwise. Registrations are only seen with
+ * page_set_service_worker_tracking() on; without it only a controlling
+ * worker counts. Always 0 when service workers are unavailable, which is the
+ * default in Servo (see PAGE_FEATURE_SERVICE_WORKERS).
+ */
+int page_has_service_worker(ServoPage *page, int *out_registered);
+
 /* ── Events (JSON arrays) ─────────────────────────────────────────── */
 
 /**
@@ -165,6 +649,60 @@ int page_wait_for_selector(ServoPage *page, const char *selector, uint64_t timeo
  */
 int page_wait_for_condition(ServoPage *page, const char *js_expr, uint64_t timeout_secs);
 
+/**
+ * Wait for text to appear anywhere in the page's rendered text.
+ * Pass non-zero case_sensitive for an exact-case match.
+ * Returns PAGE_ERR_TIMEOUT if the text does not appear within timeout_ms.
+ */
+int page_wait_for_text(ServoPage *page, const char *text, int case_sensitive,
+                        uint64_t timeout_ms);
+
+/**
+ * Enable (non-zero) or disable download capture on every page. Off by
+ * default. While enabled, clicks on <a download> links are cancelled and the
+ * target is fetched by the page's fetch() into a queue for
+ * page_wait_for_download(), so cross-origin files need CORS and bodies stay
+ * in memory until taken. Main-frame GET navigations answered with
+ * Content-Disposition: attachment are queued too and the page keeps its
+ * current document; to check that header, navigations are fetched outside
+ * Servo's HTTP cache and cookie jar. Attachments answering a form POST are not captured.
+ * Disabling takes effect from the next navigation for <a download> links and
+ * at once for attachments.
+ *
+ * @return PAGE_OK.
+ */
+int page_set_download_capture(ServoPage *page, int enabled);
+
+/**
+ * Wait for a download started by an earlier click on an <a download> link
+ * (including script-created anchors, e.g. blob exports) or a navigation to a
+ * Content-Disposition: attachment response to finish. Enable
+ * page_set_download_capture() before the click. The click may happen before
+ * this call; attachments are returned first, oldest first, then the oldest
+ * finished <a download>.
+ *
+ * On success, *out_data / *out_len hold the file bytes (free with
+ * page_buffer_free()) and *out_filename the suggested file name (free with
+ * page_string_free()). Returns PAGE_ERR_TIMEOUT if no download finishes
+ * within timeout_ms, PAGE_ERR_LOAD if fetching the file failed, or
+ * PAGE_ERR_INVALID_ARG if capture is off.
+ */
+int page_wait_for_download(ServoPage *page, uint64_t timeout_ms, uint8_t **out_data,
+                            size_t *out_len, char **out_filename);
+
+/**
+ * Wait until every <img> in the document has finished loading or failed,
+ * then for the next frame, so a following screenshot shows no half-loaded
+ * images. Images without a source are skipped; CSS backgrounds are not
+ * tracked, and loading="lazy" images outside the viewport may never load.
+ *
+ * On success, *out_loaded and *out_failed hold the number of decoded and of
+ * broken images. Returns PAGE_ERR_TIMEOUT if some image is still pending
+ * after timeout_ms.
+ */
+int page_wait_for_images(ServoPage *page, uint64_t timeout_ms, uint32_t *out_loaded,
+                          uint32_t *out_failed);
+
 /**
  * Wait for a fixed number of seconds while keeping the event loop alive.
  */
@@ -208,6 +746,25 @@ int page_key_press(ServoPage *page, const char *key_name);
  */
 int page_mouse_move(ServoPage *page, float x, float y);
 
+/**
+ * Variants of page_click(), page_click_selector() and page_mouse_move()
+ * (hover) that also report the element the event actually lands on, for
+ * debugging ambiguous selectors or overlays. The target is resolved by
+ * hit-testing just before the event and returned as JSON:
+ *   {"tag": "button", "selector": "#form > div:nth-of-type(2) > button"}
+ * or "null" if nothing is at that point. The selector matches only that
+ * element: it starts at the nearest ancestor with a unique id.
+ *
+ * Pass NULL for both out_target and out_len to skip the report. Otherwise
+ * free *out_target with page_string_free().
+ */
+int page_click_target(ServoPage *page, float x, float y, char **out_target,
+                      size_t *out_len);
+int page_click_selector_target(ServoPage *page, const char *selector,
+                               char **out_target, size_t *out_len);
+int page_hover_target(ServoPage *page, float x, float y, char **out_target,
+                      size_t *out_len);
+
 /* ── Scroll ────────────────────────────────────────────────────────── */
 
 /**
@@ -220,6 +777,16 @@ int page_scroll(ServoPage *page, double delta_x, double delta_y);
  */
 int page_scroll_to_selector(ServoPage *page, const char *selector);
 
+/**
+ * Get the document's scrollable size (scrollHeight / scrollWidth) and the
+ * current scroll offset (scrollY / scrollX), all in CSS pixels. The bottom is
+ * reached when scroll_top plus the viewport height reaches scroll_height.
+ *
+ * @return PAGE_OK or PAGE_ERR_NO_PAGE if nothing is loaded.
+ */
+int page_scroll_metrics(ServoPage *page, double *scroll_height, double *scroll_width,
+                        double *scroll_top, double *scroll_left);
+
 /* ── Select ────────────────────────────────────────────────────────── */
 
 /**
@@ -248,11 +815,39 @@ int page_get_cookies(ServoPage *page, char **out_cookies, size_t *out_len);
  */
 int page_set_cookie(ServoPage *page, const char *cookie);
 
+/**
+ * Set a cookie via document.cookie with a SameSite attribute: "None", "Lax"
+ * or "Strict" (case-insensitive), replacing any SameSite already in cookie.
+ * Browsers reject SameSite=None without Secure, so that combination is
+ * logged as a warning. Returns PAGE_ERR_INVALID_ARG for unknown values.
+ */
+int page_set_cookie_same_site(ServoPage *page, const char *cookie,
+                              const char *same_site);
+
 /**
  * Clear all cookies for the current page.
  */
 int page_clear_cookies(ServoPage *page);
 
+/**
+ * Choose which cookies pages may set, for all pages: "accept_all" (default),
+ * "block_third_party" or "block_all".
+ *
+ * Blocked HTTP(S) GET/HEAD requests (all, or those whose site differs from
+ * the top-level document's) are fetched without Cookie and with Set-Cookie
+ * dropped. Requests with a body (POST forms and fetches) cannot be re-sent
+ * outside Servo and go through unchanged, so even under "block_all" they
+ * send and store cookies. document.cookie
+ * writes are ignored in every document, or in cross-origin frames for
+ * "block_third_party". Sites are compared by their last two host labels.
+ * Cookies seeded with page_set_cookie() are kept, but "block_all" stops them
+ * from being sent. Relaxing the policy re-enables document.cookie from the
+ * next navigation.
+ *
+ * @return PAGE_OK or PAGE_ERR_INVALID_ARG for an unknown policy.
+ */
+int page_set_cookie_policy(ServoPage *page, const char *policy);
+
 /* ── Request interception ──────────────────────────────────────────── */
 
 /**
@@ -260,6 +855,178 @@ int page_clear_cookies(ServoPage *page);
  */
 int page_block_urls(ServoPage *page, const char *patterns);
 
+/* Request interceptor actions */
+#define PAGE_REQUEST_CONTINUE       0
+#define PAGE_REQUEST_ABORT          1
+#define PAGE_REQUEST_REDIRECT       2  /* *out_arg = target URL */
+#define PAGE_REQUEST_MODIFY_HEADERS 3  /* *out_arg = JSON object of headers */
+
+/**
+ * Request interceptor callback.
+ *
+ * @param userdata      The pointer passed to page_set_request_interceptor().
+ * @param request_json  {"method", "url", "headers": {name: value}, "is_main_frame"}.
+ * @param out_arg       For REDIRECT / MODIFY_HEADERS, set to a string that stays
+ *                      valid until the callback returns (it is copied).
+ * @return A PAGE_REQUEST_* action. Unknown values continue the request.
+ */
+typedef int (*page_request_interceptor_fn)(void *userdata,
+                                           const char *request_json,
+                                           const char **out_arg);
+
+/**
+ * Install a callback invoked for every request (after page_block_urls()
+ * patterns). Pass NULL as callback to remove it.
+ *
+ * ABORT fails the request like a blocked URL. REDIRECT answers with a 307 to
+ * the given URL. MODIFY_HEADERS re-sends the request with exactly the given
+ * headers; it only applies to HTTP(S) GET/HEAD requests, which are then
+ * fetched outside Servo (bypassing its cache and cookie jar).
+ *
+ * The callback runs on the engine's background thread. Calling page_*
+ * functions from inside it returns PAGE_ERR_CHANNEL instead of deadlocking.
+ */
+int page_set_request_interceptor(ServoPage *page,
+                                 page_request_interceptor_fn callback,
+                                 void *userdata);
+
+/**
+ * Set the Accept header sent with top-level navigations of the active page
+ * (e.g. "application/json"). Subresources keep their defaults. Pass NULL to
+ * restore the default. The navigation is then fetched outside Servo, as with
+ * PAGE_REQUEST_MODIFY_HEADERS: without Servo's cookie jar or HTTP cache, so
+ * it carries no cookies and cookies it sets are not stored.
+ *
+ * @return PAGE_OK, PAGE_ERR_NO_PAGE if no page exists yet, or
+ *         PAGE_ERR_INVALID_ARG for a value that is not a valid header value.
+ */
+int page_set_accept(ServoPage *page, const char *value);
+
+/**
+ * Set the Accept-Encoding header sent with top-level navigations of the
+ * active page: "identity" to receive the response uncompressed, or "gzip" to
+ * avoid a server's broken brotli. Pass NULL or "" to restore the default.
+ * As with page_set_accept(), the navigation is then fetched outside Servo.
+ *
+ * @return PAGE_OK, PAGE_ERR_NO_PAGE if no page exists yet, or
+ *         PAGE_ERR_INVALID_ARG for codings other than gzip and identity.
+ */
+int page_set_accept_encoding(ServoPage *page, const char *value);
+
+/**
+ * Override the Content-Security-Policy of top-level HTTP(S) responses of the
+ * active page, e.g. "script-src * 'unsafe-inline' 'unsafe-eval'" to let
+ * init scripts and evaluation helpers run on sites whose policy blocks them.
+ * "" removes the policy; NULL restores the site's own.
+ * Content-Security-Policy-Report-Only is dropped too, but policies in
+ * <meta http-equiv> still apply. As with page_set_accept(), the navigation is
+ * then fetched outside Servo, without its cookie jar: no cookies are sent and
+ * none are stored.
+ *
+ * SECURITY: this deliberately weakens the page's protection against
+ * injected scripts. Opt in only for content you control or sandbox.
+ *
+ * @return PAGE_OK, PAGE_ERR_NO_PAGE if no page exists yet, or
+ *         PAGE_ERR_INVALID_ARG for a policy that is not a valid header value.
+ */
+int page_set_csp(ServoPage *page, const char *policy);
+
+/**
+ * Set the fetch metadata headers sent with every HTTP(S) request of the
+ * active page, e.g. ("same-site", "cors", "empty") to look like a same-site
+ * XHR for APIs that validate them:
+ *   site  Sec-Fetch-Site: "cross-site", "same-origin", "same-site", "none"
+ *   mode  Sec-Fetch-Mode: "cors", "navigate", "no-cors", "same-origin", "websocket"
+ *   dest  Sec-Fetch-Dest: a destination token ("empty", "document", "image", ...)
+ * NULL restores the engine's value for that header. Affected GET/HEAD
+ * requests are fetched outside Servo, as with PAGE_REQUEST_MODIFY_HEADERS;
+ * other methods are sent unchanged (Servo does not expose request bodies).
+ * While set, every GET/HEAD of the page therefore goes without Servo's cookie
+ * jar and HTTP cache: no cookies are sent and none are stored.
+ *
+ * @return PAGE_OK, PAGE_ERR_NO_PAGE if no page exists yet, or
+ *         PAGE_ERR_INVALID_ARG for an unknown value.
+ */
+int page_set_fetch_metadata(ServoPage *page, const char *site, const char *mode,
+                            const char *dest);
+
+/**
+ * Set the Origin header sent with every HTTP(S) request of the active page
+ * (e.g. "https://shop.example.com", or "null"). NULL restores the default.
+ * Applied like page_set_fetch_metadata(), including the loss of cookies on
+ * GET/HEAD requests and no effect on POSTs.
+ *
+ * @return PAGE_OK, PAGE_ERR_NO_PAGE if no page exists yet, or
+ *         PAGE_ERR_INVALID_ARG if origin is not scheme://host[:port].
+ */
+int page_set_origin(ServoPage *page, const char *origin);
+
+/**
+ * Add a rule setting header `name` to `value` on HTTP(S) requests of the
+ * active page under `url_prefix`, e.g. an Authorization header only for
+ * "https://api.example.com/v1". NULL `value` removes the header instead.
+ *
+ * A request matches when its scheme, host and port equal the prefix's and
+ * its path is the prefix path or continues it after a "/" ("/v1" covers
+ * "/v1/users", not "/v10"). The query is never looked at, so URLs that only
+ * mention the prefix do not match. Rules apply in the order added, after the
+ * other header overrides, so a later match wins; redirects are matched again
+ * against the new URL. Applied like page_set_fetch_metadata(): only GET and
+ * HEAD requests can be re-sent, so POST and other requests with a body go
+ * out without the header.
+ *
+ * @return PAGE_OK, PAGE_ERR_NO_PAGE if no page exists yet, or
+ *         PAGE_ERR_INVALID_ARG for a prefix that is not an http(s) URL
+ *         without query, or an invalid header name or value.
+ */
+int page_add_header_rule(ServoPage *page, const char *url_prefix, const char *name,
+                         const char *value);
+
+/**
+ * Remove all rules added by page_add_header_rule().
+ *
+ * @return PAGE_OK or PAGE_ERR_NO_PAGE if no page exists yet.
+ */
+int page_clear_header_rules(ServoPage *page);
+
+/* ── Network emulation ─────────────────────────────────────────────── */
+
+/**
+ * Emulate a network connection type: "wifi", "4g", "3g", "2g" or "offline".
+ * Sets navigator.connection / navigator.onLine and adds the preset's latency
+ * to every HTTP(S) request; "offline" cancels HTTP(S) requests.
+ * Applies to all pages. Returns PAGE_ERR_INVALID_ARG for unknown types.
+ */
+int page_set_connection_type(ServoPage *page, const char *type);
+
+/* ── Feature flags ─────────────────────────────────────────────────── */
+
+/* Web-platform features for page_set_feature_flags(); all enabled by default */
+#define PAGE_FEATURE_WEBGL           1  /* WebGL canvas contexts */
+#define PAGE_FEATURE_WASM            2  /* the WebAssembly global */
+#define PAGE_FEATURE_SERVICE_WORKERS 4  /* navigator.serviceWorker (off in Servo builds by default) */
+#define PAGE_FEATURES_ALL            7
+
+/**
+ * Enable the features whose PAGE_FEATURE_* bits are set in mask and disable
+ * the rest, for all pages. Pass PAGE_FEATURES_ALL to restore the default.
+ * Disabled features are removed before page scripts run: WebGL contexts
+ * cannot be created and WebAssembly / navigator.serviceWorker are undefined.
+ * Disabling also affects the current document; re-enabling takes effect on
+ * the next navigation. Returns PAGE_ERR_INVALID_ARG for unknown bits.
+ */
+int page_set_feature_flags(ServoPage *page, uint32_t mask);
+
+/**
+ * Make randomness deterministic on all pages, for byte-stable captures of
+ * pages that shuffle content or generate random IDs: Math.random(),
+ * crypto.getRandomValues() and crypto.randomUUID() are replaced before page
+ * scripts run by a generator seeded with seed, restarting for each document.
+ * The generator is not cryptographically secure. Pass 0 (the default) to
+ * restore real randomness from the next navigation.
+ */
+int page_set_random_seed(ServoPage *page, uint64_t seed);
+
 /* ── Navigation (extended) ─────────────────────────────────────────── */
 
 /**
@@ -286,6 +1053,125 @@ int page_go_forward(ServoPage *page);
 int page_element_rect(ServoPage *page, const char *selector,
                        char **out_json, size_t *out_len);
 
+/**
+ * Check that a CSS selector parses, without side effects. *out_valid is set
+ * to 1 or 0. If valid and out_matches is not NULL, *out_matches receives the
+ * number of elements it matches in the current document, so zero or
+ * over-matching selectors can be flagged. If out_error is not NULL it
+ * receives the parser message for an invalid selector (free with
+ * page_string_free()), or NULL.
+ *
+ * @return PAGE_OK whenever the check ran, valid or not; an error code
+ *         otherwise (e.g. PAGE_ERR_NO_PAGE).
+ */
+int page_validate_selector(ServoPage *page, const char *selector,
+                           int *out_valid, size_t *out_matches,
+                           char **out_error);
+
+/**
+ * Check that a script parses as a classic script, as page_evaluate() runs
+ * it, without running it: return outside a function, top-level await and
+ * import/export are reported invalid. Servo compiles the script directly, so
+ * the page's CSP does not get in the way. *out_valid and *out_error are set
+ * as for page_validate_selector().
+ */
+int page_validate_script(ServoPage *page, const char *script, int *out_valid,
+                         char **out_error);
+
+/**
+ * Get the document's <a href> and <area href> links as a JSON array, in
+ * document order:
+ *   [{"url": "https://...", "text": "...", "rel": "nofollow noopener",
+ *     "target": "_blank", "nofollow": true, "sponsored": false, "ugc": false}]
+ * `url` is absolute; `rel` and `target` are null when the attribute is
+ * absent. Free the result with page_string_free().
+ */
+int page_links_detailed(ServoPage *page, char **out_json, size_t *out_len);
+
+/**
+ * Evaluate an XPath expression and return the text content of each matching
+ * node (an attribute's value for attribute nodes) as a JSON array of strings,
+ * in document order. No matches return "[]". Expressions yielding a number,
+ * string or boolean, e.g. "count(//a)", return a one-element array.
+ * Free the result with page_string_free().
+ *
+ * @return PAGE_OK, PAGE_ERR_INVALID_ARG for an invalid expression, or
+ *         another error code.
+ */
+int page_query_xpath(ServoPage *page, const char *xpath, char **out_json,
+                     size_t *out_len);
+
+/**
+ * Get the bounding rectangles of all elements matching a selector as a JSON
+ * array of {"x","y","width","height"} in document-relative CSS pixels, in
+ * document order. No matches return "[]". One round trip for any number of
+ * elements. Free the result with page_string_free().
+ */
+int page_element_rects(ServoPage *page, const char *selector,
+                       char **out_json, size_t *out_len);
+
+/**
+ * Check whether a click on the first element matching selector would reach
+ * it: the element is visible, enabled, inside the viewport, and topmost at its
+ * center point. Sets *out_clickable to 1, or 0 if it is present but e.g.
+ * hidden, disabled or covered by an overlay.
+ *
+ * @return PAGE_OK, or PAGE_ERR_SELECTOR if nothing matches.
+ */
+int page_is_clickable(ServoPage *page, const char *selector, int *out_clickable);
+
+/* Resource types for page_resources() (combine with |) */
+#define PAGE_RESOURCE_STYLESHEET 1  /* <link rel="stylesheet"> */
+#define PAGE_RESOURCE_SCRIPT     2  /* <script src> */
+#define PAGE_RESOURCE_IMAGE      4  /* <img> (chosen srcset candidate) */
+
+/**
+ * Get the stylesheets, scripts and/or images the document declares, as a
+ * JSON array of {"type": "stylesheet"|"script"|"image", "url": "..."} in
+ * document order. URLs are absolute and deduplicated per type. Reflects the
+ * current DOM — see page_network_requests() for everything fetched.
+ * Free the result with page_string_free().
+ *
+ * @return PAGE_OK, or PAGE_ERR_INVALID_ARG for unknown mask bits.
+ */
+int page_resources(ServoPage *page, uint32_t type_mask,
+                    char **out_json, size_t *out_len);
+
+/**
+ * Get the font families the document renders text with, plus every web font
+ * it declares, e.g. to diagnose screenshots that differ between hosts. JSON
+ * array of objects:
+ *
+ *   {"family": "Roboto" | null, "source": "web"|"system"|"generic"|"default",
+ *    "status": "loaded"|"error"|"loading"|"unloaded"|"unavailable" | null,
+ *    "elements": 12, "fallback_for": ["Brand Sans"]}
+ *
+ * elements counts rendered elements whose own text resolves to the family
+ * (0 for an unused or failed web font); fallback_for lists the families
+ * before it in their font-family that were skipped — failed web fonts or
+ * fonts missing on this host. status is set for web fonts only; family is
+ * null for the browser default, used when nothing in a stack renders.
+ *
+ * Servo does not expose its font matching, so stacks are resolved in the
+ * page from document.fonts, @font-face rules and text measurements; glyph
+ * fallback within a font is not detected. Free with page_string_free().
+ *
+ * @return PAGE_OK on success, or an error code.
+ */
+int page_used_fonts(ServoPage *page, char **out_json, size_t *out_len);
+
+/**
+ * Get the stylesheets and scripts that blocked the first paint of the
+ * current document, as a JSON array of
+ * {"type": "stylesheet"|"script", "url": "...", "duration_ms": 12.5|null,
+ *  "async": false, "defer": false}.
+ * duration_ms comes from Resource Timing and is null without an entry (e.g.
+ * data: URLs). async/defer scripts appear only if they had loaded before the
+ * first paint. Each navigation starts a fresh list.
+ * Free the result with page_string_free().
+ */
+int page_render_blocking(ServoPage *page, char **out_json, size_t *out_len);
+
 /**
  * Get the text content of an element.
  * Free the result with page_string_free().
@@ -375,10 +1261,140 @@ int page_page_url(ServoPage *page, uint32_t page_id,
 int page_page_title(ServoPage *page, uint32_t page_id,
                      char **out_title, size_t *out_len);
 
+/**
+ * List open pages and popups, ordered by ID, as a JSON array of
+ * {"index": 0, "id": 0, "url": "..."|null, "title": "..."|null,
+ *  "popup": false, "active": true}.
+ * Pending popups are adopted first, as by page_popup_pages(); popups are
+ * only captured after page_set_popup_handling(page, 1).
+ * Free the result with page_string_free().
+ */
+int page_windows(ServoPage *page, char **out_json, size_t *out_len);
+
+/**
+ * Make the window at index in page_windows() the active page, so
+ * page_html(), page_screenshot() etc. operate on it.
+ *
+ * @return PAGE_OK, or PAGE_ERR_NO_PAGE if index is out of range.
+ */
+int page_switch_window(ServoPage *page, size_t index);
+
+/* ── Process-wide ──────────────────────────────────────────────────── */
+
+/**
+ * Set the directory where pages created by later page_new() calls keep
+ * Servo's on-disk state (HTTP cache, cookie and HSTS storage), e.g. a
+ * writable volume when the default location is read-only. Pass NULL to
+ * restore the default. Call before page_new().
+ *
+ * The directory is created if missing; if it cannot be created or written,
+ * page_new() fails and returns NULL. The setting is process-wide in Servo:
+ * once a page exists, page_new() also fails for any other directory, so
+ * choose it before the first page and keep it.
+ *
+ * Servo also keeps cookies and localStorage there, so reusing the directory
+ * in a later run resumes the session, e.g. stays logged in. That makes it a
+ * persistent profile for the whole process: run one process per profile,
+ * and only one process per directory at a time.
+ *
+ * @return PAGE_OK, or PAGE_ERR_INVALID_ARG if path is not valid UTF-8.
+ */
+int scraper_set_cache_dir(const char *path);
+
+/**
+ * Append one JSON line per request made by any page in the process to the
+ * file at path, like a web server access log, e.g. for auditing unattended
+ * crawls. Pass NULL to stop logging. The file is created if missing and
+ * appended to, never truncated.
+ *
+ * Each line is {"time_ms", "method", "url", "main_frame", "page_url"}, with
+ * time_ms since the Unix epoch and page_url the document that made the
+ * request (null before the first load). Lines are written when a request
+ * starts, including ones later blocked or aborted; there is no response
+ * status. Every line is a single unbuffered write, so concurrent pages never
+ * interleave and a crash of the host process loses nothing already logged.
+ *
+ * @return PAGE_OK, or PAGE_ERR_INVALID_ARG if path is not valid UTF-8 or the
+ *         file cannot be opened.
+ */
+int scraper_set_access_log(const char *path);
+
+/**
+ * Get the number of page handles returned by page_new() and not yet passed
+ * to page_free(). Unlike page_page_count(), which counts the pages open
+ * inside one handle, this counts the handles themselves — a leak-detection
+ * aid that should return to zero after cleanup.
+ */
+int scraper_page_count(size_t *out_count);
+
+/**
+ * Get the last error returned to the calling thread, as a JSON
+ * object, e.g.
+ *   {"code": 2, "kind": "load_failed", "message": "page load failed: ...",
+ *    "detail": "...", "url": "https://..."}
+ * Besides code, kind and message, errors carry what is known about the
+ * failed operation: "detail" (the underlying message), "selector",
+ * "url" (page_open), "path" (files that could not be read or written),
+ * "cache_dir" (page_new*) or "exception"
+ * (page_evaluate*, as from page_last_js_error()). page_new*() failures are
+ * recorded too, so the reason behind a NULL page can be read here.
+ *
+ * Each thread has its own last error, so concurrent callers do not see each
+ * other's failures. Every nonzero return records one, including arguments
+ * rejected before reaching the engine ("null_pointer" for NULL pointers,
+ * or the function's code for invalid UTF-8); successful calls leave it
+ * unchanged. Yields "null" if the thread has no error yet. Free the result with
+ * page_string_free().
+ */
+int scraper_last_error_json(char **out_json, size_t *out_len);
+
+/**
+ * Compare two page_dom_snapshot() outputs, e.g. of the same page taken at
+ * different times. No page handle is needed.
+ *
+ * The result is JSON {"added": [...], "removed": [...], "changed": [...]}.
+ * Added and removed entries are {"path", "node"} with the snapshot subtree;
+ * changed entries are {"path", "kind": "text", "old", "new"} or
+ * {"path", "kind": "attribute", "name", "old", "new"} (null for a missing
+ * attribute). Paths look like "/html[1]/body[1]/p[2]" ("text()[n]" for
+ * text) and refer to snapshot_a for removed nodes, snapshot_b otherwise.
+ * Siblings are matched by tag and id, so a changed id shows up as a removed
+ * and an added element.
+ *
+ * @param ignore_attrs Comma-separated attribute names not to compare (e.g.
+ *                     "nonce,data-timestamp", case-insensitive), or NULL.
+ * @return PAGE_OK, or PAGE_ERR_INVALID_ARG if a snapshot is not valid.
+ *         Free *out_json with page_string_free().
+ */
+int scraper_diff_dom(const char *snapshot_a, const char *snapshot_b, const char *ignore_attrs,
+                     char **out_json, size_t *out_len);
+
+/**
+ * Release memory that no live page needs, then return freed heap memory to
+ * the OS (malloc_trim on glibc). Intended for long-running hosts between
+ * batches, before resorting to a process restart.
+ *
+ * Safe to call while pages exist: open documents, cookies and buffered
+ * messages are kept; only unused memory (shrunk buffers, torn-down pages,
+ * freed allocator arenas) is reclaimed. Cost: every live page's thread is
+ * blocked for roughly 50 ms. Calls made from inside a request interceptor
+ * skip the calling page.
+ *
+ * Returns within about half a second: a page busy with another call (e.g. a
+ * long page_open()) is not waited for; it shrinks its buffers when it gets
+ * to the request, after the trim.
+ *
+ * This is allocator trimming, not a garbage collection: Servo gives
+ * embedders no hook to run the JS GC or flush its caches, so script heaps
+ * are only collected on SpiderMonkey's own schedule.
+ */
+void scraper_reclaim_memory(void);
+
 /* ── Memory ────────────────────────────────────────────────────────── */
 
 /**
- * Free a PNG buffer returned by page_screenshot(). Safe to call with NULL.
+ * Free a buffer returned by page_screenshot() or page_screenshot_raw(). Safe
+ * to call with NULL.
  */
 void page_buffer_free(uint8_t *data, size_t len);
 
@@ -30,6 +30,7 @@ static const char *error_name(int code) {
     case PAGE_ERR_NULL_PTR:   return "NULL_POINTER";
     case PAGE_ERR_NO_PAGE:    return "NO_PAGE";
     case PAGE_ERR_SELECTOR:   return "SELECTOR_NOT_FOUND";
+    case PAGE_ERR_INVALID_ARG: return "INVALID_ARGUMENT";
     default:                     return "UNKNOWN";
     }
 }
@@ -47,6 +47,7 @@ const (
 	pageErrNullPtr    = C.PAGE_ERR_NULL_PTR
 	pageErrNoPage     = C.PAGE_ERR_NO_PAGE
 	pageErrSelector   = C.PAGE_ERR_SELECTOR
+	pageErrInvalidArg = C.PAGE_ERR_INVALID_ARG
 )
 
 // errorName returns a human-readable name for error codes
@@ -72,6 +73,8 @@ func errorName(code C.int) string {
 		return "NO_PAGE"
 	case pageErrSelector:
 		return "SELECTOR_NOT_FOUND"
+	case pageErrInvalidArg:
+		return "INVALID_ARGUMENT"
 	default:
 		return "UNKNOWN"
 	}
@@ -0,0 +1,126 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package scraper
+
+/*
+#include <stdlib.h>
+#include "servo_scraper.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// EngineOptions configures the page handle shared by RenderHTML and Stream.
+// Zero values select the defaults.
+type EngineOptions struct {
+	// Timeout for loading each document or URL (default 30s).
+	Timeout time.Duration
+	// UserAgent overrides the default User-Agent.
+	UserAgent string
+}
+
+// engine is the process-wide page handle. Servo allows only one instance
+// per process, so it is created on first use and never freed; every caller
+// works in its own tab and holds mu while that tab is active. Calls on the
+// handle run one at a time on the engine thread anyway.
+var engine struct {
+	mu      sync.Mutex
+	opts    EngineOptions
+	started bool
+	page    *C.ServoPage
+	err     error
+}
+
+// Configure sets the options of the shared page handle. It must be called
+// before the first RenderHTML or Stream call and fails afterwards.
+func Configure(opts EngineOptions) error {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	if engine.started {
+		return errors.New("scraper: Configure called after the engine started")
+	}
+	engine.opts = opts
+	return nil
+}
+
+// lockEngine locks the shared page handle, creating it on first use, and
+// returns it; the caller unlocks engine.mu when done. A failed creation is
+// not retried, since Servo cannot be started twice. Must run on a locked OS
+// thread, like every call whose failure lastError reports.
+func lockEngine() (*C.ServoPage, error) {
+	engine.mu.Lock()
+	if !engine.started {
+		engine.started = true
+		engine.page, engine.err = newEngine(engine.opts)
+	}
+	if engine.err != nil {
+		engine.mu.Unlock()
+		return nil, engine.err
+	}
+	return engine.page, nil
+}
+
+// newEngine creates the shared page handle. The timeout is rounded up to
+// whole seconds (at least one).
+func newEngine(opts EngineOptions) (*C.ServoPage, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	// page_new() takes whole seconds.
+	timeoutSecs := uint64(math.Ceil(timeout.Seconds()))
+	if timeoutSecs == 0 {
+		timeoutSecs = 1
+	}
+
+	var cUA *C.char
+	if opts.UserAgent != "" {
+		cUA = C.CString(opts.UserAgent)
+		defer C.free(unsafe.Pointer(cUA))
+	}
+	// Tabs bring their own viewport size and callers their own settle time.
+	page := C.page_new(1280, 720, C.uint64_t(timeoutSecs), 0, 0, cUA)
+	if page == nil {
+		return nil, lastError("page_new", C.PAGE_ERR_INIT)
+	}
+	return page, nil
+}
+
+// openTab creates a tab on page, defaulting to a 1280x720 viewport, and
+// makes it the active one. Requires engine.mu.
+func openTab(page *C.ServoPage, width, height int) (C.uint32_t, error) {
+	if width <= 0 {
+		width = 1280
+	}
+	if height <= 0 {
+		height = 720
+	}
+	var tab C.uint32_t
+	if rc := C.page_new_page_with_size(page, C.uint32_t(width), C.uint32_t(height), &tab); rc != C.PAGE_OK {
+		return 0, lastError("page_new_page_with_size", rc)
+	}
+	if rc := C.page_switch_to(page, tab); rc != C.PAGE_OK {
+		C.page_close_page(page, tab)
+		return 0, lastError("page_switch_to", rc)
+	}
+	return tab, nil
+}
+
+// settle waits d after a load, if d is positive. Requires engine.mu.
+func settle(page *C.ServoPage, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	if rc := C.page_wait(page, C.double(d.Seconds())); rc != C.PAGE_OK {
+		return lastError("page_wait", rc)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package scraper provides Go helpers on top of the servo-scraper C API.
+//
+// Like the example in the parent directory, it links against the shared
+// library in target/release (make build-lib), so set DYLD_LIBRARY_PATH or
+// LD_LIBRARY_PATH when running programs that use it.
+package scraper
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/../../c
+#cgo LDFLAGS: -L${SRCDIR}/../../../target/release -lservo_scraper
+#include <stdlib.h>
+#include "servo_scraper.h"
+*/
+import "C"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// Error is a failed servo-scraper call.
+type Error struct {
+	// Op is the C function that failed, e.g. "page_load_html".
+	Op string
+	// Code is the PAGE_ERR_* code it returned.
+	Code int
+	// Kind and Message come from scraper_last_error_json(), e.g.
+	// "load_failed"; empty if the library recorded no details.
+	Kind    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s failed with code %d", e.Op, e.Code)
+	}
+	return fmt.Sprintf("%s: %s", e.Op, e.Message)
+}
+
+// Timeout reports whether the call failed with PAGE_ERR_TIMEOUT. After a
+// load timeout the page still shows whatever had rendered.
+func (e *Error) Timeout() bool {
+	return e.Code == C.PAGE_ERR_TIMEOUT
+}
+
+// lastError builds an *Error for code, with the details the library
+// recorded. Must run on the OS thread that made the failed call.
+func lastError(op string, code C.int) error {
+	e := &Error{Op: op, Code: int(code)}
+	var data *C.char
+	var n C.size_t
+	if C.scraper_last_error_json(&data, &n) != C.PAGE_OK {
+		return e
+	}
+	defer C.page_string_free(data)
+
+	var last struct {
+		Code    int    `json:"code"`
+		Kind    string `json:"kind"`
+		Message string `json:"message"`
+	}
+	// Details of an earlier failure are stale if the codes differ.
+	if json.Unmarshal([]byte(C.GoStringN(data, C.int(n))), &last) == nil && last.Code == e.Code {
+		e.Kind, e.Message = last.Kind, last.Message
+	}
+	return e
+}
+
+// RenderOptions configures RenderHTML. Zero values select the defaults.
+type RenderOptions struct {
+	// Width and Height of the viewport in CSS pixels (default 1280x720).
+	Width, Height int
+	// Wait is extra settle time after the load event, e.g. for web fonts
+	// or animations (default none).
+	Wait time.Duration
+	// FullPage captures the whole document instead of the viewport.
+	FullPage bool
+	// BaseURL is the http(s) URL the document is served as, so relative
+	// stylesheets and images resolve against it. Without it only absolute
+	// asset URLs work.
+	BaseURL string
+}
+
+// RenderHTML renders an HTML document, such as html/template output, to a
+// PNG without serving it over HTTP, e.g. for social cards or report images.
+// Each document is rendered in a fresh tab of the shared page handle (see
+// Configure), closed afterwards; renders run one at a time.
+//
+// If ctx is done before rendering finishes, RenderHTML returns ctx.Err()
+// right away; the render itself cannot be interrupted and finishes (at most
+// after EngineOptions.Timeout) in the background. Failures of the library
+// are returned as *Error.
+func RenderHTML(ctx context.Context, html string, opts RenderOptions) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		png []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		png, err := renderHTML(html, opts)
+		done <- result{png, err}
+	}()
+	select {
+	case r := <-done:
+		return r.png, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func renderHTML(html string, opts RenderOptions) ([]byte, error) {
+	// scraper_last_error_json() reports errors per OS thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	page, err := lockEngine()
+	if err != nil {
+		return nil, err
+	}
+	defer engine.mu.Unlock()
+	tab, err := openTab(page, opts.Width, opts.Height)
+	if err != nil {
+		return nil, err
+	}
+	defer C.page_close_page(page, tab)
+
+	cHTML := C.CString(html)
+	defer C.free(unsafe.Pointer(cHTML))
+	var cBase *C.char
+	if opts.BaseURL != "" {
+		cBase = C.CString(opts.BaseURL)
+		defer C.free(unsafe.Pointer(cBase))
+	}
+	if rc := C.page_load_html(page, cHTML, cBase); rc != C.PAGE_OK {
+		return nil, lastError("page_load_html", rc)
+	}
+	if err := settle(page, opts.Wait); err != nil {
+		return nil, err
+	}
+
+	var data *C.uint8_t
+	var n C.size_t
+	op := "page_screenshot"
+	var rc C.int
+	if opts.FullPage {
+		op = "page_screenshot_fullpage"
+		rc = C.page_screenshot_fullpage(page, &data, &n)
+	} else {
+		rc = C.page_screenshot(page, &data, &n)
+	}
+	if rc != C.PAGE_OK {
+		return nil, lastError(op, rc)
+	}
+	png := C.GoBytes(unsafe.Pointer(data), C.int(n))
+	C.page_buffer_free(data, n)
+	return png, nil
+}
@@ -0,0 +1,222 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package scraper
+
+/*
+#include <stdlib.h>
+#include "servo_scraper.h"
+*/
+import "C"
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// StreamOptions configures Stream. Zero values select the defaults.
+type StreamOptions struct {
+	// Pages is the number of tabs of the shared page handle (see Configure)
+	// that URLs are spread over (default 1), each created on first use and
+	// reused for later URLs. The engine runs one call at a time, so loads do
+	// not overlap; more tabs only let the caller's handling of one result
+	// overlap the next load. All tabs share one cookie jar and storage.
+	Pages int
+	// Width and Height of the viewport in CSS pixels (default 1280x720).
+	Width, Height int
+	// Wait is extra settle time after each load event (default none).
+	Wait time.Duration
+	// Script, if set, is evaluated after each load; its JSON result is
+	// returned as Result.Value.
+	Script string
+}
+
+// Result is the outcome of one URL processed by Stream.
+type Result struct {
+	URL string
+	// HTML is the document after loading, empty if the load failed.
+	HTML string
+	// Value is the JSON result of StreamOptions.Script.
+	Value string
+	// Err is an *Error for library failures. A load that timed out still
+	// has the HTML and Value of whatever had rendered, with an Err whose
+	// Timeout method reports true.
+	Err error
+}
+
+// Stream loads URLs read from urls on opts.Pages tabs and sends one Result
+// per URL to the returned channel, in completion order. Neither side is
+// buffered beyond the tabs, so a crawler can feed URLs as it discovers
+// them.
+//
+// When urls is closed, Stream finishes the URLs in flight, closes its tabs
+// and closes the output channel. When ctx is done, it stops taking URLs and
+// closes the output channel promptly; URLs in flight and results not yet
+// received are dropped without a Result. Loads in flight cannot be
+// interrupted, so their tabs are closed in the background once the load
+// ends (at most EngineOptions.Timeout later).
+//
+// The caller must keep receiving until the output channel is closed or ctx
+// is done.
+func Stream(ctx context.Context, urls <-chan string, opts StreamOptions) <-chan Result {
+	pages := opts.Pages
+	if pages <= 0 {
+		pages = 1
+	}
+
+	out := make(chan Result)
+	var wg sync.WaitGroup
+	wg.Add(pages)
+	for i := 0; i < pages; i++ {
+		go func() {
+			defer wg.Done()
+			streamWorker(ctx, urls, out, opts)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// streamWorker processes URLs on one tab until urls is closed or ctx is
+// done.
+func streamWorker(ctx context.Context, urls <-chan string, out chan<- Result, opts StreamOptions) {
+	// scraper_last_error_json() reports errors per OS thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var tab C.uint32_t
+	hasTab := false
+	defer func() {
+		if hasTab {
+			if page, err := lockEngine(); err == nil {
+				C.page_close_page(page, tab)
+				engine.mu.Unlock()
+			}
+		}
+	}()
+	for {
+		var url string
+		select {
+		case <-ctx.Done():
+			return
+		case u, ok := <-urls:
+			if !ok {
+				return
+			}
+			url = u
+		}
+
+		page, err := lockEngine()
+		if err == nil && !hasTab {
+			if tab, err = openTab(page, opts.Width, opts.Height); err == nil {
+				hasTab = true
+			} else {
+				engine.mu.Unlock()
+			}
+		}
+		if err != nil {
+			if !sendResult(ctx, out, Result{URL: url, Err: err}) {
+				return
+			}
+			continue
+		}
+
+		r, busy := loadURL(ctx, page, tab, url, opts)
+		if busy {
+			// loadURL leaves closing the tab and unlocking to the background.
+			hasTab = false
+			return
+		}
+		engine.mu.Unlock()
+		if !sendResult(ctx, out, r) {
+			return
+		}
+	}
+}
+
+// sendResult delivers r unless ctx is done first.
+func sendResult(ctx context.Context, out chan<- Result, r Result) bool {
+	select {
+	case out <- r:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// loadURL opens url in tab and captures it. Requires engine.mu. busy
+// reports that ctx was cancelled while the load was still running; a
+// goroutine then waits for it, closes tab and unlocks engine.mu.
+func loadURL(ctx context.Context, page *C.ServoPage, tab C.uint32_t, url string, opts StreamOptions) (r Result, busy bool) {
+	r.URL = url
+	if rc := C.page_switch_to(page, tab); rc != C.PAGE_OK {
+		r.Err = lastError("page_switch_to", rc)
+		return r, false
+	}
+	cURL := C.CString(url)
+	defer C.free(unsafe.Pointer(cURL))
+
+	var job *C.ServoJob
+	if rc := C.page_open_async(page, cURL, &job); rc != C.PAGE_OK {
+		r.Err = lastError("page_open_async", rc)
+		return r, false
+	}
+	// Wait in short slices so cancellation is noticed.
+	rc := C.int(C.PAGE_JOB_PENDING)
+	for rc == C.PAGE_JOB_PENDING {
+		if ctx.Err() != nil {
+			go func() {
+				for C.page_job_wait(job, 1000) == C.PAGE_JOB_PENDING {
+				}
+				C.page_job_free(job)
+				C.page_close_page(page, tab)
+				engine.mu.Unlock()
+			}()
+			return r, true
+		}
+		rc = C.page_job_wait(job, 100)
+	}
+	C.page_job_free(job)
+	switch rc {
+	case C.PAGE_OK:
+		if err := settle(page, opts.Wait); err != nil {
+			r.Err = err
+			return r, false
+		}
+	case C.PAGE_ERR_TIMEOUT:
+		// The page stays usable and shows whatever had rendered.
+		r.Err = lastError("page_open", rc)
+	default:
+		r.Err = lastError("page_open", rc)
+		return r, false
+	}
+
+	var data *C.char
+	var n C.size_t
+	if rc := C.page_html(page, &data, &n); rc != C.PAGE_OK {
+		r.Err = lastError("page_html", rc)
+		return r, false
+	}
+	r.HTML = C.GoStringN(data, C.int(n))
+	C.page_string_free(data)
+
+	if opts.Script != "" {
+		cScript := C.CString(opts.Script)
+		defer C.free(unsafe.Pointer(cScript))
+		if rc := C.page_evaluate(page, cScript, &data, &n); rc != C.PAGE_OK {
+			r.HTML = ""
+			r.Err = lastError("page_evaluate", rc)
+			return r, false
+		}
+		r.Value = C.GoStringN(data, C.int(n))
+		C.page_string_free(data)
+	}
+	return r, false
+}
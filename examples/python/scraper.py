@@ -37,6 +37,7 @@ PAGE_ERR_CHANNEL = 6
 PAGE_ERR_NULL_PTR = 7
 PAGE_ERR_NO_PAGE = 8
 PAGE_ERR_SELECTOR = 9
+PAGE_ERR_INVALID_ARG = 10
 
 ERROR_NAMES = {
     PAGE_OK: "OK",
@@ -49,6 +50,7 @@ ERROR_NAMES = {
     PAGE_ERR_NULL_PTR: "NULL_POINTER",
     PAGE_ERR_NO_PAGE: "NO_PAGE",
     PAGE_ERR_SELECTOR: "SELECTOR_NOT_FOUND",
+    PAGE_ERR_INVALID_ARG: "INVALID_ARGUMENT",
 }
 
 
@@ -5,31 +5,54 @@
 //! Layer 1: `PageEngine` — single-threaded, zero-overhead core.
 
 use std::cell::{Cell, RefCell};
-use std::collections::HashMap;
+use std::collections::hash_map::RandomState;
+use std::collections::{BTreeMap, HashMap, VecDeque};
+use std::io::Write as _;
 #[cfg(unix)]
 use std::os::fd::{AsRawFd, IntoRawFd};
-use std::path::PathBuf;
+use std::path::{Path, PathBuf};
 use std::rc::Rc;
-use std::sync::{Arc, Condvar, Mutex};
-use std::time::{Duration, Instant};
+use std::sync::{Arc, Condvar, Mutex, OnceLock};
+use std::time::{Duration, Instant, SystemTime};
 
 use dpi::PhysicalSize;
+use euclid::Scale;
+use http::header::{self, HeaderMap, HeaderName, HeaderValue};
+use http::{Method, StatusCode};
 use image::codecs::png::PngEncoder;
 use image::{DynamicImage, ImageEncoder};
+use serde::Deserialize;
 use servo::resources::{self, Resource, ResourceReaderMethods};
 use servo::{
-    ConsoleLogLevel, CreateNewWebViewRequest, DevicePoint, EmbedderControl, EventLoopWaker,
-    InputEvent, JSValue, Key, KeyState, KeyboardEvent, LoadStatus, MouseButton, MouseButtonAction,
-    MouseButtonEvent, MouseMoveEvent, NamedKey, Preferences, RenderingContext, Servo, ServoBuilder,
-    SimpleDialog, SoftwareRenderingContext, WebResourceLoad, WebResourceResponse, WebView,
-    WebViewBuilder, WebViewDelegate, WebViewPoint, WheelDelta, WheelEvent, WheelMode,
+    ConsoleLogLevel, CreateNewWebViewRequest, DeviceIndependentPixel, DevicePixel, DevicePoint,
+    EmbedderControl, EventLoopWaker, InputEvent, JSValue, Key, KeyState, KeyboardEvent, LoadStatus,
+    MouseButton, MouseButtonAction, MouseButtonEvent, MouseMoveEvent, NamedKey, Preferences,
+    RenderingContext, Servo, ServoBuilder, SimpleDialog, SoftwareRenderingContext,
+    UserContentManager, UserScript, WebResourceLoad, WebResourceResponse, WebView, WebViewBuilder,
+    WebViewDelegate, WebViewPoint, WheelDelta, WheelEvent, WheelMode,
 };
 use url::Url;
 
 use crate::types::{
-    ConsoleMessage, ElementRect, InputFile, NetworkRequest, PageError, PageOptions,
+    BlockingResource, ConnectionType, ConsoleMessage, CookiePolicy, Download, ElementRect,
+    ElementTarget, FeatureFlags, ImageLayer, ImageLoadCounts, InputFile, InterceptedRequest,
+    JsErrorDetails, JsWorld, Link, LoadProgress, NetworkRequest, PageError, PageOptions,
+    PageResource, PaintTiming, RawImage, RenderMode, RequestAction, ResourceType, SameSite,
+    ScrollMetrics, UsedFont, Validation, WindowInfo,
 };
 
+/// Callback deciding what happens to each request before it is sent.
+/// See [`PageEngine::set_request_interceptor`].
+pub type RequestInterceptor = Box<dyn Fn(&InterceptedRequest) -> RequestAction>;
+
+/// See [`PageEngine::set_progress_callback`].
+pub type ProgressCallback = Box<dyn Fn(&LoadProgress)>;
+
+/// Receives HTML chunks while a document is parsed; return `false` to stop
+/// delivery for the rest of the navigation.
+/// See [`PageEngine::set_html_stream_callback`].
+pub type HtmlStreamCallback = Box<dyn Fn(&str) -> bool>;
+
 // ---------------------------------------------------------------------------
 // Internal: Suppress stderr from system libraries
 // ---------------------------------------------------------------------------
@@ -86,6 +109,46 @@ fn with_stderr_suppressed<T>(f: impl FnOnce() -> T) -> T {
     f()
 }
 
+// ---------------------------------------------------------------------------
+// Internal: Process heap
+// ---------------------------------------------------------------------------
+
+/// Return freed heap pages to the OS. Only glibc's allocator keeps freed
+/// memory mapped aggressively enough to need this; elsewhere it is a no-op.
+pub(crate) fn trim_process_heap() {
+    #[cfg(all(target_os = "linux", target_env = "gnu"))]
+    unsafe {
+        libc::malloc_trim(0);
+    }
+}
+
+/// Create `dir` if needed and check that files can be written into it.
+fn ensure_writable_dir(dir: &std::path::Path) -> std::io::Result<()> {
+    std::fs::create_dir_all(dir)?;
+    let probe = dir.join(".servo-scraper-write-test");
+    std::fs::write(&probe, b"")?;
+    std::fs::remove_file(probe)
+}
+
+/// `PageOptions::cache_dir` of the first engine in the process. Servo reads
+/// its options once per process, so later engines cannot use another one.
+static CONFIG_DIR: OnceLock<Option<PathBuf>> = OnceLock::new();
+
+/// Claim `dir` as the process's cache directory, or fail if an earlier
+/// engine already settled on a different one.
+fn claim_config_dir(dir: &Option<PathBuf>) -> Result<(), PageError> {
+    let claimed = CONFIG_DIR.get_or_init(|| dir.clone());
+    if claimed == dir {
+        return Ok(());
+    }
+    let current = claimed
+        .as_ref()
+        .map_or("Servo's default".to_string(), |d| d.display().to_string());
+    Err(PageError::InitFailed(format!(
+        "the cache directory is process-wide and already set to {current}"
+    )))
+}
+
 // ---------------------------------------------------------------------------
 // Internal: Embedded resources
 // ---------------------------------------------------------------------------
@@ -294,10 +357,639 @@ fn wait_for_network_idle_inner(
     }
 }
 
+// ---------------------------------------------------------------------------
+// Internal: Embedder-side fetch
+// ---------------------------------------------------------------------------
+
+/// Request headers the embedder-side client sets itself. `Accept-Encoding` is
+/// forwarded, but narrowed to [`DECODABLE_CODINGS`] first: the client decodes
+/// the body, since Servo does not decode intercepted responses.
+const SKIPPED_REQUEST_HEADERS: [HeaderName; 4] = [
+    header::HOST,
+    header::CONNECTION,
+    header::CONTENT_LENGTH,
+    header::TRANSFER_ENCODING,
+];
+
+/// Content codings the embedder-side client can decode.
+const DECODABLE_CODINGS: [&str; 2] = ["gzip", "identity"];
+
+/// The coding of one `Accept-Encoding` list item, without its q-value.
+fn coding_name(item: &str) -> &str {
+    item.split(';').next().unwrap_or("").trim()
+}
+
+/// Restrict an `Accept-Encoding` value to the codings the embedder-side
+/// client can decode (Servo's own default also offers `br` and `deflate`).
+/// `None` if nothing is left.
+fn decodable_accept_encoding(value: &HeaderValue) -> Option<HeaderValue> {
+    let kept: Vec<&str> = value
+        .to_str()
+        .ok()?
+        .split(',')
+        .map(str::trim)
+        .filter(|item| {
+            DECODABLE_CODINGS
+                .iter()
+                .any(|c| c.eq_ignore_ascii_case(coding_name(item)))
+        })
+        .collect();
+    if kept.is_empty() {
+        return None;
+    }
+    HeaderValue::from_str(&kept.join(", ")).ok()
+}
+
+/// Response headers that no longer describe the body handed back to Servo.
+const SKIPPED_RESPONSE_HEADERS: [HeaderName; 4] = [
+    header::CONNECTION,
+    header::CONTENT_LENGTH,
+    header::CONTENT_ENCODING,
+    header::TRANSFER_ENCODING,
+];
+
+/// Default `max_image_pixels`: 100 megapixels, about 400 MB once decoded.
+const DEFAULT_MAX_IMAGE_PIXELS: u64 = 100_000_000;
+
+/// Width and height from the header of a PNG, GIF, JPEG, WebP or BMP image.
+fn image_dimensions(data: &[u8]) -> Option<(u32, u32)> {
+    let be16 = |i: usize| Some(u16::from_be_bytes(data.get(i..i + 2)?.try_into().ok()?) as u32);
+    let le16 = |i: usize| Some(u16::from_le_bytes(data.get(i..i + 2)?.try_into().ok()?) as u32);
+    let le24 = |i: usize| {
+        let b = data.get(i..i + 3)?;
+        Some(b[0] as u32 | (b[1] as u32) << 8 | (b[2] as u32) << 16)
+    };
+    let be32 = |i: usize| Some(u32::from_be_bytes(data.get(i..i + 4)?.try_into().ok()?));
+    let le32 = |i: usize| Some(i32::from_le_bytes(data.get(i..i + 4)?.try_into().ok()?));
+
+    if data.starts_with(b"\x89PNG\r\n\x1a\n") {
+        return Some((be32(16)?, be32(20)?));
+    }
+    if data.starts_with(b"GIF87a") || data.starts_with(b"GIF89a") {
+        return Some((le16(6)?, le16(8)?));
+    }
+    if data.starts_with(b"BM") {
+        return Some((le32(18)?.unsigned_abs(), le32(22)?.unsigned_abs()));
+    }
+    if data.starts_with(b"RIFF") && data.get(8..12) == Some(b"WEBP") {
+        return match data.get(12..16)? {
+            b"VP8 " => Some((le16(26)? & 0x3fff, le16(28)? & 0x3fff)),
+            b"VP8L" => {
+                let b = data.get(21..25)?;
+                let (b0, b1, b2, b3) = (b[0] as u32, b[1] as u32, b[2] as u32, b[3] as u32);
+                Some((
+                    1 + (((b1 & 0x3f) << 8) | b0),
+                    1 + (((b3 & 0x0f) << 10) | (b2 << 2) | ((b1 & 0xc0) >> 6)),
+                ))
+            }
+            b"VP8X" => Some((1 + le24(24)?, 1 + le24(27)?)),
+            _ => None,
+        };
+    }
+    if data.starts_with(&[0xff, 0xd8]) {
+        // Walk the marker segments up to the first start-of-frame.
+        let mut i = 2;
+        while i + 4 <= data.len() {
+            if data[i] != 0xff {
+                return None;
+            }
+            let marker = data[i + 1];
+            if marker == 0xff {
+                i += 1;
+                continue;
+            }
+            if matches!(marker, 0x01 | 0xd0..=0xd9) {
+                i += 2;
+                continue;
+            }
+            if matches!(marker, 0xc0..=0xcf) && !matches!(marker, 0xc4 | 0xc8 | 0xcc) {
+                return Some((be16(i + 7)?, be16(i + 5)?));
+            }
+            i += 2 + be16(i + 2)? as usize;
+        }
+    }
+    None
+}
+
+/// Whether a request is for an image, judging by the `Accept` header Servo
+/// sends for image loads.
+fn is_image_request(headers: &HeaderMap) -> bool {
+    headers
+        .get(header::ACCEPT)
+        .and_then(|v| v.to_str().ok())
+        .is_some_and(|v| v.starts_with("image/"))
+}
+
+/// Largest response body the embedder-side client will buffer.
+const MAX_FETCH_BODY: u64 = 256 * 1024 * 1024;
+
+fn embedder_agent() -> &'static ureq::Agent {
+    static AGENT: OnceLock<ureq::Agent> = OnceLock::new();
+    AGENT.get_or_init(|| {
+        ureq::Agent::config_builder()
+            .http_status_as_error(false)
+            .max_redirects(0)
+            .build()
+            .into()
+    })
+}
+
+/// Send `request` with the embedder-side client, giving up on the whole
+/// exchange (connect, headers and body) after `timeout`.
+fn embedder_run(
+    request: http::Request<()>,
+    timeout: Duration,
+) -> Result<http::Response<ureq::Body>, ureq::Error> {
+    let agent = embedder_agent();
+    let request = agent
+        .configure_request(request)
+        .timeout_global(Some(timeout))
+        .build();
+    agent.run(request)
+}
+
+/// File every page's requests are appended to, set by
+/// [`PageEngine::set_access_log`]. Process-wide, like the fetch agent.
+static ACCESS_LOG: Mutex<Option<std::fs::File>> = Mutex::new(None);
+
+/// Append the entry built by `entry` to the access log, if one is set. Each
+/// line goes out in a single unbuffered write under the lock, so lines from
+/// concurrent pages never interleave and are on disk as soon as this returns
+/// (short of an OS crash; the file is not fsynced).
+fn log_access(entry: impl FnOnce() -> serde_json::Value) {
+    let mut log = ACCESS_LOG.lock().unwrap_or_else(|e| e.into_inner());
+    if let Some(file) = log.as_mut() {
+        let mut line = entry().to_string();
+        line.push('\n');
+        if let Err(e) = file.write_all(line.as_bytes()) {
+            log::warn!("access log write failed: {e}");
+        }
+    }
+}
+
+/// Redirects [`fetch_asset`] follows before giving up.
+const MAX_ASSET_REDIRECTS: usize = 10;
+
+/// What [`fetch_asset`] does with one URL, decided by its caller for the
+/// first request and every redirect target.
+enum AssetRequest {
+    Send(HeaderMap),
+    Redirect(Url),
+    Refuse,
+}
+
+/// Fetch an http(s) asset with the embedder-side client, following
+/// redirects. Returns the body and its MIME type, or `None` on failure, a
+/// refused URL, a non-2xx status, a body over `max_bytes` (0 = no limit) or
+/// no complete response within `timeout` per request.
+fn fetch_asset(
+    url: &Url,
+    prepare: &dyn Fn(&Url) -> AssetRequest,
+    max_bytes: u64,
+    timeout: Duration,
+) -> Option<(Vec<u8>, String)> {
+    let limit = match max_bytes {
+        0 => MAX_FETCH_BODY,
+        n => n.min(MAX_FETCH_BODY),
+    };
+    let mut url = url.clone();
+    for _ in 0..=MAX_ASSET_REDIRECTS {
+        if !matches!(url.scheme(), "http" | "https") {
+            return None;
+        }
+        let headers = match prepare(&url) {
+            AssetRequest::Send(headers) => headers,
+            AssetRequest::Redirect(target) => {
+                url = target;
+                continue;
+            }
+            AssetRequest::Refuse => return None,
+        };
+        let mut builder = http::Request::builder().uri(url.as_str());
+        for (name, value) in &headers {
+            builder = builder.header(name, value);
+        }
+        let response = embedder_run(builder.body(()).ok()?, timeout).ok()?;
+        let (parts, mut body) = response.into_parts();
+        if parts.status.is_redirection() {
+            let location = parts.headers.get(header::LOCATION)?.to_str().ok()?;
+            url = url.join(location).ok()?;
+            continue;
+        }
+        if !parts.status.is_success() {
+            return None;
+        }
+        // `data:` URIs allow no whitespace in the media type.
+        let mime = parts
+            .headers
+            .get(header::CONTENT_TYPE)
+            .and_then(|v| v.to_str().ok())
+            .map(|v| v.split_whitespace().collect::<String>())
+            .filter(|v| !v.is_empty())
+            .unwrap_or_else(|| "application/octet-stream".into());
+        let bytes = body.with_config().limit(limit).read_to_vec().ok()?;
+        return Some((bytes, mime));
+    }
+    None
+}
+
+/// Caps concurrent embedder fetches per host (`host:port`); a limit of 0
+/// means unlimited. Process-wide, like the fetch agent.
+struct HostConnections {
+    state: Mutex<HostConnectionState>,
+    freed: Condvar,
+}
+
+struct HostConnectionState {
+    limit: usize,
+    /// Fetches in flight per host; hosts at zero are removed.
+    active: HashMap<String, usize>,
+}
+
+/// A fetch slot held for one host, released on drop.
+struct HostSlot<'a> {
+    connections: &'a HostConnections,
+    host: String,
+}
+
+fn host_connections() -> &'static HostConnections {
+    static CONNECTIONS: OnceLock<HostConnections> = OnceLock::new();
+    CONNECTIONS.get_or_init(HostConnections::new)
+}
+
+impl HostConnections {
+    fn new() -> Self {
+        HostConnections {
+            state: Mutex::new(HostConnectionState {
+                limit: 0,
+                active: HashMap::new(),
+            }),
+            freed: Condvar::new(),
+        }
+    }
+
+    fn state(&self) -> std::sync::MutexGuard<'_, HostConnectionState> {
+        self.state.lock().unwrap_or_else(|e| e.into_inner())
+    }
+
+    fn limit(&self) -> usize {
+        self.state().limit
+    }
+
+    fn set_limit(&self, limit: usize) {
+        self.state().limit = limit;
+        self.freed.notify_all();
+    }
+
+    /// Block until a fetch to `url`'s host may start.
+    fn acquire(&self, url: &Url) -> HostSlot<'_> {
+        let host = format!(
+            "{}:{}",
+            url.host_str().unwrap_or_default(),
+            url.port_or_known_default().unwrap_or_default()
+        );
+        let mut state = self.state();
+        loop {
+            let limit = state.limit;
+            let count = state.active.entry(host.clone()).or_default();
+            if limit == 0 || *count < limit {
+                *count += 1;
+                return HostSlot {
+                    connections: self,
+                    host,
+                };
+            }
+            state = self.freed.wait(state).unwrap_or_else(|e| e.into_inner());
+        }
+    }
+}
+
+impl Drop for HostSlot<'_> {
+    fn drop(&mut self) {
+        let mut state = self.connections.state();
+        if let Some(count) = state.active.get_mut(&self.host) {
+            *count -= 1;
+            if *count == 0 {
+                state.active.remove(&self.host);
+            }
+        }
+        drop(state);
+        self.connections.freed.notify_all();
+    }
+}
+
+/// How [`fetch_with_headers`] handles one request.
+struct EmbedderFetch {
+    user_agent: Option<String>,
+    /// Emulated latency before the request is sent.
+    delay: Duration,
+    /// Limit for the whole exchange: connect, headers and body.
+    timeout: Duration,
+    /// Largest image (width × height) passed on to Servo; 0 = no limit.
+    max_image_pixels: u64,
+    /// Replaces the response's `Content-Security-Policy`; empty drops it.
+    csp_override: Option<HeaderValue>,
+    /// Send no `Cookie` and drop `Set-Cookie` response headers.
+    strip_cookies: bool,
+    /// Queue taking `Content-Disposition: attachment` responses instead of
+    /// Servo; set for main-frame navigations while downloads are captured.
+    downloads: Option<Arc<Mutex<VecDeque<Download>>>>,
+}
+
+/// Whether a `Content-Disposition` value asks for the body to be saved.
+fn is_attachment(disposition: &str) -> bool {
+    disposition
+        .split(';')
+        .next()
+        .is_some_and(|kind| kind.trim().eq_ignore_ascii_case("attachment"))
+}
+
+/// File name from a `Content-Disposition` value, preferring the
+/// percent-encoded `filename*` parameter over plain `filename`.
+fn disposition_filename(disposition: &str) -> Option<String> {
+    let mut plain = None;
+    for param in disposition.split(';').skip(1) {
+        let Some((name, value)) = param.split_once('=') else {
+            continue;
+        };
+        let value = value.trim();
+        match name.trim().to_ascii_lowercase().as_str() {
+            "filename*" => {
+                // RFC 8187: charset'language'percent-encoded-value.
+                let encoded = value.splitn(3, '\'').nth(2).unwrap_or(value);
+                let mut bytes = Vec::with_capacity(encoded.len());
+                let mut rest = encoded.as_bytes();
+                while let Some((&b, tail)) = rest.split_first() {
+                    let hex = tail.get(..2).and_then(|h| std::str::from_utf8(h).ok());
+                    match hex.and_then(|h| u8::from_str_radix(h, 16).ok()) {
+                        Some(decoded) if b == b'%' => {
+                            bytes.push(decoded);
+                            rest = &tail[2..];
+                        }
+                        _ => {
+                            bytes.push(b);
+                            rest = tail;
+                        }
+                    }
+                }
+                let name = String::from_utf8_lossy(&bytes).into_owned();
+                if !name.is_empty() {
+                    return Some(name);
+                }
+            }
+            "filename" => plain = Some(value.trim_matches('"').to_string()),
+            _ => {}
+        }
+    }
+    plain.filter(|name| !name.is_empty())
+}
+
+/// Perform `load` outside Servo's network stack with `headers` and feed the
+/// response back through interception.
+///
+/// Servo cannot rewrite the headers of an in-flight request, so header
+/// overrides are applied by fetching the resource here instead. Redirects are
+/// returned to Servo, which follows them (and re-enters the delegate). Runs on
+/// a worker thread after the configured delay and once the host has a free
+/// connection slot; any failure cancels the load, as does an oversized image
+/// or a timeout.
+fn fetch_with_headers(load: WebResourceLoad, mut headers: HeaderMap, fetch: EmbedderFetch) {
+    let EmbedderFetch {
+        user_agent,
+        delay,
+        timeout,
+        max_image_pixels,
+        csp_override,
+        strip_cookies,
+        downloads,
+    } = fetch;
+    if strip_cookies {
+        headers.remove(header::COOKIE);
+    }
+    if let Some(ua) = user_agent.and_then(|ua| HeaderValue::from_str(&ua).ok()) {
+        headers.entry(header::USER_AGENT).or_insert(ua);
+    }
+    match headers
+        .get(header::ACCEPT_ENCODING)
+        .and_then(decodable_accept_encoding)
+    {
+        Some(encoding) => headers.insert(header::ACCEPT_ENCODING, encoding),
+        None => headers.remove(header::ACCEPT_ENCODING),
+    };
+    std::thread::spawn(move || {
+        std::thread::sleep(delay);
+        let request = load.request();
+        let url = request.url.clone();
+        // Held until the response has been handed back to Servo.
+        let _slot = host_connections().acquire(&url);
+
+        let mut builder = http::Request::builder()
+            .method(request.method.clone())
+            .uri(url.as_str());
+        for (name, value) in headers.iter() {
+            if !SKIPPED_REQUEST_HEADERS.contains(name) {
+                builder = builder.header(name, value);
+            }
+        }
+        let result = builder
+            .body(())
+            .map_err(|e| e.to_string())
+            .and_then(|req| embedder_run(req, timeout).map_err(|e| e.to_string()))
+            .and_then(|response| {
+                let (parts, mut body) = response.into_parts();
+                body.with_config()
+                    .limit(MAX_FETCH_BODY)
+                    .read_to_vec()
+                    .map(|bytes| (parts, bytes))
+                    .map_err(|e| e.to_string())
+            });
+
+        let result = result.and_then(|(parts, body)| match image_dimensions(&body) {
+            Some((w, h)) if max_image_pixels > 0 && w as u64 * h as u64 > max_image_pixels => Err(
+                format!("image is {w}x{h}, over the {max_image_pixels}-pixel limit"),
+            ),
+            _ => Ok((parts, body)),
+        });
+
+        let disposition = result.as_ref().ok().and_then(|(parts, _)| {
+            parts
+                .headers
+                .get(header::CONTENT_DISPOSITION)?
+                .to_str()
+                .ok()
+                .filter(|value| parts.status.is_success() && is_attachment(value))
+        });
+        if let (Some(disposition), Some(downloads)) = (disposition, downloads) {
+            let filename = disposition_filename(disposition)
+                .or_else(|| {
+                    url.path_segments()
+                        .and_then(|mut segments| segments.next_back())
+                        .filter(|segment| !segment.is_empty())
+                        .map(str::to_string)
+                })
+                .unwrap_or_else(|| "download".into());
+            let data = result.map(|(_, body)| body).unwrap_or_default();
+            downloads
+                .lock()
+                .unwrap_or_else(|e| e.into_inner())
+                .push_back(Download {
+                    url: url.to_string(),
+                    filename,
+                    data,
+                });
+            // A 204 ends the navigation and keeps the current document, as
+            // a browser does when it hands a response to its download manager.
+            let response = WebResourceResponse::new(url).status_code(StatusCode::NO_CONTENT);
+            load.intercept(response).finish();
+            return;
+        }
+
+        match result {
+            Ok((parts, body)) => {
+                let mut response_headers = HeaderMap::new();
+                for (name, value) in parts.headers.iter() {
+                    let replaced_csp = csp_override.is_some()
+                        && (name == header::CONTENT_SECURITY_POLICY
+                            || name == header::CONTENT_SECURITY_POLICY_REPORT_ONLY);
+                    let stripped_cookie = strip_cookies && name == header::SET_COOKIE;
+                    if !SKIPPED_RESPONSE_HEADERS.contains(name) && !replaced_csp && !stripped_cookie
+                    {
+                        response_headers.append(name, value.clone());
+                    }
+                }
+                if let Some(csp) = csp_override.filter(|csp| !csp.is_empty()) {
+                    response_headers.insert(header::CONTENT_SECURITY_POLICY, csp);
+                }
+                let response = WebResourceResponse::new(url)
+                    .headers(response_headers)
+                    .status_code(parts.status);
+                let intercepted = load.intercept(response);
+                intercepted.send_body_data(body);
+                intercepted.finish();
+            }
+            Err(e) => {
+                log::warn!("embedder fetch of {url} failed: {e}");
+                load.intercept(WebResourceResponse::new(url)).cancel();
+            }
+        }
+    });
+}
+
+/// Build the interceptor's view of a request.
+fn intercepted_request(load: &WebResourceLoad) -> InterceptedRequest {
+    let request = load.request();
+    let mut headers: BTreeMap<String, String> = BTreeMap::new();
+    for (name, value) in request.headers.iter() {
+        let value = String::from_utf8_lossy(value.as_bytes());
+        headers
+            .entry(name.as_str().to_string())
+            .and_modify(|v| {
+                v.push_str(", ");
+                v.push_str(&value);
+            })
+            .or_insert_with(|| value.into_owned());
+    }
+    InterceptedRequest {
+        method: request.method.to_string(),
+        url: request.url.to_string(),
+        headers,
+        is_main_frame: request.is_for_main_frame,
+    }
+}
+
+/// Convert an interceptor header set to a `HeaderMap`, skipping invalid entries.
+fn header_map(headers: &BTreeMap<String, String>) -> HeaderMap {
+    let mut map = HeaderMap::new();
+    for (name, value) in headers {
+        match (
+            HeaderName::from_bytes(name.as_bytes()),
+            HeaderValue::from_str(value),
+        ) {
+            (Ok(name), Ok(value)) => {
+                map.append(name, value);
+            }
+            _ => log::warn!("ignoring invalid header {name:?}"),
+        }
+    }
+    map
+}
+
+/// Approximate site of `url` for third-party checks: the last two labels of a
+/// domain (no public suffix list, so `a.co.uk` and `b.co.uk` count as one
+/// site), or the whole host for IP addresses.
+fn site_key(url: &Url) -> Option<String> {
+    match url.host()? {
+        url::Host::Domain(domain) => {
+            let labels: Vec<&str> = domain.trim_end_matches('.').rsplitn(3, '.').collect();
+            let mut site: Vec<&str> = labels.into_iter().take(2).collect();
+            site.reverse();
+            Some(site.join(".").to_ascii_lowercase())
+        }
+        host => Some(host.to_string()),
+    }
+}
+
 // ---------------------------------------------------------------------------
 // Internal: PageDelegate — enhanced WebView delegate
 // ---------------------------------------------------------------------------
 
+/// Emulated network conditions applied to every HTTP(S) request.
+#[derive(Default)]
+struct NetworkConditions {
+    /// Extra delay before each request is released to the network.
+    latency: Cell<Duration>,
+    /// Cancel every HTTP(S) request, as if the network were down.
+    offline: Cell<bool>,
+}
+
+/// Engine-wide state shared with every page delegate, including popups.
+struct EngineShared {
+    network: NetworkConditions,
+    user_content_manager: Rc<UserContentManager>,
+    request_interceptor: RefCell<Option<Rc<dyn Fn(&InterceptedRequest) -> RequestAction>>>,
+    progress_callback: RefCell<Option<Rc<dyn Fn(&LoadProgress)>>>,
+    html_stream_callback: RefCell<Option<Rc<dyn Fn(&str) -> bool>>>,
+    /// Prefix of the console messages carrying HTML stream chunks, random per
+    /// engine so page scripts cannot fake chunks.
+    html_stream_marker: String,
+    /// Configured User-Agent, for requests fetched outside Servo.
+    user_agent: Option<String>,
+    /// Time limit for one request fetched outside Servo.
+    fetch_timeout: Duration,
+    /// Allow `file:` navigations and subresources (off by default).
+    allow_file_access: Cell<bool>,
+    /// Largest image (width × height) allowed to reach the decoder; 0 = no limit.
+    max_image_pixels: Cell<u64>,
+    cookie_policy: Cell<CookiePolicy>,
+    /// Capture `Content-Disposition: attachment` navigations, set by
+    /// `set_download_capture()`.
+    download_capture: Cell<bool>,
+}
+
+/// A header set (or with `None`, removed) on requests under `prefix`, added
+/// by `add_header_rule()`.
+struct HeaderRule {
+    prefix: Url,
+    name: HeaderName,
+    value: Option<HeaderValue>,
+}
+
+impl HeaderRule {
+    /// Whether `url` is under the rule's prefix: the same origin (scheme, host
+    /// and port), and a path equal to the prefix's or continuing it after a
+    /// `/`, so `/v1` covers `/v1/users` but not `/v10`.
+    fn matches(&self, url: &Url) -> bool {
+        if url.origin() != self.prefix.origin() {
+            return false;
+        }
+        let prefix = self.prefix.path();
+        match url.path().strip_prefix(prefix) {
+            Some(rest) => rest.is_empty() || prefix.ends_with('/') || rest.starts_with('/'),
+            None => false,
+        }
+    }
+}
+
 /// A popup WebView buffered until the engine drains it via `popup_pages()`.
 struct PendingPopup {
     webview: WebView,
@@ -307,14 +999,38 @@ struct PendingPopup {
 
 struct PageDelegate {
     load_complete: Cell<bool>,
+    /// Last `LoadStatus` of the current navigation, for progress reports.
+    load_status: Cell<Option<LoadStatus>>,
+    /// Requests started since the current navigation began.
+    load_requests: Cell<u32>,
+    /// The HTML stream callback asked to stop for the current navigation.
+    html_stream_stopped: Cell<bool>,
     frame_count: Cell<u64>,
     last_request_time: Cell<Option<Instant>>,
     console_messages: RefCell<Vec<ConsoleMessage>>,
     network_requests: RefCell<Vec<NetworkRequest>>,
     blocked_url_patterns: RefCell<Vec<String>>,
+    /// `Accept` header for main-frame navigations; `None` keeps Servo's default.
+    accept_override: RefCell<Option<HeaderValue>>,
+    /// `Accept-Encoding` header for main-frame navigations; `None` keeps Servo's default.
+    accept_encoding_override: RefCell<Option<HeaderValue>>,
+    /// `Content-Security-Policy` replacing the one main-frame responses carry;
+    /// empty drops it.
+    csp_override: RefCell<Option<HeaderValue>>,
+    /// Document served in place of the next main-frame request for this URL,
+    /// set by `load_html()`.
+    pending_html: RefCell<Option<(Url, String)>>,
+    /// Headers forced onto every HTTP(S) request of this page (`Origin`, `Sec-Fetch-*`).
+    forced_headers: RefCell<HeaderMap>,
+    /// URL-scoped header rules, applied in order after `forced_headers`.
+    header_rules: RefCell<Vec<HeaderRule>>,
+    /// Attachment responses captured from this page's navigations, oldest
+    /// first; filled by embedder fetch threads.
+    downloads: Arc<Mutex<VecDeque<Download>>>,
     closed: Cell<bool>,
     popup_buffer: Rc<RefCell<Vec<PendingPopup>>>,
     popup_enabled: Rc<Cell<bool>>,
+    shared: Rc<EngineShared>,
     default_width: Cell<u32>,
     default_height: Cell<u32>,
 }
@@ -323,27 +1039,69 @@ impl PageDelegate {
     fn new(
         popup_buffer: Rc<RefCell<Vec<PendingPopup>>>,
         popup_enabled: Rc<Cell<bool>>,
+        shared: Rc<EngineShared>,
         width: u32,
         height: u32,
     ) -> Self {
         Self {
             load_complete: Cell::new(false),
+            load_status: Cell::new(None),
+            load_requests: Cell::new(0),
+            html_stream_stopped: Cell::new(false),
             frame_count: Cell::new(0),
             last_request_time: Cell::new(None),
             console_messages: RefCell::new(Vec::new()),
             network_requests: RefCell::new(Vec::new()),
             blocked_url_patterns: RefCell::new(Vec::new()),
+            accept_override: RefCell::new(None),
+            accept_encoding_override: RefCell::new(None),
+            csp_override: RefCell::new(None),
+            pending_html: RefCell::new(None),
+            forced_headers: RefCell::new(HeaderMap::new()),
+            header_rules: RefCell::new(Vec::new()),
+            downloads: Arc::new(Mutex::new(VecDeque::new())),
             closed: Cell::new(false),
             popup_buffer,
             popup_enabled,
+            shared,
             default_width: Cell::new(width),
             default_height: Cell::new(height),
         }
     }
+
+    /// Reset load tracking before a navigation is started.
+    fn start_navigation(&self) {
+        self.load_complete.set(false);
+        self.load_status.set(None);
+        self.load_requests.set(0);
+        self.html_stream_stopped.set(false);
+    }
+
+    /// Coarse progress of the current navigation. Servo reports when
+    /// requests start but not when they finish, so the estimate follows the
+    /// document's load status; `settled` marks the end of the post-load wait.
+    fn progress(&self, settled: bool) -> LoadProgress {
+        let percent = match (self.load_status.get(), settled) {
+            (_, true) => 100.0,
+            (Some(LoadStatus::Complete), _) => 90.0,
+            (Some(LoadStatus::HeadParsed), _) => 50.0,
+            (Some(LoadStatus::Started), _) => 10.0,
+            (None, _) => 0.0,
+        };
+        LoadProgress {
+            percent,
+            requests: self.load_requests.get(),
+        }
+    }
 }
 
 impl WebViewDelegate for PageDelegate {
     fn notify_load_status_changed(&self, _webview: WebView, status: LoadStatus) {
+        self.load_status.set(Some(status));
+        // Also covers navigations the page starts itself (links, `location`).
+        if status == LoadStatus::Started {
+            self.html_stream_stopped.set(false);
+        }
         if status == LoadStatus::Complete {
             self.load_complete.set(true);
         }
@@ -355,6 +1113,17 @@ impl WebViewDelegate for PageDelegate {
     }
 
     fn show_console_message(&self, _webview: WebView, level: ConsoleLogLevel, message: String) {
+        if let Some(chunk) = message.strip_prefix(self.shared.html_stream_marker.as_str()) {
+            if !self.html_stream_stopped.get() {
+                let callback = self.shared.html_stream_callback.borrow().clone();
+                if let Some(callback) = callback {
+                    if !callback(chunk) {
+                        self.html_stream_stopped.set(true);
+                    }
+                }
+            }
+            return;
+        }
         let level_str = match level {
             ConsoleLogLevel::Log => "log",
             ConsoleLogLevel::Debug => "debug",
@@ -369,15 +1138,51 @@ impl WebViewDelegate for PageDelegate {
         });
     }
 
-    fn load_web_resource(&self, _webview: WebView, load: WebResourceLoad) {
+    fn load_web_resource(&self, webview: WebView, load: WebResourceLoad) {
         let request = load.request();
         let url_str = request.url.to_string();
+        log_access(|| {
+            let time_ms = SystemTime::now()
+                .duration_since(SystemTime::UNIX_EPOCH)
+                .map_or(0, |d| d.as_millis() as u64);
+            serde_json::json!({
+                "time_ms": time_ms,
+                "method": request.method.as_str(),
+                "url": url_str,
+                "main_frame": request.is_for_main_frame,
+                "page_url": webview.url().map(|u| u.to_string()),
+            })
+        });
         self.network_requests.borrow_mut().push(NetworkRequest {
             method: request.method.to_string(),
             url: url_str.clone(),
             is_main_frame: request.is_for_main_frame,
         });
         self.last_request_time.set(Some(Instant::now()));
+        self.load_requests.set(self.load_requests.get() + 1);
+
+        if request.is_for_main_frame {
+            let mut requested = request.url.clone();
+            requested.set_fragment(None);
+            let pending = self
+                .pending_html
+                .borrow_mut()
+                .take_if(|(url, _)| *url == requested);
+            if let Some((url, html)) = pending {
+                let mut headers = HeaderMap::new();
+                headers.insert(
+                    header::CONTENT_TYPE,
+                    HeaderValue::from_static("text/html; charset=utf-8"),
+                );
+                let response = WebResourceResponse::new(url)
+                    .headers(headers)
+                    .status_code(StatusCode::OK);
+                let intercepted = load.intercept(response);
+                intercepted.send_body_data(html.into_bytes());
+                intercepted.finish();
+                return;
+            }
+        }
 
         // Check if URL matches any blocked pattern.
         let blocked = self
@@ -386,9 +1191,162 @@ impl WebViewDelegate for PageDelegate {
             .iter()
             .any(|pattern| url_str.contains(pattern));
 
-        if blocked {
+        let is_http = matches!(request.url.scheme(), "http" | "https");
+        let is_file = request.url.scheme() == "file";
+        let network = &self.shared.network;
+
+        if blocked
+            || (is_http && network.offline.get())
+            || (is_file && !self.shared.allow_file_access.get())
+        {
             let response = WebResourceResponse::new(request.url.clone());
             load.intercept(response).cancel();
+            return;
+        }
+
+        let latency = network.latency.get();
+        let mut header_override: Option<HeaderMap> = None;
+
+        // Clone the callback out so it may run without holding the borrow.
+        let interceptor = self.shared.request_interceptor.borrow().clone();
+        if let Some(interceptor) = interceptor {
+            match interceptor(&intercepted_request(&load)) {
+                RequestAction::Continue => {}
+                RequestAction::Abort => {
+                    let response = WebResourceResponse::new(request.url.clone());
+                    load.intercept(response).cancel();
+                    return;
+                }
+                RequestAction::Redirect(target) => match HeaderValue::from_str(&target) {
+                    Ok(location) if Url::parse(&target).is_ok() => {
+                        let mut headers = HeaderMap::new();
+                        headers.insert(header::LOCATION, location);
+                        let response = WebResourceResponse::new(request.url.clone())
+                            .headers(headers)
+                            .status_code(StatusCode::TEMPORARY_REDIRECT);
+                        load.intercept(response).finish();
+                        return;
+                    }
+                    _ => log::warn!("interceptor returned invalid redirect URL {target:?}"),
+                },
+                RequestAction::ContinueWithHeaders(headers) => {
+                    header_override = Some(header_map(&headers));
+                }
+            }
+        }
+
+        if request.is_for_main_frame {
+            if let Some(accept) = self.accept_override.borrow().as_ref() {
+                header_override
+                    .get_or_insert_with(|| request.headers.clone())
+                    .insert(header::ACCEPT, accept.clone());
+            }
+            if let Some(encoding) = self.accept_encoding_override.borrow().as_ref() {
+                header_override
+                    .get_or_insert_with(|| request.headers.clone())
+                    .insert(header::ACCEPT_ENCODING, encoding.clone());
+            }
+            if is_http && self.csp_override.borrow().is_some() {
+                header_override.get_or_insert_with(|| request.headers.clone());
+            }
+        }
+
+        let forced = self.forced_headers.borrow();
+        if is_http && !forced.is_empty() {
+            let headers = header_override.get_or_insert_with(|| request.headers.clone());
+            for (name, value) in forced.iter() {
+                headers.insert(name.clone(), value.clone());
+            }
+        }
+        drop(forced);
+
+        let rules = self.header_rules.borrow();
+        let mut matching = rules
+            .iter()
+            .filter(|rule| rule.matches(&request.url))
+            .peekable();
+        if is_http && matching.peek().is_some() {
+            let headers = header_override.get_or_insert_with(|| request.headers.clone());
+            for rule in matching {
+                match &rule.value {
+                    Some(value) => headers.insert(rule.name.clone(), value.clone()),
+                    None => headers.remove(&rule.name),
+                };
+            }
+        }
+        drop(rules);
+
+        // Requests fetched by the embedder bypass Servo's cookie jar, which is
+        // how blocked cookies are neither sent nor stored.
+        let block_cookies = is_http
+            && match self.shared.cookie_policy.get() {
+                CookiePolicy::AcceptAll => false,
+                CookiePolicy::BlockAll => true,
+                CookiePolicy::BlockThirdParty => {
+                    !request.is_for_main_frame
+                        && webview
+                            .url()
+                            .is_some_and(|top| site_key(&top) != site_key(&request.url))
+                }
+            };
+        if block_cookies {
+            header_override.get_or_insert_with(|| request.headers.clone());
+        }
+
+        // Only embedder fetches know when they finish, so a connection limit
+        // routes every HTTP(S) request through them.
+        if is_http && host_connections().limit() > 0 {
+            header_override.get_or_insert_with(|| request.headers.clone());
+        }
+
+        // Image sizes can only be checked on bodies the embedder fetched.
+        let max_image_pixels = self.shared.max_image_pixels.get();
+        if max_image_pixels > 0 && is_http && is_image_request(&request.headers) {
+            header_override.get_or_insert_with(|| request.headers.clone());
+        }
+
+        // Attachments are only recognised in responses the embedder fetched.
+        // POST navigations cannot be re-sent, so form submissions are left
+        // to Servo.
+        let capture_download = is_http
+            && request.is_for_main_frame
+            && request.method == Method::GET
+            && self.shared.download_capture.get();
+        if capture_download {
+            header_override.get_or_insert_with(|| request.headers.clone());
+        }
+
+        if let Some(headers) = header_override {
+            // The request body is not exposed, so only bodiless requests can
+            // be re-sent by the embedder.
+            if is_http && matches!(request.method, Method::GET | Method::HEAD) {
+                let fetch = EmbedderFetch {
+                    user_agent: self.shared.user_agent.clone(),
+                    delay: latency,
+                    timeout: self.shared.fetch_timeout,
+                    max_image_pixels,
+                    csp_override: request
+                        .is_for_main_frame
+                        .then(|| self.csp_override.borrow().clone())
+                        .flatten(),
+                    strip_cookies: block_cookies,
+                    downloads: capture_download.then(|| self.downloads.clone()),
+                };
+                fetch_with_headers(load, headers, fetch);
+                return;
+            }
+            log::warn!(
+                "cannot override headers of {} {url_str}; sending unchanged",
+                request.method
+            );
+        }
+
+        if is_http && !latency.is_zero() {
+            // Hold the load on a timer thread; dropping it releases the request.
+            std::thread::spawn(move || {
+                std::thread::sleep(latency);
+                drop(load);
+            });
         }
         // Otherwise drop `load` to let it continue normally.
     }
@@ -434,6 +1392,7 @@ impl WebViewDelegate for PageDelegate {
         let delegate = Rc::new(PageDelegate::new(
             self.popup_buffer.clone(),
             self.popup_enabled.clone(),
+            self.shared.clone(),
             w,
             h,
         ));
@@ -441,6 +1400,7 @@ impl WebViewDelegate for PageDelegate {
         let webview = request
             .builder(rendering_context.clone())
             .delegate(delegate.clone())
+            .user_content_manager(self.shared.user_content_manager.clone())
             .build();
 
         self.popup_buffer.borrow_mut().push(PendingPopup {
@@ -487,12 +1447,12 @@ fn eval_js(
     }
 }
 
-fn take_screenshot_bytes(
+fn take_screenshot_image(
     servo: &Servo,
     event_loop: &ScraperEventLoop,
     webview: &WebView,
     timeout_secs: u64,
-) -> Result<Vec<u8>, PageError> {
+) -> Result<image::RgbaImage, PageError> {
     let result: Rc<RefCell<Option<Result<servo::RgbaImage, _>>>> = Rc::new(RefCell::new(None));
     let cb_result = result.clone();
 
@@ -511,57 +1471,570 @@ fn take_screenshot_bytes(
     }
 
     match result.borrow_mut().take() {
-        Some(Ok(image)) => {
-            let dynamic = DynamicImage::ImageRgba8(image);
-            let rgba8 = dynamic.to_rgba8();
-            let (w, h) = (rgba8.width(), rgba8.height());
-            let mut png_buf = Vec::new();
-            PngEncoder::new(&mut png_buf)
-                .write_image(&rgba8, w, h, image::ExtendedColorType::Rgba8)
-                .map_err(|e| PageError::ScreenshotFailed(format!("PNG encoding failed: {e}")))?;
-            Ok(png_buf)
-        }
+        Some(Ok(image)) => Ok(DynamicImage::ImageRgba8(image).to_rgba8()),
         Some(Err(e)) => Err(PageError::ScreenshotFailed(format!("{e:?}"))),
         None => Err(PageError::Timeout),
     }
 }
 
-fn capture_html(
+fn take_screenshot_bytes(
     servo: &Servo,
     event_loop: &ScraperEventLoop,
     webview: &WebView,
     timeout_secs: u64,
-) -> Result<String, PageError> {
-    match eval_js(
+) -> Result<Vec<u8>, PageError> {
+    encode_png(&take_screenshot_image(
         servo,
         event_loop,
         webview,
-        "document.documentElement.outerHTML",
         timeout_secs,
-    )? {
-        JSValue::String(html) => Ok(html),
-        other => Err(PageError::JsError(format!(
-            "unexpected JS result type: {other:?}"
-        ))),
+    )?)
+}
+
+fn encode_png(rgba8: &image::RgbaImage) -> Result<Vec<u8>, PageError> {
+    let (w, h) = (rgba8.width(), rgba8.height());
+    let mut png_buf = Vec::new();
+    PngEncoder::new(&mut png_buf)
+        .write_image(rgba8, w, h, image::ExtendedColorType::Rgba8)
+        .map_err(|e| PageError::ScreenshotFailed(format!("PNG encoding failed: {e}")))?;
+    Ok(png_buf)
+}
+
+/// 64-bit DCT perceptual hash: greyscale, downscale to 32×32, 2-D DCT-II,
+/// then one bit per coefficient of the lowest 8×8 frequencies (row-major,
+/// MSB first), set when it is above their median (the DC term excluded from
+/// the median). Similar images differ in few bits.
+fn perceptual_hash(image: &image::RgbaImage) -> u64 {
+    const N: usize = 32;
+    const K: usize = 8;
+    let grey = DynamicImage::ImageRgba8(image.clone()).to_luma8();
+    let small = image::imageops::resize(
+        &grey,
+        N as u32,
+        N as u32,
+        image::imageops::FilterType::Triangle,
+    );
+    let pixel = |x: usize, y: usize| f64::from(small.get_pixel(x as u32, y as u32)[0]);
+
+    let cos: Vec<f64> = (0..K * N)
+        .map(|i| {
+            let (u, x) = (i / N, i % N);
+            ((2 * x + 1) as f64 * u as f64 * std::f64::consts::PI / (2 * N) as f64).cos()
+        })
+        .collect();
+    // Rows first, keeping only the K lowest horizontal frequencies.
+    let mut rows = [[0.0; K]; N];
+    for (y, row) in rows.iter_mut().enumerate() {
+        for (u, out) in row.iter_mut().enumerate() {
+            *out = (0..N).map(|x| pixel(x, y) * cos[u * N + x]).sum();
+        }
     }
+    let mut coeffs = [0.0; K * K];
+    for v in 0..K {
+        for u in 0..K {
+            coeffs[v * K + u] = (0..N).map(|y| rows[y][u] * cos[v * N + y]).sum();
+        }
+    }
+
+    let mut sorted = coeffs[1..].to_vec();
+    sorted.sort_by(f64::total_cmp);
+    let median = sorted[sorted.len() / 2];
+    coeffs
+        .iter()
+        .fold(0u64, |hash, &c| (hash << 1) | u64::from(c > median))
 }
 
-/// Serialize a JSValue to a JSON string.
-fn jsvalue_to_json(value: &JSValue) -> String {
-    match value {
-        JSValue::Undefined => "undefined".to_string(),
-        JSValue::Null => "null".to_string(),
-        JSValue::Boolean(b) => serde_json::to_string(b).unwrap(),
-        JSValue::Number(n) => serde_json::to_string(n).unwrap(),
-        JSValue::String(s) => serde_json::to_string(s).unwrap(),
-        JSValue::Array(arr) => {
-            let items: Vec<String> = arr.iter().map(jsvalue_to_json).collect();
-            format!("[{}]", items.join(","))
+/// Recover a transparent layer from two renders of it, one over a black
+/// backdrop and one over white: a pixel's alpha is how little it changes
+/// between the two, and its colour is the black render un-premultiplied.
+fn unmatte(
+    black: &image::RgbaImage,
+    white: &image::RgbaImage,
+) -> Result<image::RgbaImage, PageError> {
+    if black.dimensions() != white.dimensions() {
+        return Err(PageError::ScreenshotFailed(
+            "layer renders differ in size".into(),
+        ));
+    }
+    let mut out = image::RgbaImage::new(black.width(), black.height());
+    for ((b, w), px) in black.pixels().zip(white.pixels()).zip(out.pixels_mut()) {
+        let spread: u32 = (0..3).map(|c| u32::from(w[c].saturating_sub(b[c]))).sum();
+        let alpha = 255 - (spread / 3).min(255);
+        if alpha == 0 {
+            continue;
         }
-        JSValue::Object(map) => {
-            let entries: Vec<String> = map
-                .iter()
-                .map(|(k, v)| {
+        let un = |c: usize| (u32::from(b[c]) * 255 / alpha).min(255) as u8;
+        *px = image::Rgba([un(0), un(1), un(2), alpha as u8]);
+    }
+    Ok(out)
+}
+
+/// Sibling lists longer than this (after trimming the common prefix and
+/// suffix) are not aligned; their differing middle counts as replaced.
+const MAX_DIFF_CELLS: usize = 4_000_000;
+
+/// Differences between two `dom_snapshot()` trees, collected as JSON entries.
+struct DomDiff<'a> {
+    ignored_attributes: &'a [&'a str],
+    added: Vec<serde_json::Value>,
+    removed: Vec<serde_json::Value>,
+    changed: Vec<serde_json::Value>,
+}
+
+/// What siblings are matched by: the tag and `id`, or `None` for text.
+fn dom_node_key(node: &serde_json::Value) -> Result<Option<(&str, Option<&str>)>, PageError> {
+    if node.get("text").is_some_and(serde_json::Value::is_string) {
+        return Ok(None);
+    }
+    let tag = node.get("tag").and_then(serde_json::Value::as_str);
+    let attrs = node.get("attrs").and_then(serde_json::Value::as_object);
+    let children = node.get("children").and_then(serde_json::Value::as_array);
+    match (tag, attrs, children) {
+        (Some(tag), Some(attrs), Some(_)) => Ok(Some((
+            tag,
+            attrs.get("id").and_then(serde_json::Value::as_str),
+        ))),
+        _ => Err(PageError::InvalidArgument(
+            "invalid DOM snapshot node (expected {tag, attrs, children} or {text})".into(),
+        )),
+    }
+}
+
+/// XPath-like path of each child, e.g. `/html[1]/body[1]/p[2]` and
+/// `.../text()[1]`, counting same-kind siblings.
+fn dom_child_paths(parent: &str, keys: &[Option<(&str, Option<&str>)>]) -> Vec<String> {
+    let mut counts: HashMap<&str, usize> = HashMap::new();
+    keys.iter()
+        .map(|key| {
+            let name = key.map_or("text()", |(tag, _)| tag);
+            let n = counts.entry(name).or_default();
+            *n += 1;
+            format!("{parent}/{name}[{n}]")
+        })
+        .collect()
+}
+
+impl DomDiff<'_> {
+    /// Compare two sibling lists, aligning them by the longest common
+    /// subsequence of their keys.
+    fn children(
+        &mut self,
+        path_a: &str,
+        path_b: &str,
+        a: &[serde_json::Value],
+        b: &[serde_json::Value],
+    ) -> Result<(), PageError> {
+        let keys_a = a.iter().map(dom_node_key).collect::<Result<Vec<_>, _>>()?;
+        let keys_b = b.iter().map(dom_node_key).collect::<Result<Vec<_>, _>>()?;
+        let paths_a = dom_child_paths(path_a, &keys_a);
+        let paths_b = dom_child_paths(path_b, &keys_b);
+
+        let mut pairs = Vec::new();
+        let prefix = keys_a
+            .iter()
+            .zip(&keys_b)
+            .take_while(|(x, y)| x == y)
+            .count();
+        let suffix = keys_a[prefix..]
+            .iter()
+            .rev()
+            .zip(keys_b[prefix..].iter().rev())
+            .take_while(|(x, y)| x == y)
+            .count();
+        pairs.extend((0..prefix).map(|i| (i, i)));
+        let (mid_a, mid_b) = (
+            &keys_a[prefix..keys_a.len() - suffix],
+            &keys_b[prefix..keys_b.len() - suffix],
+        );
+        let (n, m) = (mid_a.len(), mid_b.len());
+        if n > 0 && m > 0 && (n + 1) * (m + 1) <= MAX_DIFF_CELLS {
+            let mut lcs = vec![0u32; (n + 1) * (m + 1)];
+            for i in (0..n).rev() {
+                for j in (0..m).rev() {
+                    lcs[i * (m + 1) + j] = if mid_a[i] == mid_b[j] {
+                        lcs[(i + 1) * (m + 1) + j + 1] + 1
+                    } else {
+                        lcs[(i + 1) * (m + 1) + j].max(lcs[i * (m + 1) + j + 1])
+                    };
+                }
+            }
+            let (mut i, mut j) = (0, 0);
+            while i < n && j < m {
+                if mid_a[i] == mid_b[j] {
+                    pairs.push((prefix + i, prefix + j));
+                    i += 1;
+                    j += 1;
+                } else if lcs[(i + 1) * (m + 1) + j] >= lcs[i * (m + 1) + j + 1] {
+                    i += 1;
+                } else {
+                    j += 1;
+                }
+            }
+        }
+        pairs.extend((0..suffix).map(|k| (keys_a.len() - suffix + k, keys_b.len() - suffix + k)));
+
+        let mut matched_a = vec![false; a.len()];
+        let mut matched_b = vec![false; b.len()];
+        for &(i, j) in &pairs {
+            matched_a[i] = true;
+            matched_b[j] = true;
+        }
+        for (i, node) in a.iter().enumerate().filter(|(i, _)| !matched_a[*i]) {
+            self.removed
+                .push(serde_json::json!({"path": paths_a[i], "node": node}));
+        }
+        for (j, node) in b.iter().enumerate().filter(|(j, _)| !matched_b[*j]) {
+            self.added
+                .push(serde_json::json!({"path": paths_b[j], "node": node}));
+        }
+        for (i, j) in pairs {
+            self.node(&paths_a[i], &paths_b[j], &a[i], &b[j])?;
+        }
+        Ok(())
+    }
+
+    /// Compare two nodes with the same key. Changes are reported at `path_b`.
+    fn node(
+        &mut self,
+        path_a: &str,
+        path_b: &str,
+        a: &serde_json::Value,
+        b: &serde_json::Value,
+    ) -> Result<(), PageError> {
+        if let (Some(old), Some(new)) = (a.get("text"), b.get("text")) {
+            if old != new {
+                self.changed.push(serde_json::json!({
+                    "path": path_b, "kind": "text", "old": old, "new": new,
+                }));
+            }
+            return Ok(());
+        }
+        let empty = serde_json::Map::new();
+        let attrs_a = a["attrs"].as_object().unwrap_or(&empty);
+        let attrs_b = b["attrs"].as_object().unwrap_or(&empty);
+        let mut names: Vec<&String> = attrs_a.keys().chain(attrs_b.keys()).collect();
+        names.sort();
+        names.dedup();
+        for name in names {
+            let ignored = self
+                .ignored_attributes
+                .iter()
+                .any(|ignored| ignored.eq_ignore_ascii_case(name));
+            let (old, new) = (attrs_a.get(name), attrs_b.get(name));
+            if !ignored && old != new {
+                self.changed.push(serde_json::json!({
+                    "path": path_b, "kind": "attribute", "name": name, "old": old, "new": new,
+                }));
+            }
+        }
+        let children_a = a["children"].as_array().map_or(&[][..], Vec::as_slice);
+        let children_b = b["children"].as_array().map_or(&[][..], Vec::as_slice);
+        self.children(path_a, path_b, children_a, children_b)
+    }
+}
+
+/// What `SINGLE_FILE_COLLECT_JS` reports: the document base URL, absolute
+/// image URLs, stylesheet URLs, `<style>` contents and `style` attributes
+/// referencing `url()`, the last three in marker order.
+#[derive(Deserialize)]
+struct SingleFileParts {
+    base: String,
+    images: Vec<String>,
+    sheets: Vec<String>,
+    styles: Vec<String>,
+    attrs: Vec<String>,
+}
+
+/// `@import`s nested deeper than this keep their absolute URL.
+const MAX_CSS_IMPORT_DEPTH: u32 = 8;
+
+/// Which `single_file()` asset requests may go out, and with which headers:
+/// blocked URL patterns, offline emulation and the request interceptor apply
+/// as they do to the page's own requests.
+struct AssetPolicy<'a> {
+    user_agent: Option<&'a str>,
+    blocked: Vec<String>,
+    offline: bool,
+    interceptor: Option<Rc<dyn Fn(&InterceptedRequest) -> RequestAction>>,
+}
+
+impl AssetPolicy<'_> {
+    fn prepare(&self, url: &Url) -> AssetRequest {
+        let url_str = url.as_str();
+        if self.offline || self.blocked.iter().any(|p| url_str.contains(p.as_str())) {
+            return AssetRequest::Refuse;
+        }
+        let mut headers = HeaderMap::new();
+        if let Some(ua) = self
+            .user_agent
+            .and_then(|ua| HeaderValue::from_str(ua).ok())
+        {
+            headers.insert(header::USER_AGENT, ua);
+        }
+        let Some(interceptor) = &self.interceptor else {
+            return AssetRequest::Send(headers);
+        };
+        let request = InterceptedRequest {
+            method: "GET".into(),
+            url: url_str.to_string(),
+            headers: headers
+                .iter()
+                .map(|(name, value)| {
+                    let value = String::from_utf8_lossy(value.as_bytes()).into_owned();
+                    (name.as_str().to_string(), value)
+                })
+                .collect(),
+            is_main_frame: false,
+        };
+        match interceptor(&request) {
+            RequestAction::Continue => AssetRequest::Send(headers),
+            RequestAction::Abort => AssetRequest::Refuse,
+            RequestAction::Redirect(target) => match Url::parse(&target) {
+                Ok(target) => AssetRequest::Redirect(target),
+                Err(_) => {
+                    log::warn!("interceptor returned invalid redirect URL {target:?}");
+                    AssetRequest::Send(headers)
+                }
+            },
+            RequestAction::ContinueWithHeaders(headers) => AssetRequest::Send(header_map(&headers)),
+        }
+    }
+}
+
+/// Fetches and inlines the assets of a `single_file()` export. Responses
+/// are cached per URL (without fragment); failures are cached as `None`.
+struct SingleFile<'a> {
+    policy: AssetPolicy<'a>,
+    max_asset_bytes: u64,
+    timeout: Duration,
+    fetched: HashMap<Url, Option<(Vec<u8>, String)>>,
+}
+
+impl SingleFile<'_> {
+    fn fetch(&mut self, url: &Url) -> Option<&(Vec<u8>, String)> {
+        let (policy, max_bytes, timeout) = (&self.policy, self.max_asset_bytes, self.timeout);
+        let mut url = url.clone();
+        url.set_fragment(None);
+        self.fetched
+            .entry(url)
+            .or_insert_with_key(|url| {
+                fetch_asset(url, &|hop| policy.prepare(hop), max_bytes, timeout)
+            })
+            .as_ref()
+    }
+
+    /// `url` as a `data:` URI keeping its fragment, e.g. for SVG sprites.
+    fn data_uri(&mut self, url: &Url) -> Option<String> {
+        use base64::Engine as _;
+        let (body, mime) = self.fetch(url)?;
+        let mut uri = format!(
+            "data:{mime};base64,{}",
+            base64::engine::general_purpose::STANDARD.encode(body)
+        );
+        if let Some(fragment) = url.fragment() {
+            uri.push('#');
+            uri.push_str(fragment);
+        }
+        Some(uri)
+    }
+
+    /// Rewrite `css` served from `base`: `url()` references become `data:`
+    /// URIs and `@import`ed sheets are inlined. References that cannot be
+    /// inlined are made absolute.
+    fn css(&mut self, css: &str, base: &Url, depth: u32) -> String {
+        let bytes = css.as_bytes();
+        let mut out = String::with_capacity(css.len());
+        let (mut copied, mut i) = (0, 0);
+        while i < bytes.len() {
+            let rest = &bytes[i..];
+            if rest.starts_with(b"/*") {
+                i = css[i + 2..]
+                    .find("*/")
+                    .map_or(bytes.len(), |end| i + end + 4);
+                continue;
+            }
+            if matches!(bytes[i], b'"' | b'\'') {
+                i += css_string_len(&css[i..]).unwrap_or(1);
+                continue;
+            }
+            let replaced = if starts_with_ignore_case(rest, b"@import") {
+                parse_css_import(css, i + 7).map(|(target, media, end)| {
+                    let import = self.import(target, media, base, depth);
+                    (import, end)
+                })
+            } else if starts_with_ignore_case(rest, b"url(")
+                && (i == 0 || !is_css_name_byte(bytes[i - 1]))
+            {
+                parse_css_url(css, i + 4).map(|(target, end)| (self.url_ref(target, base), end))
+            } else {
+                None
+            };
+            match replaced {
+                Some((replacement, end)) => {
+                    out.push_str(&css[copied..i]);
+                    out.push_str(&replacement);
+                    copied = end;
+                    i = end;
+                }
+                None => i += 1,
+            }
+        }
+        out.push_str(&css[copied..]);
+        out
+    }
+
+    /// The inlined contents of an `@import` rule, wrapped in `@media` for a
+    /// media query, or the rule with an absolute URL if it cannot be fetched.
+    fn import(&mut self, target: &str, media: &str, base: &Url, depth: u32) -> String {
+        let url = base.join(target).ok();
+        let sheet = url
+            .as_ref()
+            .filter(|_| depth < MAX_CSS_IMPORT_DEPTH)
+            .and_then(|url| self.fetch(url))
+            .map(|(body, _)| String::from_utf8_lossy(body).into_owned());
+        match (url, sheet) {
+            (Some(url), Some(sheet)) => {
+                let sheet = self.css(&sheet, &url, depth + 1);
+                if media.is_empty() || media.eq_ignore_ascii_case("all") {
+                    sheet
+                } else {
+                    format!("@media {media} {{\n{sheet}\n}}")
+                }
+            }
+            (url, _) => {
+                let target = css_url(url.as_ref().map_or(target, Url::as_str));
+                if media.is_empty() {
+                    format!("@import {target};")
+                } else {
+                    format!("@import {target} {media};")
+                }
+            }
+        }
+    }
+
+    /// A `url()` token for `target`. Fragment-only references (`url(#id)`)
+    /// and non-http(s) URLs such as `data:` are kept as they are.
+    fn url_ref(&mut self, target: &str, base: &Url) -> String {
+        let url = if target.starts_with('#') {
+            None
+        } else {
+            base.join(target).ok()
+        };
+        match url {
+            Some(url) if matches!(url.scheme(), "http" | "https") => {
+                css_url(&self.data_uri(&url).unwrap_or_else(|| url.into()))
+            }
+            _ => css_url(target),
+        }
+    }
+}
+
+fn starts_with_ignore_case(bytes: &[u8], prefix: &[u8]) -> bool {
+    bytes.len() >= prefix.len() && bytes[..prefix.len()].eq_ignore_ascii_case(prefix)
+}
+
+/// Whether `b` can be part of a CSS identifier, so `url(` after it is part
+/// of a longer function name.
+fn is_css_name_byte(b: u8) -> bool {
+    b.is_ascii_alphanumeric() || b == b'-' || b == b'_' || b >= 0x80
+}
+
+/// Length of the quoted CSS string `s` starts with, including both quotes,
+/// or `None` if it is unterminated.
+fn css_string_len(s: &str) -> Option<usize> {
+    let bytes = s.as_bytes();
+    let quote = bytes[0];
+    let mut i = 1;
+    while i < bytes.len() {
+        match bytes[i] {
+            b'\\' => i += 2,
+            b'\n' => return None,
+            b if b == quote => return Some(i + 1),
+            _ => i += 1,
+        }
+    }
+    None
+}
+
+/// Parse a `url(` token whose argument starts at `start`: the URL without
+/// quotes and the index past the closing parenthesis.
+fn parse_css_url(css: &str, start: usize) -> Option<(&str, usize)> {
+    let rest = &css[start..];
+    let trimmed = rest.trim_start();
+    let offset = start + rest.len() - trimmed.len();
+    if !trimmed.starts_with(['"', '\'']) {
+        let end = trimmed.find(')')?;
+        return Some((trimmed[..end].trim_end(), offset + end + 1));
+    }
+    let len = css_string_len(trimmed)?;
+    let after = offset + len;
+    let tail = &css[after..];
+    let close = after + tail.len() - tail.trim_start().len();
+    css[close..]
+        .starts_with(')')
+        .then_some((&trimmed[1..len - 1], close + 1))
+}
+
+/// Parse an `@import` rule whose prelude starts at `start`: the URL, the
+/// media query (possibly empty) and the index past the closing `;`.
+fn parse_css_import(css: &str, start: usize) -> Option<(&str, &str, usize)> {
+    let rest = &css[start..];
+    let trimmed = rest.trim_start();
+    let offset = start + rest.len() - trimmed.len();
+    let (target, after) = if starts_with_ignore_case(trimmed.as_bytes(), b"url(") {
+        parse_css_url(css, offset + 4)?
+    } else if trimmed.starts_with(['"', '\'']) {
+        let len = css_string_len(trimmed)?;
+        (&trimmed[1..len - 1], offset + len)
+    } else {
+        return None;
+    };
+    let end = css[after..].find(';').map_or(css.len(), |i| after + i + 1);
+    let media = css[after..end].trim_end_matches(';').trim();
+    Some((target, media, end))
+}
+
+/// A quoted CSS `url()` token.
+fn css_url(url: &str) -> String {
+    format!("url(\"{}\")", url.replace('"', "%22").replace('\n', ""))
+}
+
+fn capture_html(
+    servo: &Servo,
+    event_loop: &ScraperEventLoop,
+    webview: &WebView,
+    timeout_secs: u64,
+) -> Result<String, PageError> {
+    match eval_js(
+        servo,
+        event_loop,
+        webview,
+        "document.documentElement.outerHTML",
+        timeout_secs,
+    )? {
+        JSValue::String(html) => Ok(html),
+        other => Err(PageError::JsError(format!(
+            "unexpected JS result type: {other:?}"
+        ))),
+    }
+}
+
+/// Serialize a JSValue to a JSON string.
+fn jsvalue_to_json(value: &JSValue) -> String {
+    match value {
+        JSValue::Undefined => "undefined".to_string(),
+        JSValue::Null => "null".to_string(),
+        JSValue::Boolean(b) => serde_json::to_string(b).unwrap(),
+        JSValue::Number(n) => serde_json::to_string(n).unwrap(),
+        JSValue::String(s) => serde_json::to_string(s).unwrap(),
+        JSValue::Array(arr) => {
+            let items: Vec<String> = arr.iter().map(jsvalue_to_json).collect();
+            format!("[{}]", items.join(","))
+        }
+        JSValue::Object(map) => {
+            let entries: Vec<String> = map
+                .iter()
+                .map(|(k, v)| {
                     format!(
                         "{}:{}",
                         serde_json::to_string(k).unwrap(),
@@ -585,6 +2058,41 @@ fn js_string_literal(s: &str) -> String {
     serde_json::to_string(s).unwrap_or_else(|_| format!("\"{}\"", s))
 }
 
+/// Wrap `script` for the emulated isolated world: a strict-mode direct `eval`
+/// inside a function keeps its declarations local, with `world` bound to an
+/// object kept on a hidden, non-enumerable window property. Only the scope is
+/// separate; see [`JsWorld::Isolated`] for what the page can still reach.
+fn isolated_world_script(script: &str) -> String {
+    format!(
+        "(function(world) {{ 'use strict'; return eval({}); }})(\
+            window.__servoScraperWorld || Object.defineProperty(window, '__servoScraperWorld', \
+                {{value: Object.create(null)}}).__servoScraperWorld)",
+        js_string_literal(script)
+    )
+}
+
+/// Validate a `Sec-Fetch-*` value: one of `allowed`, or any lowercase token.
+fn fetch_metadata_value(
+    header: &str,
+    value: &str,
+    allowed: Option<&[&str]>,
+) -> Result<HeaderValue, PageError> {
+    let valid = match allowed {
+        Some(allowed) => allowed.contains(&value),
+        None => {
+            !value.is_empty()
+                && value
+                    .bytes()
+                    .all(|b| b.is_ascii_lowercase() || b.is_ascii_digit() || b == b'-')
+        }
+    };
+    let invalid = || PageError::InvalidArgument(format!("invalid {header} value: {value:?}"));
+    if !valid {
+        return Err(invalid());
+    }
+    HeaderValue::from_str(value).map_err(|_| invalid())
+}
+
 /// Map a key name string to a `Key`.
 fn parse_key_name(name: &str) -> Key {
     match name {
@@ -606,6 +2114,552 @@ fn parse_key_name(name: &str) -> Key {
     }
 }
 
+/// Init script recording the last uncaught exception, so `evaluate()` failures
+/// can report its name, message and stack.
+const JS_ERROR_RECORDER: &str = "(function() { \
+    window.addEventListener('error', function(e) { \
+        var err = e.error; \
+        var info = { \
+            name: err && err.name ? String(err.name) : null, \
+            message: err && err.message !== undefined ? String(err.message) : String(e.message), \
+            stack: err && err.stack ? String(err.stack) : null \
+        }; \
+        Object.defineProperty(window, '__servoScraperLastError', \
+            {value: JSON.stringify(info), writable: true, configurable: true}); \
+    }); \
+})()";
+
+/// Read and clear the exception recorded by `JS_ERROR_RECORDER`.
+const JS_ERROR_TAKE: &str = "(function() { \
+    var v = window.__servoScraperLastError || null; \
+    window.__servoScraperLastError = null; \
+    return v; \
+})()";
+
+/// Exception info as recorded by `JS_ERROR_RECORDER`.
+#[derive(Deserialize)]
+struct RecordedJsError {
+    name: Option<String>,
+    message: Option<String>,
+    stack: Option<String>,
+}
+
+/// Init script recording the latest Largest Contentful Paint candidate, which
+/// is only reported to observers (not in the performance timeline).
+const LCP_RECORDER: &str = "(function() { \
+    if (typeof PerformanceObserver === 'undefined' || \
+        (PerformanceObserver.supportedEntryTypes || []).indexOf('largest-contentful-paint') === -1) return; \
+    new PerformanceObserver(function(list) { \
+        var entries = list.getEntries(); \
+        if (entries.length) window.__servoScraperLcp = entries[entries.length - 1].startTime; \
+    }).observe({type: 'largest-contentful-paint', buffered: true}); \
+})()";
+
+/// Read `[fcp, lcp]` in ms, with -1 for paints not reported yet.
+const PAINT_TIMING_JS: &str = "(function() { \
+    var fcp = -1; \
+    var paints = performance.getEntriesByName ? performance.getEntriesByName('first-contentful-paint') : []; \
+    if (paints.length) fcp = paints[0].startTime; \
+    var lcp = typeof window.__servoScraperLcp === 'number' ? window.__servoScraperLcp : -1; \
+    return [fcp, lcp]; \
+})()";
+
+/// Init script for `set_render_mode_tracking()`, measuring the document at
+/// `DOMContentLoaded` for `render_mode()`: `[elements, text]`, where `text` counts the non-blank
+/// characters of body text outside `<script>`, `<style>`, `<noscript>` and
+/// `<template>`. The measuring function is kept for the later reading.
+const RENDER_MODE_RECORDER: &str = "(function() { \
+    function measure() { \
+        var text = 0; \
+        if (document.body) { \
+            var walker = document.createTreeWalker(document.body, NodeFilter.SHOW_TEXT); \
+            while (walker.nextNode()) { \
+                var node = walker.currentNode, parent = node.parentNode.localName; \
+                if (parent === 'script' || parent === 'style' || parent === 'noscript' || \
+                    parent === 'template') continue; \
+                text += node.data.replace(/\\s+/g, '').length; \
+            } \
+        } \
+        return [document.getElementsByTagName('*').length, text]; \
+    } \
+    Object.defineProperty(window, '__servoScraperDomSize', {value: measure}); \
+    document.addEventListener('DOMContentLoaded', function() { \
+        Object.defineProperty(window, '__servoScraperDclDom', {value: measure()}); \
+    }, {once: true}); \
+})()";
+
+/// Read `[elements, text]` at `DOMContentLoaded` followed by the same now, or
+/// `null` before `DOMContentLoaded`.
+const RENDER_MODE_JS: &str = "(function() { \
+    var before = window.__servoScraperDclDom, measure = window.__servoScraperDomSize; \
+    return before && measure ? before.concat(measure()) : null; \
+})()";
+
+/// Below this much text after settling, `render_mode()` compares element
+/// counts instead: too little text to tell the two apart.
+const RENDER_MODE_MIN_TEXT: f64 = 200.0;
+
+/// Classify from the share of content (text, or elements on text-poor pages)
+/// present at `DOMContentLoaded`: `>= 0.8` server-rendered, `<= 0.25`
+/// client-rendered, hybrid in between.
+fn classify_render_mode(before: [f64; 2], after: [f64; 2]) -> RenderMode {
+    let [elements_before, text_before] = before;
+    let [elements_after, text_after] = after;
+    let share = if text_after >= RENDER_MODE_MIN_TEXT {
+        text_before / text_after
+    } else if elements_after > 0.0 {
+        elements_before / elements_after
+    } else {
+        1.0
+    };
+    if share >= 0.8 {
+        RenderMode::ServerRendered
+    } else if share <= 0.25 {
+        RenderMode::ClientRendered
+    } else {
+        RenderMode::Hybrid
+    }
+}
+
+/// Init script for `set_service_worker_tracking()`, noting successful
+/// `navigator.serviceWorker.register()` calls in
+/// `window.__servoScraperSwRegistered`.
+const SERVICE_WORKER_RECORDER: &str = "(function() { \
+    if (typeof ServiceWorkerContainer === 'undefined') return; \
+    var register = ServiceWorkerContainer.prototype.register; \
+    ServiceWorkerContainer.prototype.register = function() { \
+        return register.apply(this, arguments).then(function(reg) { \
+            window.__servoScraperSwRegistered = true; \
+            return reg; \
+        }); \
+    }; \
+})()";
+
+/// Whether the document registered, or is controlled by, a service worker.
+const HAS_SERVICE_WORKER_JS: &str = "window.__servoScraperSwRegistered === true || \
+    !!(navigator.serviceWorker && navigator.serviceWorker.controller)";
+
+/// Serializes the document as a `dom_snapshot()` tree: elements as
+/// `{tag, attrs, children}`, text as `{text}` with whitespace collapsed.
+/// Whitespace-only text, comments and processing instructions are skipped.
+const DOM_SNAPSHOT_JS: &str = "(function() { \
+    function walk(n) { \
+        if (n.nodeType === 3) { \
+            var text = n.data.replace(/\\s+/g, ' ').trim(); \
+            return text ? {text: text} : null; \
+        } \
+        if (n.nodeType !== 1) return null; \
+        var attrs = {}, children = []; \
+        for (var i = 0; i < n.attributes.length; i++) \
+            attrs[n.attributes[i].name] = n.attributes[i].value; \
+        for (var c = n.firstChild; c; c = c.nextSibling) { \
+            var w = walk(c); \
+            if (w) children.push(w); \
+        } \
+        return {tag: n.localName, attrs: attrs, children: children}; \
+    } \
+    var root = document.documentElement; \
+    return root ? JSON.stringify(walk(root)) : 'null'; \
+})()";
+
+/// First half of `single_file()`: clones the document into an inert one
+/// kept as `window.__servoScraperSingleFile`, with scripts, `<base>`,
+/// `http-equiv` metas, preload hints and inline event handlers removed,
+/// canvases turned into images and URLs made absolute. Reports a
+/// `SingleFileParts` JSON, with stylesheet links, `<style>` elements and
+/// `style` attributes to rewrite tagged by index.
+const SINGLE_FILE_COLLECT_JS: &str = "(function() { \
+    var root = document.documentElement; \
+    if (!root) return null; \
+    var doc = document.implementation.createHTMLDocument(''); \
+    var clone = doc.importNode(root, true); \
+    function abs(v) { try { return new URL(v, document.baseURI).href; } catch (e) { return v; } } \
+    var images = [], sheets = [], styles = [], attrs = []; \
+    function image(el, name, url) { \
+        if (!url) return; \
+        el.setAttribute(name, url); \
+        if (images.indexOf(url) < 0) images.push(url); \
+    } \
+    var imgs = root.querySelectorAll('img'), cloneImgs = clone.querySelectorAll('img'); \
+    var canvases = root.querySelectorAll('canvas'), cloneCanvases = clone.querySelectorAll('canvas'); \
+    for (var i = 0; i < imgs.length; i++) { \
+        cloneImgs[i].removeAttribute('srcset'); \
+        cloneImgs[i].removeAttribute('sizes'); \
+        image(cloneImgs[i], 'src', imgs[i].currentSrc || (imgs[i].getAttribute('src') ? imgs[i].src : '')); \
+    } \
+    for (var i = 0; i < canvases.length; i++) { \
+        var img = doc.createElement('img'), from = cloneCanvases[i]; \
+        try { img.setAttribute('src', canvases[i].toDataURL()); } catch (e) { continue; } \
+        ['id', 'class', 'style', 'width', 'height'].forEach(function(name) { \
+            if (from.hasAttribute(name)) img.setAttribute(name, from.getAttribute(name)); \
+        }); \
+        from.replaceWith(img); \
+    } \
+    clone.querySelectorAll('script, base, picture source, meta[http-equiv], meta[charset]') \
+        .forEach(function(el) { el.remove(); }); \
+    clone.querySelectorAll('link[href]').forEach(function(link) { \
+        var rel = ' ' + (link.getAttribute('rel') || '').toLowerCase().split(/\\s+/).join(' ') + ' '; \
+        var href = abs(link.getAttribute('href')); \
+        if (rel.indexOf(' stylesheet ') >= 0) { \
+            link.setAttribute('href', href); \
+            link.setAttribute('data-servo-scraper-sheet', sheets.push(href) - 1); \
+        } else if (rel.indexOf(' icon ') >= 0) image(link, 'href', href); \
+        else if (/ (preload|modulepreload|prefetch|preconnect|dns-prefetch) /.test(rel)) link.remove(); \
+        else link.setAttribute('href', href); \
+    }); \
+    clone.querySelectorAll('style').forEach(function(s) { \
+        s.setAttribute('data-servo-scraper-style', styles.push(s.textContent) - 1); \
+    }); \
+    clone.querySelectorAll('[style]').forEach(function(el) { \
+        var v = el.getAttribute('style'); \
+        if (v.toLowerCase().indexOf('url(') >= 0) el.setAttribute('data-servo-scraper-attr', attrs.push(v) - 1); \
+    }); \
+    clone.querySelectorAll('[poster]').forEach(function(el) { image(el, 'poster', abs(el.getAttribute('poster'))); }); \
+    clone.querySelectorAll('input[src]').forEach(function(el) { image(el, 'src', abs(el.getAttribute('src'))); }); \
+    clone.querySelectorAll('iframe[src], video[src], audio[src], source[src], track[src], embed[src]') \
+        .forEach(function(el) { el.setAttribute('src', abs(el.getAttribute('src'))); }); \
+    clone.querySelectorAll('a[href], area[href], form[action]').forEach(function(el) { \
+        var name = el.hasAttribute('href') ? 'href' : 'action', v = el.getAttribute(name); \
+        if (v.charAt(0) !== '#') el.setAttribute(name, abs(v)); \
+    }); \
+    [clone].concat(Array.from(clone.querySelectorAll('*'))).forEach(function(el) { \
+        Array.from(el.attributes).forEach(function(a) { \
+            if (/^on/i.test(a.name)) el.removeAttribute(a.name); \
+        }); \
+    }); \
+    var head = clone.querySelector('head'); \
+    if (head) { \
+        var meta = doc.createElement('meta'); \
+        meta.setAttribute('charset', 'utf-8'); \
+        head.insertBefore(meta, head.firstChild); \
+    } \
+    Object.defineProperty(window, '__servoScraperSingleFile', \
+        {value: clone, configurable: true, writable: true}); \
+    return JSON.stringify({base: document.baseURI, images: images, sheets: sheets, \
+        styles: styles, attrs: attrs}); \
+})()";
+
+/// Second half of `single_file()`, called with `{images: {url: dataUri},
+/// sheets, styles, attrs}`: applies the inlined assets to the clone and
+/// serializes it. A `null` sheet keeps its `<link>`.
+const SINGLE_FILE_APPLY_JS: &str = "function(r) { \
+    var clone = window.__servoScraperSingleFile; \
+    if (!clone) return null; \
+    delete window.__servoScraperSingleFile; \
+    function take(el, name) { var i = el.getAttribute(name); el.removeAttribute(name); return i; } \
+    clone.querySelectorAll('[data-servo-scraper-sheet]').forEach(function(link) { \
+        var css = r.sheets[take(link, 'data-servo-scraper-sheet')]; \
+        if (css === null || css === undefined) return; \
+        var style = link.ownerDocument.createElement('style'); \
+        if (link.hasAttribute('media')) style.setAttribute('media', link.getAttribute('media')); \
+        style.textContent = css; \
+        link.replaceWith(style); \
+    }); \
+    clone.querySelectorAll('[data-servo-scraper-style]').forEach(function(s) { \
+        s.textContent = r.styles[take(s, 'data-servo-scraper-style')]; \
+    }); \
+    clone.querySelectorAll('[data-servo-scraper-attr]').forEach(function(el) { \
+        el.setAttribute('style', r.attrs[take(el, 'data-servo-scraper-attr')]); \
+    }); \
+    clone.querySelectorAll('img[src], input[src], link[href], [poster]').forEach(function(el) { \
+        ['src', 'href', 'poster'].forEach(function(name) { \
+            var v = el.getAttribute(name); \
+            if (v !== null && Object.prototype.hasOwnProperty.call(r.images, v)) \
+                el.setAttribute(name, r.images[v]); \
+        }); \
+    }); \
+    return (document.doctype ? '<!DOCTYPE ' + document.doctype.name + '>\\n' : '') + clone.outerHTML; \
+}";
+
+/// Lists the fonts the document renders with for `used_fonts()`, as JSON
+/// `RecordedFont`s. Servo does not expose its font matching, so each
+/// rendered element's `font-family` stack is resolved here: generic families
+/// always match, web fonts when `document.fonts` reports them loaded (or, if
+/// it cannot tell, when they render), other families when a probe span
+/// measures differently from all of `monospace`, `serif` and `sans-serif`.
+/// Per-glyph fallback within a family is not visible. Web fonts declared by
+/// `@font-face` but never used are listed with 0 elements.
+const USED_FONTS_JS: &str = "(function() { \
+    var body = document.body; \
+    if (!body) return '[]'; \
+    var generic = ['serif', 'sans-serif', 'monospace', 'cursive', 'fantasy', 'system-ui', \
+        'ui-serif', 'ui-sans-serif', 'ui-monospace', 'ui-rounded', 'math', 'emoji', 'fangsong']; \
+    function unquote(f) { \
+        f = f.trim(); \
+        var q = f.charAt(0); \
+        return (q === '\"' || q === \"'\") && f.length > 1 && f.charAt(f.length - 1) === q ? f.slice(1, -1) : f; \
+    } \
+    var web = {}; \
+    function declare(family, status) { \
+        var key = family.toLowerCase(), w = web[key] || (web[key] = {family: family, status: null}); \
+        if (status && w.status !== 'loaded') w.status = status; \
+    } \
+    function addRules(rules) { \
+        Array.prototype.forEach.call(rules || [], function(rule) { \
+            if (rule.type === 5) { \
+                var family = unquote(rule.style.getPropertyValue('font-family')); \
+                if (family) declare(family, null); \
+            } else if (rule.styleSheet) { \
+                try { addRules(rule.styleSheet.cssRules); } catch (e) {} \
+            } else if (rule.cssRules) addRules(rule.cssRules); \
+        }); \
+    } \
+    Array.prototype.forEach.call(document.styleSheets, function(sheet) { \
+        try { addRules(sheet.cssRules); } catch (e) {} \
+    }); \
+    try { document.fonts.forEach(function(face) { declare(unquote(face.family), face.status); }); } catch (e) {} \
+    var probe = document.createElement('span'); \
+    probe.textContent = 'mmmmmmmmmmlli WwQq@#0123'; \
+    probe.style.cssText = 'position: absolute; left: -9999px; top: 0; font-size: 72px; \
+        white-space: nowrap; visibility: hidden'; \
+    body.appendChild(probe); \
+    function width(stack) { probe.style.fontFamily = stack; return probe.getBoundingClientRect().width; } \
+    var bases = ['monospace', 'serif', 'sans-serif'], baseWidths = bases.map(width), measured = {}; \
+    function renders(family) { \
+        var key = 'f:' + family; \
+        if (!(key in measured)) measured[key] = bases.some(function(b, i) { \
+            return width(JSON.stringify(family) + ', ' + b) !== baseWidths[i]; \
+        }); \
+        return measured[key]; \
+    } \
+    function resolve(stack) { \
+        var skipped = [], families = stack.split(',').map(unquote).filter(Boolean); \
+        for (var i = 0; i < families.length; i++) { \
+            var f = families[i], key = f.toLowerCase(), w = web[key]; \
+            if (generic.indexOf(key) >= 0) return {family: key, source: 'generic', skipped: skipped}; \
+            if (w ? w.status === 'loaded' || (w.status !== 'error' && renders(f)) : renders(f)) \
+                return {family: w ? w.family : f, source: w ? 'web' : 'system', skipped: skipped}; \
+            skipped.push(f); \
+        } \
+        return {family: null, source: 'default', skipped: skipped}; \
+    } \
+    var resolved = {}, used = {}, order = []; \
+    function entry(family, source) { \
+        var key = source + ':' + String(family).toLowerCase(); \
+        if (!used[key]) { \
+            used[key] = {family: family, source: source, status: null, elements: 0, fallback_for: []}; \
+            order.push(key); \
+        } \
+        return used[key]; \
+    } \
+    [body].concat(Array.from(body.querySelectorAll('*'))).forEach(function(el) { \
+        if (el === probe || !el.getClientRects().length) return; \
+        if (!Array.prototype.some.call(el.childNodes, function(n) { \
+            return n.nodeType === 3 && /\\S/.test(n.data); \
+        })) return; \
+        var stack = getComputedStyle(el).fontFamily; \
+        var r = resolved['s:' + stack] || (resolved['s:' + stack] = resolve(stack)); \
+        var e = entry(r.family, r.source); \
+        e.elements++; \
+        r.skipped.forEach(function(f) { if (e.fallback_for.indexOf(f) < 0) e.fallback_for.push(f); }); \
+    }); \
+    Object.keys(web).forEach(function(key) { \
+        var w = web[key]; \
+        entry(w.family, 'web').status = w.status || (renders(w.family) ? 'loaded' : 'unavailable'); \
+    }); \
+    probe.remove(); \
+    return JSON.stringify(order.map(function(key) { return used[key]; })); \
+})()";
+
+/// A font as reported by `USED_FONTS_JS`.
+#[derive(Deserialize)]
+struct RecordedFont {
+    family: Option<String>,
+    source: String,
+    status: Option<String>,
+    elements: u32,
+    fallback_for: Vec<String>,
+}
+
+/// Sets `document.cookie`, bypassing the setter installed by
+/// `set_cookie_policy()` when present.
+const SET_COOKIE_JS: &str = "(window.__servoScraperSetCookie || \
+    function(c) { document.cookie = c; })";
+
+/// `cookie` with its `SameSite` attributes replaced by `same_site`.
+fn cookie_with_same_site(cookie: &str, same_site: SameSite) -> String {
+    let mut parts = cookie.split(';').map(str::trim);
+    let mut out = vec![parts.next().unwrap_or_default()];
+    out.extend(parts.filter(|attr| {
+        let name = attr.split('=').next().unwrap_or_default().trim();
+        !name.eq_ignore_ascii_case("samesite")
+    }));
+    let secure = out[1..]
+        .iter()
+        .any(|attr| attr.eq_ignore_ascii_case("secure"));
+    let value = match same_site {
+        SameSite::None => {
+            if !secure {
+                log::warn!("cookie {cookie:?} has SameSite=None without Secure");
+            }
+            "SameSite=None"
+        }
+        SameSite::Lax => "SameSite=Lax",
+        SameSite::Strict => "SameSite=Strict",
+    };
+    out.push(value);
+    out.join("; ")
+}
+
+/// Init script reporting parsed markup through the console: each
+/// `MutationObserver` batch sends the `outerHTML` of newly inserted elements
+/// (and the text of inserted text nodes) not already covered by an inserted
+/// ancestor, prefixed with `marker`.
+fn html_stream_recorder(marker: &str) -> String {
+    format!(
+        "(function(marker) {{ \
+            var send = console.debug.bind(console); \
+            new MutationObserver(function(records) {{ \
+                var added = new Set(); \
+                records.forEach(function(r) {{ r.addedNodes.forEach(function(n) {{ added.add(n); }}); }}); \
+                var chunk = ''; \
+                added.forEach(function(n) {{ \
+                    for (var p = n.parentNode; p; p = p.parentNode) if (added.has(p)) return; \
+                    if (!n.isConnected) return; \
+                    if (n.nodeType === 1) chunk += n.outerHTML; \
+                    else if (n.nodeType === 3) chunk += n.data; \
+                }}); \
+                if (chunk) send(marker + chunk); \
+            }}).observe(document, {{childList: true, subtree: true}}); \
+        }})({})",
+        js_string_literal(marker)
+    )
+}
+
+/// A console prefix page scripts cannot guess, for `html_stream_recorder()`.
+fn random_marker() -> String {
+    use std::hash::{BuildHasher, Hasher};
+
+    let mut hasher = RandomState::new().build_hasher();
+    hasher.write_u128(
+        SystemTime::now()
+            .duration_since(SystemTime::UNIX_EPOCH)
+            .map_or(0, |d| d.as_nanos()),
+    );
+    format!("__servoScraperHtml{:016x}:", hasher.finish())
+}
+
+/// Bounds of [`PageEngine::set_zoom`], matching Servo's own zoom limits.
+const MIN_ZOOM: f32 = 0.1;
+const MAX_ZOOM: f32 = 8.0;
+
+/// Largest factor [`PageEngine::screenshot_scales`] accepts. Real displays
+/// stop around 4x; 8x of a 1280x720 viewport is already a 10240x5760 surface.
+const MAX_SCALE_FACTOR: f32 = 8.0;
+
+/// Tag fixed and sticky elements as overlays for the layer stylesheets.
+const LAYER_MARK_JS: &str = "(function() { \
+    document.querySelectorAll('body *').forEach(function(el) { \
+        var p = getComputedStyle(el).position; \
+        if (p === 'fixed' || p === 'sticky') el.setAttribute('data-servo-scraper-overlay', ''); \
+    }); \
+})()";
+
+/// Drop the layer stylesheet and overlay tags.
+const LAYER_CLEANUP_JS: &str = "(function() { \
+    var s = document.getElementById('__servoScraperLayer'); \
+    if (s) s.remove(); \
+    document.querySelectorAll('[data-servo-scraper-overlay]').forEach(function(el) { \
+        el.removeAttribute('data-servo-scraper-overlay'); \
+    }); \
+})()";
+
+const LAYER_HIDE_OVERLAYS: &str = "[data-servo-scraper-overlay] { visibility: hidden !important; }";
+const LAYER_HIDE_MEDIA: &str = "img, picture, svg, video, canvas, iframe, object, embed \
+    { visibility: hidden !important; }";
+const LAYER_HIDE_TEXT: &str = "*, *::before, *::after { color: transparent !important; \
+    text-shadow: none !important; text-decoration-color: transparent !important; \
+    caret-color: transparent !important; }";
+const LAYER_HIDE_BOXES: &str = "*, *::before, *::after { \
+    background-color: transparent !important; background-image: none !important; \
+    border-color: transparent !important; outline-color: transparent !important; \
+    box-shadow: none !important; }";
+const LAYER_ONLY_OVERLAYS: &str = "body * { visibility: hidden !important; } \
+    [data-servo-scraper-overlay], [data-servo-scraper-overlay] * \
+    { visibility: visible !important; } \
+    body { background: transparent !important; }";
+
+/// Init script capturing downloads, installed by `set_download_capture()`.
+/// Clicks on `<a download>` links (and `click()` on detached ones, the usual
+/// blob-export pattern) are cancelled and the target is fetched into a
+/// per-document queue instead, since Servo has no download manager.
+const DOWNLOAD_RECORDER: &str = "(function() { \
+    if (window.__servoScraperDownloads) return; \
+    var queue = []; \
+    Object.defineProperty(window, '__servoScraperDownloads', {value: queue}); \
+    function fileName(a, resp) { \
+        var name = a.getAttribute('download'); \
+        if (name) return name; \
+        var cd = resp.headers.get('content-disposition') || ''; \
+        var m = /filename\\*?=(?:UTF-8'')?\"?([^\";]+)\"?/i.exec(cd); \
+        if (m) { try { return decodeURIComponent(m[1]); } catch (e) { return m[1]; } } \
+        var path = new URL(a.href).pathname; \
+        return path.substring(path.lastIndexOf('/') + 1) || 'download'; \
+    } \
+    function capture(a) { \
+        var entry = {url: a.href, done: false}; \
+        queue.push(entry); \
+        fetch(a.href).then(function(resp) { \
+            if (!resp.ok) throw new Error('HTTP ' + resp.status); \
+            entry.filename = fileName(a, resp); \
+            return resp.arrayBuffer(); \
+        }).then(function(buf) { \
+            var bytes = new Uint8Array(buf), bin = ''; \
+            for (var i = 0; i < bytes.length; i += 0x8000) \
+                bin += String.fromCharCode.apply(null, bytes.subarray(i, i + 0x8000)); \
+            entry.data = btoa(bin); \
+            entry.done = true; \
+        }).catch(function(e) { \
+            entry.error = String(e); \
+            entry.done = true; \
+        }); \
+    } \
+    document.addEventListener('click', function(e) { \
+        var a = e.target && e.target.closest ? e.target.closest('a[download]') : null; \
+        if (a && a.href) { e.preventDefault(); capture(a); } \
+    }, true); \
+    var click = HTMLAnchorElement.prototype.click; \
+    HTMLAnchorElement.prototype.click = function() { \
+        if (!this.isConnected && this.hasAttribute('download') && this.href) { \
+            capture(this); \
+            return; \
+        } \
+        return click.call(this); \
+    }; \
+})()";
+
+/// `[loaded, failed, pending]` counts of the document's `<img>` elements for
+/// `wait_for_images()`. Images without a source are skipped; a complete image
+/// without natural size is broken.
+const IMAGE_STATUS_JS: &str = "(function() { \
+    var counts = [0, 0, 0]; \
+    Array.prototype.forEach.call(document.images, function(img) { \
+        if (!img.currentSrc && !img.getAttribute('src')) return; \
+        if (!img.complete) counts[2]++; \
+        else if (img.naturalWidth > 0) counts[0]++; \
+        else counts[1]++; \
+    }); \
+    return counts; \
+})()";
+
+/// Remove and return the oldest finished download recorded by `DOWNLOAD_RECORDER`.
+const DOWNLOAD_TAKE: &str = "(function() { \
+    var q = window.__servoScraperDownloads || []; \
+    for (var i = 0; i < q.length; i++) { \
+        if (q[i].done) return JSON.stringify(q.splice(i, 1)[0]); \
+    } \
+    return null; \
+})()";
+
+/// A download as recorded by `DOWNLOAD_RECORDER`.
+#[derive(Deserialize)]
+struct RecordedDownload {
+    url: String,
+    filename: Option<String>,
+    data: Option<String>,
+    error: Option<String>,
+}
+
 // ---------------------------------------------------------------------------
 // Internal: Per-page state
 // ---------------------------------------------------------------------------
@@ -617,6 +2671,8 @@ struct PageState {
     delegate: Rc<PageDelegate>,
     width: u32,
     height: u32,
+    /// Opened by a page (`window.open()`, `target="_blank"`), not `new_page()`.
+    popup: bool,
 }
 
 // ===========================================================================
@@ -635,12 +2691,24 @@ pub struct PageEngine {
     next_page_id: u32,
     popup_buffer: Rc<RefCell<Vec<PendingPopup>>>,
     popup_enabled: Rc<Cell<bool>>,
+    shared: Rc<EngineShared>,
+    /// Keyed scripts registered with the user content manager.
+    init_scripts: HashMap<&'static str, Rc<UserScript>>,
+    /// Details of the most recent failed `evaluate()` call.
+    last_js_error: RefCell<Option<JsErrorDetails>>,
     options: PageOptions,
 }
 
 impl PageEngine {
     /// Create a new page engine with the given options.
     pub fn new(options: PageOptions) -> Result<Self, PageError> {
+        if let Some(ref dir) = options.cache_dir {
+            ensure_writable_dir(dir).map_err(|e| {
+                PageError::InitFailed(format!("cache directory {}: {e}", dir.display()))
+            })?;
+        }
+        claim_config_dir(&options.cache_dir)?;
+
         resources::set(Box::new(EmbeddedResourceReader));
 
         rustls::crypto::aws_lc_rs::default_provider()
@@ -651,6 +2719,12 @@ impl PageEngine {
         let waker = event_loop.create_waker();
 
         let mut builder = ServoBuilder::default().event_loop_waker(waker);
+        if let Some(ref dir) = options.cache_dir {
+            builder = builder.opts(servo::opts::Opts {
+                config_dir: Some(dir.clone()),
+                ..Default::default()
+            });
+        }
         if let Some(ref ua) = options.user_agent {
             builder = builder.preferences(Preferences {
                 user_agent: ua.clone(),
@@ -660,6 +2734,30 @@ impl PageEngine {
         let servo = builder.build();
         servo.setup_logging();
 
+        let shared = Rc::new(EngineShared {
+            network: NetworkConditions::default(),
+            user_content_manager: Rc::new(UserContentManager::new(&servo)),
+            request_interceptor: RefCell::new(None),
+            progress_callback: RefCell::new(None),
+            html_stream_callback: RefCell::new(None),
+            html_stream_marker: random_marker(),
+            user_agent: options.user_agent.clone(),
+            fetch_timeout: Duration::from_secs(options.timeout),
+            allow_file_access: Cell::new(false),
+            max_image_pixels: Cell::new(DEFAULT_MAX_IMAGE_PIXELS),
+            cookie_policy: Cell::new(CookiePolicy::AcceptAll),
+            download_capture: Cell::new(false),
+        });
+        shared
+            .user_content_manager
+            .add_script(Rc::new(UserScript::new(
+                JS_ERROR_RECORDER.to_string(),
+                None,
+            )));
+        shared
+            .user_content_manager
+            .add_script(Rc::new(UserScript::new(LCP_RECORDER.to_string(), None)));
+
         Ok(Self {
             servo,
             event_loop,
@@ -668,6 +2766,9 @@ impl PageEngine {
             next_page_id: 0,
             popup_buffer: Rc::new(RefCell::new(Vec::new())),
             popup_enabled: Rc::new(Cell::new(false)),
+            shared,
+            init_scripts: HashMap::new(),
+            last_js_error: RefCell::new(None),
             options,
         })
     }
@@ -704,6 +2805,7 @@ impl PageEngine {
         let delegate = Rc::new(PageDelegate::new(
             self.popup_buffer.clone(),
             self.popup_enabled.clone(),
+            self.shared.clone(),
             width,
             height,
         ));
@@ -719,22 +2821,60 @@ impl PageEngine {
                 delegate,
                 width,
                 height,
+                popup: false,
             },
         );
 
         Ok(id)
     }
 
+    /// Install, replace, or (with `None`) remove a keyed init script. Init scripts
+    /// run before page scripts on every subsequent navigation of every page. The
+    /// script is also evaluated once in the active page so the current document
+    /// picks it up without a reload.
+    fn set_init_script(&mut self, key: &'static str, source: Option<String>) {
+        let ucm = &self.shared.user_content_manager;
+        if let Some(old) = self.init_scripts.remove(key) {
+            ucm.remove_script(old);
+        }
+        if let Some(source) = source {
+            if let Ok(webview) = self.webview() {
+                let _ = eval_js(
+                    &self.servo,
+                    &self.event_loop,
+                    webview,
+                    &source,
+                    self.options.timeout,
+                );
+            }
+            let script = Rc::new(UserScript::new(source, None));
+            ucm.add_script(script.clone());
+            self.init_scripts.insert(key, script);
+        }
+    }
+
     /// Wait for the current load to complete (spin until `load_complete` + idle wait).
     fn wait_for_load(&self) -> Result<(), PageError> {
         let page = self.active_page()?;
         let delegate_rc = page.delegate.clone();
         let delegate_rc2 = delegate_rc.clone();
+        let callback = self.shared.progress_callback.borrow().clone();
+        let last_report = Cell::new(None);
+        let report = |progress: LoadProgress| {
+            if let Some(callback) = &callback {
+                if last_report.replace(Some(progress)) != Some(progress) {
+                    callback(&progress);
+                }
+            }
+        };
         let loaded = with_stderr_suppressed(|| {
             let loaded = spin_until(
                 &self.servo,
                 &self.event_loop,
-                move || delegate_rc2.load_complete.get(),
+                || {
+                    report(delegate_rc2.progress(false));
+                    delegate_rc2.load_complete.get()
+                },
                 self.options.timeout,
             );
 
@@ -748,10 +2888,22 @@ impl PageEngine {
                 );
             }
 
+            if loaded {
+                report(delegate_rc.progress(true));
+            }
             loaded
         });
 
         if !loaded {
+            // Keep the WebView: flush pending paints so whatever has rendered
+            // so far is available to html()/screenshot() after the timeout.
+            wait_for_idle(
+                &self.servo,
+                &self.event_loop,
+                &delegate_rc,
+                Duration::from_millis(100),
+                Duration::from_secs(1),
+            );
             return Err(PageError::Timeout);
         }
 
@@ -760,9 +2912,27 @@ impl PageEngine {
 
     /// Open a URL. Creates a new WebView or navigates the existing one.
     /// If no pages exist, auto-creates page 0 and makes it active (backward compat).
+    ///
+    /// `Err(Timeout)` is a warning, not a failure: the page stays open and
+    /// reflects whatever had loaded and rendered before the deadline, so
+    /// `html()`, `evaluate()` and `screenshot()` still work on it.
     pub fn open(&mut self, url: &str) -> Result<(), PageError> {
         let parsed_url =
             Url::parse(url).map_err(|e| PageError::LoadFailed(format!("invalid URL: {e}")))?;
+        match parsed_url.scheme() {
+            "http" | "https" | "data" | "about" => {}
+            "file" if self.shared.allow_file_access.get() => {}
+            "file" => {
+                return Err(PageError::LoadFailed(
+                    "file: URLs are disabled (enable with set_allow_file_access)".to_string(),
+                ));
+            }
+            other => {
+                return Err(PageError::LoadFailed(format!(
+                    "unsupported URL scheme: {other}"
+                )));
+            }
+        }
 
         // Auto-create page 0 if no pages exist (backward compatibility).
         if self.pages.is_empty() {
@@ -775,13 +2945,14 @@ impl PageEngine {
             .get_mut(&self.active_page_id.ok_or(PageError::NoPage)?)
             .ok_or(PageError::NoPage)?;
 
-        page.delegate.load_complete.set(false);
+        page.delegate.start_navigation();
 
         if let Some(ref webview) = page.webview {
             webview.load(parsed_url);
         } else {
             let webview = WebViewBuilder::new(&self.servo, page.rendering_context.clone())
                 .delegate(page.delegate.clone())
+                .user_content_manager(self.shared.user_content_manager.clone())
                 .url(parsed_url)
                 .build();
             page.webview = Some(webview);
@@ -790,39 +2961,318 @@ impl PageEngine {
         self.wait_for_load()
     }
 
+    /// Load `html` as the active page's document and wait for it like
+    /// [`open()`](Self::open), e.g. to render a template without serving it.
+    ///
+    /// With an HTTP(S) `base_url` the document is answered in place of the
+    /// navigation to that URL, so it gets the URL's origin and relative
+    /// assets resolve against it; nothing is requested for the document
+    /// itself. Without one it is loaded as a `data:` URL, where only
+    /// absolute URLs work.
+    pub fn load_html(&mut self, html: &str, base_url: Option<&str>) -> Result<(), PageError> {
+        use base64::Engine as _;
+
+        let Some(base_url) = base_url else {
+            let b64 = base64::engine::general_purpose::STANDARD.encode(html);
+            return self.open(&format!("data:text/html;charset=utf-8;base64,{b64}"));
+        };
+        let mut url = Url::parse(base_url)
+            .map_err(|e| PageError::InvalidArgument(format!("invalid base URL: {e}")))?;
+        if !matches!(url.scheme(), "http" | "https") {
+            return Err(PageError::InvalidArgument(format!(
+                "base URL must be http or https: {base_url}"
+            )));
+        }
+        url.set_fragment(None);
+
+        if self.pages.is_empty() {
+            let id = self.create_page_internal(self.options.width, self.options.height)?;
+            self.active_page_id = Some(id);
+        }
+        *self.active_delegate()?.pending_html.borrow_mut() = Some((url, html.to_string()));
+        let result = self.open(base_url);
+        if let Ok(delegate) = self.active_delegate() {
+            delegate.pending_html.borrow_mut().take();
+        }
+        result
+    }
+
+    /// Make `url` the current document's base URL without navigating, so
+    /// relative URLs in later extraction calls (`links_detailed()`,
+    /// `resources()`, `a.href` in scripts) resolve against it — e.g. for
+    /// HTML loaded through a proxy or as a fragment.
+    ///
+    /// The first `<base href>` is rewritten, or one is inserted at the top of
+    /// `<head>`, so it shows up in `html()`. Resources already loaded are not
+    /// fetched again, and the next navigation drops the override.
+    pub fn set_base_url(&self, url: &str) -> Result<(), PageError> {
+        let parsed = Url::parse(url)
+            .map_err(|e| PageError::InvalidArgument(format!("invalid base URL: {e}")))?;
+        if parsed.cannot_be_a_base() {
+            return Err(PageError::InvalidArgument(format!(
+                "URL cannot be a base: {url}"
+            )));
+        }
+        let webview = self.webview()?;
+        let js = format!(
+            "(function(href) {{ \
+                var root = document.documentElement; \
+                if (!root) return false; \
+                var base = document.querySelector('base[href]'); \
+                if (!base) {{ \
+                    var head = document.head || root; \
+                    base = document.createElement('base'); \
+                    head.insertBefore(base, head.firstChild); \
+                }} \
+                base.setAttribute('href', href); \
+                return true; \
+            }})({})",
+            js_string_literal(parsed.as_str())
+        );
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &js,
+            self.options.timeout,
+        )? {
+            JSValue::Boolean(true) => Ok(()),
+            JSValue::Boolean(false) => Err(PageError::JsError(
+                "document has no element to hold a <base>".into(),
+            )),
+            other => Err(PageError::JsError(format!(
+                "unexpected set_base_url result: {other:?}"
+            ))),
+        }
+    }
+
     /// Evaluate JavaScript and return the result as a JSON string.
+    ///
+    /// On `JsError`, [`last_js_error()`](Self::last_js_error) describes the failure.
     pub fn evaluate(&self, script: &str) -> Result<String, PageError> {
+        self.evaluate_in_world(script, JsWorld::Main)
+    }
+
+    /// Run JavaScript in the given world and return the result as a JSON string.
+    ///
+    /// In [`JsWorld::Isolated`], `var`/`let`/`function` declarations never
+    /// reach page globals; helpers shared between isolated calls are stored on
+    /// `world` (e.g. `world.extract = function() { ... }`). That keeps names
+    /// from colliding but does not hide the script from a hostile page.
+    pub fn evaluate_in_world(&self, script: &str, world: JsWorld) -> Result<String, PageError> {
+        self.last_js_error.replace(None);
         let webview = self.webview()?;
-        let value = eval_js(
+        // Discard anything the page threw earlier (e.g. from a timer), so a
+        // failure below is only ever blamed on this script.
+        let _ = eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            JS_ERROR_TAKE,
+            self.options.timeout,
+        );
+        let wrapped;
+        let script = match world {
+            JsWorld::Main => script,
+            JsWorld::Isolated => {
+                wrapped = isolated_world_script(script);
+                &wrapped
+            }
+        };
+        let result = eval_js(
             &self.servo,
             &self.event_loop,
             webview,
             script,
             self.options.timeout,
-        )?;
-        Ok(jsvalue_to_json(&value))
+        );
+        match result {
+            Ok(value) => Ok(jsvalue_to_json(&value)),
+            Err(PageError::JsError(detail)) => {
+                let details = self.js_error_details(webview, &detail);
+                self.last_js_error.replace(Some(details));
+                Err(PageError::JsError(detail))
+            }
+            Err(e) => Err(e),
+        }
     }
 
-    /// Take a screenshot of the current viewport (PNG bytes).
-    pub fn screenshot(&self) -> Result<Vec<u8>, PageError> {
-        let webview = self.webview()?;
-        take_screenshot_bytes(&self.servo, &self.event_loop, webview, self.options.timeout)
+    /// Details of the exception that made the last `evaluate()` call fail, or
+    /// `None` if it succeeded. `kind` tells syntax errors (`CompilationFailure`)
+    /// apart from thrown exceptions (`EvaluationFailure`).
+    pub fn last_js_error(&self) -> Option<JsErrorDetails> {
+        self.last_js_error.borrow().clone()
     }
 
-    /// Take a full-page screenshot (PNG bytes).
-    pub fn screenshot_fullpage(&self) -> Result<Vec<u8>, PageError> {
-        let webview = self.webview()?;
-        let page = self.active_page()?;
-        let js = "Math.max(document.documentElement.scrollHeight, document.body.scrollHeight)";
-        if let Ok(JSValue::Number(doc_height)) = eval_js(
+    /// Combine Servo's failure kind with the exception captured in the page.
+    fn js_error_details(&self, webview: &WebView, detail: &str) -> JsErrorDetails {
+        let kind: String = detail
+            .chars()
+            .take_while(|c| c.is_ascii_alphanumeric())
+            .collect();
+        let recorded = match eval_js(
             &self.servo,
             &self.event_loop,
             webview,
-            js,
+            JS_ERROR_TAKE,
             self.options.timeout,
         ) {
-            let mut doc_height = doc_height as u32;
-            if doc_height > page.height {
+            Ok(JSValue::String(json)) => serde_json::from_str::<RecordedJsError>(&json).ok(),
+            _ => None,
+        };
+        match recorded {
+            Some(info) => JsErrorDetails {
+                kind,
+                name: info.name,
+                message: info.message.unwrap_or_else(|| detail.to_string()),
+                stack: info.stack,
+            },
+            None => JsErrorDetails {
+                kind,
+                name: None,
+                message: detail.to_string(),
+                stack: None,
+            },
+        }
+    }
+
+    /// Take a screenshot of the current viewport (PNG bytes).
+    pub fn screenshot(&self) -> Result<Vec<u8>, PageError> {
+        let webview = self.webview()?;
+        take_screenshot_bytes(&self.servo, &self.event_loop, webview, self.options.timeout)
+    }
+
+    /// Take a screenshot as uncompressed RGBA pixels, skipping the PNG
+    /// encoding, e.g. to hand the frame straight to an image-processing
+    /// library.
+    pub fn screenshot_raw(&self) -> Result<RawImage, PageError> {
+        let webview = self.webview()?;
+        let image =
+            take_screenshot_image(&self.servo, &self.event_loop, webview, self.options.timeout)?;
+        let (width, height) = image.dimensions();
+        Ok(RawImage {
+            width,
+            height,
+            stride: width as usize * 4,
+            data: image.into_raw(),
+        })
+    }
+
+    /// Perceptual hash of the rendered viewport, for spotting near-duplicate
+    /// pages: compare two hashes by the number of differing bits
+    /// (`(a ^ b).count_ones()`), where identical renders give 0 and a handful
+    /// of bits means the same layout with minor changes.
+    ///
+    /// The algorithm is the DCT-based pHash: the screenshot is converted to
+    /// greyscale and scaled to 32×32, and each of the 64 lowest-frequency DCT
+    /// coefficients contributes a bit that is set when it is above their median.
+    pub fn screenshot_phash(&self) -> Result<u64, PageError> {
+        let webview = self.webview()?;
+        let image =
+            take_screenshot_image(&self.servo, &self.event_loop, webview, self.options.timeout)?;
+        Ok(perceptual_hash(&image))
+    }
+
+    /// Take a full-page screenshot (PNG bytes).
+    pub fn screenshot_fullpage(&self) -> Result<Vec<u8>, PageError> {
+        encode_png(&self.capture_fullpage()?)
+    }
+
+    /// Screenshot the full-width band from the top of the first element
+    /// matching `start_selector` to the bottom of the first matching
+    /// `end_selector` (PNG bytes), e.g. a section from one heading to the
+    /// next. If the end element comes first, the band spans from its top to
+    /// the bottom of the start element instead. Like
+    /// [`screenshot_fullpage()`](Self::screenshot_fullpage), the page is left
+    /// resized to the document height.
+    pub fn screenshot_between(
+        &self,
+        start_selector: &str,
+        end_selector: &str,
+    ) -> Result<Vec<u8>, PageError> {
+        let webview = self.webview()?;
+        // Measure at the final size, so viewport-relative layout matches the
+        // captured image.
+        self.resize_to_document()?;
+        let js = format!(
+            "(function(a, b) {{ \
+                var start = document.querySelector(a), end = document.querySelector(b); \
+                if (!start) return 0; \
+                if (!end) return 1; \
+                var s = start.getBoundingClientRect(), e = end.getBoundingClientRect(); \
+                return [Math.min(s.top, e.top) + window.scrollY, \
+                        Math.max(s.bottom, e.bottom) + window.scrollY, window.innerWidth]; \
+            }})({}, {})",
+            js_string_literal(start_selector),
+            js_string_literal(end_selector),
+        );
+        let (top, bottom, css_width) = match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &js,
+            self.options.timeout,
+        )? {
+            JSValue::Number(n) => {
+                let missing = if n == 0.0 {
+                    start_selector
+                } else {
+                    end_selector
+                };
+                return Err(PageError::SelectorNotFound(missing.to_string()));
+            }
+            JSValue::Array(arr) => match arr.as_slice() {
+                [JSValue::Number(t), JSValue::Number(b), JSValue::Number(w)] => (*t, *b, *w),
+                _ => return Err(PageError::JsError("invalid section bounds".into())),
+            },
+            other => {
+                return Err(PageError::JsError(format!(
+                    "unexpected section bounds: {other:?}"
+                )));
+            }
+        };
+
+        let image =
+            take_screenshot_image(&self.servo, &self.event_loop, webview, self.options.timeout)?;
+        // Device pixels per CSS pixel, which differs from 1 under zoom.
+        let scale = if css_width > 0.0 {
+            f64::from(image.width()) / css_width
+        } else {
+            1.0
+        };
+        let y = ((top.max(0.0) * scale).floor() as u32).min(image.height());
+        let end = ((bottom * scale).ceil().max(0.0) as u32).min(image.height());
+        if end <= y {
+            return Err(PageError::ScreenshotFailed(
+                "section has no visible height".into(),
+            ));
+        }
+        let band = image::imageops::crop_imm(&image, 0, y, image.width(), end - y).to_image();
+        encode_png(&band)
+    }
+
+    /// Resize the WebView to the document height and capture it.
+    fn capture_fullpage(&self) -> Result<image::RgbaImage, PageError> {
+        self.resize_to_document()?;
+        let webview = self.webview()?;
+        take_screenshot_image(&self.servo, &self.event_loop, webview, self.options.timeout)
+    }
+
+    /// Resize the WebView to the document height, if taller than the page,
+    /// and wait for the layout to settle.
+    fn resize_to_document(&self) -> Result<(), PageError> {
+        let webview = self.webview()?;
+        let page = self.active_page()?;
+        let js = "Math.max(document.documentElement.scrollHeight, document.body.scrollHeight)";
+        if let Ok(JSValue::Number(doc_height)) = eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            js,
+            self.options.timeout,
+        ) {
+            let mut doc_height = doc_height as u32;
+            if doc_height > page.height {
                 let new_size = PhysicalSize::new(page.width, doc_height);
                 webview.resize(new_size);
                 let got_frame = wait_for_frame(
@@ -875,25 +3325,682 @@ impl PageEngine {
                 }
             }
         }
-        take_screenshot_bytes(&self.servo, &self.event_loop, webview, self.options.timeout)
+        Ok(())
+    }
+
+    /// Take a screenshot of exactly the viewport (PNG bytes), even right after
+    /// [`screenshot_fullpage()`](Self::screenshot_fullpage) left the WebView
+    /// resized to the document height. The image is the page's viewport size.
+    pub fn screenshot_viewport(&self) -> Result<Vec<u8>, PageError> {
+        let webview = self.webview()?;
+        let page = self.active_page()?;
+        // The page size is in device pixels, while innerWidth is in CSS
+        // pixels and shrinks under zoom, so scale it back up.
+        let size = eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            "(function() { \
+                var dpr = window.devicePixelRatio || 1; \
+                return [Math.round(window.innerWidth * dpr), \
+                        Math.round(window.innerHeight * dpr)]; \
+            })()",
+            self.options.timeout,
+        )?;
+        let current = match &size {
+            JSValue::Array(dims) => match dims.as_slice() {
+                [JSValue::Number(w), JSValue::Number(h)] => Some((*w as u32, *h as u32)),
+                _ => None,
+            },
+            _ => None,
+        };
+        if current != Some((page.width, page.height)) {
+            webview.resize(PhysicalSize::new(page.width, page.height));
+            let got_frame = wait_for_frame(
+                &self.servo,
+                &self.event_loop,
+                &page.delegate,
+                Duration::from_secs(self.options.timeout),
+            );
+            if !got_frame {
+                return Err(PageError::ScreenshotFailed(
+                    "timed out waiting for repaint after resize".to_string(),
+                ));
+            }
+            wait_for_idle(
+                &self.servo,
+                &self.event_loop,
+                &page.delegate,
+                Duration::from_millis(100),
+                Duration::from_secs(self.options.timeout),
+            );
+        }
+        take_screenshot_bytes(&self.servo, &self.event_loop, webview, self.options.timeout)
+    }
+
+    /// Take one viewport screenshot per device-scale factor (PNG bytes each).
+    ///
+    /// The CSS viewport stays the same, so the layout is unchanged — only the
+    /// raster scale differs between outputs. Factors must be within
+    /// (0, 8]. The previous scale and size are restored afterwards, also
+    /// on failure.
+    pub fn screenshot_scales(&self, factors: &[f32]) -> Result<Vec<Vec<u8>>, PageError> {
+        if let Some(bad) = factors
+            .iter()
+            .find(|f| !f.is_finite() || **f <= 0.0 || **f > MAX_SCALE_FACTOR)
+        {
+            return Err(PageError::InvalidArgument(format!(
+                "scale factor must be within 0-{MAX_SCALE_FACTOR}, got {bad}"
+            )));
+        }
+        let webview = self.webview()?;
+        let page = self.active_page()?;
+        let previous_scale = webview.hidpi_scale_factor();
+        let previous_size = page.rendering_context.size();
+
+        let mut shots = Vec::with_capacity(factors.len());
+        let mut result = Ok(());
+        for &factor in factors {
+            webview.set_hidpi_scale_factor(Scale::<f32, DeviceIndependentPixel, DevicePixel>::new(
+                factor,
+            ));
+            webview.resize(PhysicalSize::new(
+                (page.width as f32 * factor).round() as u32,
+                (page.height as f32 * factor).round() as u32,
+            ));
+            let got_frame = wait_for_frame(
+                &self.servo,
+                &self.event_loop,
+                &page.delegate,
+                Duration::from_secs(self.options.timeout),
+            );
+            if !got_frame {
+                result = Err(PageError::ScreenshotFailed(format!(
+                    "timed out waiting for repaint at {factor}x"
+                )));
+                break;
+            }
+            wait_for_idle(
+                &self.servo,
+                &self.event_loop,
+                &page.delegate,
+                Duration::from_millis(100),
+                Duration::from_secs(self.options.timeout),
+            );
+            match take_screenshot_bytes(
+                &self.servo,
+                &self.event_loop,
+                webview,
+                self.options.timeout,
+            ) {
+                Ok(png) => shots.push(png),
+                Err(e) => {
+                    result = Err(e);
+                    break;
+                }
+            }
+        }
+
+        webview.set_hidpi_scale_factor(previous_scale);
+        webview.resize(previous_size);
+        let restored = wait_for_frame(
+            &self.servo,
+            &self.event_loop,
+            &page.delegate,
+            Duration::from_secs(self.options.timeout),
+        );
+        if !restored && result.is_ok() {
+            result = Err(PageError::ScreenshotFailed(
+                "timed out waiting for repaint after restoring the scale".to_string(),
+            ));
+        }
+
+        result.map(|()| shots)
+    }
+
+    /// Set the browser zoom of the active page, as with Ctrl+/Ctrl− in a
+    /// browser: unlike a device-scale factor, zoom shrinks the CSS viewport
+    /// (`window.innerWidth` at 1.25 is `width / 1.25`), so the page reflows and
+    /// media queries re-evaluate. Must be within 0.1–8.0; the default is 1.0.
+    /// The zoom belongs to the page and survives navigations.
+    pub fn set_zoom(&mut self, factor: f32) -> Result<(), PageError> {
+        if !factor.is_finite() || !(MIN_ZOOM..=MAX_ZOOM).contains(&factor) {
+            return Err(PageError::InvalidArgument(format!(
+                "zoom must be within {MIN_ZOOM}-{MAX_ZOOM}, got {factor}"
+            )));
+        }
+        let webview = self.webview()?;
+        let delegate = self.active_delegate()?;
+        webview.set_page_zoom(factor);
+        wait_for_frame(
+            &self.servo,
+            &self.event_loop,
+            delegate,
+            Duration::from_millis(500),
+        );
+        wait_for_idle(
+            &self.servo,
+            &self.event_loop,
+            delegate,
+            Duration::from_millis(100),
+            Duration::from_secs(self.options.timeout),
+        );
+        Ok(())
+    }
+
+    /// Get the browser zoom of the active page.
+    pub fn zoom(&self) -> Result<f32, PageError> {
+        Ok(self.webview()?.page_zoom())
+    }
+
+    /// Take a viewport screenshot at every `step_px` CSS pixels of vertical
+    /// scroll, from the top of the document to the bottom (PNG bytes each).
+    ///
+    /// The last frame is always the bottom of the page, so it may overlap the
+    /// previous one by less than a step. The document height is measured once
+    /// up front; content added while scrolling is not followed. The original
+    /// scroll position is restored afterwards.
+    pub fn screenshot_filmstrip(&self, step_px: u32) -> Result<Vec<Vec<u8>>, PageError> {
+        if step_px == 0 {
+            return Err(PageError::InvalidArgument(
+                "filmstrip step must be positive".into(),
+            ));
+        }
+        let webview = self.webview()?;
+        let delegate = self.active_delegate()?;
+
+        let js = "[window.scrollX, window.scrollY, \
+            Math.max(document.documentElement.scrollHeight, \
+                document.body ? document.body.scrollHeight : 0) - window.innerHeight]";
+        let (orig_x, orig_y, max_y) = match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            js,
+            self.options.timeout,
+        )? {
+            JSValue::Array(arr) => match arr.as_slice() {
+                [JSValue::Number(x), JSValue::Number(y), JSValue::Number(max)] => {
+                    (*x, *y, max.max(0.0).floor() as u32)
+                }
+                _ => return Err(PageError::JsError("invalid scroll metrics".into())),
+            },
+            other => {
+                return Err(PageError::JsError(format!(
+                    "unexpected scroll metrics: {other:?}"
+                )));
+            }
+        };
+
+        let mut frames = Vec::new();
+        let mut y = 0;
+        let result = loop {
+            if let Err(e) = eval_js(
+                &self.servo,
+                &self.event_loop,
+                webview,
+                &format!("window.scrollTo(0, {y})"),
+                self.options.timeout,
+            ) {
+                break Err(e);
+            }
+            wait_for_frame(
+                &self.servo,
+                &self.event_loop,
+                delegate,
+                Duration::from_millis(500),
+            );
+            wait_for_idle(
+                &self.servo,
+                &self.event_loop,
+                delegate,
+                Duration::from_millis(100),
+                Duration::from_secs(self.options.timeout),
+            );
+            match take_screenshot_bytes(
+                &self.servo,
+                &self.event_loop,
+                webview,
+                self.options.timeout,
+            ) {
+                Ok(png) => frames.push(png),
+                Err(e) => break Err(e),
+            }
+            if y >= max_y {
+                break Ok(());
+            }
+            y = y.saturating_add(step_px).min(max_y);
+        };
+
+        let _ = eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &format!("window.scrollTo({orig_x}, {orig_y})"),
+            self.options.timeout,
+        );
+        result.map(|()| frames)
+    }
+
+    /// Capture the viewport as separate layers: `background` (opaque: box
+    /// backgrounds, borders and background images), `text`, `images` (`<img>`,
+    /// `<svg>`, `<video>`, `<canvas>` and embedded frames) and `overlays`
+    /// (fixed and sticky elements). Each layer is produced by re-rendering the
+    /// page with a stylesheet hiding everything else; the transparent layers
+    /// are rendered over black and white and their alpha recovered from the
+    /// difference, so anti-aliased edges survive.
+    ///
+    /// Stacking the layers in order approximates the screenshot; content that
+    /// is both text and image (e.g. an SVG `<text>`) lands in one layer only.
+    pub fn export_layers(&self) -> Result<Vec<ImageLayer>, PageError> {
+        let webview = self.webview()?;
+        eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            LAYER_MARK_JS,
+            self.options.timeout,
+        )?;
+
+        let passes: [(&str, Vec<&str>, bool); 4] = [
+            (
+                "background",
+                vec![LAYER_HIDE_OVERLAYS, LAYER_HIDE_MEDIA, LAYER_HIDE_TEXT],
+                false,
+            ),
+            (
+                "text",
+                vec![LAYER_HIDE_OVERLAYS, LAYER_HIDE_MEDIA, LAYER_HIDE_BOXES],
+                true,
+            ),
+            (
+                "images",
+                vec![LAYER_HIDE_OVERLAYS, LAYER_HIDE_TEXT, LAYER_HIDE_BOXES],
+                true,
+            ),
+            ("overlays", vec![LAYER_ONLY_OVERLAYS], true),
+        ];
+
+        let mut layers = Vec::new();
+        let mut result = Ok(());
+        for (name, sheets, matte) in passes {
+            let css = sheets.join("\n");
+            let png = if matte {
+                self.render_layer(&format!("{css}\nhtml {{ background: #000 !important; }}"))
+                    .and_then(|black| {
+                        let white = self.render_layer(&format!(
+                            "{css}\nhtml {{ background: #fff !important; }}"
+                        ))?;
+                        encode_png(&unmatte(&black, &white)?)
+                    })
+            } else {
+                self.render_layer(&css).and_then(|image| encode_png(&image))
+            };
+            match png {
+                Ok(png) => layers.push(ImageLayer {
+                    name: name.to_string(),
+                    png,
+                }),
+                Err(e) => {
+                    result = Err(e);
+                    break;
+                }
+            }
+        }
+
+        let _ = eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            LAYER_CLEANUP_JS,
+            self.options.timeout,
+        );
+        result.map(|()| layers)
+    }
+
+    /// Apply `css` as the layer stylesheet and capture the viewport.
+    fn render_layer(&self, css: &str) -> Result<image::RgbaImage, PageError> {
+        let webview = self.webview()?;
+        let delegate = self.active_delegate()?;
+        let js = format!(
+            "(function() {{ \
+                var s = document.getElementById('__servoScraperLayer'); \
+                if (!s) {{ \
+                    s = document.createElement('style'); \
+                    s.id = '__servoScraperLayer'; \
+                    document.documentElement.appendChild(s); \
+                }} \
+                s.textContent = {}; \
+            }})()",
+            js_string_literal(css)
+        );
+        eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &js,
+            self.options.timeout,
+        )?;
+        wait_for_frame(
+            &self.servo,
+            &self.event_loop,
+            delegate,
+            Duration::from_millis(500),
+        );
+        wait_for_idle(
+            &self.servo,
+            &self.event_loop,
+            delegate,
+            Duration::from_millis(100),
+            Duration::from_secs(self.options.timeout),
+        );
+        take_screenshot_image(&self.servo, &self.event_loop, webview, self.options.timeout)
+    }
+
+    /// Capture the page's HTML.
+    pub fn html(&self) -> Result<String, PageError> {
+        let webview = self.webview()?;
+        capture_html(&self.servo, &self.event_loop, webview, self.options.timeout)
+    }
+
+    /// Capture the document as a JSON tree for [`diff_dom`](Self::diff_dom).
+    /// Elements are `{"tag", "attrs", "children"}` and text is `{"text"}`
+    /// with whitespace collapsed; whitespace-only text and comments are
+    /// skipped. `null` if there is no document element.
+    pub fn dom_snapshot(&self) -> Result<String, PageError> {
+        let webview = self.webview()?;
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            DOM_SNAPSHOT_JS,
+            self.options.timeout,
+        )? {
+            JSValue::String(json) => Ok(json),
+            other => Err(PageError::JsError(format!(
+                "unexpected DOM snapshot result: {other:?}"
+            ))),
+        }
+    }
+
+    /// Compare two [`dom_snapshot`](Self::dom_snapshot) outputs, e.g. taken
+    /// at different times. Siblings are matched by tag and `id` (text nodes by
+    /// position), so a changed `id` counts as a removed and an added element.
+    ///
+    /// Returns JSON `{"added": [...], "removed": [...], "changed": [...]}`.
+    /// Added and removed entries are `{"path", "node"}`, with `node` the
+    /// snapshot subtree; changed entries are `{"path", "kind": "text", "old",
+    /// "new"}` or `{"path", "kind": "attribute", "name", "old", "new"}` with
+    /// `null` for a missing attribute. Paths look like `/html[1]/body[1]/p[2]`
+    /// (`text()[n]` for text) and refer to `a` for removed nodes, `b`
+    /// otherwise. Attributes named in `ignored_attributes` (case-insensitive)
+    /// are not compared. Invalid snapshots return `InvalidArgument`.
+    pub fn diff_dom(a: &str, b: &str, ignored_attributes: &[&str]) -> Result<String, PageError> {
+        let parse = |json: &str| {
+            serde_json::from_str::<serde_json::Value>(json)
+                .map_err(|e| PageError::InvalidArgument(format!("invalid DOM snapshot: {e}")))
+        };
+        let (a, b) = (parse(a)?, parse(b)?);
+        // A `null` snapshot (no document element) is an empty tree.
+        let root_a: &[serde_json::Value] = if a.is_null() {
+            &[]
+        } else {
+            std::slice::from_ref(&a)
+        };
+        let root_b: &[serde_json::Value] = if b.is_null() {
+            &[]
+        } else {
+            std::slice::from_ref(&b)
+        };
+        let mut diff = DomDiff {
+            ignored_attributes,
+            added: Vec::new(),
+            removed: Vec::new(),
+            changed: Vec::new(),
+        };
+        diff.children("", "", root_a, root_b)?;
+        Ok(serde_json::json!({
+            "added": diff.added,
+            "removed": diff.removed,
+            "changed": diff.changed,
+        })
+        .to_string())
+    }
+
+    /// Export the current document as one self-contained HTML file, e.g. for
+    /// archiving or offline viewing. The markup is the live DOM, so it
+    /// includes script-rendered content; scripts themselves are dropped, and
+    /// canvases become images. Stylesheets (with their `@import`s), images
+    /// and CSS assets such as fonts and backgrounds are inlined as `data:`
+    /// URIs.
+    ///
+    /// Assets are fetched again by the embedder-side client, blocking the
+    /// engine for up to the configured timeout per request, with the
+    /// configured User-Agent but without cookies. Blocked URL patterns,
+    /// offline emulation and the request interceptor (as a `GET` subresource)
+    /// apply to each request and redirect; other header overrides do not.
+    /// Assets that are refused, fail or exceed `max_asset_bytes` (0 = no
+    /// limit) keep their absolute URL, as do frames, media and links.
+    pub fn single_file(&self, max_asset_bytes: u64) -> Result<String, PageError> {
+        let webview = self.webview()?;
+        let parts: SingleFileParts = match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            SINGLE_FILE_COLLECT_JS,
+            self.options.timeout,
+        )? {
+            JSValue::String(json) => serde_json::from_str(&json)
+                .map_err(|e| PageError::JsError(format!("invalid single-file parts: {e}")))?,
+            other => {
+                return Err(PageError::JsError(format!(
+                    "unexpected single-file result: {other:?}"
+                )));
+            }
+        };
+        let base = Url::parse(&parts.base).ok();
+        let mut assets = SingleFile {
+            policy: AssetPolicy {
+                user_agent: self.shared.user_agent.as_deref(),
+                blocked: self
+                    .active_delegate()?
+                    .blocked_url_patterns
+                    .borrow()
+                    .clone(),
+                offline: self.shared.network.offline.get(),
+                interceptor: self.shared.request_interceptor.borrow().clone(),
+            },
+            max_asset_bytes,
+            timeout: self.shared.fetch_timeout,
+            fetched: HashMap::new(),
+        };
+        let images: serde_json::Map<String, serde_json::Value> = parts
+            .images
+            .iter()
+            .filter_map(|src| {
+                let uri = assets.data_uri(&Url::parse(src).ok()?)?;
+                Some((src.clone(), uri.into()))
+            })
+            .collect();
+        let sheets: Vec<Option<String>> = parts
+            .sheets
+            .iter()
+            .map(|href| {
+                let url = Url::parse(href).ok()?;
+                let (body, _) = assets.fetch(&url)?;
+                let css = String::from_utf8_lossy(body).into_owned();
+                Some(assets.css(&css, &url, 0))
+            })
+            .collect();
+        let mut inline = |css: &String| match &base {
+            Some(base) => assets.css(css, base, 0),
+            None => css.clone(),
+        };
+        let styles: Vec<String> = parts.styles.iter().map(&mut inline).collect();
+        let attrs: Vec<String> = parts.attrs.iter().map(&mut inline).collect();
+
+        let applied = serde_json::json!({
+            "images": images,
+            "sheets": sheets,
+            "styles": styles,
+            "attrs": attrs,
+        });
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &format!("({SINGLE_FILE_APPLY_JS})({applied})"),
+            self.options.timeout,
+        )? {
+            JSValue::String(html) => Ok(html),
+            other => Err(PageError::JsError(format!(
+                "unexpected single-file result: {other:?}"
+            ))),
+        }
+    }
+
+    /// Get the current page URL.
+    pub fn url(&self) -> Option<String> {
+        self.webview()
+            .ok()
+            .and_then(|wv| wv.url().map(|u| u.to_string()))
+    }
+
+    /// Get the current page title.
+    pub fn title(&self) -> Option<String> {
+        self.webview().ok().and_then(|wv| wv.page_title())
+    }
+
+    /// Get the document's character encoding (`document.characterSet`, e.g.
+    /// `UTF-8` or `windows-1252`), as determined from the `Content-Type`
+    /// header, a BOM or `<meta charset>`. Empty if undetermined.
+    pub fn charset(&self) -> Option<String> {
+        let webview = self.webview().ok()?;
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            "document.characterSet || ''",
+            self.options.timeout,
+        ) {
+            Ok(JSValue::String(charset)) => Some(charset),
+            _ => Some(String::new()),
+        }
+    }
+
+    /// Get First Contentful Paint and Largest Contentful Paint of the current
+    /// document, relative to navigation start. Metrics the engine has not
+    /// reported yet are `None`; LCP may still grow until user input.
+    pub fn paint_timing(&self) -> Result<PaintTiming, PageError> {
+        let webview = self.webview()?;
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            PAINT_TIMING_JS,
+            self.options.timeout,
+        )? {
+            JSValue::Array(arr) => match arr.as_slice() {
+                [JSValue::Number(fcp), JSValue::Number(lcp)] => Ok(PaintTiming {
+                    first_contentful_paint: (*fcp >= 0.0).then_some(*fcp),
+                    largest_contentful_paint: (*lcp >= 0.0).then_some(*lcp),
+                }),
+                _ => Err(PageError::JsError("invalid paint timing value".into())),
+            },
+            other => Err(PageError::JsError(format!(
+                "unexpected paint timing result: {other:?}"
+            ))),
+        }
     }
 
-    /// Capture the page's HTML.
-    pub fn html(&self) -> Result<String, PageError> {
+    /// Guess whether the current document is server-rendered,
+    /// client-rendered (e.g. a single-page app) or a hybrid, to decide whether
+    /// a page needs a full render or a plain HTTP fetch would do.
+    ///
+    /// The basis is how much of the content existed at `DOMContentLoaded`
+    /// compared to now (call it after the post-load wait): the share of
+    /// visible body text, or of elements when there is under 200 characters
+    /// of text. At least 80% is server-rendered, at most 25% client-rendered,
+    /// anything between hybrid. This is a heuristic: frameworks that render
+    /// synchronously before `DOMContentLoaded` look server-rendered, and
+    /// content still loading looks client-rendered. Requires
+    /// [`set_render_mode_tracking(true)`](Self::set_render_mode_tracking)
+    /// before the load; fails with `InvalidArgument` otherwise, and with
+    /// `JsError` for a document that has not reached `DOMContentLoaded` since
+    /// tracking was enabled.
+    pub fn render_mode(&self) -> Result<RenderMode, PageError> {
+        if !self.init_scripts.contains_key("render_mode") {
+            return Err(PageError::InvalidArgument(
+                "render mode tracking is off; call set_render_mode_tracking(true) first".into(),
+            ));
+        }
         let webview = self.webview()?;
-        capture_html(&self.servo, &self.event_loop, webview, self.options.timeout)
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            RENDER_MODE_JS,
+            self.options.timeout,
+        )? {
+            JSValue::Array(arr) => match arr.as_slice() {
+                [
+                    JSValue::Number(e0),
+                    JSValue::Number(t0),
+                    JSValue::Number(e1),
+                    JSValue::Number(t1),
+                ] => Ok(classify_render_mode([*e0, *t0], [*e1, *t1])),
+                _ => Err(PageError::JsError("invalid render mode measurement".into())),
+            },
+            JSValue::Null | JSValue::Undefined => Err(PageError::JsError(
+                "document has not reached DOMContentLoaded".into(),
+            )),
+            other => Err(PageError::JsError(format!(
+                "unexpected render mode result: {other:?}"
+            ))),
+        }
     }
 
-    /// Get the current page URL.
-    pub fn url(&self) -> Option<String> {
-        self.webview()
-            .ok()
-            .and_then(|wv| wv.url().map(|u| u.to_string()))
+    /// Measure every document at `DOMContentLoaded` (off by default) for
+    /// [`render_mode()`](Self::render_mode). Applies to documents loaded
+    /// afterwards: the current one is past that point.
+    pub fn set_render_mode_tracking(&mut self, enabled: bool) {
+        self.set_init_script(
+            "render_mode",
+            enabled.then(|| RENDER_MODE_RECORDER.to_string()),
+        );
     }
 
-    /// Get the current page title.
-    pub fn title(&self) -> Option<String> {
-        self.webview().ok().and_then(|wv| wv.page_title())
+    /// Note `navigator.serviceWorker.register()` calls (off by default) on
+    /// every page for [`has_service_worker()`](Self::has_service_worker).
+    /// Applies to the current document and those loaded afterwards, so enable
+    /// it before the page registers its worker.
+    pub fn set_service_worker_tracking(&mut self, enabled: bool) {
+        self.set_init_script(
+            "service_workers",
+            enabled.then(|| SERVICE_WORKER_RECORDER.to_string()),
+        );
+    }
+
+    /// Whether the current document registered a service worker, or was
+    /// served under one registered earlier (e.g. in a persistent profile).
+    /// Registrations are only seen while
+    /// [`set_service_worker_tracking(true)`](Self::set_service_worker_tracking)
+    /// is on; without it, only a controlling worker counts. Always `false`
+    /// when service workers are unavailable, which is the default in Servo.
+    pub fn has_service_worker(&self) -> Result<bool, PageError> {
+        let webview = self.webview()?;
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            HAS_SERVICE_WORKER_JS,
+            self.options.timeout,
+        )? {
+            JSValue::Boolean(b) => Ok(b),
+            other => Err(PageError::JsError(format!(
+                "unexpected service worker result: {other:?}"
+            ))),
+        }
     }
 
     /// Drain and return captured console messages.
@@ -919,12 +4026,27 @@ impl PageEngine {
         }
     }
 
-    /// Reset all state: drop all pages, clear popup buffer, reset ID counter.
+    /// Reset all state: drop all pages, clear popup buffer, reset ID counter,
+    /// and drop network emulation, the request interceptor, file access and
+    /// init scripts.
     pub fn reset(&mut self) {
         self.pages.clear();
         self.active_page_id = None;
         self.next_page_id = 0;
         self.popup_buffer.borrow_mut().clear();
+        self.shared.network.latency.set(Duration::ZERO);
+        self.shared.network.offline.set(false);
+        self.shared.request_interceptor.borrow_mut().take();
+        self.shared.progress_callback.borrow_mut().take();
+        self.shared.html_stream_callback.borrow_mut().take();
+        self.shared.allow_file_access.set(false);
+        self.shared.max_image_pixels.set(DEFAULT_MAX_IMAGE_PIXELS);
+        self.shared.cookie_policy.set(CookiePolicy::AcceptAll);
+        self.shared.download_capture.set(false);
+        host_connections().set_limit(0);
+        for (_, script) in self.init_scripts.drain() {
+            self.shared.user_content_manager.remove_script(script);
+        }
     }
 
     // -- Phase 2: Wait mechanisms --
@@ -986,6 +4108,197 @@ impl PageEngine {
         }
     }
 
+    /// Wait until `text` appears anywhere in the page's rendered text
+    /// (`document.body.innerText`). Matching is case-insensitive unless
+    /// `case_sensitive` is set.
+    pub fn wait_for_text(
+        &self,
+        text: &str,
+        case_sensitive: bool,
+        timeout_ms: u64,
+    ) -> Result<(), PageError> {
+        let webview = self.webview()?;
+        let delegate = self.active_delegate()?;
+        let escaped = js_string_literal(text);
+        let js = if case_sensitive {
+            format!(
+                "(function() {{ \
+                    var body = document.body; \
+                    return !!body && body.innerText.indexOf({escaped}) !== -1; \
+                }})()"
+            )
+        } else {
+            format!(
+                "(function() {{ \
+                    var body = document.body; \
+                    return !!body && \
+                        body.innerText.toLowerCase().indexOf({escaped}.toLowerCase()) !== -1; \
+                }})()"
+            )
+        };
+
+        let deadline = Instant::now() + Duration::from_millis(timeout_ms);
+        loop {
+            if let Ok(JSValue::Boolean(true)) = eval_js(
+                &self.servo,
+                &self.event_loop,
+                webview,
+                &js,
+                self.options.timeout,
+            ) {
+                return Ok(());
+            }
+            if Instant::now() >= deadline {
+                return Err(PageError::Timeout);
+            }
+            wait_for_frame(
+                &self.servo,
+                &self.event_loop,
+                delegate,
+                Duration::from_millis(200),
+            );
+        }
+    }
+
+    /// Capture downloads (off by default) on every page into a queue for
+    /// [`wait_for_download()`](Self::wait_for_download): `<a download>`
+    /// clicks are cancelled and their target is fetched with the page's
+    /// `fetch()`, and main-frame GET navigations answered with
+    /// `Content-Disposition: attachment` are kept out of the page, which
+    /// stays on its current document. Applies to the current document and
+    /// those loaded afterwards.
+    ///
+    /// While enabled, links are never downloaded by Servo itself: cross-origin
+    /// `<a download>` targets fail unless the server allows CORS, and bodies
+    /// are held in memory until taken. Main-frame GET navigations are fetched
+    /// by the embedder, bypassing Servo's HTTP cache and cookie jar. Attachments answering a
+    /// form POST are not captured, since the embedder never sees the request
+    /// body. Disabling takes effect from the next navigation for
+    /// `<a download>` links and at once for attachments.
+    pub fn set_download_capture(&mut self, enabled: bool) {
+        self.set_init_script("downloads", enabled.then(|| DOWNLOAD_RECORDER.to_string()));
+        self.shared.download_capture.set(enabled);
+    }
+
+    /// Wait for a download started by an earlier click on an `<a download>`
+    /// link (including script-created anchors, e.g. blob exports) or a
+    /// navigation to a `Content-Disposition: attachment` response to finish,
+    /// and return its contents. Requires
+    /// [`set_download_capture(true)`](Self::set_download_capture) before the
+    /// click; fails with `InvalidArgument` otherwise.
+    ///
+    /// Downloads are queued from the moment of the click, so the click may
+    /// come before this call. Attachments are returned first, oldest first,
+    /// then the oldest finished `<a download>` of the current document.
+    pub fn wait_for_download(&self, timeout_ms: u64) -> Result<Download, PageError> {
+        use base64::Engine as _;
+
+        if !self.init_scripts.contains_key("downloads") {
+            return Err(PageError::InvalidArgument(
+                "download capture is off; call set_download_capture(true) first".into(),
+            ));
+        }
+        let webview = self.webview()?;
+        let delegate = self.active_delegate()?;
+
+        let deadline = Instant::now() + Duration::from_millis(timeout_ms);
+        loop {
+            let attachment = delegate
+                .downloads
+                .lock()
+                .unwrap_or_else(|e| e.into_inner())
+                .pop_front();
+            if let Some(download) = attachment {
+                return Ok(download);
+            }
+            if let Ok(JSValue::String(json)) = eval_js(
+                &self.servo,
+                &self.event_loop,
+                webview,
+                DOWNLOAD_TAKE,
+                self.options.timeout,
+            ) {
+                let recorded: RecordedDownload = serde_json::from_str(&json)
+                    .map_err(|e| PageError::JsError(format!("bad download record: {e}")))?;
+                if let Some(error) = recorded.error {
+                    return Err(PageError::LoadFailed(format!(
+                        "download {} failed: {error}",
+                        recorded.url
+                    )));
+                }
+                let data = base64::engine::general_purpose::STANDARD
+                    .decode(recorded.data.unwrap_or_default())
+                    .map_err(|e| PageError::JsError(format!("bad download data: {e}")))?;
+                return Ok(Download {
+                    url: recorded.url,
+                    filename: recorded.filename.unwrap_or_else(|| "download".into()),
+                    data,
+                });
+            }
+            if Instant::now() >= deadline {
+                return Err(PageError::Timeout);
+            }
+            wait_for_frame(
+                &self.servo,
+                &self.event_loop,
+                delegate,
+                Duration::from_millis(200),
+            );
+        }
+    }
+
+    /// Wait until every `<img>` in the document has finished loading or
+    /// failed, then for the next frame so a screenshot shows them painted.
+    /// Unlike network idle, this also covers images still being decoded.
+    ///
+    /// Fails with `Timeout` if some image is still pending after
+    /// `timeout_ms`; note that `loading="lazy"` images outside the viewport
+    /// may never start. CSS background images are not tracked.
+    pub fn wait_for_images(&self, timeout_ms: u64) -> Result<ImageLoadCounts, PageError> {
+        let webview = self.webview()?;
+        let delegate = self.active_delegate()?;
+
+        let deadline = Instant::now() + Duration::from_millis(timeout_ms);
+        loop {
+            if let Ok(JSValue::Array(counts)) = eval_js(
+                &self.servo,
+                &self.event_loop,
+                webview,
+                IMAGE_STATUS_JS,
+                self.options.timeout,
+            ) {
+                if let [
+                    JSValue::Number(loaded),
+                    JSValue::Number(failed),
+                    JSValue::Number(pending),
+                ] = counts.as_slice()
+                {
+                    if *pending == 0.0 {
+                        wait_for_frame(
+                            &self.servo,
+                            &self.event_loop,
+                            delegate,
+                            Duration::from_millis(200),
+                        );
+                        return Ok(ImageLoadCounts {
+                            loaded: *loaded as u32,
+                            failed: *failed as u32,
+                        });
+                    }
+                }
+            }
+            if Instant::now() >= deadline {
+                return Err(PageError::Timeout);
+            }
+            wait_for_frame(
+                &self.servo,
+                &self.event_loop,
+                delegate,
+                Duration::from_millis(100),
+            );
+        }
+    }
+
     /// Wait for a fixed duration while keeping the event loop alive.
     pub fn wait(&self, seconds: f64) {
         spin_for(
@@ -1102,6 +4415,92 @@ impl PageEngine {
         }
     }
 
+    /// Report the element at viewport coordinates `(x, y)` — the one a
+    /// [`click()`](Self::click) or [`mouse_move()`](Self::mouse_move) there
+    /// would hit — or `None` if nothing is there. Coordinates are device
+    /// pixels, as for input events.
+    pub fn element_at(&self, x: f32, y: f32) -> Result<Option<ElementTarget>, PageError> {
+        self.resolve_target(&format!("[{x}, {y}]"), None)
+    }
+
+    /// Report the element a [`click_selector()`](Self::click_selector) would
+    /// hit: the topmost element at the center of the first match, which may
+    /// be a child or an overlay rather than the match itself.
+    pub fn selector_target(&self, selector: &str) -> Result<Option<ElementTarget>, PageError> {
+        let escaped = js_string_literal(selector);
+        self.resolve_target(
+            &format!(
+                "(function() {{ \
+                var el = document.querySelector({escaped}); \
+                if (!el) return null; \
+                var r = el.getBoundingClientRect(); \
+                return [r.left + r.width/2, r.top + r.height/2]; \
+            }})()"
+            ),
+            Some(selector),
+        )
+    }
+
+    /// Hit-test the point produced by the JS expression `point` and describe
+    /// the element found there. `point` evaluates to `[x, y]`, or to `null`
+    /// when `selector` matched nothing.
+    fn resolve_target(
+        &self,
+        point: &str,
+        selector: Option<&str>,
+    ) -> Result<Option<ElementTarget>, PageError> {
+        let webview = self.webview()?;
+        let js = format!(
+            "(function(p) {{ \
+                if (!p) return false; \
+                var dpr = window.devicePixelRatio || 1; \
+                var el = document.elementFromPoint(p[0] / dpr, p[1] / dpr); \
+                if (!el) return null; \
+                var esc = window.CSS && CSS.escape ? CSS.escape : null; \
+                var steps = []; \
+                for (var n = el; n && n.nodeType === 1; n = n.parentElement) {{ \
+                    if (esc && n.id && document.querySelectorAll('#' + esc(n.id)).length === 1) {{ \
+                        steps.unshift('#' + esc(n.id)); break; \
+                    }} \
+                    var step = n.localName, i = 1, same = 0; \
+                    for (var s = n.parentElement && n.parentElement.firstElementChild; s; s = s.nextElementSibling) {{ \
+                        if (s.localName !== n.localName) continue; \
+                        same++; \
+                        if (s === n) i = same; \
+                    }} \
+                    if (same > 1) step += ':nth-of-type(' + i + ')'; \
+                    steps.unshift(step); \
+                }} \
+                return [el.localName, steps.join(' > ')]; \
+            }})({point})"
+        );
+
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &js,
+            self.options.timeout,
+        )? {
+            JSValue::Array(fields) => match fields.as_slice() {
+                [JSValue::String(tag), JSValue::String(selector)] => Ok(Some(ElementTarget {
+                    tag: tag.clone(),
+                    selector: selector.clone(),
+                })),
+                other => Err(PageError::JsError(format!(
+                    "unexpected target result: {other:?}"
+                ))),
+            },
+            JSValue::Boolean(false) => Err(PageError::SelectorNotFound(
+                selector.unwrap_or_default().to_string(),
+            )),
+            JSValue::Null | JSValue::Undefined => Ok(None),
+            other => Err(PageError::JsError(format!(
+                "unexpected target result: {other:?}"
+            ))),
+        }
+    }
+
     /// Type text by sending individual key events.
     pub fn type_text(&self, text: &str) -> Result<(), PageError> {
         let webview = self.webview()?;
@@ -1237,6 +4636,43 @@ impl PageEngine {
         }
     }
 
+    /// Get the document's scrollable size and current scroll offset. At the
+    /// bottom, `scroll_top` plus the viewport height reaches `scroll_height`.
+    pub fn scroll_metrics(&self) -> Result<ScrollMetrics, PageError> {
+        let webview = self.webview()?;
+        let js = "(function() { \
+                var el = document.scrollingElement || document.documentElement; \
+                if (!el) return [0, 0, 0, 0]; \
+                return [el.scrollHeight, el.scrollWidth, window.scrollY, window.scrollX]; \
+            })()";
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            js,
+            self.options.timeout,
+        )? {
+            JSValue::Array(arr) if arr.len() == 4 => {
+                let nums: Vec<f64> = arr
+                    .iter()
+                    .map(|v| match v {
+                        JSValue::Number(n) => Ok(*n),
+                        _ => Err(PageError::JsError("invalid scroll metric".into())),
+                    })
+                    .collect::<Result<Vec<_>, _>>()?;
+                Ok(ScrollMetrics {
+                    scroll_height: nums[0],
+                    scroll_width: nums[1],
+                    scroll_top: nums[2],
+                    scroll_left: nums[3],
+                })
+            }
+            other => Err(PageError::JsError(format!(
+                "unexpected scroll metrics result: {other:?}"
+            ))),
+        }
+    }
+
     // -- Select --
 
     /// Select an option in a `<select>` element by value.
@@ -1355,11 +4791,12 @@ impl PageEngine {
         }
     }
 
-    /// Set a cookie via `document.cookie = '...'`.
+    /// Set a cookie via `document.cookie = '...'`. Not subject to the
+    /// [cookie policy](Self::set_cookie_policy).
     pub fn set_cookie(&self, cookie: &str) -> Result<(), PageError> {
         let webview = self.webview()?;
         let escaped = js_string_literal(cookie);
-        let js = format!("document.cookie = {escaped}");
+        let js = format!("{SET_COOKIE_JS}({escaped})");
         eval_js(
             &self.servo,
             &self.event_loop,
@@ -1370,15 +4807,24 @@ impl PageEngine {
         Ok(())
     }
 
+    /// Set a cookie with the given `SameSite` attribute, replacing any
+    /// `SameSite` already in `cookie`. `SameSite::None` without `Secure` is
+    /// logged as a warning, since browsers reject that combination.
+    pub fn set_cookie_same_site(&self, cookie: &str, same_site: SameSite) -> Result<(), PageError> {
+        self.set_cookie(&cookie_with_same_site(cookie, same_site))
+    }
+
     /// Clear all cookies by expiring each one.
     pub fn clear_cookies(&self) -> Result<(), PageError> {
         let webview = self.webview()?;
         let js = r#"(function() {
+            var set = window.__servoScraperSetCookie ||
+                function(c) { document.cookie = c; };
             var cookies = document.cookie.split(';');
             for (var i = 0; i < cookies.length; i++) {
                 var name = cookies[i].split('=')[0].trim();
                 if (name) {
-                    document.cookie = name + '=;expires=Thu, 01 Jan 1970 00:00:00 GMT;path=/';
+                    set(name + '=;expires=Thu, 01 Jan 1970 00:00:00 GMT;path=/');
                 }
             }
         })()"#;
@@ -1392,6 +4838,58 @@ impl PageEngine {
         Ok(())
     }
 
+    /// Choose which cookies pages may set, for all pages: `AcceptAll` (the
+    /// default), `BlockThirdParty` or `BlockAll`.
+    ///
+    /// Blocked cookies are enforced in two places. HTTP(S) `GET`/`HEAD`
+    /// requests they apply to (all of them, or those whose site differs from
+    /// the top-level document's) are fetched by the embedder without `Cookie`
+    /// and with `Set-Cookie` dropped. Requests with a body (form posts,
+    /// `fetch()` with `POST`) cannot be re-sent by the embedder and go
+    /// through Servo unchanged, so even under `BlockAll` they carry cookies
+    /// and their `Set-Cookie` headers are stored. An init script ignores
+    /// `document.cookie` writes in every document, or in cross-origin frames
+    /// for `BlockThirdParty`.
+    /// Cookies set with [`set_cookie`](Self::set_cookie) are not affected,
+    /// though `BlockAll` keeps them from being sent. Relaxing the policy
+    /// re-enables `document.cookie` from the next navigation.
+    pub fn set_cookie_policy(&mut self, policy: CookiePolicy) {
+        self.shared.cookie_policy.set(policy);
+        let block_all = match policy {
+            CookiePolicy::AcceptAll => {
+                self.set_init_script("cookies", None);
+                return;
+            }
+            CookiePolicy::BlockThirdParty => false,
+            CookiePolicy::BlockAll => true,
+        };
+        let js = format!(
+            "(function(blockAll) {{ \
+                var desc = Object.getOwnPropertyDescriptor(Document.prototype, 'cookie'); \
+                if (!desc || !desc.set) return; \
+                if (!window.__servoScraperSetCookie) {{ \
+                    var set = desc.set; \
+                    Object.defineProperty(window, '__servoScraperSetCookie', \
+                        {{value: function(c) {{ set.call(document, c); }}}}); \
+                }} \
+                var original = window.__servoScraperSetCookie; \
+                function thirdParty() {{ \
+                    if (window.top === window) return false; \
+                    try {{ return typeof window.top.location.href !== 'string'; }} \
+                    catch (e) {{ return true; }} \
+                }} \
+                Object.defineProperty(Document.prototype, 'cookie', {{ \
+                    configurable: true, enumerable: desc.enumerable, get: desc.get, \
+                    set: function cookie(value) {{ \
+                        if (blockAll || this !== document || thirdParty()) return; \
+                        original(value); \
+                    }} \
+                }}); \
+            }})({block_all})"
+        );
+        self.set_init_script("cookies", Some(js));
+    }
+
     // -- Request interception --
 
     /// Set URL patterns to block. Any request whose URL contains a pattern is cancelled.
@@ -1402,11 +4900,381 @@ impl PageEngine {
         }
     }
 
-    /// Clear all blocked URL patterns.
-    pub fn clear_blocked_urls(&mut self) {
-        if let Ok(delegate) = self.active_delegate() {
-            delegate.blocked_url_patterns.borrow_mut().clear();
+    /// Clear all blocked URL patterns.
+    pub fn clear_blocked_urls(&mut self) {
+        if let Ok(delegate) = self.active_delegate() {
+            delegate.blocked_url_patterns.borrow_mut().clear();
+        }
+    }
+
+    /// Install (or with `None`, remove) a callback consulted for every request
+    /// of every page, after blocked URL patterns.
+    ///
+    /// The callback can let a request continue, abort it (the page sees a
+    /// failed load), redirect it, or re-send it with a different header set.
+    /// Header overrides only apply to HTTP(S) `GET`/`HEAD` requests: Servo
+    /// cannot modify in-flight requests, so they are fetched by the embedder
+    /// and bypass Servo's HTTP cache and cookie jar (cookies are only sent if
+    /// the callback includes a `cookie` header).
+    pub fn set_request_interceptor(&mut self, interceptor: Option<RequestInterceptor>) {
+        *self.shared.request_interceptor.borrow_mut() = interceptor.map(Rc::from);
+    }
+
+    /// Install (or with `None`, remove) a callback reporting the progress of
+    /// navigations started by `open()`, `reload()`, `go_back()` and
+    /// `go_forward()`. It is called from the event loop whenever the estimate
+    /// changes, ending with 100% once the page has loaded and settled.
+    pub fn set_progress_callback(&mut self, callback: Option<ProgressCallback>) {
+        *self.shared.progress_callback.borrow_mut() = callback.map(Rc::from);
+    }
+
+    /// Install (or with `None`, remove) a callback receiving the markup of
+    /// documents as it is parsed or inserted by scripts, in chunks of
+    /// `outerHTML` for each batch of new nodes, so consumers can start on the
+    /// top of a slow page before it has loaded. Applies to documents loaded
+    /// after the call, on every page.
+    ///
+    /// The callback runs on the event loop; returning `false` stops delivery
+    /// until the next navigation. Chunks are not a byte-exact copy of the
+    /// response: they are serialized from the DOM, and nodes inserted into an
+    /// already reported element are sent on their own.
+    pub fn set_html_stream_callback(&mut self, callback: Option<HtmlStreamCallback>) {
+        let enabled = callback.is_some();
+        *self.shared.html_stream_callback.borrow_mut() = callback.map(Rc::from);
+        self.set_init_script(
+            "html_stream",
+            enabled.then(|| html_stream_recorder(&self.shared.html_stream_marker)),
+        );
+    }
+
+    /// Set (or with `None`, clear) the `Accept` header sent with top-level
+    /// navigations of the active page, e.g. `application/json` for endpoints
+    /// that content-negotiate. Subresource requests are unaffected. Like header
+    /// overrides from the request interceptor, the navigation is then fetched
+    /// by the embedder, which bypasses Servo's cookie jar and HTTP cache: no
+    /// cookies are sent with it and its `Set-Cookie` headers are not stored.
+    pub fn set_accept(&mut self, value: Option<&str>) -> Result<(), PageError> {
+        let value = value
+            .map(|v| {
+                HeaderValue::from_str(v).map_err(|_| {
+                    PageError::InvalidArgument(format!("invalid Accept header value: {v:?}"))
+                })
+            })
+            .transpose()?;
+        *self.active_delegate()?.accept_override.borrow_mut() = value;
+        Ok(())
+    }
+
+    /// Replace the `Content-Security-Policy` of top-level HTTP(S) responses of
+    /// the active page with `policy` (`""` removes it, `None` restores the
+    /// site's own). `Content-Security-Policy-Report-Only` is dropped as well.
+    ///
+    /// This is a deliberate security relaxation for controlled scraping, e.g.
+    /// to let init scripts and injected helpers run on sites whose policy
+    /// forbids them — never point it at content you do not trust. Policies
+    /// delivered in `<meta http-equiv>` still apply. Like
+    /// [`set_accept`](Self::set_accept), the navigation is fetched by the
+    /// embedder, bypassing Servo's cookie jar and HTTP cache: no cookies are
+    /// sent with it and its `Set-Cookie` headers are not stored.
+    pub fn set_csp(&mut self, policy: Option<&str>) -> Result<(), PageError> {
+        let policy = policy
+            .map(|p| {
+                HeaderValue::from_str(p).map_err(|_| {
+                    PageError::InvalidArgument(format!("invalid Content-Security-Policy: {p:?}"))
+                })
+            })
+            .transpose()?;
+        *self.active_delegate()?.csp_override.borrow_mut() = policy;
+        Ok(())
+    }
+
+    /// Set (or with `None` or `""`, clear) the `Accept-Encoding` header sent
+    /// with top-level navigations of the active page — e.g. `identity` to get
+    /// an uncompressed response, or `gzip` to avoid a server's broken brotli.
+    /// Only `gzip` and `identity` are accepted: the navigation is fetched by
+    /// the embedder, like with [`set_accept`](Self::set_accept), and that
+    /// client decodes nothing else.
+    pub fn set_accept_encoding(&mut self, value: Option<&str>) -> Result<(), PageError> {
+        let value = value
+            .filter(|v| !v.is_empty())
+            .map(|v| {
+                let header = HeaderValue::from_str(v).map_err(|_| {
+                    PageError::InvalidArgument(format!(
+                        "invalid Accept-Encoding header value: {v:?}"
+                    ))
+                })?;
+                for item in v.split(',') {
+                    let coding = coding_name(item);
+                    if !DECODABLE_CODINGS
+                        .iter()
+                        .any(|c| c.eq_ignore_ascii_case(coding))
+                    {
+                        return Err(PageError::InvalidArgument(format!(
+                            "unsupported content coding {coding:?} (use gzip or identity)"
+                        )));
+                    }
+                }
+                Ok(header)
+            })
+            .transpose()?;
+        *self
+            .active_delegate()?
+            .accept_encoding_override
+            .borrow_mut() = value;
+        Ok(())
+    }
+
+    /// Set the `Sec-Fetch-Site`, `Sec-Fetch-Mode` and `Sec-Fetch-Dest` headers
+    /// sent with every HTTP(S) request of the active page, e.g. `same-site`,
+    /// `cors`, `empty` to look like a same-site XHR. `None` restores Servo's
+    /// value for that header. Like other header overrides, affected `GET`/`HEAD`
+    /// requests are fetched by the embedder; other methods are sent unchanged,
+    /// since Servo does not hand request bodies to the embedder.
+    ///
+    /// While any of these is set, every HTTP(S) `GET`/`HEAD` of the page —
+    /// document, scripts, images and XHRs alike — bypasses Servo's cookie jar
+    /// and HTTP cache: no cookies are sent and `Set-Cookie` is not stored.
+    pub fn set_fetch_metadata(
+        &mut self,
+        site: Option<&str>,
+        mode: Option<&str>,
+        dest: Option<&str>,
+    ) -> Result<(), PageError> {
+        const SITES: [&str; 4] = ["cross-site", "same-origin", "same-site", "none"];
+        const MODES: [&str; 5] = ["cors", "navigate", "no-cors", "same-origin", "websocket"];
+
+        let site = site
+            .map(|s| fetch_metadata_value("Sec-Fetch-Site", s, Some(&SITES[..])))
+            .transpose()?;
+        let mode = mode
+            .map(|m| fetch_metadata_value("Sec-Fetch-Mode", m, Some(&MODES[..])))
+            .transpose()?;
+        let dest = dest
+            .map(|d| fetch_metadata_value("Sec-Fetch-Dest", d, None))
+            .transpose()?;
+
+        let mut forced = self.active_delegate()?.forced_headers.borrow_mut();
+        for (name, value) in [
+            ("sec-fetch-site", site),
+            ("sec-fetch-mode", mode),
+            ("sec-fetch-dest", dest),
+        ] {
+            let name = HeaderName::from_static(name);
+            match value {
+                Some(value) => forced.insert(name, value),
+                None => forced.remove(name),
+            };
+        }
+        Ok(())
+    }
+
+    /// Set (or with `None`, clear) the `Origin` header sent with every HTTP(S)
+    /// request of the active page. `origin` must be a serialized origin such as
+    /// `https://shop.example.com`, or `null`. Applied like
+    /// [`set_fetch_metadata`](Self::set_fetch_metadata), so it too drops
+    /// cookies from the page's `GET`/`HEAD` requests and leaves `POST`s as
+    /// Servo sends them.
+    pub fn set_origin(&mut self, origin: Option<&str>) -> Result<(), PageError> {
+        let value = origin
+            .map(|o| {
+                let valid = o == "null"
+                    || Url::parse(o)
+                        .map(|u| {
+                            matches!(u.scheme(), "http" | "https")
+                                && u.origin().ascii_serialization() == o
+                        })
+                        .unwrap_or(false);
+                if !valid {
+                    return Err(PageError::InvalidArgument(format!(
+                        "invalid origin {o:?} (expected scheme://host[:port])"
+                    )));
+                }
+                HeaderValue::from_str(o)
+                    .map_err(|_| PageError::InvalidArgument(format!("invalid origin {o:?}")))
+            })
+            .transpose()?;
+        let mut forced = self.active_delegate()?.forced_headers.borrow_mut();
+        match value {
+            Some(value) => forced.insert(header::ORIGIN, value),
+            None => forced.remove(header::ORIGIN),
+        };
+        Ok(())
+    }
+
+    /// Add a rule that sets header `name` to `value` (or with `None`, removes
+    /// it) on HTTP(S) requests of the active page under `url_prefix`, e.g. an
+    /// `Authorization` header only for `https://api.example.com/v1`.
+    ///
+    /// A request matches when its scheme, host and port equal the prefix's
+    /// and its path is the prefix path or continues it after a `/` (`/v1`
+    /// covers `/v1/users`, not `/v10`); the query never counts, so a URL that
+    /// merely mentions the prefix does not match. Rules apply in the order
+    /// added, after the other header overrides, so a later match wins.
+    /// Redirects re-enter the rules with the new URL. Applied like
+    /// [`set_fetch_metadata`](Self::set_fetch_metadata): only `GET` and `HEAD`
+    /// requests can be re-sent by the embedder, so requests with a body
+    /// (`POST` and the like) go out without the rule's header.
+    pub fn add_header_rule(
+        &mut self,
+        url_prefix: &str,
+        name: &str,
+        value: Option<&str>,
+    ) -> Result<(), PageError> {
+        let prefix = Url::parse(url_prefix)
+            .ok()
+            .filter(|u| matches!(u.scheme(), "http" | "https"))
+            .filter(|u| u.query().is_none() && u.fragment().is_none())
+            .ok_or_else(|| {
+                PageError::InvalidArgument(format!(
+                    "invalid header rule prefix {url_prefix:?} (expected an http(s) URL without query)"
+                ))
+            })?;
+        let header_name = HeaderName::from_bytes(name.as_bytes())
+            .map_err(|_| PageError::InvalidArgument(format!("invalid header name {name:?}")))?;
+        let value = value
+            .map(|v| {
+                HeaderValue::from_str(v).map_err(|_| {
+                    PageError::InvalidArgument(format!("invalid value for header {name:?}"))
+                })
+            })
+            .transpose()?;
+        self.active_delegate()?
+            .header_rules
+            .borrow_mut()
+            .push(HeaderRule {
+                prefix,
+                name: header_name,
+                value,
+            });
+        Ok(())
+    }
+
+    /// Remove all rules added by [`add_header_rule`](Self::add_header_rule).
+    pub fn clear_header_rules(&mut self) -> Result<(), PageError> {
+        self.active_delegate()?.header_rules.borrow_mut().clear();
+        Ok(())
+    }
+
+    // -- Network emulation --
+
+    /// Emulate a network connection type for all pages.
+    ///
+    /// Overrides `navigator.connection` (`type`, `effectiveType`, `rtt`,
+    /// `downlink`) and `navigator.onLine`, and delays every HTTP(S) request by
+    /// the preset's round-trip time. `Offline` cancels HTTP(S) requests
+    /// outright. Bandwidth is not throttled — only latency.
+    pub fn set_connection_type(&mut self, connection_type: ConnectionType) {
+        // (type, effectiveType, rtt ms, downlink Mbps, online)
+        let (kind, effective, rtt, downlink, online) = match connection_type {
+            ConnectionType::Wifi => ("wifi", "4g", 0, 30.0, true),
+            ConnectionType::Cellular4g => ("cellular", "4g", 100, 10.0, true),
+            ConnectionType::Cellular3g => ("cellular", "3g", 300, 0.7, true),
+            ConnectionType::Cellular2g => ("cellular", "2g", 1500, 0.25, true),
+            ConnectionType::Offline => ("none", "4g", 0, 0.0, false),
+        };
+
+        let network = &self.shared.network;
+        network.latency.set(Duration::from_millis(rtt));
+        network.offline.set(!online);
+
+        let js = format!(
+            "(function() {{ \
+                var info = {{type: '{kind}', effectiveType: '{effective}', rtt: {rtt}, \
+                    downlink: {downlink}, saveData: false}}; \
+                var conn = {{onchange: null, \
+                    addEventListener: function() {{}}, \
+                    removeEventListener: function() {{}}}}; \
+                Object.keys(info).forEach(function(k) {{ \
+                    Object.defineProperty(conn, k, {{get: function() {{ return info[k]; }}}}); \
+                }}); \
+                Object.defineProperty(Navigator.prototype, 'connection', \
+                    {{get: function() {{ return conn; }}, configurable: true}}); \
+                Object.defineProperty(Navigator.prototype, 'onLine', \
+                    {{get: function() {{ return {online}; }}, configurable: true}}); \
+            }})()"
+        );
+        self.set_init_script("connection", Some(js));
+    }
+
+    /// Switch web-platform features on or off for all pages.
+    ///
+    /// Disabled features are removed by an init script before page scripts
+    /// run: WebGL contexts cannot be created, and `WebAssembly` /
+    /// `navigator.serviceWorker` are undefined. Disabling also applies to the
+    /// current document; re-enabling takes effect on the next navigation.
+    pub fn set_feature_flags(&mut self, flags: FeatureFlags) {
+        if flags == FeatureFlags::default() {
+            self.set_init_script("features", None);
+            return;
+        }
+        let js = format!(
+            "(function(webgl, wasm, sw) {{ \
+                if (!webgl) {{ \
+                    var getContext = HTMLCanvasElement.prototype.getContext; \
+                    HTMLCanvasElement.prototype.getContext = function(type) {{ \
+                        if (/webgl/i.test(type)) return null; \
+                        return getContext.apply(this, arguments); \
+                    }}; \
+                    delete window.WebGLRenderingContext; \
+                    delete window.WebGL2RenderingContext; \
+                }} \
+                if (!wasm) delete window.WebAssembly; \
+                if (!sw) {{ \
+                    delete Navigator.prototype.serviceWorker; \
+                    delete window.ServiceWorker; \
+                    delete window.ServiceWorkerContainer; \
+                    delete window.ServiceWorkerRegistration; \
+                }} \
+            }})({}, {}, {})",
+            flags.webgl, flags.webassembly, flags.service_workers,
+        );
+        self.set_init_script("features", Some(js));
+    }
+
+    /// Make `Math.random()`, `crypto.getRandomValues()` and
+    /// `crypto.randomUUID()` deterministic on all pages: each document starts
+    /// the same pseudo-random sequence derived from `seed`, installed before
+    /// page scripts run. `0` restores real randomness from the next navigation.
+    /// The generator (mulberry32) is not cryptographically secure.
+    pub fn set_random_seed(&mut self, seed: u64) {
+        if seed == 0 {
+            self.set_init_script("random", None);
+            return;
         }
+        let js = format!(
+            "(function(lo, hi) {{ \
+                var s = (lo ^ Math.imul(hi, 0x9e3779b9)) >>> 0; \
+                function next() {{ \
+                    s = (s + 0x6d2b79f5) >>> 0; \
+                    var t = Math.imul(s ^ (s >>> 15), s | 1); \
+                    t ^= t + Math.imul(t ^ (t >>> 7), t | 61); \
+                    return (t ^ (t >>> 14)) >>> 0; \
+                }} \
+                Math.random = function random() {{ return next() / 4294967296; }}; \
+                if (typeof Crypto === 'undefined') return; \
+                Crypto.prototype.getRandomValues = function getRandomValues(array) {{ \
+                    if (array.byteLength > 65536) \
+                        throw new DOMException('byte length exceeds 65536', 'QuotaExceededError'); \
+                    var bytes = new Uint8Array(array.buffer, array.byteOffset, array.byteLength); \
+                    for (var i = 0; i < bytes.length; i++) bytes[i] = next() & 255; \
+                    return array; \
+                }}; \
+                if (!Crypto.prototype.randomUUID) return; \
+                Crypto.prototype.randomUUID = function randomUUID() {{ \
+                    var b = this.getRandomValues(new Uint8Array(16)); \
+                    b[6] = (b[6] & 15) | 64; \
+                    b[8] = (b[8] & 63) | 128; \
+                    var h = Array.prototype.map.call(b, function(x) {{ \
+                        return (x + 256).toString(16).slice(1); \
+                    }}).join(''); \
+                    return h.slice(0, 8) + '-' + h.slice(8, 12) + '-' + h.slice(12, 16) + \
+                        '-' + h.slice(16, 20) + '-' + h.slice(20); \
+                }}; \
+            }})({}, {})",
+            seed as u32,
+            (seed >> 32) as u32,
+        );
+        self.set_init_script("random", Some(js));
     }
 
     // -- Navigation --
@@ -1415,7 +5283,7 @@ impl PageEngine {
     pub fn reload(&self) -> Result<(), PageError> {
         let webview = self.webview()?;
         let delegate = self.active_delegate()?;
-        delegate.load_complete.set(false);
+        delegate.start_navigation();
         webview.reload();
         self.wait_for_load()
     }
@@ -1427,7 +5295,7 @@ impl PageEngine {
             return Ok(false);
         }
         let delegate = self.active_delegate()?;
-        delegate.load_complete.set(false);
+        delegate.start_navigation();
         webview.go_back(1);
         self.wait_for_load()?;
         Ok(true)
@@ -1440,7 +5308,7 @@ impl PageEngine {
             return Ok(false);
         }
         let delegate = self.active_delegate()?;
-        delegate.load_complete.set(false);
+        delegate.start_navigation();
         webview.go_forward(1);
         self.wait_for_load()?;
         Ok(true)
@@ -1492,6 +5360,500 @@ impl PageEngine {
         }
     }
 
+    /// Get the bounding rectangles of all elements matching a CSS selector,
+    /// in document order. Coordinates are document-relative CSS pixels (the
+    /// scroll offset is added). No matches yield an empty list.
+    pub fn element_rects(&self, selector: &str) -> Result<Vec<ElementRect>, PageError> {
+        let webview = self.webview()?;
+        let escaped = js_string_literal(selector);
+        let js = format!(
+            "(function() {{ \
+                var sx = window.scrollX, sy = window.scrollY; \
+                return Array.prototype.map.call(document.querySelectorAll({escaped}), function(el) {{ \
+                    var r = el.getBoundingClientRect(); \
+                    return [r.x + sx, r.y + sy, r.width, r.height]; \
+                }}); \
+            }})()"
+        );
+
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &js,
+            self.options.timeout,
+        )? {
+            JSValue::Array(rects) => rects
+                .iter()
+                .map(|rect| match rect {
+                    JSValue::Array(arr) if arr.len() == 4 => {
+                        let nums: Vec<f64> = arr
+                            .iter()
+                            .map(|v| match v {
+                                JSValue::Number(n) => Ok(*n),
+                                _ => Err(PageError::JsError("invalid rect value".into())),
+                            })
+                            .collect::<Result<Vec<_>, _>>()?;
+                        Ok(ElementRect {
+                            x: nums[0],
+                            y: nums[1],
+                            width: nums[2],
+                            height: nums[3],
+                        })
+                    }
+                    other => Err(PageError::JsError(format!(
+                        "unexpected rect result: {other:?}"
+                    ))),
+                })
+                .collect(),
+            other => Err(PageError::JsError(format!(
+                "unexpected rects result: {other:?}"
+            ))),
+        }
+    }
+
+    /// Whether `click_selector()` on this selector would hit the element: it is
+    /// visible, enabled, inside the viewport, and the topmost element at its
+    /// center point (not covered by an overlay or consent banner).
+    ///
+    /// Returns `SelectorNotFound` if nothing matches.
+    pub fn is_clickable(&self, selector: &str) -> Result<bool, PageError> {
+        let webview = self.webview()?;
+        let escaped = js_string_literal(selector);
+        let js = format!(
+            "(function() {{ \
+                var el = document.querySelector({escaped}); \
+                if (!el) return null; \
+                if (el.matches(':disabled')) return false; \
+                var style = getComputedStyle(el); \
+                if (style.visibility === 'hidden' || style.pointerEvents === 'none') return false; \
+                var r = el.getBoundingClientRect(); \
+                if (r.width <= 0 || r.height <= 0) return false; \
+                var x = r.left + r.width/2, y = r.top + r.height/2; \
+                if (x < 0 || y < 0 || x >= window.innerWidth || y >= window.innerHeight) return false; \
+                var hit = document.elementFromPoint(x, y); \
+                return !!hit && el.contains(hit); \
+            }})()"
+        );
+
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &js,
+            self.options.timeout,
+        )? {
+            JSValue::Boolean(b) => Ok(b),
+            JSValue::Null | JSValue::Undefined => {
+                Err(PageError::SelectorNotFound(selector.to_string()))
+            }
+            other => Err(PageError::JsError(format!(
+                "unexpected clickability result: {other:?}"
+            ))),
+        }
+    }
+
+    /// Evaluate an XPath expression against the document. Returns the text
+    /// content of each matching node in document order (an attribute's value
+    /// for attribute nodes), or a single string for expressions that yield a
+    /// number, string or boolean, e.g. `count(//a)`. No matches return an
+    /// empty list; an invalid expression returns [`PageError::InvalidArgument`].
+    pub fn query_xpath(&self, xpath: &str) -> Result<Vec<String>, PageError> {
+        let webview = self.webview()?;
+        let escaped = js_string_literal(xpath);
+        let js = format!(
+            "(function() {{ \
+                if (typeof document.evaluate !== 'function') return null; \
+                var r; \
+                try {{ r = document.evaluate({escaped}, document, null, XPathResult.ANY_TYPE, null); }} \
+                catch (e) {{ return String(e && e.message || e); }} \
+                switch (r.resultType) {{ \
+                    case XPathResult.NUMBER_TYPE: return [String(r.numberValue)]; \
+                    case XPathResult.STRING_TYPE: return [r.stringValue]; \
+                    case XPathResult.BOOLEAN_TYPE: return [String(r.booleanValue)]; \
+                }} \
+                var out = [], n; \
+                while ((n = r.iterateNext())) out.push(n.textContent || ''); \
+                return out; \
+            }})()"
+        );
+
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &js,
+            self.options.timeout,
+        )? {
+            JSValue::Array(items) => items
+                .into_iter()
+                .map(|item| match item {
+                    JSValue::String(s) => Ok(s),
+                    other => Err(PageError::JsError(format!(
+                        "unexpected XPath item: {other:?}"
+                    ))),
+                })
+                .collect(),
+            JSValue::String(msg) => Err(PageError::InvalidArgument(format!(
+                "invalid XPath {xpath:?}: {msg}"
+            ))),
+            JSValue::Null | JSValue::Undefined => Err(PageError::JsError(
+                "document.evaluate() is not available".into(),
+            )),
+            other => Err(PageError::JsError(format!(
+                "unexpected XPath result: {other:?}"
+            ))),
+        }
+    }
+
+    /// Check that `selector` parses, and count the elements it matches in the
+    /// current document. Nothing on the page is touched.
+    pub fn validate_selector(&self, selector: &str) -> Result<Validation, PageError> {
+        let escaped = js_string_literal(selector);
+        self.run_validation(&format!(
+            "(function() {{ \
+                try {{ return document.querySelectorAll({escaped}).length; }} \
+                catch (e) {{ return String(e && e.message || e); }} \
+            }})()"
+        ))
+    }
+
+    /// Check that `script` parses as a classic script, the way
+    /// [`evaluate()`](Self::evaluate) runs it, without running it: `return`
+    /// outside a function, top-level `await` and `import`/`export` are syntax
+    /// errors.
+    ///
+    /// Servo compiles the script itself behind a leading `throw`, so the
+    /// page's CSP does not apply (unlike `eval` or `new Function`) and none
+    /// of it executes. Its `var` names (and sloppy-mode block function names)
+    /// may still be declared on `window` as `undefined`, and the page's
+    /// `error` listeners may see the probe's exception.
+    pub fn validate_script(&self, script: &str) -> Result<Validation, PageError> {
+        let webview = self.webview()?;
+        let _ = eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            JS_ERROR_TAKE,
+            self.options.timeout,
+        );
+        // The block gives script semantics without hoisting declarations to
+        // the global scope; the uncalled function copy makes unbalanced
+        // braces that would close the block a syntax error.
+        let probe = format!("throw null;\n{{\n{script}\n}}\n(function() {{\n{script}\n}});");
+        let result = eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &probe,
+            self.options.timeout,
+        );
+        match result {
+            Err(PageError::JsError(detail)) if detail.starts_with("CompilationFailure") => {
+                let details = self.js_error_details(webview, &detail);
+                Ok(Validation {
+                    valid: false,
+                    error: Some(details.message),
+                    matches: None,
+                })
+            }
+            // The leading `throw` ran, so the whole script compiled.
+            Err(PageError::JsError(_)) => {
+                let _ = eval_js(
+                    &self.servo,
+                    &self.event_loop,
+                    webview,
+                    JS_ERROR_TAKE,
+                    self.options.timeout,
+                );
+                Ok(Validation {
+                    valid: true,
+                    error: None,
+                    matches: None,
+                })
+            }
+            Ok(other) => Err(PageError::JsError(format!(
+                "unexpected validation result: {other:?}"
+            ))),
+            Err(e) => Err(e),
+        }
+    }
+
+    /// Evaluate a validation probe returning a match count or an error
+    /// message.
+    fn run_validation(&self, js: &str) -> Result<Validation, PageError> {
+        let webview = self.webview()?;
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            js,
+            self.options.timeout,
+        )? {
+            JSValue::Number(n) => Ok(Validation {
+                valid: true,
+                error: None,
+                matches: Some(n as usize),
+            }),
+            JSValue::String(msg) => Ok(Validation {
+                valid: false,
+                error: Some(msg),
+                matches: None,
+            }),
+            other => Err(PageError::JsError(format!(
+                "unexpected validation result: {other:?}"
+            ))),
+        }
+    }
+
+    /// List the document's `<a href>` and `<area href>` links in document
+    /// order, with their `rel` and `target` attributes and whether `rel`
+    /// marks them nofollow, sponsored or UGC.
+    pub fn links_detailed(&self) -> Result<Vec<Link>, PageError> {
+        let webview = self.webview()?;
+        let js = "(function() { \
+                return Array.prototype.map.call(document.querySelectorAll('a[href], area[href]'), function(a) { \
+                    return [a.href, (a.textContent || a.getAttribute('alt') || '').replace(/\\s+/g, ' ').trim(), \
+                            a.getAttribute('rel'), a.getAttribute('target')]; \
+                }); \
+            })()";
+
+        let optional = |v: &JSValue| match v {
+            JSValue::String(s) => Some(s.clone()),
+            _ => None,
+        };
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            js,
+            self.options.timeout,
+        )? {
+            JSValue::Array(items) => items
+                .iter()
+                .map(|item| match item {
+                    JSValue::Array(fields) => match fields.as_slice() {
+                        [JSValue::String(url), JSValue::String(text), rel, target] => {
+                            let rel = optional(rel);
+                            let has = |token: &str| {
+                                rel.as_deref().is_some_and(|r| {
+                                    r.split_ascii_whitespace()
+                                        .any(|t| t.eq_ignore_ascii_case(token))
+                                })
+                            };
+                            Ok(Link {
+                                url: url.clone(),
+                                text: text.clone(),
+                                nofollow: has("nofollow"),
+                                sponsored: has("sponsored"),
+                                ugc: has("ugc"),
+                                rel,
+                                target: optional(target),
+                            })
+                        }
+                        other => Err(PageError::JsError(format!(
+                            "unexpected link item: {other:?}"
+                        ))),
+                    },
+                    other => Err(PageError::JsError(format!(
+                        "unexpected link item: {other:?}"
+                    ))),
+                })
+                .collect(),
+            other => Err(PageError::JsError(format!(
+                "unexpected links result: {other:?}"
+            ))),
+        }
+    }
+
+    /// List the stylesheets, scripts and/or images the document declares, as
+    /// absolute URLs in document order, without duplicates. Unlike
+    /// [`network_requests()`](Self::network_requests) this reflects the
+    /// current DOM, not what was fetched.
+    pub fn resources(&self, types: &[ResourceType]) -> Result<Vec<PageResource>, PageError> {
+        let webview = self.webview()?;
+        let wanted = |t| types.contains(&t);
+        let js = format!(
+            "(function(css, js, img) {{ \
+                var out = [], seen = {{}}; \
+                function add(type, url) {{ \
+                    if (!url || seen[type + ' ' + url]) return; \
+                    seen[type + ' ' + url] = true; \
+                    out.push([type, url]); \
+                }} \
+                if (css) document.querySelectorAll('link[href]').forEach(function(l) {{ \
+                    if (/(^|\\s)stylesheet(\\s|$)/i.test(l.rel)) add('stylesheet', l.href); \
+                }}); \
+                if (js) document.querySelectorAll('script[src]').forEach(function(s) {{ \
+                    add('script', s.src); \
+                }}); \
+                if (img) document.querySelectorAll('img').forEach(function(i) {{ \
+                    add('image', i.currentSrc || i.src); \
+                }}); \
+                return out; \
+            }})({}, {}, {})",
+            wanted(ResourceType::Stylesheet),
+            wanted(ResourceType::Script),
+            wanted(ResourceType::Image),
+        );
+
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            &js,
+            self.options.timeout,
+        )? {
+            JSValue::Array(items) => items
+                .iter()
+                .map(|item| match item {
+                    JSValue::Array(pair) => match pair.as_slice() {
+                        [JSValue::String(kind), JSValue::String(url)] => {
+                            let kind = match kind.as_str() {
+                                "stylesheet" => ResourceType::Stylesheet,
+                                "script" => ResourceType::Script,
+                                _ => ResourceType::Image,
+                            };
+                            Ok(PageResource {
+                                kind,
+                                url: url.clone(),
+                            })
+                        }
+                        _ => Err(PageError::JsError("invalid resource entry".into())),
+                    },
+                    _ => Err(PageError::JsError("invalid resource entry".into())),
+                })
+                .collect(),
+            other => Err(PageError::JsError(format!(
+                "unexpected resources result: {other:?}"
+            ))),
+        }
+    }
+
+    /// List the font families the current document renders text with, and
+    /// the web fonts it declares, to diagnose font substitution (e.g. between
+    /// hosts with different installed fonts). Each entry says whether the
+    /// family is a web font (with its load status), a system font, a generic
+    /// family or the browser default, and which earlier families of the
+    /// elements' `font-family` were skipped; failed web fonts are included.
+    ///
+    /// Servo does not expose its font matching, so this is resolved in the
+    /// page from `document.fonts`, the CSSOM and text measurements; fallback
+    /// for individual glyphs a font lacks is not detected.
+    pub fn used_fonts(&self) -> Result<Vec<UsedFont>, PageError> {
+        let webview = self.webview()?;
+        let json = match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            USED_FONTS_JS,
+            self.options.timeout,
+        )? {
+            JSValue::String(json) => json,
+            other => {
+                return Err(PageError::JsError(format!(
+                    "unexpected used fonts result: {other:?}"
+                )));
+            }
+        };
+        let fonts: Vec<RecordedFont> = serde_json::from_str(&json)
+            .map_err(|e| PageError::JsError(format!("bad used fonts record: {e}")))?;
+        Ok(fonts
+            .into_iter()
+            .map(|f| UsedFont {
+                family: f.family,
+                source: f.source,
+                status: f.status,
+                elements: f.elements,
+                fallback_for: f.fallback_for,
+            })
+            .collect())
+    }
+
+    /// List the stylesheets and scripts that blocked the first paint of the
+    /// current document, with their fetch durations.
+    ///
+    /// Uses `PerformanceResourceTiming.renderBlockingStatus` where the engine
+    /// reports it; otherwise applicable stylesheets and parser-blocking
+    /// scripts in `<head>` count as blocking. `async`/`defer` scripts are only
+    /// listed when they had finished loading before the first paint, and no
+    /// resource requested after it is listed.
+    pub fn render_blocking(&self) -> Result<Vec<BlockingResource>, PageError> {
+        let webview = self.webview()?;
+        let js = "(function() { \
+                var paint = performance.getEntriesByType('paint').filter(function(e) { \
+                    return e.name === 'first-paint' || e.name === 'first-contentful-paint'; \
+                }).map(function(e) { return e.startTime; }); \
+                var fp = paint.length ? Math.min.apply(null, paint) : Infinity; \
+                var timing = {}; \
+                performance.getEntriesByType('resource').forEach(function(e) { \
+                    if (!timing[e.name]) timing[e.name] = e; \
+                }); \
+                var out = []; \
+                function add(type, url, inHead, async, defer) { \
+                    var t = timing[url]; \
+                    if (t && t.startTime > fp) return; \
+                    var blocking; \
+                    if (async || defer) blocking = !!t && t.responseEnd <= fp; \
+                    else if (t && typeof t.renderBlockingStatus === 'string') \
+                        blocking = t.renderBlockingStatus === 'blocking'; \
+                    else blocking = type === 'stylesheet' || inHead; \
+                    if (blocking) out.push([type, url, t ? t.duration : null, async, defer]); \
+                } \
+                document.querySelectorAll('link[href]').forEach(function(l) { \
+                    if (!/(^|\\s)stylesheet(\\s|$)/i.test(l.rel) || l.disabled) return; \
+                    if (l.media && !matchMedia(l.media).matches) return; \
+                    add('stylesheet', l.href, !!l.closest('head'), false, false); \
+                }); \
+                document.querySelectorAll('script[src]').forEach(function(s) { \
+                    var module = s.type === 'module'; \
+                    add('script', s.src, !!s.closest('head'), s.async, s.defer || module); \
+                }); \
+                return out; \
+            })()";
+
+        match eval_js(
+            &self.servo,
+            &self.event_loop,
+            webview,
+            js,
+            self.options.timeout,
+        )? {
+            JSValue::Array(items) => items
+                .iter()
+                .map(|item| match item {
+                    JSValue::Array(fields) => match fields.as_slice() {
+                        [
+                            JSValue::String(kind),
+                            JSValue::String(url),
+                            duration,
+                            JSValue::Boolean(is_async),
+                            JSValue::Boolean(defer),
+                        ] => Ok(BlockingResource {
+                            kind: if kind == "stylesheet" {
+                                ResourceType::Stylesheet
+                            } else {
+                                ResourceType::Script
+                            },
+                            url: url.clone(),
+                            duration_ms: match duration {
+                                JSValue::Number(ms) => Some(*ms),
+                                _ => None,
+                            },
+                            is_async: *is_async,
+                            defer: *defer,
+                        }),
+                        _ => Err(PageError::JsError("invalid render-blocking entry".into())),
+                    },
+                    _ => Err(PageError::JsError("invalid render-blocking entry".into())),
+                })
+                .collect(),
+            other => Err(PageError::JsError(format!(
+                "unexpected render-blocking result: {other:?}"
+            ))),
+        }
+    }
+
     /// Get the text content of the first element matching a CSS selector.
     pub fn element_text(&self, selector: &str) -> Result<String, PageError> {
         let webview = self.webview()?;
@@ -1636,11 +5998,88 @@ impl PageEngine {
         self.pages.len()
     }
 
+    /// Release memory the engine no longer needs: shrink per-page buffers and
+    /// spin the event loop briefly so Servo finishes tearing down closed pages
+    /// and their documents. Open pages and their state are left intact.
+    ///
+    /// This does not run the JS garbage collector or drop Servo's caches:
+    /// the embedding API exposes no GC or memory-pressure hook, so script
+    /// heaps shrink only when SpiderMonkey collects on its own schedule.
+    pub fn reclaim_memory(&mut self) {
+        for page in self.pages.values() {
+            page.delegate.console_messages.borrow_mut().shrink_to_fit();
+            page.delegate.network_requests.borrow_mut().shrink_to_fit();
+        }
+        self.popup_buffer.borrow_mut().shrink_to_fit();
+        spin_for(&self.servo, &self.event_loop, Duration::from_millis(50));
+    }
+
     /// Enable or disable popup capture. When disabled (default), popups are blocked.
     pub fn set_popup_handling(&mut self, enabled: bool) {
         self.popup_enabled.set(enabled);
     }
 
+    /// Allow or forbid `file:` URLs, both for `open()` and for subresources
+    /// of any page. Off by default so untrusted pages cannot read local files.
+    pub fn set_allow_file_access(&mut self, enabled: bool) {
+        self.shared.allow_file_access.set(enabled);
+    }
+
+    /// Refuse to decode HTTP(S) images larger than `pixels` (width × height),
+    /// e.g. decompression bombs; they render as broken images. The default
+    /// (also after `reset()`) is 100 megapixels, about 400 MB decoded; `0`
+    /// disables the check.
+    ///
+    /// Dimensions are read from the PNG, GIF, JPEG, WebP or BMP header, so
+    /// while a limit is set every HTTP(S) image is fetched by the embedder,
+    /// bypassing Servo's HTTP cache and cookie jar. Disable it for trusted
+    /// sites whose images need cookies or should be cached.
+    pub fn set_max_image_pixels(&mut self, pixels: u64) {
+        self.shared.max_image_pixels.set(pixels);
+    }
+
+    /// Allow at most `n` concurrent requests per host (`host:port`) for all
+    /// pages; `0` (the default) leaves them unlimited. Queued requests wait
+    /// for a free slot.
+    ///
+    /// Servo does not report when its own requests finish, so while a limit
+    /// is set HTTP(S) `GET`/`HEAD` requests are fetched by the embedder,
+    /// bypassing Servo's HTTP cache and cookie jar: they carry no cookies and
+    /// cookies they set are not stored. Requests with a body are sent by
+    /// Servo and not counted. [`reset()`](Self::reset) lifts the limit.
+    pub fn set_max_connections_per_host(&mut self, n: usize) {
+        host_connections().set_limit(n);
+    }
+
+    /// Append one JSON line per request of every page in the process to
+    /// `path`, like a web server access log; `None` stops logging. The file
+    /// is created if missing and never truncated.
+    ///
+    /// Lines look like `{"time_ms", "method", "url", "main_frame",
+    /// "page_url"}`, with `time_ms` since the Unix epoch and `page_url` the
+    /// document that made the request (`null` before the first load). They
+    /// are written when the request starts, including requests later blocked
+    /// or aborted; Servo does not report responses, so there is no status.
+    pub fn set_access_log(path: Option<&Path>) -> Result<(), PageError> {
+        let file = match path {
+            Some(path) => Some(
+                std::fs::OpenOptions::new()
+                    .create(true)
+                    .append(true)
+                    .open(path)
+                    .map_err(|e| {
+                        PageError::InvalidArgument(format!(
+                            "cannot open access log {}: {e}",
+                            path.display()
+                        ))
+                    })?,
+            ),
+            None => None,
+        };
+        *ACCESS_LOG.lock().unwrap_or_else(|e| e.into_inner()) = file;
+        Ok(())
+    }
+
     /// Drain pending popup WebViews, assign page IDs, and return them.
     pub fn popup_pages(&mut self) -> Vec<u32> {
         let popups: Vec<PendingPopup> = self.popup_buffer.borrow_mut().drain(..).collect();
@@ -1658,6 +6097,7 @@ impl PageEngine {
                     delegate: popup.delegate,
                     width,
                     height,
+                    popup: true,
                 },
             );
             ids.push(id);
@@ -1665,6 +6105,35 @@ impl PageEngine {
         ids
     }
 
+    /// List every open page — tabs from `new_page()` and popups — ordered by
+    /// ID, adopting pending popups first like [`popup_pages()`](Self::popup_pages).
+    /// Popups are only captured with [`set_popup_handling(true)`](Self::set_popup_handling).
+    pub fn windows(&mut self) -> Vec<WindowInfo> {
+        self.popup_pages();
+        self.page_ids()
+            .into_iter()
+            .enumerate()
+            .map(|(index, id)| WindowInfo {
+                index,
+                id,
+                url: self.page_url(id),
+                title: self.page_title(id),
+                popup: self.pages[&id].popup,
+                active: self.active_page_id == Some(id),
+            })
+            .collect()
+    }
+
+    /// Make the window at `index` in [`windows()`](Self::windows) the active
+    /// page, so `html()`, `screenshot()` etc. operate on it.
+    pub fn switch_window(&mut self, index: usize) -> Result<(), PageError> {
+        self.popup_pages();
+        match self.page_ids().get(index) {
+            Some(&id) => self.switch_to(id),
+            None => Err(PageError::NoPage),
+        }
+    }
+
     /// Get the URL of a specific page by ID (without switching).
     pub fn page_url(&self, page_id: u32) -> Option<String> {
         self.pages
@@ -1681,3 +6150,261 @@ impl PageEngine {
             .and_then(|wv| wv.page_title())
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn image_dimensions_reads_headers() {
+        let mut png = b"\x89PNG\r\n\x1a\n\0\0\0\x0dIHDR".to_vec();
+        png.extend_from_slice(&640u32.to_be_bytes());
+        png.extend_from_slice(&480u32.to_be_bytes());
+        assert_eq!(image_dimensions(&png), Some((640, 480)));
+
+        assert_eq!(
+            image_dimensions(b"GIF89a\x20\x03\x58\x02"),
+            Some((800, 600))
+        );
+
+        let mut bmp = vec![0; 26];
+        bmp[..2].copy_from_slice(b"BM");
+        bmp[18..22].copy_from_slice(&1024i32.to_le_bytes());
+        bmp[22..26].copy_from_slice(&(-768i32).to_le_bytes());
+        assert_eq!(image_dimensions(&bmp), Some((1024, 768)));
+
+        let webp = |chunk: &[u8; 4], payload: &[u8]| {
+            let mut data = b"RIFF\0\0\0\0WEBP".to_vec();
+            data.extend_from_slice(chunk);
+            data.extend_from_slice(&[0; 4]);
+            data.extend_from_slice(payload);
+            data
+        };
+        let lossy = webp(b"VP8 ", b"\0\0\0\x9d\x01\x2a\x2c\x01\xc8\x00");
+        assert_eq!(image_dimensions(&lossy), Some((300, 200)));
+        let bits = 299u32 | (199 << 14);
+        let mut lossless = vec![0x2f];
+        lossless.extend_from_slice(&bits.to_le_bytes());
+        assert_eq!(
+            image_dimensions(&webp(b"VP8L", &lossless)),
+            Some((300, 200))
+        );
+        let extended = webp(b"VP8X", b"\0\0\0\0\x2b\x01\0\xc7\0\0");
+        assert_eq!(image_dimensions(&extended), Some((300, 200)));
+
+        // SOI, an APP0 segment, then SOF0 (height before width).
+        let jpeg = b"\xff\xd8\xff\xe0\x00\x04\0\0\xff\xc0\x00\x11\x08\x01\xe0\x02\x80";
+        assert_eq!(image_dimensions(jpeg), Some((640, 480)));
+    }
+
+    #[test]
+    fn cookie_with_same_site_replaces_the_attribute() {
+        assert_eq!(
+            cookie_with_same_site("a=1; Path=/; samesite=strict", SameSite::Lax),
+            "a=1; Path=/; SameSite=Lax"
+        );
+        assert_eq!(
+            cookie_with_same_site("a=1;SameSite = None;Secure", SameSite::Strict),
+            "a=1; Secure; SameSite=Strict"
+        );
+        assert_eq!(
+            cookie_with_same_site("a=1; Secure", SameSite::None),
+            "a=1; Secure; SameSite=None"
+        );
+        // Only attributes are replaced, not a cookie named "samesite".
+        assert_eq!(
+            cookie_with_same_site("SameSite=1", SameSite::Lax),
+            "SameSite=1; SameSite=Lax"
+        );
+    }
+
+    #[test]
+    fn header_rule_matches_origin_and_path_prefix() {
+        let rule = |prefix: &str| HeaderRule {
+            prefix: Url::parse(prefix).unwrap(),
+            name: header::AUTHORIZATION,
+            value: None,
+        };
+        let matches = |rule: &HeaderRule, url: &str| rule.matches(&Url::parse(url).unwrap());
+
+        let api = rule("https://api.example.com/v1");
+        assert!(matches(&api, "https://api.example.com/v1"));
+        assert!(matches(&api, "https://api.example.com/v1/users?page=2"));
+        assert!(matches(&api, "https://API.example.com:443/v1/"));
+        assert!(!matches(&api, "https://api.example.com/v10"));
+        assert!(!matches(&api, "https://api.example.com/"));
+        assert!(!matches(&api, "http://api.example.com/v1"));
+        assert!(!matches(&api, "https://api.example.com:8443/v1"));
+        assert!(!matches(&api, "https://api.example.com.evil.test/v1"));
+        assert!(!matches(
+            &api,
+            "https://evil.test/?next=https://api.example.com/v1"
+        ));
+
+        let root = rule("https://api.example.com");
+        assert!(matches(&root, "https://api.example.com/anything"));
+        let dir = rule("https://api.example.com/v1/");
+        assert!(matches(&dir, "https://api.example.com/v1/users"));
+        assert!(!matches(&dir, "https://api.example.com/v1"));
+    }
+
+    #[test]
+    fn host_connections_count_slots_per_host() {
+        let connections = HostConnections::new();
+        connections.set_limit(2);
+        let a = Url::parse("https://a.example/x").unwrap();
+        let a_explicit_port = Url::parse("https://a.example:443/y").unwrap();
+        let a_other_port = Url::parse("https://a.example:8443/").unwrap();
+        let active = |host: &str| connections.state().active.get(host).copied();
+
+        let first = connections.acquire(&a);
+        let second = connections.acquire(&a_explicit_port);
+        let other = connections.acquire(&a_other_port);
+        assert_eq!(active("a.example:443"), Some(2));
+        assert_eq!(active("a.example:8443"), Some(1));
+
+        drop(first);
+        assert_eq!(active("a.example:443"), Some(1));
+        // A freed slot lets the next fetch in without blocking.
+        let third = connections.acquire(&a);
+        assert_eq!(active("a.example:443"), Some(2));
+
+        drop((second, third, other));
+        assert!(connections.state().active.is_empty());
+    }
+
+    #[test]
+    fn host_connections_wait_for_a_free_slot() {
+        let connections = Arc::new(HostConnections::new());
+        connections.set_limit(1);
+        let url = Url::parse("http://b.example/").unwrap();
+        let slot = connections.acquire(&url);
+
+        let (sender, receiver) = std::sync::mpsc::channel();
+        let waiter = {
+            let connections = connections.clone();
+            let url = url.clone();
+            std::thread::spawn(move || {
+                let _slot = connections.acquire(&url);
+                sender.send(()).unwrap();
+            })
+        };
+        assert!(receiver.recv_timeout(Duration::from_millis(100)).is_err());
+        drop(slot);
+        receiver
+            .recv_timeout(Duration::from_secs(5))
+            .expect("waiter not woken");
+        waiter.join().unwrap();
+        assert!(connections.state().active.is_empty());
+    }
+
+    #[test]
+    fn image_dimensions_rejects_other_data() {
+        assert_eq!(image_dimensions(b""), None);
+        assert_eq!(image_dimensions(b"<svg></svg>"), None);
+        assert_eq!(image_dimensions(b"\x89PNG\r\n\x1a\n\0\0"), None);
+        assert_eq!(image_dimensions(b"GIF89a\x01"), None);
+        // A JPEG that ends before its start-of-frame.
+        assert_eq!(image_dimensions(b"\xff\xd8\xff\xe0\x00\x10"), None);
+        assert_eq!(image_dimensions(b"RIFF\0\0\0\0WEBPVP8?"), None);
+    }
+
+    #[test]
+    fn parse_css_url_reads_bare_and_quoted_urls() {
+        assert_eq!(parse_css_url("url( a.png )x", 4), Some(("a.png", 12)));
+        let css = r#"url("a b).png" )"#;
+        assert_eq!(parse_css_url(css, 4), Some(("a b).png", css.len())));
+        let css = r"url('x\'y')";
+        assert_eq!(parse_css_url(css, 4), Some((r"x\'y", css.len())));
+        assert_eq!(parse_css_url(r#"url("a.png" x)"#, 4), None);
+        assert_eq!(parse_css_url(r#"url("a.png)"#, 4), None);
+        assert_eq!(parse_css_url("url(a.png", 4), None);
+    }
+
+    #[test]
+    fn parse_css_import_reads_target_and_media() {
+        let css = r#"@import "a.css";"#;
+        assert_eq!(parse_css_import(css, 7), Some(("a.css", "", css.len())));
+        let css = "@import url(b.css) screen and (min-width: 600px);p{}";
+        assert_eq!(
+            parse_css_import(css, 7),
+            Some(("b.css", "screen and (min-width: 600px)", css.len() - 3))
+        );
+        // The last rule of a sheet may omit its `;`.
+        let css = "@import 'c.css' print";
+        assert_eq!(
+            parse_css_import(css, 7),
+            Some(("c.css", "print", css.len()))
+        );
+        assert_eq!(parse_css_import("@import c.css;", 7), None);
+    }
+
+    #[test]
+    fn single_file_css_inlines_urls_and_imports() {
+        let base = Url::parse("https://example.com/css/site.css").unwrap();
+        let asset = |path: &str, body: &[u8], mime: &str| {
+            let url = base.join(path).unwrap();
+            (url, Some((body.to_vec(), mime.to_string())))
+        };
+        let mut assets = SingleFile {
+            // Refuse everything not cached below, so nothing is fetched.
+            policy: AssetPolicy {
+                user_agent: None,
+                blocked: vec![String::new()],
+                offline: false,
+                interceptor: None,
+            },
+            max_asset_bytes: 0,
+            timeout: Duration::from_secs(1),
+            fetched: HashMap::from([
+                asset("img.png", b"GIF", "image/gif"),
+                asset("sub.css", b"d { background: url(img.png#top) }", "text/css"),
+            ]),
+        };
+        let css = concat!(
+            "/* url(comment.png) @import \"comment.css\"; */\n",
+            "a { content: \"url(string.png)\"; background: URL( 'img.png' ) }\n",
+            "b { mask: url(#clip); src: url(data:font/woff2;base64,AAAA); x: my-url(x) }\n",
+            "@import \"sub.css\" print;\n",
+            "@import url(gone.css) screen;\n",
+            "c { background: url(/missing.png) }\n",
+        );
+        assert_eq!(
+            assets.css(css, &base, 0),
+            concat!(
+                "/* url(comment.png) @import \"comment.css\"; */\n",
+                "a { content: \"url(string.png)\"; background: url(\"data:image/gif;base64,R0lG\") }\n",
+                "b { mask: url(\"#clip\"); src: url(\"data:font/woff2;base64,AAAA\"); x: my-url(x) }\n",
+                "@media print {\n",
+                "d { background: url(\"data:image/gif;base64,R0lG#top\") }\n",
+                "}\n",
+                "@import url(\"https://example.com/css/gone.css\") screen;\n",
+                "c { background: url(\"https://example.com/missing.png\") }\n",
+            )
+        );
+    }
+
+    #[test]
+    fn content_disposition_names_attachments() {
+        assert!(is_attachment("attachment"));
+        assert!(is_attachment(" Attachment ; filename=a.txt"));
+        assert!(!is_attachment("inline; filename=a.txt"));
+
+        assert_eq!(
+            disposition_filename("attachment; filename=\"report 1.csv\""),
+            Some("report 1.csv".into())
+        );
+        assert_eq!(
+            disposition_filename(
+                "attachment; filename=plain.txt; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf"
+            ),
+            Some("résumé.pdf".into())
+        );
+        assert_eq!(
+            disposition_filename("attachment; FILENAME*=utf-8'en'100%25.txt"),
+            Some("100%.txt".into())
+        );
+        assert_eq!(disposition_filename("attachment"), None);
+        assert_eq!(disposition_filename("attachment; filename=\"\""), None);
+    }
+}
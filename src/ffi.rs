@@ -4,8 +4,14 @@
 
 //! Layer 3: C FFI — `extern "C"` functions wrapping [`Page`](crate::Page).
 
-use crate::page::Page;
-use crate::types::{InputFile, PageError, PageOptions};
+use crate::page::{
+    Page, PageJob, SendHtmlStreamCallback, SendProgressCallback, SendRequestInterceptor,
+};
+use crate::types::{
+    ConnectionType, CookiePolicy, ElementTarget, FeatureFlags, InputFile, InterceptedRequest,
+    JsWorld, LoadProgress, PageError, PageOptions, RequestAction, ResourceType, SameSite,
+    Validation,
+};
 
 const PAGE_OK: i32 = 0;
 const PAGE_ERR_INIT: i32 = 1;
@@ -17,8 +23,108 @@ const PAGE_ERR_CHANNEL: i32 = 6;
 const PAGE_ERR_NULL_PTR: i32 = 7;
 const PAGE_ERR_NO_PAGE: i32 = 8;
 const PAGE_ERR_SELECTOR: i32 = 9;
+const PAGE_ERR_INVALID_ARG: i32 = 10;
 
+thread_local! {
+    /// The last error returned on this thread, as a JSON object, for
+    /// `scraper_last_error_json()`. Every nonzero return records one.
+    static LAST_ERROR: std::cell::RefCell<Option<serde_json::Value>> =
+        const { std::cell::RefCell::new(None) };
+}
+
+/// Map `e` to its code and record it as this thread's last error.
 fn error_code(e: &PageError) -> i32 {
+    error_code_with(e, serde_json::Value::Null)
+}
+
+/// Like `error_code()`, merging the fields of the `context` object (the URL,
+/// JS exception, ... of the failed operation) into the recorded error.
+fn error_code_with(e: &PageError, context: serde_json::Value) -> i32 {
+    let code = page_error_code(e);
+    let detail = match e {
+        PageError::InitFailed(msg)
+        | PageError::LoadFailed(msg)
+        | PageError::JsError(msg)
+        | PageError::ScreenshotFailed(msg)
+        | PageError::InvalidArgument(msg) => Some(msg),
+        PageError::Timeout
+        | PageError::ChannelClosed
+        | PageError::NoPage
+        | PageError::SelectorNotFound(_) => None,
+    };
+    let mut error = serde_json::json!({
+        "code": code,
+        "kind": error_kind(code),
+        "message": e.to_string(),
+    });
+    if let Some(detail) = detail {
+        error["detail"] = detail.as_str().into();
+    }
+    if let PageError::SelectorNotFound(selector) = e {
+        error["selector"] = selector.as_str().into();
+    }
+    if let serde_json::Value::Object(fields) = context {
+        for (key, value) in fields.into_iter().filter(|(_, value)| !value.is_null()) {
+            error[key] = value;
+        }
+    }
+    LAST_ERROR.with(|last| *last.borrow_mut() = Some(error));
+    code
+}
+
+/// Record a failure caught before reaching the engine, which has no
+/// `PageError`, and return `code`.
+fn fail(code: i32, message: &str) -> i32 {
+    let error = serde_json::json!({
+        "code": code,
+        "kind": error_kind(code),
+        "message": message,
+    });
+    LAST_ERROR.with(|last| *last.borrow_mut() = Some(error));
+    code
+}
+
+/// A required pointer argument was NULL.
+fn null_ptr() -> i32 {
+    fail(PAGE_ERR_NULL_PTR, "a required pointer argument is NULL")
+}
+
+/// A string argument was not valid UTF-8; `code` is the function's
+/// documented code for that.
+fn not_utf8(code: i32) -> i32 {
+    fail(code, "a string argument is not valid UTF-8")
+}
+
+/// A result string contained a NUL byte, so it cannot be returned as a C
+/// string.
+fn nul_byte() -> i32 {
+    fail(PAGE_ERR_JS, "the result contains a NUL byte")
+}
+
+/// A file could not be written by a function that saves images to disk.
+fn write_failed(path: &std::path::Path, e: std::io::Error) -> i32 {
+    let e = PageError::ScreenshotFailed(format!("cannot write {}: {e}", path.display()));
+    error_code_with(&e, serde_json::json!({ "path": path }))
+}
+
+/// The `kind` of the last-error JSON for `code`.
+fn error_kind(code: i32) -> &'static str {
+    match code {
+        PAGE_ERR_INIT => "init_failed",
+        PAGE_ERR_LOAD => "load_failed",
+        PAGE_ERR_TIMEOUT => "timeout",
+        PAGE_ERR_JS => "js_error",
+        PAGE_ERR_SCREENSHOT => "screenshot_failed",
+        PAGE_ERR_CHANNEL => "channel_closed",
+        PAGE_ERR_NULL_PTR => "null_pointer",
+        PAGE_ERR_NO_PAGE => "no_page",
+        PAGE_ERR_SELECTOR => "selector_not_found",
+        PAGE_ERR_INVALID_ARG => "invalid_argument",
+        _ => "unknown",
+    }
+}
+
+fn page_error_code(e: &PageError) -> i32 {
     match e {
         PageError::InitFailed(_) => PAGE_ERR_INIT,
         PageError::LoadFailed(_) => PAGE_ERR_LOAD,
@@ -28,11 +134,15 @@ fn error_code(e: &PageError) -> i32 {
         PageError::ChannelClosed => PAGE_ERR_CHANNEL,
         PageError::NoPage => PAGE_ERR_NO_PAGE,
         PageError::SelectorNotFound(_) => PAGE_ERR_SELECTOR,
+        PageError::InvalidArgument(_) => PAGE_ERR_INVALID_ARG,
     }
 }
 
 // -- Lifecycle --
 
+/// Cache directory for pages created by subsequent `page_new()` calls.
+static CACHE_DIR: std::sync::Mutex<Option<std::path::PathBuf>> = std::sync::Mutex::new(None);
+
 /// Create a new page instance.
 ///
 /// Returns an opaque pointer, or NULL on failure.
@@ -53,6 +163,158 @@ pub unsafe extern "C" fn page_new(
     fullpage: i32,
     user_agent: *const std::ffi::c_char,
 ) -> *mut Page {
+    let options = unsafe { page_options(width, height, timeout, wait, fullpage, user_agent) };
+    let cache_dir = options.cache_dir.clone();
+    match Page::new(options) {
+        Ok(p) => Box::into_raw(Box::new(p)),
+        Err(e) => {
+            error_code_with(&e, serde_json::json!({ "cache_dir": cache_dir }));
+            std::ptr::null_mut()
+        }
+    }
+}
+
+/// Configuration object accepted by `page_new_json()`. Every key is optional;
+/// missing keys keep the `page_new()` defaults.
+#[derive(serde::Deserialize)]
+struct PageConfig {
+    width: Option<u32>,
+    height: Option<u32>,
+    timeout: Option<u64>,
+    wait: Option<f64>,
+    fullpage: Option<bool>,
+    user_agent: Option<String>,
+    cache_dir: Option<std::path::PathBuf>,
+    blocked_urls: Option<Vec<String>>,
+    accept: Option<String>,
+    accept_encoding: Option<String>,
+    origin: Option<String>,
+    connection: Option<String>,
+    allow_file_access: Option<bool>,
+    max_image_pixels: Option<u64>,
+    popups: Option<bool>,
+    #[serde(flatten)]
+    unknown: std::collections::BTreeMap<String, serde_json::Value>,
+}
+
+/// Create a new page instance from a JSON configuration object, e.g.
+/// `{"width": 1920, "height": 1080, "user_agent": "Bot/1.0"}`.
+///
+/// Recognized keys are `width`, `height`, `timeout`, `wait`, `fullpage`,
+/// `user_agent` and `cache_dir` (as for `scraper_set_cache_dir()`), plus
+/// settings applied right after creation: `blocked_urls`, `accept`,
+/// `accept_encoding`, `origin`, `connection`, `allow_file_access`,
+/// `max_image_pixels` and `popups`. The per-page ones are applied to an
+/// initial page that is already active, so the first `page_open()` uses them.
+/// Unknown keys are ignored with a log warning, written once the engine (and
+/// with it Servo's logger) exists; a rejected config is only reported by
+/// `scraper_last_error_json()`.
+///
+/// Returns NULL if `config_json` is NULL, not a JSON object, has a key of the
+/// wrong type or an invalid setting, or if the page cannot be created.
+///
+/// # Safety
+///
+/// The returned pointer must be freed with `page_free()`.
+/// `config_json` must be a valid C string.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_new_json(config_json: *const std::ffi::c_char) -> *mut Page {
+    if config_json.is_null() {
+        null_ptr();
+        return std::ptr::null_mut();
+    }
+    let config: PageConfig = match unsafe { std::ffi::CStr::from_ptr(config_json) }
+        .to_str()
+        .map_err(|e| e.to_string())
+        .and_then(|s| serde_json::from_str(s).map_err(|e| e.to_string()))
+    {
+        Ok(c) => c,
+        Err(e) => {
+            // No engine yet, so no logger either; the last error has the reason.
+            error_code(&PageError::InvalidArgument(format!("invalid config: {e}")));
+            return std::ptr::null_mut();
+        }
+    };
+    match page_from_config(config) {
+        Ok(page) => Box::into_raw(Box::new(page)),
+        Err(e) => {
+            log::warn!("page_new_json: {e}");
+            error_code(&e);
+            std::ptr::null_mut()
+        }
+    }
+}
+
+/// Create the page described by `config`. Per-page settings such as `accept`
+/// need a page to apply to, so an initial page is created and made active
+/// first; the first `page_open()` then navigates it, keeping the settings.
+fn page_from_config(config: PageConfig) -> Result<Page, PageError> {
+    let connection = config
+        .connection
+        .as_deref()
+        .map(str::parse::<ConnectionType>)
+        .transpose()?;
+
+    let defaults = PageOptions::default();
+    let options = PageOptions {
+        width: config.width.unwrap_or(defaults.width),
+        height: config.height.unwrap_or(defaults.height),
+        timeout: config.timeout.unwrap_or(defaults.timeout),
+        wait: config.wait.unwrap_or(defaults.wait),
+        fullpage: config.fullpage.unwrap_or(defaults.fullpage),
+        user_agent: config.user_agent,
+        cache_dir: config
+            .cache_dir
+            .or_else(|| CACHE_DIR.lock().unwrap_or_else(|e| e.into_inner()).clone()),
+    };
+    let page = Page::new(options)?;
+    // Creating the engine installs Servo's logger, so warn only now.
+    for key in config.unknown.keys() {
+        log::warn!("page_new_json: ignoring unknown key {key:?}");
+    }
+    let id = page.new_page()?;
+    page.switch_to(id)?;
+
+    if let Some(patterns) = config.blocked_urls {
+        page.block_urls(patterns);
+    }
+    if let Some(c) = connection {
+        page.set_connection_type(c);
+    }
+    if let Some(enabled) = config.allow_file_access {
+        page.set_allow_file_access(enabled);
+    }
+    if let Some(pixels) = config.max_image_pixels {
+        page.set_max_image_pixels(pixels);
+    }
+    if let Some(enabled) = config.popups {
+        page.set_popup_handling(enabled);
+    }
+    if let Some(value) = config.accept {
+        page.set_accept(Some(&value))?;
+    }
+    if let Some(value) = config.accept_encoding {
+        page.set_accept_encoding(Some(&value))?;
+    }
+    if let Some(value) = config.origin {
+        page.set_origin(Some(&value))?;
+    }
+    Ok(page)
+}
+
+/// Build `PageOptions` from `page_new()` arguments.
+///
+/// # Safety
+///
+/// `user_agent` must be a valid C string or NULL.
+unsafe fn page_options(
+    width: u32,
+    height: u32,
+    timeout: u64,
+    wait: f64,
+    fullpage: i32,
+    user_agent: *const std::ffi::c_char,
+) -> PageOptions {
     let ua = if user_agent.is_null() {
         None
     } else {
@@ -61,17 +323,14 @@ pub unsafe extern "C" fn page_new(
             Err(_) => None,
         }
     };
-    let options = PageOptions {
+    PageOptions {
         width,
         height,
         timeout,
         wait,
         fullpage: fullpage != 0,
         user_agent: ua,
-    };
-    match Page::new(options) {
-        Ok(p) => Box::into_raw(Box::new(p)),
-        Err(_) => std::ptr::null_mut(),
+        cache_dir: CACHE_DIR.lock().unwrap_or_else(|e| e.into_inner()).clone(),
     }
 }
 
@@ -96,7 +355,7 @@ pub unsafe extern "C" fn page_free(page: *mut Page) {
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn page_reset(page: *mut Page) -> i32 {
     if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     page.reset();
@@ -113,831 +372,2951 @@ pub unsafe extern "C" fn page_reset(page: *mut Page) -> i32 {
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn page_open(page: *mut Page, url: *const std::ffi::c_char) -> i32 {
     if page.is_null() || url.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     let url_str = match unsafe { std::ffi::CStr::from_ptr(url) }.to_str() {
         Ok(s) => s,
-        Err(_) => return PAGE_ERR_LOAD,
+        Err(_) => return not_utf8(PAGE_ERR_LOAD),
     };
     match page.open(url_str) {
         Ok(()) => PAGE_OK,
-        Err(e) => error_code(&e),
+        Err(e) => error_code_with(&e, serde_json::json!({ "url": url_str })),
     }
 }
 
-// -- Capture --
-
-/// Evaluate JavaScript and return the result as a JSON string.
-///
-/// On success, `*out_json` is set to a heap-allocated null-terminated string
-/// and `*out_len` to its length. Free with `page_string_free()`.
+/// Load `html` as the document and wait for it like `page_open()`. With a
+/// non-NULL `base_url` (HTTP(S)), the document takes that URL, so relative
+/// assets resolve against it.
 ///
 /// # Safety
 ///
-/// All pointer arguments must be valid or NULL.
+/// `page` and `html` must be valid pointers. `base_url` may be NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_evaluate(
+pub unsafe extern "C" fn page_load_html(
     page: *mut Page,
-    script: *const std::ffi::c_char,
-    out_json: *mut *mut std::ffi::c_char,
-    out_len: *mut usize,
+    html: *const std::ffi::c_char,
+    base_url: *const std::ffi::c_char,
 ) -> i32 {
-    if page.is_null() || script.is_null() || out_json.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || html.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    let script_str = match unsafe { std::ffi::CStr::from_ptr(script) }.to_str() {
+    let html = match unsafe { std::ffi::CStr::from_ptr(html) }.to_str() {
         Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+        Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
     };
-    match page.evaluate(script_str) {
-        Ok(json) => match std::ffi::CString::new(json) {
-            Ok(cstr) => {
-                let len = cstr.as_bytes().len();
-                let ptr = cstr.into_raw();
-                unsafe {
-                    *out_json = ptr;
-                    *out_len = len;
-                }
-                PAGE_OK
-            }
-            Err(_) => PAGE_ERR_JS,
-        },
-        Err(e) => error_code(&e),
+    let base_url = match unsafe { optional_str(base_url) } {
+        Ok(base_url) => base_url,
+        Err(()) => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    match page.load_html(html, base_url) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code_with(&e, serde_json::json!({ "url": base_url })),
     }
 }
 
-/// Take a screenshot. Returns PNG bytes.
-///
-/// On success, `*out_data` and `*out_len` are set. Free with `page_buffer_free()`.
+/// Change the document's base URL without navigating, so later extraction
+/// resolves relative URLs against `url`.
 ///
 /// # Safety
 ///
-/// All pointer arguments must be valid or NULL.
+/// `page` and `url` must be valid pointers.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_screenshot(
-    page: *mut Page,
-    out_data: *mut *mut u8,
-    out_len: *mut usize,
-) -> i32 {
-    if page.is_null() || out_data.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+pub unsafe extern "C" fn page_set_base_url(page: *mut Page, url: *const std::ffi::c_char) -> i32 {
+    if page.is_null() || url.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.screenshot() {
-        Ok(png_bytes) => {
-            let boxed = png_bytes.into_boxed_slice();
-            let len = boxed.len();
-            let ptr = Box::into_raw(boxed) as *mut u8;
-            unsafe {
-                *out_data = ptr;
-                *out_len = len;
-            }
-            PAGE_OK
+    let url_str = match unsafe { std::ffi::CStr::from_ptr(url) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    match page.set_base_url(url_str) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code_with(&e, serde_json::json!({ "url": url_str })),
+    }
+}
+
+// -- Async jobs --
+
+/// `page_job_poll()` / `page_job_wait()` status of an unfinished job.
+const PAGE_JOB_PENDING: i32 = -1;
+
+enum AnyJob {
+    Open(PageJob<()>),
+    Evaluate(PageJob<String>),
+}
+
+/// Handle for an operation started by `page_open_async()` or
+/// `page_evaluate_async()`.
+pub struct PageJobHandle {
+    job: AnyJob,
+    /// Result code and, for evaluate jobs, the JSON result once finished.
+    outcome: Option<(i32, Option<String>)>,
+    /// The last-error JSON of a failed job, recorded again by every poll
+    /// that returns its code.
+    error: Option<serde_json::Value>,
+}
+
+impl PageJobHandle {
+    fn new(job: AnyJob) -> Self {
+        Self {
+            job,
+            outcome: None,
+            error: None,
         }
-        Err(e) => error_code(&e),
+    }
+
+    /// Collect the result, waiting up to `timeout` (`None` = don't block).
+    /// Returns the result code, or `PAGE_JOB_PENDING`.
+    fn poll(&mut self, timeout: Option<std::time::Duration>) -> i32 {
+        if self.outcome.is_none() {
+            let result = match &self.job {
+                AnyJob::Open(job) => job_result(job, timeout).map(|r| r.map(|()| None)),
+                AnyJob::Evaluate(job) => job_result(job, timeout).map(|r| r.map(Some)),
+            };
+            self.outcome = result.map(|r| match r {
+                Ok(value) => (PAGE_OK, value),
+                Err(e) => {
+                    let code = error_code(&e);
+                    self.error = LAST_ERROR.with(|last| last.borrow().clone());
+                    (code, None)
+                }
+            });
+        } else if let Some(error) = &self.error {
+            LAST_ERROR.with(|last| *last.borrow_mut() = Some(error.clone()));
+        }
+        self.outcome
+            .as_ref()
+            .map_or(PAGE_JOB_PENDING, |(code, _)| *code)
     }
 }
 
-/// Take a full-page screenshot. Returns PNG bytes.
+fn job_result<T>(
+    job: &PageJob<T>,
+    timeout: Option<std::time::Duration>,
+) -> Option<Result<T, PageError>> {
+    match timeout {
+        Some(timeout) => job.wait_timeout(timeout),
+        None => job.try_result(),
+    }
+}
+
+/// Start loading a URL and return immediately with a job handle in `*out_job`.
+/// Free the handle with `page_job_free()`.
 ///
 /// # Safety
 ///
 /// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_screenshot_fullpage(
+pub unsafe extern "C" fn page_open_async(
     page: *mut Page,
-    out_data: *mut *mut u8,
-    out_len: *mut usize,
+    url: *const std::ffi::c_char,
+    out_job: *mut *mut PageJobHandle,
 ) -> i32 {
-    if page.is_null() || out_data.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || url.is_null() || out_job.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.screenshot_fullpage() {
-        Ok(png_bytes) => {
-            let boxed = png_bytes.into_boxed_slice();
-            let len = boxed.len();
-            let ptr = Box::into_raw(boxed) as *mut u8;
-            unsafe {
-                *out_data = ptr;
-                *out_len = len;
-            }
+    let url_str = match unsafe { std::ffi::CStr::from_ptr(url) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_LOAD),
+    };
+    match page.open_async(url_str) {
+        Ok(job) => {
+            unsafe { *out_job = Box::into_raw(Box::new(PageJobHandle::new(AnyJob::Open(job)))) };
             PAGE_OK
         }
         Err(e) => error_code(&e),
     }
 }
 
-/// Capture the page HTML.
-///
-/// On success, `*out_html` and `*out_len` are set. Free with `page_string_free()`.
+/// Start evaluating JavaScript and return immediately with a job handle in
+/// `*out_job`. Get the JSON result with `page_job_result()`.
 ///
 /// # Safety
 ///
 /// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_html(
+pub unsafe extern "C" fn page_evaluate_async(
     page: *mut Page,
-    out_html: *mut *mut std::ffi::c_char,
-    out_len: *mut usize,
+    script: *const std::ffi::c_char,
+    out_job: *mut *mut PageJobHandle,
 ) -> i32 {
-    if page.is_null() || out_html.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || script.is_null() || out_job.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.html() {
-        Ok(html) => match std::ffi::CString::new(html) {
-            Ok(cstr) => {
-                let len = cstr.as_bytes().len();
-                let ptr = cstr.into_raw();
-                unsafe {
-                    *out_html = ptr;
-                    *out_len = len;
-                }
-                PAGE_OK
-            }
-            Err(_) => PAGE_ERR_JS,
-        },
+    let script_str = match unsafe { std::ffi::CStr::from_ptr(script) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.evaluate_async(script_str) {
+        Ok(job) => {
+            unsafe {
+                *out_job = Box::into_raw(Box::new(PageJobHandle::new(AnyJob::Evaluate(job))))
+            };
+            PAGE_OK
+        }
         Err(e) => error_code(&e),
     }
 }
 
-// -- Page info --
-
-/// Get the current page URL.
+/// Check a job without blocking. `*out_status` is set to `PAGE_JOB_PENDING`
+/// or, once finished, the operation's result code.
 ///
 /// # Safety
 ///
 /// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_url(
-    page: *mut Page,
-    out_url: *mut *mut std::ffi::c_char,
-    out_len: *mut usize,
-) -> i32 {
-    if page.is_null() || out_url.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+pub unsafe extern "C" fn page_job_poll(job: *mut PageJobHandle, out_status: *mut i32) -> i32 {
+    if job.is_null() || out_status.is_null() {
+        return null_ptr();
     }
-    let page = unsafe { &*page };
-    match page.url() {
-        Some(url_str) => match std::ffi::CString::new(url_str) {
-            Ok(cstr) => {
-                let len = cstr.as_bytes().len();
-                let ptr = cstr.into_raw();
-                unsafe {
-                    *out_url = ptr;
-                    *out_len = len;
-                }
-                PAGE_OK
-            }
-            Err(_) => PAGE_ERR_JS,
-        },
-        None => PAGE_ERR_NO_PAGE,
+    let job = unsafe { &mut *job };
+    unsafe { *out_status = job.poll(None) };
+    PAGE_OK
+}
+
+/// Wait up to `timeout_ms` for a job. Returns the operation's result code, or
+/// `PAGE_JOB_PENDING` if it is still running.
+///
+/// # Safety
+///
+/// `job` must be a valid pointer or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_job_wait(job: *mut PageJobHandle, timeout_ms: u64) -> i32 {
+    if job.is_null() {
+        return null_ptr();
     }
+    let job = unsafe { &mut *job };
+    job.poll(Some(std::time::Duration::from_millis(timeout_ms)))
 }
 
-/// Get the current page title.
+/// Get a finished job's result code and, for evaluate jobs that succeeded, a
+/// copy of the JSON result in `*out_json` (free with `page_string_free()`).
+/// For other jobs `*out_json` is set to NULL. Returns `PAGE_JOB_PENDING` if
+/// the job is still running.
 ///
 /// # Safety
 ///
 /// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_title(
-    page: *mut Page,
-    out_title: *mut *mut std::ffi::c_char,
+pub unsafe extern "C" fn page_job_result(
+    job: *mut PageJobHandle,
+    out_json: *mut *mut std::ffi::c_char,
     out_len: *mut usize,
 ) -> i32 {
-    if page.is_null() || out_title.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if job.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
     }
-    let page = unsafe { &*page };
-    match page.title() {
-        Some(title_str) => match std::ffi::CString::new(title_str) {
+    let job = unsafe { &mut *job };
+    let code = job.poll(None);
+    unsafe {
+        *out_json = std::ptr::null_mut();
+        *out_len = 0;
+    }
+    if let Some((_, Some(json))) = &job.outcome {
+        match std::ffi::CString::new(json.as_str()) {
             Ok(cstr) => {
                 let len = cstr.as_bytes().len();
                 let ptr = cstr.into_raw();
                 unsafe {
-                    *out_title = ptr;
+                    *out_json = ptr;
                     *out_len = len;
                 }
-                PAGE_OK
             }
-            Err(_) => PAGE_ERR_JS,
-        },
-        None => PAGE_ERR_NO_PAGE,
+            Err(_) => return nul_byte(),
+        }
     }
+    code
 }
 
-// -- Events (JSON) --
+/// Free a job handle. The operation itself is not cancelled. Safe to call with NULL.
+///
+/// # Safety
+///
+/// `job` must be a pointer returned by an async page function, or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_job_free(job: *mut PageJobHandle) {
+    if !job.is_null() {
+        unsafe { drop(Box::from_raw(job)) };
+    }
+}
 
-/// Get console messages as a JSON array.
+/// Allow or forbid `file:` URLs. Pass non-zero to allow. Off by default.
 ///
 /// # Safety
 ///
-/// All pointer arguments must be valid or NULL.
+/// `page` must be a valid pointer.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_console_messages(
-    page: *mut Page,
-    out_json: *mut *mut std::ffi::c_char,
-    out_len: *mut usize,
-) -> i32 {
-    if page.is_null() || out_json.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+pub unsafe extern "C" fn page_set_allow_file_access(page: *mut Page, enabled: i32) -> i32 {
+    if page.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    let msgs = page.console_messages();
-    let json = serde_json::to_string(&msgs).unwrap_or_else(|_| "[]".to_string());
-    match std::ffi::CString::new(json) {
-        Ok(cstr) => {
-            let len = cstr.as_bytes().len();
-            let ptr = cstr.into_raw();
+    page.set_allow_file_access(enabled != 0);
+    PAGE_OK
+}
+
+/// Skip HTTP(S) images whose width × height exceeds `pixels`; they render as
+/// broken images. The default is 100 megapixels; pass 0 to disable.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_max_image_pixels(page: *mut Page, pixels: u64) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    page.set_max_image_pixels(pixels);
+    PAGE_OK
+}
+
+/// Allow at most `n` concurrent HTTP(S) requests per host, for all pages.
+/// Pass 0 for no limit (the default). While a limit is set, `GET`/`HEAD`
+/// requests bypass the cookie jar.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_max_connections_per_host(page: *mut Page, n: usize) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    page.set_max_connections_per_host(n);
+    PAGE_OK
+}
+
+// -- Capture --
+
+/// Evaluate JavaScript and return the result as a JSON string.
+///
+/// On success, `*out_json` is set to a heap-allocated null-terminated string
+/// and `*out_len` to its length. Free with `page_string_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_evaluate(
+    page: *mut Page,
+    script: *const std::ffi::c_char,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    unsafe { page_evaluate_in_world(page, script, PAGE_WORLD_MAIN, out_json, out_len) }
+}
+
+const PAGE_WORLD_MAIN: i32 = 0;
+const PAGE_WORLD_ISOLATED: i32 = 1;
+
+/// Evaluate JavaScript in a `PAGE_WORLD_*` context and return the result as a
+/// JSON string. `page_evaluate()` is this with `PAGE_WORLD_MAIN`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_evaluate_in_world(
+    page: *mut Page,
+    script: *const std::ffi::c_char,
+    world: i32,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || script.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let script_str = match unsafe { std::ffi::CStr::from_ptr(script) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    let world = match world {
+        PAGE_WORLD_MAIN => JsWorld::Main,
+        PAGE_WORLD_ISOLATED => JsWorld::Isolated,
+        other => {
+            let e = PageError::InvalidArgument(format!("unknown JS world {other}"));
+            return error_code(&e);
+        }
+    };
+    match page.evaluate_in_world(script_str, world) {
+        Ok(json) => match std::ffi::CString::new(json) {
+            Ok(cstr) => {
+                let len = cstr.as_bytes().len();
+                let ptr = cstr.into_raw();
+                unsafe {
+                    *out_json = ptr;
+                    *out_len = len;
+                }
+                PAGE_OK
+            }
+            Err(_) => nul_byte(),
+        },
+        Err(e @ PageError::JsError(_)) => {
+            error_code_with(&e, serde_json::json!({ "exception": page.last_js_error() }))
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Get details of the exception that made the last `page_evaluate()` fail, as
+/// JSON (`{"kind","name","message","stack"}`), or `null` if it succeeded.
+/// Free the result with `page_string_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_last_js_error(
+    page: *mut Page,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let json = serde_json::to_string(&page.last_js_error()).unwrap_or_else(|_| "null".into());
+    match std::ffi::CString::new(json) {
+        Ok(cstr) => {
+            let len = cstr.as_bytes().len();
+            let ptr = cstr.into_raw();
             unsafe {
                 *out_json = ptr;
                 *out_len = len;
             }
-            PAGE_OK
-        }
-        Err(_) => PAGE_ERR_JS,
+            PAGE_OK
+        }
+        Err(_) => nul_byte(),
+    }
+}
+
+/// Take a screenshot. Returns PNG bytes.
+///
+/// On success, `*out_data` and `*out_len` are set. Free with `page_buffer_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_screenshot(
+    page: *mut Page,
+    out_data: *mut *mut u8,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_data.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.screenshot() {
+        Ok(png_bytes) => {
+            let boxed = png_bytes.into_boxed_slice();
+            let len = boxed.len();
+            let ptr = Box::into_raw(boxed) as *mut u8;
+            unsafe {
+                *out_data = ptr;
+                *out_len = len;
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Take a screenshot of exactly the viewport, restoring the viewport size if a
+/// previous full-page screenshot enlarged it. Returns PNG bytes; free with
+/// `page_buffer_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_screenshot_viewport(
+    page: *mut Page,
+    out_data: *mut *mut u8,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_data.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.screenshot_viewport() {
+        Ok(png_bytes) => {
+            let boxed = png_bytes.into_boxed_slice();
+            let len = boxed.len();
+            let ptr = Box::into_raw(boxed) as *mut u8;
+            unsafe {
+                *out_data = ptr;
+                *out_len = len;
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Screenshot the full-width band from the top of `start_selector` to the
+/// bottom of `end_selector`. Returns PNG bytes; free with `page_buffer_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_screenshot_between(
+    page: *mut Page,
+    start_selector: *const std::ffi::c_char,
+    end_selector: *const std::ffi::c_char,
+    out_data: *mut *mut u8,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null()
+        || start_selector.is_null()
+        || end_selector.is_null()
+        || out_data.is_null()
+        || out_len.is_null()
+    {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let (start, end) = match (
+        unsafe { std::ffi::CStr::from_ptr(start_selector) }.to_str(),
+        unsafe { std::ffi::CStr::from_ptr(end_selector) }.to_str(),
+    ) {
+        (Ok(s), Ok(e)) => (s, e),
+        _ => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    match page.screenshot_between(start, end) {
+        Ok(png_bytes) => {
+            let boxed = png_bytes.into_boxed_slice();
+            let len = boxed.len();
+            let ptr = Box::into_raw(boxed) as *mut u8;
+            unsafe {
+                *out_data = ptr;
+                *out_len = len;
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Take a screenshot as uncompressed RGBA pixels (8 bits per channel, not
+/// premultiplied, rows top to bottom, `*out_stride == width * 4`).
+///
+/// On success, all out parameters are set. Free with `page_buffer_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_screenshot_raw(
+    page: *mut Page,
+    out_data: *mut *mut u8,
+    out_len: *mut usize,
+    out_width: *mut u32,
+    out_height: *mut u32,
+    out_stride: *mut usize,
+) -> i32 {
+    if page.is_null()
+        || out_data.is_null()
+        || out_len.is_null()
+        || out_width.is_null()
+        || out_height.is_null()
+        || out_stride.is_null()
+    {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.screenshot_raw() {
+        Ok(image) => {
+            let boxed = image.data.into_boxed_slice();
+            let len = boxed.len();
+            let ptr = Box::into_raw(boxed) as *mut u8;
+            unsafe {
+                *out_data = ptr;
+                *out_len = len;
+                *out_width = image.width;
+                *out_height = image.height;
+                *out_stride = image.stride;
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Compute a 64-bit DCT perceptual hash of the viewport into `*out_hash`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_screenshot_phash(page: *mut Page, out_hash: *mut u64) -> i32 {
+    if page.is_null() || out_hash.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.screenshot_phash() {
+        Ok(hash) => {
+            unsafe { *out_hash = hash };
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Take a full-page screenshot. Returns PNG bytes.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_screenshot_fullpage(
+    page: *mut Page,
+    out_data: *mut *mut u8,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_data.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.screenshot_fullpage() {
+        Ok(png_bytes) => {
+            let boxed = png_bytes.into_boxed_slice();
+            let len = boxed.len();
+            let ptr = Box::into_raw(boxed) as *mut u8;
+            unsafe {
+                *out_data = ptr;
+                *out_len = len;
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Take a viewport screenshot at each of `count` device-scale factors and write
+/// them to `dir` as `<prefix>@<factor>x.png` (e.g. `icon@2x.png`).
+///
+/// `*out_written` is set to the number of files written, also on failure.
+///
+/// # Safety
+///
+/// `page`, `dir`, `prefix` and `out_written` must be valid pointers. `factors`
+/// must point to `count` floats.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_screenshot_scales(
+    page: *mut Page,
+    factors: *const f32,
+    count: usize,
+    dir: *const std::ffi::c_char,
+    prefix: *const std::ffi::c_char,
+    out_written: *mut usize,
+) -> i32 {
+    if page.is_null()
+        || factors.is_null()
+        || dir.is_null()
+        || prefix.is_null()
+        || out_written.is_null()
+    {
+        return null_ptr();
+    }
+    unsafe { *out_written = 0 };
+    let page = unsafe { &*page };
+    let factors = unsafe { std::slice::from_raw_parts(factors, count) };
+    let (dir, prefix) = match (
+        unsafe { std::ffi::CStr::from_ptr(dir) }.to_str(),
+        unsafe { std::ffi::CStr::from_ptr(prefix) }.to_str(),
+    ) {
+        (Ok(d), Ok(p)) => (std::path::Path::new(d), p),
+        _ => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    let shots = match page.screenshot_scales(factors) {
+        Ok(shots) => shots,
+        Err(e) => return error_code(&e),
+    };
+    if let Err(e) = std::fs::create_dir_all(dir) {
+        return write_failed(dir, e);
+    }
+    for (i, (factor, png)) in factors.iter().zip(shots).enumerate() {
+        let path = dir.join(format!("{prefix}@{factor}x.png"));
+        if let Err(e) = std::fs::write(&path, png) {
+            return write_failed(&path, e);
+        }
+        unsafe { *out_written = i + 1 };
+    }
+    PAGE_OK
+}
+
+/// Set the browser zoom of the active page (0.1–8.0, default 1.0). The page
+/// reflows at the new CSS viewport size.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_zoom(page: *mut Page, factor: f64) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.set_zoom(factor as f32) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Get the browser zoom of the active page into `*out_factor`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_get_zoom(page: *mut Page, out_factor: *mut f64) -> i32 {
+    if page.is_null() || out_factor.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.zoom() {
+        Ok(factor) => {
+            unsafe { *out_factor = f64::from(factor) };
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Take a screenshot at every `step_px` pixels of scroll from top to bottom and
+/// write them to `dir` as `<prefix>-0001.png`, `<prefix>-0002.png`, ...
+///
+/// `*out_written` is set to the number of frames written, also on failure.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_screenshot_filmstrip(
+    page: *mut Page,
+    step_px: u32,
+    dir: *const std::ffi::c_char,
+    prefix: *const std::ffi::c_char,
+    out_written: *mut usize,
+) -> i32 {
+    if page.is_null() || dir.is_null() || prefix.is_null() || out_written.is_null() {
+        return null_ptr();
+    }
+    unsafe { *out_written = 0 };
+    let page = unsafe { &*page };
+    let (dir, prefix) = match (
+        unsafe { std::ffi::CStr::from_ptr(dir) }.to_str(),
+        unsafe { std::ffi::CStr::from_ptr(prefix) }.to_str(),
+    ) {
+        (Ok(d), Ok(p)) => (std::path::Path::new(d), p),
+        _ => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    let frames = match page.screenshot_filmstrip(step_px) {
+        Ok(frames) => frames,
+        Err(e) => return error_code(&e),
+    };
+    if let Err(e) = std::fs::create_dir_all(dir) {
+        return write_failed(dir, e);
+    }
+    for (i, png) in frames.into_iter().enumerate() {
+        let path = dir.join(format!("{prefix}-{:04}.png", i + 1));
+        if let Err(e) = std::fs::write(&path, png) {
+            return write_failed(&path, e);
+        }
+        unsafe { *out_written = i + 1 };
+    }
+    PAGE_OK
+}
+
+/// Export the viewport as transparent layers and write them to `dir` as
+/// `<prefix>-background.png`, `<prefix>-text.png`, `<prefix>-images.png` and
+/// `<prefix>-overlays.png`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_export_layers(
+    page: *mut Page,
+    dir: *const std::ffi::c_char,
+    prefix: *const std::ffi::c_char,
+) -> i32 {
+    if page.is_null() || dir.is_null() || prefix.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let (dir, prefix) = match (
+        unsafe { std::ffi::CStr::from_ptr(dir) }.to_str(),
+        unsafe { std::ffi::CStr::from_ptr(prefix) }.to_str(),
+    ) {
+        (Ok(d), Ok(p)) => (std::path::Path::new(d), p),
+        _ => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    let layers = match page.export_layers() {
+        Ok(layers) => layers,
+        Err(e) => return error_code(&e),
+    };
+    if let Err(e) = std::fs::create_dir_all(dir) {
+        return write_failed(dir, e);
+    }
+    for layer in layers {
+        let path = dir.join(format!("{prefix}-{}.png", layer.name));
+        if let Err(e) = std::fs::write(&path, layer.png) {
+            return write_failed(&path, e);
+        }
+    }
+    PAGE_OK
+}
+
+/// Screenshot buffer lent out by `page_screenshot_borrow()`.
+pub struct ScreenshotBorrow {
+    data: Vec<u8>,
+}
+
+/// Take a viewport screenshot without handing over ownership of the buffer.
+///
+/// On success, `*out_data` / `*out_len` point into a buffer owned by
+/// `*out_handle`. Release it with `page_screenshot_release()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_screenshot_borrow(
+    page: *mut Page,
+    out_data: *mut *const u8,
+    out_len: *mut usize,
+    out_handle: *mut *mut ScreenshotBorrow,
+) -> i32 {
+    if page.is_null() || out_data.is_null() || out_len.is_null() || out_handle.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.screenshot() {
+        Ok(data) => {
+            let borrow = Box::new(ScreenshotBorrow { data });
+            unsafe {
+                *out_data = borrow.data.as_ptr();
+                *out_len = borrow.data.len();
+                *out_handle = Box::into_raw(borrow);
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Release a screenshot borrowed with `page_screenshot_borrow()`.
+///
+/// # Safety
+///
+/// `handle` must be a handle returned by `page_screenshot_borrow()`, or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_screenshot_release(handle: *mut ScreenshotBorrow) {
+    if !handle.is_null() {
+        drop(unsafe { Box::from_raw(handle) });
+    }
+}
+
+/// Capture the page HTML.
+///
+/// On success, `*out_html` and `*out_len` are set. Free with `page_string_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_html(
+    page: *mut Page,
+    out_html: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_html.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.html() {
+        Ok(html) => match std::ffi::CString::new(html) {
+            Ok(cstr) => {
+                let len = cstr.as_bytes().len();
+                let ptr = cstr.into_raw();
+                unsafe {
+                    *out_html = ptr;
+                    *out_len = len;
+                }
+                PAGE_OK
+            }
+            Err(_) => nul_byte(),
+        },
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Capture the document as a JSON tree for `scraper_diff_dom()`.
+///
+/// On success, `*out_json` and `*out_len` are set. Free with `page_string_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_dom_snapshot(
+    page: *mut Page,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.dom_snapshot() {
+        Ok(json) => match std::ffi::CString::new(json) {
+            Ok(cstr) => {
+                let len = cstr.as_bytes().len();
+                let ptr = cstr.into_raw();
+                unsafe {
+                    *out_json = ptr;
+                    *out_len = len;
+                }
+                PAGE_OK
+            }
+            Err(_) => nul_byte(),
+        },
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Export the document as one self-contained HTML file: stylesheets, images
+/// and fonts are inlined as data: URIs and scripts dropped. Assets over
+/// `max_asset_bytes` (0 = no limit), blocked or failing to fetch keep their URL.
+///
+/// On success, `*out_html` and `*out_len` are set. Free with `page_string_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_single_file(
+    page: *mut Page,
+    max_asset_bytes: u64,
+    out_html: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_html.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.single_file(max_asset_bytes) {
+        Ok(html) => match std::ffi::CString::new(html) {
+            Ok(cstr) => {
+                let len = cstr.as_bytes().len();
+                let ptr = cstr.into_raw();
+                unsafe {
+                    *out_html = ptr;
+                    *out_len = len;
+                }
+                PAGE_OK
+            }
+            Err(_) => nul_byte(),
+        },
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Capture the page HTML gzip-compressed. Pass -1 for the default level (6)
+/// or 0-9.
+///
+/// On success, `*out_data` and `*out_len` are set. Free with `page_buffer_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_html_gzip(
+    page: *mut Page,
+    level: i32,
+    out_data: *mut *mut u8,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_data.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let level = match level {
+        -1 => 6,
+        0..=9 => level as u32,
+        other => {
+            let e = PageError::InvalidArgument(format!("gzip level {other} is not -1 or 0-9"));
+            return error_code(&e);
+        }
+    };
+    let page = unsafe { &*page };
+    match page.html_gzip(level) {
+        Ok(gz) => {
+            let boxed = gz.into_boxed_slice();
+            let len = boxed.len();
+            let ptr = Box::into_raw(boxed) as *mut u8;
+            unsafe {
+                *out_data = ptr;
+                *out_len = len;
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+// -- Page info --
+
+/// Get the current page URL.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_url(
+    page: *mut Page,
+    out_url: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_url.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.url() {
+        Some(url_str) => match std::ffi::CString::new(url_str) {
+            Ok(cstr) => {
+                let len = cstr.as_bytes().len();
+                let ptr = cstr.into_raw();
+                unsafe {
+                    *out_url = ptr;
+                    *out_len = len;
+                }
+                PAGE_OK
+            }
+            Err(_) => nul_byte(),
+        },
+        None => error_code(&PageError::NoPage),
+    }
+}
+
+/// Get the current page title.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_title(
+    page: *mut Page,
+    out_title: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_title.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.title() {
+        Some(title_str) => match std::ffi::CString::new(title_str) {
+            Ok(cstr) => {
+                let len = cstr.as_bytes().len();
+                let ptr = cstr.into_raw();
+                unsafe {
+                    *out_title = ptr;
+                    *out_len = len;
+                }
+                PAGE_OK
+            }
+            Err(_) => nul_byte(),
+        },
+        None => error_code(&PageError::NoPage),
+    }
+}
+
+/// Get the document's character encoding (e.g. `"UTF-8"`), or `""` if
+/// undetermined.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_charset(
+    page: *mut Page,
+    out_charset: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_charset.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.charset() {
+        Some(charset) => match std::ffi::CString::new(charset) {
+            Ok(cstr) => {
+                let len = cstr.as_bytes().len();
+                let ptr = cstr.into_raw();
+                unsafe {
+                    *out_charset = ptr;
+                    *out_len = len;
+                }
+                PAGE_OK
+            }
+            Err(_) => nul_byte(),
+        },
+        None => error_code(&PageError::NoPage),
+    }
+}
+
+/// Enable or disable service worker tracking for `page_has_service_worker()`.
+/// Pass non-zero to enable.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_service_worker_tracking(page: *mut Page, enabled: i32) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    page.set_service_worker_tracking(enabled != 0);
+    PAGE_OK
+}
+
+/// Report whether the page registered (or is controlled by) a service worker.
+/// `*out_registered` is set to 1 if so, 0 otherwise.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_has_service_worker(page: *mut Page, out_registered: *mut i32) -> i32 {
+    if page.is_null() || out_registered.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.has_service_worker() {
+        Ok(registered) => {
+            unsafe { *out_registered = registered as i32 };
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Get First Contentful Paint and Largest Contentful Paint in milliseconds
+/// since navigation start. A metric not available yet is set to `-1`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_paint_timing(
+    page: *mut Page,
+    out_fcp_ms: *mut f64,
+    out_lcp_ms: *mut f64,
+) -> i32 {
+    if page.is_null() || out_fcp_ms.is_null() || out_lcp_ms.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.paint_timing() {
+        Ok(timing) => {
+            unsafe {
+                *out_fcp_ms = timing.first_contentful_paint.unwrap_or(-1.0);
+                *out_lcp_ms = timing.largest_contentful_paint.unwrap_or(-1.0);
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Enable or disable render mode tracking for `page_render_mode()`. Pass
+/// non-zero to enable.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_render_mode_tracking(page: *mut Page, enabled: i32) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    page.set_render_mode_tracking(enabled != 0);
+    PAGE_OK
+}
+
+/// Guess how the current document was rendered: "server-rendered",
+/// "client-rendered" or "hybrid". Free the result with `page_string_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_render_mode(
+    page: *mut Page,
+    out_mode: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_mode.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.render_mode() {
+        Ok(mode) => match std::ffi::CString::new(mode.to_string()) {
+            Ok(cstr) => {
+                let len = cstr.as_bytes().len();
+                let ptr = cstr.into_raw();
+                unsafe {
+                    *out_mode = ptr;
+                    *out_len = len;
+                }
+                PAGE_OK
+            }
+            Err(_) => nul_byte(),
+        },
+        Err(e) => error_code(&e),
+    }
+}
+
+// -- Events (JSON) --
+
+/// Get console messages as a JSON array.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_console_messages(
+    page: *mut Page,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let msgs = page.console_messages();
+    let json = serde_json::to_string(&msgs).unwrap_or_else(|_| "[]".to_string());
+    match std::ffi::CString::new(json) {
+        Ok(cstr) => {
+            let len = cstr.as_bytes().len();
+            let ptr = cstr.into_raw();
+            unsafe {
+                *out_json = ptr;
+                *out_len = len;
+            }
+            PAGE_OK
+        }
+        Err(_) => nul_byte(),
+    }
+}
+
+/// Get network requests as a JSON array.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_network_requests(
+    page: *mut Page,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let reqs = page.network_requests();
+    let json = serde_json::to_string(&reqs).unwrap_or_else(|_| "[]".to_string());
+    match std::ffi::CString::new(json) {
+        Ok(cstr) => {
+            let len = cstr.as_bytes().len();
+            let ptr = cstr.into_raw();
+            unsafe {
+                *out_json = ptr;
+                *out_len = len;
+            }
+            PAGE_OK
+        }
+        Err(_) => nul_byte(),
+    }
+}
+
+// -- Wait FFI --
+
+/// Wait for a CSS selector to match an element.
+///
+/// # Safety
+///
+/// `page` and `selector` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_wait_for_selector(
+    page: *mut Page,
+    selector: *const std::ffi::c_char,
+    timeout_secs: u64,
+) -> i32 {
+    if page.is_null() || selector.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.wait_for_selector(sel, timeout_secs) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Wait for a JS expression to evaluate to a truthy value.
+///
+/// # Safety
+///
+/// `page` and `js_expr` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_wait_for_condition(
+    page: *mut Page,
+    js_expr: *const std::ffi::c_char,
+    timeout_secs: u64,
+) -> i32 {
+    if page.is_null() || js_expr.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let expr = match unsafe { std::ffi::CStr::from_ptr(js_expr) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.wait_for_condition(expr, timeout_secs) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Wait for `text` to appear in the page's rendered text.
+/// Pass non-zero `case_sensitive` for an exact-case match.
+///
+/// # Safety
+///
+/// `page` and `text` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_wait_for_text(
+    page: *mut Page,
+    text: *const std::ffi::c_char,
+    case_sensitive: i32,
+    timeout_ms: u64,
+) -> i32 {
+    if page.is_null() || text.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let text_str = match unsafe { std::ffi::CStr::from_ptr(text) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.wait_for_text(text_str, case_sensitive != 0, timeout_ms) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Enable or disable download capture for `page_wait_for_download()`. Pass
+/// non-zero to enable.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_download_capture(page: *mut Page, enabled: i32) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    page.set_download_capture(enabled != 0);
+    PAGE_OK
+}
+
+/// Wait for a download started by an earlier click to finish.
+///
+/// On success, `*out_data`/`*out_len` hold the file bytes (free with
+/// `page_buffer_free()`) and `*out_filename` the suggested file name (free
+/// with `page_string_free()`).
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_wait_for_download(
+    page: *mut Page,
+    timeout_ms: u64,
+    out_data: *mut *mut u8,
+    out_len: *mut usize,
+    out_filename: *mut *mut std::ffi::c_char,
+) -> i32 {
+    if page.is_null() || out_data.is_null() || out_len.is_null() || out_filename.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.wait_for_download(timeout_ms) {
+        Ok(download) => {
+            let filename = match std::ffi::CString::new(download.filename) {
+                Ok(cstr) => cstr,
+                Err(_) => return nul_byte(),
+            };
+            let boxed = download.data.into_boxed_slice();
+            let len = boxed.len();
+            let ptr = Box::into_raw(boxed) as *mut u8;
+            unsafe {
+                *out_data = ptr;
+                *out_len = len;
+                *out_filename = filename.into_raw();
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Wait until every `<img>` has loaded or failed.
+///
+/// On success, `*out_loaded` and `*out_failed` are set.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_wait_for_images(
+    page: *mut Page,
+    timeout_ms: u64,
+    out_loaded: *mut u32,
+    out_failed: *mut u32,
+) -> i32 {
+    if page.is_null() || out_loaded.is_null() || out_failed.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.wait_for_images(timeout_ms) {
+        Ok(counts) => {
+            unsafe {
+                *out_loaded = counts.loaded;
+                *out_failed = counts.failed;
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Wait for a fixed number of seconds.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_wait(page: *mut Page, seconds: f64) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    page.wait(seconds);
+    PAGE_OK
+}
+
+/// Wait for the next navigation to complete.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_wait_for_navigation(page: *mut Page, timeout_secs: u64) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.wait_for_navigation(timeout_secs) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Wait until no new network requests arrive for `idle_ms` milliseconds.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_wait_for_network_idle(
+    page: *mut Page,
+    idle_ms: u64,
+    timeout_secs: u64,
+) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.wait_for_network_idle(idle_ms, timeout_secs) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+// -- Input FFI --
+
+/// Click at the given coordinates.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_click(page: *mut Page, x: f32, y: f32) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.click(x, y) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Click on an element matching a CSS selector.
+///
+/// # Safety
+///
+/// `page` and `selector` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_click_selector(
+    page: *mut Page,
+    selector: *const std::ffi::c_char,
+) -> i32 {
+    if page.is_null() || selector.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.click_selector(sel) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Like `page_click()`, but first reports the element under `(x, y)` as JSON
+/// `{"tag", "selector"}` (`null` if none) in `*out_target`. Pass NULL for
+/// `out_target` and `out_len` to skip the report. Free with
+/// `page_string_free()`.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer; `out_target` and `out_len` must be valid
+/// pointers or both NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_click_target(
+    page: *mut Page,
+    x: f32,
+    y: f32,
+    out_target: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    unsafe {
+        with_target(
+            out_target,
+            out_len,
+            || page.element_at(x, y),
+            || page.click(x, y),
+        )
+    }
+}
+
+/// Like `page_click_selector()`, but also reports the element the click
+/// actually lands on. See `page_click_target()`.
+///
+/// # Safety
+///
+/// `page` and `selector` must be valid pointers; `out_target` and `out_len`
+/// must be valid pointers or both NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_click_selector_target(
+    page: *mut Page,
+    selector: *const std::ffi::c_char,
+    out_target: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || selector.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    unsafe {
+        with_target(
+            out_target,
+            out_len,
+            || page.selector_target(sel),
+            || page.click_selector(sel),
+        )
+    }
+}
+
+/// Like `page_mouse_move()` (hover), but also reports the element under the
+/// pointer. See `page_click_target()`.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer; `out_target` and `out_len` must be valid
+/// pointers or both NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_hover_target(
+    page: *mut Page,
+    x: f32,
+    y: f32,
+    out_target: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    unsafe {
+        with_target(
+            out_target,
+            out_len,
+            || page.element_at(x, y),
+            || page.mouse_move(x, y),
+        )
+    }
+}
+
+/// Run `action`. Unless `out_target` and `out_len` are both NULL, `resolve`
+/// its target first and write it as JSON once the action succeeds.
+///
+/// # Safety
+///
+/// `out_target` and `out_len` must be valid pointers or both NULL.
+unsafe fn with_target(
+    out_target: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+    resolve: impl FnOnce() -> Result<Option<ElementTarget>, PageError>,
+    action: impl FnOnce() -> Result<(), PageError>,
+) -> i32 {
+    if out_target.is_null() != out_len.is_null() {
+        return null_ptr();
+    }
+    if out_target.is_null() {
+        return match action() {
+            Ok(()) => PAGE_OK,
+            Err(e) => error_code(&e),
+        };
+    }
+    let target = match resolve().and_then(|t| action().map(|()| t)) {
+        Ok(t) => t,
+        Err(e) => return error_code(&e),
+    };
+    let json = serde_json::to_string(&target).unwrap_or_else(|_| "null".to_string());
+    match std::ffi::CString::new(json) {
+        Ok(cstr) => {
+            let len = cstr.as_bytes().len();
+            let ptr = cstr.into_raw();
+            unsafe {
+                *out_target = ptr;
+                *out_len = len;
+            }
+            PAGE_OK
+        }
+        Err(_) => nul_byte(),
+    }
+}
+
+/// Type text by sending individual key events.
+///
+/// # Safety
+///
+/// `page` and `text` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_type_text(page: *mut Page, text: *const std::ffi::c_char) -> i32 {
+    if page.is_null() || text.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let text_str = match unsafe { std::ffi::CStr::from_ptr(text) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.type_text(text_str) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Press a single key by name (e.g. "Enter", "Tab", "a").
+///
+/// # Safety
+///
+/// `page` and `key_name` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_key_press(page: *mut Page, key_name: *const std::ffi::c_char) -> i32 {
+    if page.is_null() || key_name.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let name = match unsafe { std::ffi::CStr::from_ptr(key_name) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.key_press(name) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Move the mouse to the given coordinates.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_mouse_move(page: *mut Page, x: f32, y: f32) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.mouse_move(x, y) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+// -- Scroll FFI --
+
+/// Scroll the viewport by the given pixel deltas.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_scroll(page: *mut Page, delta_x: f64, delta_y: f64) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.scroll(delta_x, delta_y) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Scroll an element matching a CSS selector into view.
+///
+/// # Safety
+///
+/// `page` and `selector` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_scroll_to_selector(
+    page: *mut Page,
+    selector: *const std::ffi::c_char,
+) -> i32 {
+    if page.is_null() || selector.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.scroll_to_selector(sel) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Get the document's scrollable size and scroll offset in CSS pixels.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_scroll_metrics(
+    page: *mut Page,
+    out_scroll_height: *mut f64,
+    out_scroll_width: *mut f64,
+    out_scroll_top: *mut f64,
+    out_scroll_left: *mut f64,
+) -> i32 {
+    if page.is_null()
+        || out_scroll_height.is_null()
+        || out_scroll_width.is_null()
+        || out_scroll_top.is_null()
+        || out_scroll_left.is_null()
+    {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.scroll_metrics() {
+        Ok(metrics) => {
+            unsafe {
+                *out_scroll_height = metrics.scroll_height;
+                *out_scroll_width = metrics.scroll_width;
+                *out_scroll_top = metrics.scroll_top;
+                *out_scroll_left = metrics.scroll_left;
+            }
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
+// -- Select FFI --
+
+/// Select an option in a `<select>` element by value.
+///
+/// # Safety
+///
+/// `page`, `selector`, and `value` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_select_option(
+    page: *mut Page,
+    selector: *const std::ffi::c_char,
+    value: *const std::ffi::c_char,
+) -> i32 {
+    if page.is_null() || selector.is_null() || value.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    let val = match unsafe { std::ffi::CStr::from_ptr(value) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.select_option(sel, val) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+// -- File upload FFI --
+
+/// Set files on an `<input type="file">` element.
+///
+/// `paths` is a comma-separated list of file paths. Each file is read from disk,
+/// its MIME type inferred from the extension, and injected via the DataTransfer API.
+///
+/// # Safety
+///
+/// `page`, `selector`, and `paths` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_input_files(
+    page: *mut Page,
+    selector: *const std::ffi::c_char,
+    paths: *const std::ffi::c_char,
+) -> i32 {
+    if page.is_null() || selector.is_null() || paths.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    let paths_str = match unsafe { std::ffi::CStr::from_ptr(paths) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+
+    let mut files = Vec::new();
+    for path_str in paths_str
+        .split(',')
+        .map(|s| s.trim())
+        .filter(|s| !s.is_empty())
+    {
+        let path = std::path::Path::new(path_str);
+        let data = match std::fs::read(path) {
+            Ok(d) => d,
+            Err(e) => {
+                let e = PageError::JsError(format!("cannot read {path_str}: {e}"));
+                return error_code_with(&e, serde_json::json!({ "path": path_str }));
+            }
+        };
+        let name = path
+            .file_name()
+            .and_then(|n| n.to_str())
+            .unwrap_or("file")
+            .to_string();
+        let mime_type = match path.extension().and_then(|e| e.to_str()) {
+            Some("txt") => "text/plain",
+            Some("html") | Some("htm") => "text/html",
+            Some("css") => "text/css",
+            Some("js") => "application/javascript",
+            Some("json") => "application/json",
+            Some("xml") => "application/xml",
+            Some("pdf") => "application/pdf",
+            Some("png") => "image/png",
+            Some("jpg") | Some("jpeg") => "image/jpeg",
+            Some("gif") => "image/gif",
+            Some("svg") => "image/svg+xml",
+            Some("webp") => "image/webp",
+            Some("zip") => "application/zip",
+            Some("csv") => "text/csv",
+            _ => "application/octet-stream",
+        }
+        .to_string();
+        files.push(InputFile {
+            name,
+            mime_type,
+            data,
+        });
+    }
+
+    match page.set_input_files(sel, files) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+// -- Cookies FFI --
+
+/// Get cookies for the current page.
+///
+/// On success, `*out_cookies` and `*out_len` are set. Free with `page_string_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_get_cookies(
+    page: *mut Page,
+    out_cookies: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_cookies.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.get_cookies() {
+        Ok(cookies) => match std::ffi::CString::new(cookies) {
+            Ok(cstr) => {
+                let len = cstr.as_bytes().len();
+                let ptr = cstr.into_raw();
+                unsafe {
+                    *out_cookies = ptr;
+                    *out_len = len;
+                }
+                PAGE_OK
+            }
+            Err(_) => nul_byte(),
+        },
+        Err(e) => error_code(&e),
     }
 }
 
-/// Get network requests as a JSON array.
+/// Set a cookie via `document.cookie`.
 ///
 /// # Safety
 ///
-/// All pointer arguments must be valid or NULL.
+/// `page` and `cookie` must be valid pointers.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_network_requests(
+pub unsafe extern "C" fn page_set_cookie(page: *mut Page, cookie: *const std::ffi::c_char) -> i32 {
+    if page.is_null() || cookie.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let cookie_str = match unsafe { std::ffi::CStr::from_ptr(cookie) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.set_cookie(cookie_str) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Set a cookie with a `SameSite` attribute: `"None"`, `"Lax"` or `"Strict"`.
+/// Unknown values return `PAGE_ERR_INVALID_ARG`.
+///
+/// # Safety
+///
+/// `page`, `cookie` and `same_site` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_cookie_same_site(
     page: *mut Page,
-    out_json: *mut *mut std::ffi::c_char,
-    out_len: *mut usize,
+    cookie: *const std::ffi::c_char,
+    same_site: *const std::ffi::c_char,
 ) -> i32 {
-    if page.is_null() || out_json.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || cookie.is_null() || same_site.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    let reqs = page.network_requests();
-    let json = serde_json::to_string(&reqs).unwrap_or_else(|_| "[]".to_string());
-    match std::ffi::CString::new(json) {
-        Ok(cstr) => {
-            let len = cstr.as_bytes().len();
-            let ptr = cstr.into_raw();
-            unsafe {
-                *out_json = ptr;
-                *out_len = len;
-            }
-            PAGE_OK
-        }
-        Err(_) => PAGE_ERR_JS,
+    let (cookie_str, same_site_str) = match (
+        unsafe { std::ffi::CStr::from_ptr(cookie) }.to_str(),
+        unsafe { std::ffi::CStr::from_ptr(same_site) }.to_str(),
+    ) {
+        (Ok(c), Ok(s)) => (c, s),
+        _ => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    match same_site_str
+        .parse::<SameSite>()
+        .and_then(|same_site| page.set_cookie_same_site(cookie_str, same_site))
+    {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
     }
 }
 
-// -- Wait FFI --
+/// Clear all cookies for the current page.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_clear_cookies(page: *mut Page) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.clear_cookies() {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
 
-/// Wait for a CSS selector to match an element.
+/// Set which cookies pages may set ("accept_all", "block_third_party",
+/// "block_all"), for all pages.
 ///
 /// # Safety
 ///
-/// `page` and `selector` must be valid pointers.
+/// `page` and `policy` must be valid pointers.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_wait_for_selector(
+pub unsafe extern "C" fn page_set_cookie_policy(
     page: *mut Page,
-    selector: *const std::ffi::c_char,
-    timeout_secs: u64,
+    policy: *const std::ffi::c_char,
 ) -> i32 {
-    if page.is_null() || selector.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || policy.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
+    let policy_str = match unsafe { std::ffi::CStr::from_ptr(policy) }.to_str() {
         Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+        Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
     };
-    match page.wait_for_selector(sel, timeout_secs) {
-        Ok(()) => PAGE_OK,
+    match policy_str.parse::<CookiePolicy>() {
+        Ok(policy) => {
+            page.set_cookie_policy(policy);
+            PAGE_OK
+        }
         Err(e) => error_code(&e),
     }
 }
 
-/// Wait for a JS expression to evaluate to a truthy value.
+// -- Request interception FFI --
+
+/// Set URL patterns to block (comma-separated). Pass NULL to clear.
 ///
 /// # Safety
 ///
-/// `page` and `js_expr` must be valid pointers.
+/// `page` must be a valid pointer. `patterns` may be NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_wait_for_condition(
+pub unsafe extern "C" fn page_block_urls(
     page: *mut Page,
-    js_expr: *const std::ffi::c_char,
-    timeout_secs: u64,
+    patterns: *const std::ffi::c_char,
 ) -> i32 {
-    if page.is_null() || js_expr.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    let expr = match unsafe { std::ffi::CStr::from_ptr(js_expr) }.to_str() {
-        Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+    if patterns.is_null() {
+        page.clear_blocked_urls();
+    } else {
+        let pat_str = match unsafe { std::ffi::CStr::from_ptr(patterns) }.to_str() {
+            Ok(s) => s,
+            Err(_) => return not_utf8(PAGE_ERR_JS),
+        };
+        let pats: Vec<String> = pat_str
+            .split(',')
+            .map(|s| s.trim().to_string())
+            .filter(|s| !s.is_empty())
+            .collect();
+        page.block_urls(pats);
+    }
+    PAGE_OK
+}
+
+// -- Request interceptor FFI --
+
+const PAGE_REQUEST_CONTINUE: i32 = 0;
+const PAGE_REQUEST_ABORT: i32 = 1;
+const PAGE_REQUEST_REDIRECT: i32 = 2;
+const PAGE_REQUEST_MODIFY_HEADERS: i32 = 3;
+
+/// C request interceptor: receives `userdata` and the request as JSON, returns
+/// a `PAGE_REQUEST_*` action. For `REDIRECT` / `MODIFY_HEADERS`, `*out_arg` is
+/// set to the target URL / a JSON object of headers; it is copied as soon as
+/// the callback returns.
+pub type PageRequestInterceptor = unsafe extern "C" fn(
+    userdata: *mut std::ffi::c_void,
+    request_json: *const std::ffi::c_char,
+    out_arg: *mut *const std::ffi::c_char,
+) -> i32;
+
+/// Caller-owned `userdata`, moved to the engine thread with the callback.
+struct UserData(*mut std::ffi::c_void);
+
+unsafe impl Send for UserData {}
+
+impl UserData {
+    fn get(&self) -> *mut std::ffi::c_void {
+        self.0
+    }
+}
+
+fn call_request_interceptor(
+    callback: PageRequestInterceptor,
+    userdata: &UserData,
+    request: &InterceptedRequest,
+) -> RequestAction {
+    let json = match serde_json::to_string(request).map(std::ffi::CString::new) {
+        Ok(Ok(json)) => json,
+        _ => return RequestAction::Continue,
     };
-    match page.wait_for_condition(expr, timeout_secs) {
-        Ok(()) => PAGE_OK,
-        Err(e) => error_code(&e),
+    let mut out_arg: *const std::ffi::c_char = std::ptr::null();
+    let action = unsafe { callback(userdata.get(), json.as_ptr(), &mut out_arg) };
+    let arg = if out_arg.is_null() {
+        None
+    } else {
+        unsafe { std::ffi::CStr::from_ptr(out_arg) }
+            .to_str()
+            .ok()
+            .map(str::to_string)
+    };
+    match (action, arg) {
+        (PAGE_REQUEST_ABORT, _) => RequestAction::Abort,
+        (PAGE_REQUEST_REDIRECT, Some(url)) => RequestAction::Redirect(url),
+        (PAGE_REQUEST_MODIFY_HEADERS, Some(headers)) => match serde_json::from_str(&headers) {
+            Ok(headers) => RequestAction::ContinueWithHeaders(headers),
+            Err(_) => RequestAction::Continue,
+        },
+        _ => RequestAction::Continue,
     }
 }
 
-/// Wait for a fixed number of seconds.
+/// Install a callback invoked for every request before it is sent. Pass a NULL
+/// `callback` to remove it.
+///
+/// The callback runs on the engine's background thread. Calling `page_*`
+/// functions from inside it returns `PAGE_ERR_CHANNEL` instead of deadlocking.
 ///
 /// # Safety
 ///
-/// `page` must be a valid pointer.
+/// `page` must be a valid pointer. `callback` must be safe to call from another
+/// thread with `userdata` until it is replaced, removed, or the page is freed.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_wait(page: *mut Page, seconds: f64) -> i32 {
+pub unsafe extern "C" fn page_set_request_interceptor(
+    page: *mut Page,
+    callback: Option<PageRequestInterceptor>,
+    userdata: *mut std::ffi::c_void,
+) -> i32 {
     if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    page.wait(seconds);
+    let userdata = UserData(userdata);
+    page.set_request_interceptor(callback.map(|callback| {
+        Box::new(move |request: &InterceptedRequest| {
+            call_request_interceptor(callback, &userdata, request)
+        }) as SendRequestInterceptor
+    }));
     PAGE_OK
 }
 
-/// Wait for the next navigation to complete.
+/// C progress callback: receives `userdata`, the estimated percentage and the
+/// number of requests started so far.
+pub type PageProgressCallback =
+    unsafe extern "C" fn(userdata: *mut std::ffi::c_void, percent: f64, requests: u32);
+
+/// Install a callback reporting navigation progress while `page_open()`,
+/// `page_reload()`, `page_go_back()` or `page_go_forward()` blocks. Pass a
+/// NULL `callback` to remove it.
+///
+/// The callback runs on the engine's background thread whenever the estimate
+/// changes. Calling `page_*` functions from inside it returns
+/// `PAGE_ERR_CHANNEL` instead of deadlocking.
 ///
 /// # Safety
 ///
-/// `page` must be a valid pointer.
+/// `page` must be a valid pointer. `callback` must be safe to call from another
+/// thread with `userdata` until it is replaced, removed, or the page is freed.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_wait_for_navigation(page: *mut Page, timeout_secs: u64) -> i32 {
+pub unsafe extern "C" fn page_set_progress_callback(
+    page: *mut Page,
+    callback: Option<PageProgressCallback>,
+    userdata: *mut std::ffi::c_void,
+) -> i32 {
     if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.wait_for_navigation(timeout_secs) {
+    let userdata = UserData(userdata);
+    page.set_progress_callback(callback.map(|callback| {
+        Box::new(move |progress: &LoadProgress| unsafe {
+            callback(userdata.get(), progress.percent, progress.requests)
+        }) as SendProgressCallback
+    }));
+    PAGE_OK
+}
+
+/// C HTML stream callback: receives `userdata` and a NUL-terminated chunk of
+/// `len` bytes; a nonzero return stops delivery until the next navigation.
+pub type PageHtmlStreamCallback = unsafe extern "C" fn(
+    userdata: *mut std::ffi::c_void,
+    chunk: *const std::ffi::c_char,
+    len: usize,
+) -> i32;
+
+/// Install a callback receiving HTML chunks while documents are parsed. Pass
+/// a NULL `callback` to remove it.
+///
+/// The callback runs on the engine's background thread; the chunk is only
+/// valid during the call. Calling `page_*` functions from inside it returns
+/// `PAGE_ERR_CHANNEL` instead of deadlocking.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer. `callback` must be safe to call from another
+/// thread with `userdata` until it is replaced, removed, or the page is freed.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_html_stream_callback(
+    page: *mut Page,
+    callback: Option<PageHtmlStreamCallback>,
+    userdata: *mut std::ffi::c_void,
+) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let userdata = UserData(userdata);
+    page.set_html_stream_callback(callback.map(|callback| {
+        Box::new(move |chunk: &str| {
+            let chunk = std::ffi::CString::new(chunk.replace('\0', "")).unwrap_or_default();
+            let len = chunk.as_bytes().len();
+            unsafe { callback(userdata.get(), chunk.as_ptr(), len) == 0 }
+        }) as SendHtmlStreamCallback
+    }));
+    PAGE_OK
+}
+
+/// Set the `Accept` header for top-level navigations of the active page.
+/// Pass NULL to restore the default.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer. `value` may be NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_accept(page: *mut Page, value: *const std::ffi::c_char) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let value = if value.is_null() {
+        None
+    } else {
+        match unsafe { std::ffi::CStr::from_ptr(value) }.to_str() {
+            Ok(s) => Some(s),
+            Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
+        }
+    };
+    match page.set_accept(value) {
         Ok(()) => PAGE_OK,
         Err(e) => error_code(&e),
     }
 }
 
-/// Wait until no new network requests arrive for `idle_ms` milliseconds.
+/// Replace the `Content-Security-Policy` of top-level responses of the active
+/// page; `""` removes it, NULL restores the site's own. A deliberate security
+/// relaxation — see `PageEngine::set_csp`.
 ///
 /// # Safety
 ///
-/// `page` must be a valid pointer.
+/// `page` must be a valid pointer. `policy` may be NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_wait_for_network_idle(
+pub unsafe extern "C" fn page_set_csp(page: *mut Page, policy: *const std::ffi::c_char) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let policy = if policy.is_null() {
+        None
+    } else {
+        match unsafe { std::ffi::CStr::from_ptr(policy) }.to_str() {
+            Ok(s) => Some(s),
+            Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
+        }
+    };
+    match page.set_csp(policy) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Set the `Accept-Encoding` header for top-level navigations of the active
+/// page (`"identity"` or `"gzip"`). Pass NULL or `""` to restore the default.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer. `value` may be NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_accept_encoding(
     page: *mut Page,
-    idle_ms: u64,
-    timeout_secs: u64,
+    value: *const std::ffi::c_char,
 ) -> i32 {
     if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.wait_for_network_idle(idle_ms, timeout_secs) {
+    let value = if value.is_null() {
+        None
+    } else {
+        match unsafe { std::ffi::CStr::from_ptr(value) }.to_str() {
+            Ok(s) => Some(s),
+            Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
+        }
+    };
+    match page.set_accept_encoding(value) {
         Ok(()) => PAGE_OK,
         Err(e) => error_code(&e),
     }
 }
 
-// -- Input FFI --
+/// Read an optional C string argument: NULL is `Ok(None)`, invalid UTF-8 is `Err`.
+///
+/// # Safety
+///
+/// `s` must be a valid C string or NULL.
+unsafe fn optional_str<'a>(s: *const std::ffi::c_char) -> Result<Option<&'a str>, ()> {
+    if s.is_null() {
+        return Ok(None);
+    }
+    unsafe { std::ffi::CStr::from_ptr(s) }
+        .to_str()
+        .map(Some)
+        .map_err(|_| ())
+}
 
-/// Click at the given coordinates.
+/// Set the `Sec-Fetch-Site` / `-Mode` / `-Dest` headers for every HTTP(S)
+/// request of the active page. NULL restores the default for that header.
 ///
 /// # Safety
 ///
-/// `page` must be a valid pointer.
+/// `page` must be a valid pointer. The other arguments may be NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_click(page: *mut Page, x: f32, y: f32) -> i32 {
+pub unsafe extern "C" fn page_set_fetch_metadata(
+    page: *mut Page,
+    site: *const std::ffi::c_char,
+    mode: *const std::ffi::c_char,
+    dest: *const std::ffi::c_char,
+) -> i32 {
     if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.click(x, y) {
+    let (site, mode, dest) =
+        match unsafe { (optional_str(site), optional_str(mode), optional_str(dest)) } {
+            (Ok(site), Ok(mode), Ok(dest)) => (site, mode, dest),
+            _ => return not_utf8(PAGE_ERR_INVALID_ARG),
+        };
+    match page.set_fetch_metadata(site, mode, dest) {
         Ok(()) => PAGE_OK,
         Err(e) => error_code(&e),
     }
 }
 
-/// Click on an element matching a CSS selector.
+/// Set the `Origin` header for every HTTP(S) request of the active page.
+/// Pass NULL to restore the default.
 ///
 /// # Safety
 ///
-/// `page` and `selector` must be valid pointers.
+/// `page` must be a valid pointer. `origin` may be NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_click_selector(
+pub unsafe extern "C" fn page_set_origin(page: *mut Page, origin: *const std::ffi::c_char) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let origin = match unsafe { optional_str(origin) } {
+        Ok(origin) => origin,
+        Err(()) => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    match page.set_origin(origin) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Add a rule setting header `name` to `value` on HTTP(S) requests of the
+/// active page under `url_prefix` (same origin, path prefix). NULL `value`
+/// removes the header instead. Rules apply in order; later matches override
+/// earlier ones.
+///
+/// # Safety
+///
+/// `page`, `url_prefix` and `name` must be valid pointers. `value` may be NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_add_header_rule(
     page: *mut Page,
-    selector: *const std::ffi::c_char,
+    url_prefix: *const std::ffi::c_char,
+    name: *const std::ffi::c_char,
+    value: *const std::ffi::c_char,
 ) -> i32 {
-    if page.is_null() || selector.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || url_prefix.is_null() || name.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
-        Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+    let (url_prefix, name) = match unsafe {
+        (
+            std::ffi::CStr::from_ptr(url_prefix).to_str(),
+            std::ffi::CStr::from_ptr(name).to_str(),
+        )
+    } {
+        (Ok(url_prefix), Ok(name)) => (url_prefix, name),
+        _ => return not_utf8(PAGE_ERR_INVALID_ARG),
     };
-    match page.click_selector(sel) {
+    let value = match unsafe { optional_str(value) } {
+        Ok(value) => value,
+        Err(()) => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    match page.add_header_rule(url_prefix, name, value) {
         Ok(()) => PAGE_OK,
         Err(e) => error_code(&e),
     }
 }
 
-/// Type text by sending individual key events.
+/// Remove all rules added by `page_add_header_rule`.
 ///
 /// # Safety
 ///
-/// `page` and `text` must be valid pointers.
+/// `page` must be a valid pointer.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_type_text(page: *mut Page, text: *const std::ffi::c_char) -> i32 {
-    if page.is_null() || text.is_null() {
-        return PAGE_ERR_NULL_PTR;
+pub unsafe extern "C" fn page_clear_header_rules(page: *mut Page) -> i32 {
+    if page.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    let text_str = match unsafe { std::ffi::CStr::from_ptr(text) }.to_str() {
+    match page.clear_header_rules() {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+// -- Network emulation FFI --
+
+/// Emulate a network connection type ("wifi", "4g", "3g", "2g", "offline").
+///
+/// # Safety
+///
+/// `page` and `conn_type` must be valid pointers.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_connection_type(
+    page: *mut Page,
+    conn_type: *const std::ffi::c_char,
+) -> i32 {
+    if page.is_null() || conn_type.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let type_str = match unsafe { std::ffi::CStr::from_ptr(conn_type) }.to_str() {
         Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+        Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
     };
-    match page.type_text(text_str) {
-        Ok(()) => PAGE_OK,
+    match type_str.parse::<ConnectionType>() {
+        Ok(connection_type) => {
+            page.set_connection_type(connection_type);
+            PAGE_OK
+        }
         Err(e) => error_code(&e),
     }
 }
 
-/// Press a single key by name (e.g. "Enter", "Tab", "a").
+const PAGE_FEATURE_WEBGL: u32 = 1;
+const PAGE_FEATURE_WASM: u32 = 2;
+const PAGE_FEATURE_SERVICE_WORKERS: u32 = 4;
+
+/// Enable the web-platform features whose `PAGE_FEATURE_*` bits are set in
+/// `mask` and disable the rest, for all pages. Unknown bits return
+/// `PAGE_ERR_INVALID_ARG`.
 ///
 /// # Safety
 ///
-/// `page` and `key_name` must be valid pointers.
+/// `page` must be a valid pointer.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_key_press(page: *mut Page, key_name: *const std::ffi::c_char) -> i32 {
-    if page.is_null() || key_name.is_null() {
-        return PAGE_ERR_NULL_PTR;
+pub unsafe extern "C" fn page_set_feature_flags(page: *mut Page, mask: u32) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    if mask & !(PAGE_FEATURE_WEBGL | PAGE_FEATURE_WASM | PAGE_FEATURE_SERVICE_WORKERS) != 0 {
+        let e = PageError::InvalidArgument(format!("unknown feature flags in {mask:#x}"));
+        return error_code(&e);
     }
     let page = unsafe { &*page };
-    let name = match unsafe { std::ffi::CStr::from_ptr(key_name) }.to_str() {
-        Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
-    };
-    match page.key_press(name) {
-        Ok(()) => PAGE_OK,
-        Err(e) => error_code(&e),
+    page.set_feature_flags(FeatureFlags {
+        webgl: mask & PAGE_FEATURE_WEBGL != 0,
+        webassembly: mask & PAGE_FEATURE_WASM != 0,
+        service_workers: mask & PAGE_FEATURE_SERVICE_WORKERS != 0,
+    });
+    PAGE_OK
+}
+
+/// Seed `Math.random()` and `crypto.getRandomValues()` on all pages so every
+/// document sees the same sequence; `0` restores real randomness.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_set_random_seed(page: *mut Page, seed: u64) -> i32 {
+    if page.is_null() {
+        return null_ptr();
     }
+    let page = unsafe { &*page };
+    page.set_random_seed(seed);
+    PAGE_OK
 }
 
-/// Move the mouse to the given coordinates.
+// -- Navigation FFI --
+
+/// Reload the current page.
 ///
 /// # Safety
 ///
 /// `page` must be a valid pointer.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_mouse_move(page: *mut Page, x: f32, y: f32) -> i32 {
+pub unsafe extern "C" fn page_reload(page: *mut Page) -> i32 {
     if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.mouse_move(x, y) {
+    match page.reload() {
         Ok(()) => PAGE_OK,
         Err(e) => error_code(&e),
     }
 }
 
-// -- Scroll FFI --
-
-/// Scroll the viewport by the given pixel deltas.
+/// Navigate back in history. Returns `PAGE_ERR_NO_PAGE` if no history.
 ///
 /// # Safety
 ///
 /// `page` must be a valid pointer.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_scroll(page: *mut Page, delta_x: f64, delta_y: f64) -> i32 {
+pub unsafe extern "C" fn page_go_back(page: *mut Page) -> i32 {
     if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.scroll(delta_x, delta_y) {
-        Ok(()) => PAGE_OK,
+    match page.go_back() {
+        Ok(true) => PAGE_OK,
+        Ok(false) => error_code(&PageError::NoPage),
         Err(e) => error_code(&e),
     }
 }
 
-/// Scroll an element matching a CSS selector into view.
+/// Navigate forward in history. Returns `PAGE_ERR_NO_PAGE` if no forward history.
 ///
 /// # Safety
 ///
-/// `page` and `selector` must be valid pointers.
+/// `page` must be a valid pointer.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_scroll_to_selector(
-    page: *mut Page,
-    selector: *const std::ffi::c_char,
-) -> i32 {
-    if page.is_null() || selector.is_null() {
-        return PAGE_ERR_NULL_PTR;
+pub unsafe extern "C" fn page_go_forward(page: *mut Page) -> i32 {
+    if page.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
-        Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
-    };
-    match page.scroll_to_selector(sel) {
-        Ok(()) => PAGE_OK,
+    match page.go_forward() {
+        Ok(true) => PAGE_OK,
+        Ok(false) => error_code(&PageError::NoPage),
         Err(e) => error_code(&e),
     }
 }
 
-// -- Select FFI --
+// -- Element info FFI --
 
-/// Select an option in a `<select>` element by value.
+/// Get the bounding rectangle of an element as JSON (`{"x":..,"y":..,"width":..,"height":..}`).
 ///
 /// # Safety
 ///
-/// `page`, `selector`, and `value` must be valid pointers.
+/// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_select_option(
+pub unsafe extern "C" fn page_element_rect(
     page: *mut Page,
     selector: *const std::ffi::c_char,
-    value: *const std::ffi::c_char,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
 ) -> i32 {
-    if page.is_null() || selector.is_null() || value.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || selector.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
     let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
         Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
     };
-    let val = match unsafe { std::ffi::CStr::from_ptr(value) }.to_str() {
-        Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
-    };
-    match page.select_option(sel, val) {
-        Ok(()) => PAGE_OK,
+    match page.element_rect(sel) {
+        Ok(rect) => {
+            let json = serde_json::to_string(&rect).unwrap_or_else(|_| "{}".to_string());
+            match std::ffi::CString::new(json) {
+                Ok(cstr) => {
+                    let len = cstr.as_bytes().len();
+                    let ptr = cstr.into_raw();
+                    unsafe {
+                        *out_json = ptr;
+                        *out_len = len;
+                    }
+                    PAGE_OK
+                }
+                Err(_) => nul_byte(),
+            }
+        }
         Err(e) => error_code(&e),
     }
 }
 
-// -- File upload FFI --
-
-/// Set files on an `<input type="file">` element.
-///
-/// `paths` is a comma-separated list of file paths. Each file is read from disk,
-/// its MIME type inferred from the extension, and injected via the DataTransfer API.
+/// Check that `selector` parses: `*out_valid` is set to 1 or 0. If valid and
+/// `out_matches` is not NULL, it receives the number of matching elements.
+/// If invalid and `out_error` is not NULL, it receives the parser message
+/// (free with `page_string_free()`); otherwise it is set to NULL.
 ///
 /// # Safety
 ///
-/// `page`, `selector`, and `paths` must be valid pointers.
+/// `page`, `selector` and `out_valid` must be valid pointers; `out_matches`
+/// and `out_error` may be NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_set_input_files(
+pub unsafe extern "C" fn page_validate_selector(
     page: *mut Page,
     selector: *const std::ffi::c_char,
-    paths: *const std::ffi::c_char,
+    out_valid: *mut i32,
+    out_matches: *mut usize,
+    out_error: *mut *mut std::ffi::c_char,
 ) -> i32 {
-    if page.is_null() || selector.is_null() || paths.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || selector.is_null() || out_valid.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
     let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
         Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
-    };
-    let paths_str = match unsafe { std::ffi::CStr::from_ptr(paths) }.to_str() {
-        Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+        Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
     };
-
-    let mut files = Vec::new();
-    for path_str in paths_str
-        .split(',')
-        .map(|s| s.trim())
-        .filter(|s| !s.is_empty())
-    {
-        let path = std::path::Path::new(path_str);
-        let data = match std::fs::read(path) {
-            Ok(d) => d,
-            Err(_) => return PAGE_ERR_JS,
-        };
-        let name = path
-            .file_name()
-            .and_then(|n| n.to_str())
-            .unwrap_or("file")
-            .to_string();
-        let mime_type = match path.extension().and_then(|e| e.to_str()) {
-            Some("txt") => "text/plain",
-            Some("html") | Some("htm") => "text/html",
-            Some("css") => "text/css",
-            Some("js") => "application/javascript",
-            Some("json") => "application/json",
-            Some("xml") => "application/xml",
-            Some("pdf") => "application/pdf",
-            Some("png") => "image/png",
-            Some("jpg") | Some("jpeg") => "image/jpeg",
-            Some("gif") => "image/gif",
-            Some("svg") => "image/svg+xml",
-            Some("webp") => "image/webp",
-            Some("zip") => "application/zip",
-            Some("csv") => "text/csv",
-            _ => "application/octet-stream",
+    match page.validate_selector(sel) {
+        Ok(validation) => {
+            if !out_matches.is_null() {
+                unsafe { *out_matches = validation.matches.unwrap_or(0) };
+            }
+            unsafe { write_validation(validation, out_valid, out_error) }
         }
-        .to_string();
-        files.push(InputFile {
-            name,
-            mime_type,
-            data,
-        });
-    }
-
-    match page.set_input_files(sel, files) {
-        Ok(()) => PAGE_OK,
         Err(e) => error_code(&e),
     }
 }
 
-// -- Cookies FFI --
-
-/// Get cookies for the current page.
-///
-/// On success, `*out_cookies` and `*out_len` are set. Free with `page_string_free()`.
+/// Check that `script` parses as a classic script, without running it.
+/// `*out_valid` and `*out_error` are set as for `page_validate_selector()`.
 ///
 /// # Safety
 ///
-/// All pointer arguments must be valid or NULL.
+/// `page`, `script` and `out_valid` must be valid pointers; `out_error` may
+/// be NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_get_cookies(
+pub unsafe extern "C" fn page_validate_script(
     page: *mut Page,
-    out_cookies: *mut *mut std::ffi::c_char,
-    out_len: *mut usize,
+    script: *const std::ffi::c_char,
+    out_valid: *mut i32,
+    out_error: *mut *mut std::ffi::c_char,
 ) -> i32 {
-    if page.is_null() || out_cookies.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || script.is_null() || out_valid.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.get_cookies() {
-        Ok(cookies) => match std::ffi::CString::new(cookies) {
-            Ok(cstr) => {
-                let len = cstr.as_bytes().len();
-                let ptr = cstr.into_raw();
-                unsafe {
-                    *out_cookies = ptr;
-                    *out_len = len;
-                }
-                PAGE_OK
-            }
-            Err(_) => PAGE_ERR_JS,
-        },
+    let script = match unsafe { std::ffi::CStr::from_ptr(script) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    match page.validate_script(script) {
+        Ok(validation) => unsafe { write_validation(validation, out_valid, out_error) },
         Err(e) => error_code(&e),
     }
 }
 
-/// Set a cookie via `document.cookie`.
+/// Write the validity flag and, if requested, the error message.
 ///
 /// # Safety
 ///
-/// `page` and `cookie` must be valid pointers.
-#[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_set_cookie(page: *mut Page, cookie: *const std::ffi::c_char) -> i32 {
-    if page.is_null() || cookie.is_null() {
-        return PAGE_ERR_NULL_PTR;
-    }
-    let page = unsafe { &*page };
-    let cookie_str = match unsafe { std::ffi::CStr::from_ptr(cookie) }.to_str() {
-        Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
-    };
-    match page.set_cookie(cookie_str) {
-        Ok(()) => PAGE_OK,
-        Err(e) => error_code(&e),
+/// `out_valid` must be valid; `out_error` may be NULL.
+unsafe fn write_validation(
+    validation: Validation,
+    out_valid: *mut i32,
+    out_error: *mut *mut std::ffi::c_char,
+) -> i32 {
+    unsafe { *out_valid = validation.valid as i32 };
+    if !out_error.is_null() {
+        let error = validation
+            .error
+            .and_then(|e| std::ffi::CString::new(e).ok())
+            .map_or(std::ptr::null_mut(), std::ffi::CString::into_raw);
+        unsafe { *out_error = error };
     }
+    PAGE_OK
 }
 
-/// Clear all cookies for the current page.
+/// Get the document's links as a JSON array of objects with `url`, `text`,
+/// `rel`, `target`, `nofollow`, `sponsored` and `ugc`. Free with
+/// `page_string_free()`.
 ///
 /// # Safety
 ///
-/// `page` must be a valid pointer.
+/// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_clear_cookies(page: *mut Page) -> i32 {
-    if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+pub unsafe extern "C" fn page_links_detailed(
+    page: *mut Page,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.clear_cookies() {
-        Ok(()) => PAGE_OK,
+    match page.links_detailed() {
+        Ok(links) => {
+            let json = serde_json::to_string(&links).unwrap_or_else(|_| "[]".to_string());
+            match std::ffi::CString::new(json) {
+                Ok(cstr) => {
+                    let len = cstr.as_bytes().len();
+                    let ptr = cstr.into_raw();
+                    unsafe {
+                        *out_json = ptr;
+                        *out_len = len;
+                    }
+                    PAGE_OK
+                }
+                Err(_) => nul_byte(),
+            }
+        }
         Err(e) => error_code(&e),
     }
 }
 
-// -- Request interception FFI --
-
-/// Set URL patterns to block (comma-separated). Pass NULL to clear.
+/// Evaluate an XPath expression and return the text of each matching node as
+/// a JSON array of strings (`[]` if none match). Expressions yielding a
+/// number, string or boolean return a one-element array. An invalid
+/// expression returns `PAGE_ERR_INVALID_ARG`. Free with `page_string_free()`.
 ///
 /// # Safety
 ///
-/// `page` must be a valid pointer. `patterns` may be NULL.
+/// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_block_urls(
+pub unsafe extern "C" fn page_query_xpath(
     page: *mut Page,
-    patterns: *const std::ffi::c_char,
+    xpath: *const std::ffi::c_char,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
 ) -> i32 {
-    if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || xpath.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    if patterns.is_null() {
-        page.clear_blocked_urls();
-    } else {
-        let pat_str = match unsafe { std::ffi::CStr::from_ptr(patterns) }.to_str() {
-            Ok(s) => s,
-            Err(_) => return PAGE_ERR_JS,
-        };
-        let pats: Vec<String> = pat_str
-            .split(',')
-            .map(|s| s.trim().to_string())
-            .filter(|s| !s.is_empty())
-            .collect();
-        page.block_urls(pats);
+    let xpath = match unsafe { std::ffi::CStr::from_ptr(xpath) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    match page.query_xpath(xpath) {
+        Ok(items) => {
+            let json = serde_json::to_string(&items).unwrap_or_else(|_| "[]".to_string());
+            match std::ffi::CString::new(json) {
+                Ok(cstr) => {
+                    let len = cstr.as_bytes().len();
+                    let ptr = cstr.into_raw();
+                    unsafe {
+                        *out_json = ptr;
+                        *out_len = len;
+                    }
+                    PAGE_OK
+                }
+                Err(_) => nul_byte(),
+            }
+        }
+        Err(e) => error_code(&e),
     }
-    PAGE_OK
 }
 
-// -- Navigation FFI --
-
-/// Reload the current page.
+/// Get the bounding rectangles of all elements matching a selector as a JSON
+/// array (`[]` if none match). Free with `page_string_free()`.
 ///
 /// # Safety
 ///
-/// `page` must be a valid pointer.
+/// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_reload(page: *mut Page) -> i32 {
-    if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+pub unsafe extern "C" fn page_element_rects(
+    page: *mut Page,
+    selector: *const std::ffi::c_char,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || selector.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.reload() {
-        Ok(()) => PAGE_OK,
+    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.element_rects(sel) {
+        Ok(rects) => {
+            let json = serde_json::to_string(&rects).unwrap_or_else(|_| "[]".to_string());
+            match std::ffi::CString::new(json) {
+                Ok(cstr) => {
+                    let len = cstr.as_bytes().len();
+                    let ptr = cstr.into_raw();
+                    unsafe {
+                        *out_json = ptr;
+                        *out_len = len;
+                    }
+                    PAGE_OK
+                }
+                Err(_) => nul_byte(),
+            }
+        }
         Err(e) => error_code(&e),
     }
 }
 
-/// Navigate back in history. Returns `PAGE_ERR_NO_PAGE` if no history.
+/// Get the font families the document renders with and the web fonts it
+/// declares, as a JSON array of `{"family","source","status","elements",
+/// "fallback_for"}` objects.
+///
+/// On success, `*out_json` and `*out_len` are set. Free with `page_string_free()`.
 ///
 /// # Safety
 ///
-/// `page` must be a valid pointer.
+/// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_go_back(page: *mut Page) -> i32 {
-    if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+pub unsafe extern "C" fn page_used_fonts(
+    page: *mut Page,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    match page.go_back() {
-        Ok(true) => PAGE_OK,
-        Ok(false) => PAGE_ERR_NO_PAGE,
+    match page.used_fonts() {
+        Ok(fonts) => {
+            let json = serde_json::to_string(&fonts).unwrap_or_else(|_| "[]".to_string());
+            match std::ffi::CString::new(json) {
+                Ok(cstr) => {
+                    let len = cstr.as_bytes().len();
+                    let ptr = cstr.into_raw();
+                    unsafe {
+                        *out_json = ptr;
+                        *out_len = len;
+                    }
+                    PAGE_OK
+                }
+                Err(_) => nul_byte(),
+            }
+        }
         Err(e) => error_code(&e),
     }
 }
 
-/// Navigate forward in history. Returns `PAGE_ERR_NO_PAGE` if no forward history.
+const PAGE_RESOURCE_STYLESHEET: u32 = 1;
+const PAGE_RESOURCE_SCRIPT: u32 = 2;
+const PAGE_RESOURCE_IMAGE: u32 = 4;
+
+/// Get the resources the document declares, selected by a mask of
+/// `PAGE_RESOURCE_*` bits, as a JSON array of `{"type","url"}` objects.
 ///
 /// # Safety
 ///
-/// `page` must be a valid pointer.
+/// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_go_forward(page: *mut Page) -> i32 {
-    if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+pub unsafe extern "C" fn page_resources(
+    page: *mut Page,
+    type_mask: u32,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let all = PAGE_RESOURCE_STYLESHEET | PAGE_RESOURCE_SCRIPT | PAGE_RESOURCE_IMAGE;
+    if type_mask & !all != 0 {
+        let e = PageError::InvalidArgument(format!("unknown resource types in {type_mask:#x}"));
+        return error_code(&e);
     }
     let page = unsafe { &*page };
-    match page.go_forward() {
-        Ok(true) => PAGE_OK,
-        Ok(false) => PAGE_ERR_NO_PAGE,
+    let types: Vec<ResourceType> = [
+        (PAGE_RESOURCE_STYLESHEET, ResourceType::Stylesheet),
+        (PAGE_RESOURCE_SCRIPT, ResourceType::Script),
+        (PAGE_RESOURCE_IMAGE, ResourceType::Image),
+    ]
+    .into_iter()
+    .filter(|(bit, _)| type_mask & bit != 0)
+    .map(|(_, kind)| kind)
+    .collect();
+    match page.resources(&types) {
+        Ok(resources) => {
+            let json = serde_json::to_string(&resources).unwrap_or_else(|_| "[]".to_string());
+            match std::ffi::CString::new(json) {
+                Ok(cstr) => {
+                    let len = cstr.as_bytes().len();
+                    let ptr = cstr.into_raw();
+                    unsafe {
+                        *out_json = ptr;
+                        *out_len = len;
+                    }
+                    PAGE_OK
+                }
+                Err(_) => nul_byte(),
+            }
+        }
         Err(e) => error_code(&e),
     }
 }
 
-// -- Element info FFI --
-
-/// Get the bounding rectangle of an element as JSON (`{"x":..,"y":..,"width":..,"height":..}`).
+/// Get the stylesheets and scripts that blocked the first paint as a JSON
+/// array of `{"type","url","duration_ms","async","defer"}` objects. Free with
+/// `page_string_free()`.
 ///
 /// # Safety
 ///
 /// All pointer arguments must be valid or NULL.
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn page_element_rect(
+pub unsafe extern "C" fn page_render_blocking(
     page: *mut Page,
-    selector: *const std::ffi::c_char,
     out_json: *mut *mut std::ffi::c_char,
     out_len: *mut usize,
 ) -> i32 {
-    if page.is_null() || selector.is_null() || out_json.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+    if page.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
     }
     let page = unsafe { &*page };
-    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
-        Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
-    };
-    match page.element_rect(sel) {
-        Ok(rect) => {
-            let json = serde_json::to_string(&rect).unwrap_or_else(|_| "{}".to_string());
+    match page.render_blocking() {
+        Ok(resources) => {
+            let json = serde_json::to_string(&resources).unwrap_or_else(|_| "[]".to_string());
             match std::ffi::CString::new(json) {
                 Ok(cstr) => {
                     let len = cstr.as_bytes().len();
@@ -948,13 +3327,43 @@ pub unsafe extern "C" fn page_element_rect(
                     }
                     PAGE_OK
                 }
-                Err(_) => PAGE_ERR_JS,
+                Err(_) => nul_byte(),
             }
         }
         Err(e) => error_code(&e),
     }
 }
 
+/// Check whether the first element matching `selector` could be clicked:
+/// visible, enabled, in the viewport and not covered at its center point.
+/// Sets `*out_clickable` to 1 or 0. Returns `PAGE_ERR_SELECTOR` if nothing matches.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_is_clickable(
+    page: *mut Page,
+    selector: *const std::ffi::c_char,
+    out_clickable: *mut i32,
+) -> i32 {
+    if page.is_null() || selector.is_null() || out_clickable.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
+        Ok(s) => s,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
+    };
+    match page.is_clickable(sel) {
+        Ok(clickable) => {
+            unsafe { *out_clickable = clickable as i32 };
+            PAGE_OK
+        }
+        Err(e) => error_code(&e),
+    }
+}
+
 /// Get the text content of an element.
 ///
 /// # Safety
@@ -968,12 +3377,12 @@ pub unsafe extern "C" fn page_element_text(
     out_len: *mut usize,
 ) -> i32 {
     if page.is_null() || selector.is_null() || out_text.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
         Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
     };
     match page.element_text(sel) {
         Ok(text) => match std::ffi::CString::new(text) {
@@ -986,7 +3395,7 @@ pub unsafe extern "C" fn page_element_text(
                 }
                 PAGE_OK
             }
-            Err(_) => PAGE_ERR_JS,
+            Err(_) => nul_byte(),
         },
         Err(e) => error_code(&e),
     }
@@ -1011,16 +3420,16 @@ pub unsafe extern "C" fn page_element_attribute(
         || out_value.is_null()
         || out_len.is_null()
     {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
         Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
     };
     let attr = match unsafe { std::ffi::CStr::from_ptr(attribute) }.to_str() {
         Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
     };
     match page.element_attribute(sel, attr) {
         Ok(value) => {
@@ -1035,7 +3444,7 @@ pub unsafe extern "C" fn page_element_attribute(
                     }
                     PAGE_OK
                 }
-                Err(_) => PAGE_ERR_JS,
+                Err(_) => nul_byte(),
             }
         }
         Err(e) => error_code(&e),
@@ -1055,12 +3464,12 @@ pub unsafe extern "C" fn page_element_html(
     out_len: *mut usize,
 ) -> i32 {
     if page.is_null() || selector.is_null() || out_html.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     let sel = match unsafe { std::ffi::CStr::from_ptr(selector) }.to_str() {
         Ok(s) => s,
-        Err(_) => return PAGE_ERR_JS,
+        Err(_) => return not_utf8(PAGE_ERR_JS),
     };
     match page.element_html(sel) {
         Ok(html) => match std::ffi::CString::new(html) {
@@ -1073,7 +3482,7 @@ pub unsafe extern "C" fn page_element_html(
                 }
                 PAGE_OK
             }
-            Err(_) => PAGE_ERR_JS,
+            Err(_) => nul_byte(),
         },
         Err(e) => error_code(&e),
     }
@@ -1090,7 +3499,7 @@ pub unsafe extern "C" fn page_element_html(
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn page_new_page(page: *mut Page, out_id: *mut u32) -> i32 {
     if page.is_null() || out_id.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     match page.new_page() {
@@ -1116,7 +3525,7 @@ pub unsafe extern "C" fn page_new_page_with_size(
     out_id: *mut u32,
 ) -> i32 {
     if page.is_null() || out_id.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     match page.new_page_with_size(width, height) {
@@ -1136,7 +3545,7 @@ pub unsafe extern "C" fn page_new_page_with_size(
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn page_switch_to(page: *mut Page, page_id: u32) -> i32 {
     if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     match page.switch_to(page_id) {
@@ -1153,7 +3562,7 @@ pub unsafe extern "C" fn page_switch_to(page: *mut Page, page_id: u32) -> i32 {
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn page_close_page(page: *mut Page, page_id: u32) -> i32 {
     if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     match page.close_page(page_id) {
@@ -1171,7 +3580,7 @@ pub unsafe extern "C" fn page_close_page(page: *mut Page, page_id: u32) -> i32 {
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn page_active_page_id(page: *mut Page, out_id: *mut u32) -> i32 {
     if page.is_null() || out_id.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     match page.active_page_id() {
@@ -1179,7 +3588,7 @@ pub unsafe extern "C" fn page_active_page_id(page: *mut Page, out_id: *mut u32)
             unsafe { *out_id = id };
             PAGE_OK
         }
-        None => PAGE_ERR_NO_PAGE,
+        None => error_code(&PageError::NoPage),
     }
 }
 
@@ -1196,7 +3605,7 @@ pub unsafe extern "C" fn page_page_ids(
     out_len: *mut usize,
 ) -> i32 {
     if page.is_null() || out_json.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     let ids = page.page_ids();
@@ -1211,7 +3620,7 @@ pub unsafe extern "C" fn page_page_ids(
             }
             PAGE_OK
         }
-        Err(_) => PAGE_ERR_JS,
+        Err(_) => nul_byte(),
     }
 }
 
@@ -1223,7 +3632,7 @@ pub unsafe extern "C" fn page_page_ids(
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn page_page_count(page: *mut Page, out_count: *mut usize) -> i32 {
     if page.is_null() || out_count.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     unsafe { *out_count = page.page_count() };
@@ -1238,7 +3647,7 @@ pub unsafe extern "C" fn page_page_count(page: *mut Page, out_count: *mut usize)
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn page_set_popup_handling(page: *mut Page, enabled: i32) -> i32 {
     if page.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     page.set_popup_handling(enabled != 0);
@@ -1258,7 +3667,7 @@ pub unsafe extern "C" fn page_popup_pages(
     out_len: *mut usize,
 ) -> i32 {
     if page.is_null() || out_json.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     let ids = page.popup_pages();
@@ -1273,7 +3682,7 @@ pub unsafe extern "C" fn page_popup_pages(
             }
             PAGE_OK
         }
-        Err(_) => PAGE_ERR_JS,
+        Err(_) => nul_byte(),
     }
 }
 
@@ -1291,7 +3700,7 @@ pub unsafe extern "C" fn page_page_url(
     out_len: *mut usize,
 ) -> i32 {
     if page.is_null() || out_url.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     match page.page_url(page_id) {
@@ -1305,9 +3714,9 @@ pub unsafe extern "C" fn page_page_url(
                 }
                 PAGE_OK
             }
-            Err(_) => PAGE_ERR_JS,
+            Err(_) => nul_byte(),
         },
-        None => PAGE_ERR_NO_PAGE,
+        None => error_code(&PageError::NoPage),
     }
 }
 
@@ -1325,7 +3734,7 @@ pub unsafe extern "C" fn page_page_title(
     out_len: *mut usize,
 ) -> i32 {
     if page.is_null() || out_title.is_null() || out_len.is_null() {
-        return PAGE_ERR_NULL_PTR;
+        return null_ptr();
     }
     let page = unsafe { &*page };
     match page.page_title(page_id) {
@@ -1339,15 +3748,221 @@ pub unsafe extern "C" fn page_page_title(
                 }
                 PAGE_OK
             }
-            Err(_) => PAGE_ERR_JS,
+            Err(_) => nul_byte(),
+        },
+        None => error_code(&PageError::NoPage),
+    }
+}
+
+/// List open pages and popups as a JSON array of
+/// `{"index","id","url","title","popup","active"}` objects.
+/// Free the result with `page_string_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_windows(
+    page: *mut Page,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if page.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    let windows = page.windows();
+    let json = serde_json::to_string(&windows).unwrap_or_else(|_| "[]".to_string());
+    match std::ffi::CString::new(json) {
+        Ok(cstr) => {
+            let len = cstr.as_bytes().len();
+            let ptr = cstr.into_raw();
+            unsafe {
+                *out_json = ptr;
+                *out_len = len;
+            }
+            PAGE_OK
+        }
+        Err(_) => nul_byte(),
+    }
+}
+
+/// Make the window at `index` in `page_windows()` the active page.
+///
+/// # Safety
+///
+/// `page` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn page_switch_window(page: *mut Page, index: usize) -> i32 {
+    if page.is_null() {
+        return null_ptr();
+    }
+    let page = unsafe { &*page };
+    match page.switch_window(index) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+// -- Process-wide --
+
+/// Get the last error returned on the calling thread as a JSON object with
+/// `code`, `kind`, `message` and, where known, `detail`, `selector`, `url`,
+/// `path`, `cache_dir` or `exception`; `null` if there was none. Free with
+/// `page_string_free()`.
+///
+/// # Safety
+///
+/// All pointer arguments must be valid or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn scraper_last_error_json(
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if out_json.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let json = LAST_ERROR.with(|last| match last.borrow().as_ref() {
+        Some(error) => error.to_string(),
+        None => "null".to_string(),
+    });
+    match std::ffi::CString::new(json) {
+        Ok(cstr) => {
+            let len = cstr.as_bytes().len();
+            let ptr = cstr.into_raw();
+            unsafe {
+                *out_json = ptr;
+                *out_len = len;
+            }
+            PAGE_OK
+        }
+        Err(_) => nul_byte(),
+    }
+}
+
+/// Compare two `page_dom_snapshot()` outputs; `ignore_attrs` is a
+/// comma-separated list of attribute names to skip, or NULL. No page is
+/// needed. Free the JSON result with `page_string_free()`.
+///
+/// # Safety
+///
+/// `snapshot_a`, `snapshot_b`, `out_json` and `out_len` must be valid
+/// pointers. `ignore_attrs` may be NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn scraper_diff_dom(
+    snapshot_a: *const std::ffi::c_char,
+    snapshot_b: *const std::ffi::c_char,
+    ignore_attrs: *const std::ffi::c_char,
+    out_json: *mut *mut std::ffi::c_char,
+    out_len: *mut usize,
+) -> i32 {
+    if snapshot_a.is_null() || snapshot_b.is_null() || out_json.is_null() || out_len.is_null() {
+        return null_ptr();
+    }
+    let (a, b) = match unsafe {
+        (
+            std::ffi::CStr::from_ptr(snapshot_a).to_str(),
+            std::ffi::CStr::from_ptr(snapshot_b).to_str(),
+        )
+    } {
+        (Ok(a), Ok(b)) => (a, b),
+        _ => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    let ignored: Vec<&str> = match unsafe { optional_str(ignore_attrs) } {
+        Ok(list) => list
+            .unwrap_or_default()
+            .split(',')
+            .map(str::trim)
+            .filter(|s| !s.is_empty())
+            .collect(),
+        Err(()) => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    match Page::diff_dom(a, b, &ignored) {
+        Ok(json) => match std::ffi::CString::new(json) {
+            Ok(cstr) => {
+                let len = cstr.as_bytes().len();
+                let ptr = cstr.into_raw();
+                unsafe {
+                    *out_json = ptr;
+                    *out_len = len;
+                }
+                PAGE_OK
+            }
+            Err(_) => nul_byte(),
         },
-        None => PAGE_ERR_NO_PAGE,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Set the directory where pages created afterwards keep Servo's on-disk state
+/// (HTTP cache, cookie and HSTS storage). Pass NULL to restore the default.
+/// The path is validated by `page_new()`, which returns NULL if it cannot be
+/// created or written, or if an earlier page already used another directory
+/// (Servo's options are process-wide).
+///
+/// # Safety
+///
+/// `path` must be a valid C string or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn scraper_set_cache_dir(path: *const std::ffi::c_char) -> i32 {
+    let dir = if path.is_null() {
+        None
+    } else {
+        match unsafe { std::ffi::CStr::from_ptr(path) }.to_str() {
+            Ok(s) => Some(std::path::PathBuf::from(s)),
+            Err(_) => return not_utf8(PAGE_ERR_INVALID_ARG),
+        }
+    };
+    *CACHE_DIR.lock().unwrap_or_else(|e| e.into_inner()) = dir;
+    PAGE_OK
+}
+
+/// Append one JSON line per request of every page to the file at `path`.
+/// Pass NULL to stop logging.
+///
+/// # Safety
+///
+/// `path` must be a valid C string or NULL.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn scraper_set_access_log(path: *const std::ffi::c_char) -> i32 {
+    let path = match unsafe { optional_str(path) } {
+        Ok(path) => path.map(std::path::Path::new),
+        Err(()) => return not_utf8(PAGE_ERR_INVALID_ARG),
+    };
+    match Page::set_access_log(path) {
+        Ok(()) => PAGE_OK,
+        Err(e) => error_code(&e),
+    }
+}
+
+/// Get the number of page handles created by `page_new()` and not yet freed
+/// with `page_free()`.
+///
+/// # Safety
+///
+/// `out_count` must be a valid pointer.
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn scraper_page_count(out_count: *mut usize) -> i32 {
+    if out_count.is_null() {
+        return null_ptr();
     }
+    unsafe { *out_count = Page::live_handles() };
+    PAGE_OK
+}
+
+/// Release memory that no live page needs and return freed heap to the OS.
+/// Call between batches in long-running hosts; safe while pages exist, and
+/// does not wait more than about half a second for busy ones. Does not force
+/// a JS garbage collection (Servo exposes no hook for it).
+#[unsafe(no_mangle)]
+pub extern "C" fn scraper_reclaim_memory() {
+    Page::reclaim_memory();
 }
 
 // -- Memory --
 
-/// Free a buffer returned by `page_screenshot()` or `page_screenshot_fullpage()`.
+/// Free a buffer returned by `page_screenshot()`, `page_screenshot_fullpage()`
+/// or `page_screenshot_raw()`.
 ///
 /// # Safety
 ///
@@ -1373,3 +3988,152 @@ pub unsafe extern "C" fn page_string_free(s: *mut std::ffi::c_char) {
         unsafe { drop(std::ffi::CString::from_raw(s)) };
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::io::{BufRead, BufReader, Write};
+    use std::net::TcpListener;
+    use std::sync::{Arc, Mutex};
+
+    /// Answer every request on `listener` with an empty page and collect
+    /// the lower-cased request heads.
+    fn serve(listener: TcpListener) -> Arc<Mutex<Vec<String>>> {
+        let heads = Arc::new(Mutex::new(Vec::new()));
+        let log = heads.clone();
+        std::thread::spawn(move || {
+            for stream in listener.incoming() {
+                let Ok(stream) = stream else { continue };
+                let mut reader = BufReader::new(stream);
+                let mut head = String::new();
+                let mut line = String::new();
+                while reader.read_line(&mut line).is_ok_and(|n| n > 2) {
+                    head.push_str(&line.to_ascii_lowercase());
+                    line.clear();
+                }
+                log.lock().unwrap().push(head);
+                let _ = reader.into_inner().write_all(
+                    b"HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\
+                      Content-Length: 0\r\nConnection: close\r\n\r\n",
+                );
+            }
+        });
+        heads
+    }
+
+    // Servo allows one engine per process, so this is the only test here
+    // that creates a page.
+    #[test]
+    fn page_from_config_applies_page_settings() {
+        let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+        let base = format!("http://127.0.0.1:{}", listener.local_addr().unwrap().port());
+        let heads = serve(listener);
+
+        let config: PageConfig = serde_json::from_str(
+            r#"{"timeout": 10, "wait": 0, "accept": "application/json",
+                "accept_encoding": "identity", "origin": "https://example.com",
+                "blocked_urls": ["/blocked"], "fulpage": true, "proxy": "http://p"}"#,
+        )
+        .unwrap();
+        // Unknown keys are collected for the warning, not rejected.
+        let unknown: Vec<&str> = config.unknown.keys().map(String::as_str).collect();
+        assert_eq!(unknown, ["fulpage", "proxy"]);
+        let page = page_from_config(config).expect("page_from_config failed");
+
+        page.open(&format!("{base}/page")).expect("open failed");
+        page.open(&format!("data:text/html,<img src='{base}/blocked.png'>"))
+            .expect("open failed");
+
+        let heads = heads.lock().unwrap();
+        let head = heads
+            .iter()
+            .find(|h| h.starts_with("get /page "))
+            .expect("page request not received");
+        assert!(head.contains("\r\naccept: application/json\r\n"), "{head}");
+        assert!(head.contains("\r\naccept-encoding: identity\r\n"), "{head}");
+        assert!(
+            head.contains("\r\norigin: https://example.com\r\n"),
+            "{head}"
+        );
+        assert!(
+            !heads.iter().any(|h| h.starts_with("get /blocked")),
+            "blocked URL was fetched"
+        );
+    }
+
+    /// This thread's last error, as `scraper_last_error_json()` returns it.
+    fn last_error() -> serde_json::Value {
+        let mut ptr = std::ptr::null_mut();
+        let mut len = 0;
+        assert_eq!(
+            unsafe { scraper_last_error_json(&mut ptr, &mut len) },
+            PAGE_OK
+        );
+        let json = unsafe { std::ffi::CString::from_raw(ptr) };
+        serde_json::from_slice(json.as_bytes()).unwrap()
+    }
+
+    #[test]
+    fn last_error_json_carries_operation_fields() {
+        let e = PageError::LoadFailed("connection refused".into());
+        let code = error_code_with(&e, serde_json::json!({ "url": "https://a.test/" }));
+        assert_eq!(code, PAGE_ERR_LOAD);
+        assert_eq!(
+            last_error(),
+            serde_json::json!({
+                "code": PAGE_ERR_LOAD,
+                "kind": "load_failed",
+                "message": e.to_string(),
+                "detail": "connection refused",
+                "url": "https://a.test/",
+            })
+        );
+
+        error_code(&PageError::SelectorNotFound("#missing".into()));
+        let error = last_error();
+        assert_eq!(error["kind"], "selector_not_found");
+        assert_eq!(error["selector"], "#missing");
+        assert!(error.get("detail").is_none(), "{error}");
+
+        let exception = crate::types::JsErrorDetails {
+            kind: "EvaluationFailure".into(),
+            name: Some("TypeError".into()),
+            message: "boom".into(),
+            stack: None,
+        };
+        let e = PageError::JsError("boom".into());
+        error_code_with(&e, serde_json::json!({ "exception": exception }));
+        let error = last_error();
+        assert_eq!(error["code"], PAGE_ERR_JS);
+        assert_eq!(error["exception"]["name"], "TypeError");
+        assert_eq!(error["exception"]["message"], "boom");
+
+        // Unknown context is left out rather than recorded as null.
+        error_code_with(&PageError::Timeout, serde_json::json!({ "url": null }));
+        assert!(last_error().get("url").is_none());
+    }
+
+    #[test]
+    fn last_error_json_replaces_stale_errors() {
+        error_code_with(
+            &PageError::LoadFailed("earlier".into()),
+            serde_json::json!({ "url": "https://a.test/" }),
+        );
+        let code = unsafe { page_open(std::ptr::null_mut(), std::ptr::null()) };
+        assert_eq!(code, PAGE_ERR_NULL_PTR);
+        let error = last_error();
+        assert_eq!(error["code"], PAGE_ERR_NULL_PTR);
+        assert_eq!(error["kind"], "null_pointer");
+        assert!(error.get("url").is_none(), "{error}");
+
+        let invalid = b"\xff\0";
+        let code = unsafe { scraper_set_cache_dir(invalid.as_ptr().cast()) };
+        assert_eq!(code, PAGE_ERR_INVALID_ARG);
+        let error = last_error();
+        assert_eq!(error["kind"], "invalid_argument");
+        assert!(
+            error["message"].as_str().unwrap().contains("UTF-8"),
+            "{error}"
+        );
+    }
+}
@@ -38,6 +38,14 @@ mod ffi;
 mod page;
 mod types;
 
-pub use engine::PageEngine;
-pub use page::Page;
-pub use types::{ConsoleMessage, ElementRect, InputFile, NetworkRequest, PageError, PageOptions};
+pub use engine::{HtmlStreamCallback, PageEngine, ProgressCallback, RequestInterceptor};
+pub use page::{
+    Page, PageJob, SendHtmlStreamCallback, SendProgressCallback, SendRequestInterceptor,
+};
+pub use types::{
+    BlockingResource, ConnectionType, ConsoleMessage, CookiePolicy, Download, ElementRect,
+    ElementTarget, FeatureFlags, ImageLayer, ImageLoadCounts, InputFile, InterceptedRequest,
+    JsErrorDetails, JsWorld, Link, LoadProgress, NetworkRequest, PageError, PageOptions,
+    PageResource, PaintTiming, RawImage, RenderMode, RequestAction, ResourceType, SameSite,
+    ScrollMetrics, UsedFont, Validation, WindowInfo,
+};
@@ -14,12 +14,13 @@
 //! servo-scraper --wait-for "h1" --screenshot page.png https://example.com
 //! ```
 
+use std::path::PathBuf;
 use std::process;
 
 use bpaf::Bpaf;
 use image::ImageFormat;
 use log::error;
-use servo_scraper::{PageEngine, PageOptions};
+use servo_scraper::{PageEngine, PageError, PageOptions};
 use url::Url;
 
 // ---------------------------------------------------------------------------
@@ -73,6 +74,10 @@ struct CliConfig {
     #[bpaf(long("user-agent"), argument("STRING"))]
     user_agent: Option<String>,
 
+    /// Directory for the HTTP cache and other on-disk engine state
+    #[bpaf(long("cache-dir"), argument("PATH"))]
+    cache_dir: Option<PathBuf>,
+
     /// Wait for network idle (no new requests for N ms) before capturing
     #[bpaf(long("wait-for-network-idle"), argument("MS"))]
     wait_for_network_idle: Option<u64>,
@@ -81,6 +86,10 @@ struct CliConfig {
     #[bpaf(long("block-urls"), argument("PATTERNS"))]
     block_urls: Option<String>,
 
+    /// Allow loading file: URLs
+    #[bpaf(long("allow-file-access"))]
+    allow_file_access: bool,
+
     /// URL to load
     #[bpaf(positional::<String>("URL"), parse(parse_url))]
     url: Url,
@@ -115,6 +124,7 @@ fn main() {
         wait: config.wait,
         fullpage: config.fullpage,
         user_agent: config.user_agent.clone(),
+        cache_dir: config.cache_dir.clone(),
     };
 
     let mut engine = PageEngine::new(options).unwrap_or_else(|e| {
@@ -122,6 +132,8 @@ fn main() {
         process::exit(1);
     });
 
+    engine.set_allow_file_access(config.allow_file_access);
+
     // If block-urls requested, create the page explicitly so patterns are
     // in place *before* the first navigation.
     if let Some(ref patterns_str) = config.block_urls {
@@ -140,10 +152,16 @@ fn main() {
 
     eprintln!("Loading {}...", config.url);
 
-    engine.open(config.url.as_str()).unwrap_or_else(|e| {
-        eprintln!("Error: page load failed: {e}");
-        process::exit(1);
-    });
+    match engine.open(config.url.as_str()) {
+        Ok(()) => {}
+        Err(PageError::Timeout) => {
+            eprintln!("Warning: page load timed out, capturing partially loaded page.");
+        }
+        Err(e) => {
+            eprintln!("Error: page load failed: {e}");
+            process::exit(1);
+        }
+    }
 
     if config.wait > 0.0 {
         eprintln!("Page loaded after {:.1}s settle time.", config.wait);
@@ -5,39 +5,126 @@
 //! Layer 2: `Page` — thread-safe wrapper (`Send + Sync`).
 
 use std::sync::Mutex;
+use std::sync::atomic::{AtomicU64, Ordering};
 use std::sync::mpsc;
 use std::thread;
+use std::time::{Duration, Instant};
 
-use crate::engine::PageEngine;
+use crate::engine::{HtmlStreamCallback, PageEngine, ProgressCallback, RequestInterceptor};
 use crate::types::{
-    ConsoleMessage, ElementRect, InputFile, NetworkRequest, PageError, PageOptions,
+    BlockingResource, ConnectionType, ConsoleMessage, CookiePolicy, Download, ElementRect,
+    ElementTarget, FeatureFlags, ImageLayer, ImageLoadCounts, InputFile, InterceptedRequest,
+    JsErrorDetails, JsWorld, Link, LoadProgress, NetworkRequest, PageError, PageOptions,
+    PageResource, PaintTiming, RawImage, RenderMode, RequestAction, ResourceType, SameSite,
+    ScrollMetrics, UsedFont, Validation, WindowInfo,
 };
 
+/// A [`RequestInterceptor`] that can be handed to the background thread.
+pub type SendRequestInterceptor = Box<dyn Fn(&InterceptedRequest) -> RequestAction + Send>;
+
+/// A [`ProgressCallback`] that can be handed to the background thread.
+pub type SendProgressCallback = Box<dyn Fn(&LoadProgress) + Send>;
+
+/// An [`HtmlStreamCallback`] that can be handed to the background thread.
+pub type SendHtmlStreamCallback = Box<dyn Fn(&str) -> bool + Send>;
+
 /// Commands sent from the `Page` handle to the background thread.
 enum Command {
     Open {
         url: String,
         response: mpsc::Sender<Result<(), PageError>>,
     },
+    LoadHtml {
+        html: String,
+        base_url: Option<String>,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
+    SetBaseUrl {
+        url: String,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
     Evaluate {
         script: String,
+        world: JsWorld,
         response: mpsc::Sender<Result<String, PageError>>,
     },
+    LastJsError {
+        response: mpsc::Sender<Option<JsErrorDetails>>,
+    },
+    ScreenshotScales {
+        factors: Vec<f32>,
+        response: mpsc::Sender<Result<Vec<Vec<u8>>, PageError>>,
+    },
+    SetZoom {
+        factor: f32,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
+    Zoom {
+        response: mpsc::Sender<Result<f32, PageError>>,
+    },
+    ScreenshotFilmstrip {
+        step_px: u32,
+        response: mpsc::Sender<Result<Vec<Vec<u8>>, PageError>>,
+    },
+    ExportLayers {
+        response: mpsc::Sender<Result<Vec<ImageLayer>, PageError>>,
+    },
     Screenshot {
         response: mpsc::Sender<Result<Vec<u8>, PageError>>,
     },
+    ScreenshotBetween {
+        start_selector: String,
+        end_selector: String,
+        response: mpsc::Sender<Result<Vec<u8>, PageError>>,
+    },
+    ScreenshotPhash {
+        response: mpsc::Sender<Result<u64, PageError>>,
+    },
+    ScreenshotRaw {
+        response: mpsc::Sender<Result<RawImage, PageError>>,
+    },
+    ScreenshotViewport {
+        response: mpsc::Sender<Result<Vec<u8>, PageError>>,
+    },
     ScreenshotFullpage {
         response: mpsc::Sender<Result<Vec<u8>, PageError>>,
     },
     Html {
         response: mpsc::Sender<Result<String, PageError>>,
     },
+    DomSnapshot {
+        response: mpsc::Sender<Result<String, PageError>>,
+    },
+    SingleFile {
+        max_asset_bytes: u64,
+        response: mpsc::Sender<Result<String, PageError>>,
+    },
     Url {
         response: mpsc::Sender<Option<String>>,
     },
     Title {
         response: mpsc::Sender<Option<String>>,
     },
+    Charset {
+        response: mpsc::Sender<Option<String>>,
+    },
+    PaintTiming {
+        response: mpsc::Sender<Result<PaintTiming, PageError>>,
+    },
+    SetRenderModeTracking {
+        enabled: bool,
+        response: mpsc::Sender<()>,
+    },
+    RenderMode {
+        response: mpsc::Sender<Result<RenderMode, PageError>>,
+    },
+    SetServiceWorkerTracking {
+        enabled: bool,
+        response: mpsc::Sender<()>,
+    },
+    HasServiceWorker {
+        response: mpsc::Sender<Result<bool, PageError>>,
+    },
     ConsoleMessages {
         response: mpsc::Sender<Vec<ConsoleMessage>>,
     },
@@ -61,6 +148,24 @@ enum Command {
         timeout: u64,
         response: mpsc::Sender<Result<(), PageError>>,
     },
+    WaitForText {
+        text: String,
+        case_sensitive: bool,
+        timeout_ms: u64,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
+    SetDownloadCapture {
+        enabled: bool,
+        response: mpsc::Sender<()>,
+    },
+    WaitForDownload {
+        timeout_ms: u64,
+        response: mpsc::Sender<Result<Download, PageError>>,
+    },
+    WaitForImages {
+        timeout_ms: u64,
+        response: mpsc::Sender<Result<ImageLoadCounts, PageError>>,
+    },
     Wait {
         seconds: f64,
         response: mpsc::Sender<()>,
@@ -97,6 +202,15 @@ enum Command {
         y: f32,
         response: mpsc::Sender<Result<(), PageError>>,
     },
+    ElementAt {
+        x: f32,
+        y: f32,
+        response: mpsc::Sender<Result<Option<ElementTarget>, PageError>>,
+    },
+    SelectorTarget {
+        selector: String,
+        response: mpsc::Sender<Result<Option<ElementTarget>, PageError>>,
+    },
     // Scroll
     Scroll {
         delta_x: f64,
@@ -107,6 +221,9 @@ enum Command {
         selector: String,
         response: mpsc::Sender<Result<(), PageError>>,
     },
+    ScrollMetrics {
+        response: mpsc::Sender<Result<ScrollMetrics, PageError>>,
+    },
     // Select
     SelectOption {
         selector: String,
@@ -127,9 +244,18 @@ enum Command {
         cookie: String,
         response: mpsc::Sender<Result<(), PageError>>,
     },
+    SetCookieSameSite {
+        cookie: String,
+        same_site: SameSite,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
     ClearCookies {
         response: mpsc::Sender<Result<(), PageError>>,
     },
+    SetCookiePolicy {
+        policy: CookiePolicy,
+        response: mpsc::Sender<()>,
+    },
     // Request interception
     BlockUrls {
         patterns: Vec<String>,
@@ -138,6 +264,62 @@ enum Command {
     ClearBlockedUrls {
         response: mpsc::Sender<()>,
     },
+    SetRequestInterceptor {
+        interceptor: Option<SendRequestInterceptor>,
+        response: mpsc::Sender<()>,
+    },
+    SetProgressCallback {
+        callback: Option<SendProgressCallback>,
+        response: mpsc::Sender<()>,
+    },
+    SetHtmlStreamCallback {
+        callback: Option<SendHtmlStreamCallback>,
+        response: mpsc::Sender<()>,
+    },
+    SetAccept {
+        value: Option<String>,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
+    SetAcceptEncoding {
+        value: Option<String>,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
+    SetCsp {
+        policy: Option<String>,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
+    SetFetchMetadata {
+        site: Option<String>,
+        mode: Option<String>,
+        dest: Option<String>,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
+    SetOrigin {
+        origin: Option<String>,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
+    AddHeaderRule {
+        url_prefix: String,
+        name: String,
+        value: Option<String>,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
+    ClearHeaderRules {
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
+    // Network emulation
+    SetConnectionType {
+        connection_type: ConnectionType,
+        response: mpsc::Sender<()>,
+    },
+    SetFeatureFlags {
+        flags: FeatureFlags,
+        response: mpsc::Sender<()>,
+    },
+    SetRandomSeed {
+        seed: u64,
+        response: mpsc::Sender<()>,
+    },
     // Navigation
     Reload {
         response: mpsc::Sender<Result<(), PageError>>,
@@ -153,6 +335,39 @@ enum Command {
         selector: String,
         response: mpsc::Sender<Result<ElementRect, PageError>>,
     },
+    ElementRects {
+        selector: String,
+        response: mpsc::Sender<Result<Vec<ElementRect>, PageError>>,
+    },
+    ValidateSelector {
+        selector: String,
+        response: mpsc::Sender<Result<Validation, PageError>>,
+    },
+    ValidateScript {
+        script: String,
+        response: mpsc::Sender<Result<Validation, PageError>>,
+    },
+    LinksDetailed {
+        response: mpsc::Sender<Result<Vec<Link>, PageError>>,
+    },
+    QueryXpath {
+        xpath: String,
+        response: mpsc::Sender<Result<Vec<String>, PageError>>,
+    },
+    Resources {
+        types: Vec<ResourceType>,
+        response: mpsc::Sender<Result<Vec<PageResource>, PageError>>,
+    },
+    UsedFonts {
+        response: mpsc::Sender<Result<Vec<UsedFont>, PageError>>,
+    },
+    RenderBlocking {
+        response: mpsc::Sender<Result<Vec<BlockingResource>, PageError>>,
+    },
+    IsClickable {
+        selector: String,
+        response: mpsc::Sender<Result<bool, PageError>>,
+    },
     ElementText {
         selector: String,
         response: mpsc::Sender<Result<String, PageError>>,
@@ -196,9 +411,28 @@ enum Command {
         enabled: bool,
         response: mpsc::Sender<()>,
     },
+    SetAllowFileAccess {
+        enabled: bool,
+        response: mpsc::Sender<()>,
+    },
+    SetMaxImagePixels {
+        pixels: u64,
+        response: mpsc::Sender<()>,
+    },
+    SetMaxConnectionsPerHost {
+        n: usize,
+        response: mpsc::Sender<()>,
+    },
     PopupPages {
         response: mpsc::Sender<Vec<u32>>,
     },
+    Windows {
+        response: mpsc::Sender<Vec<WindowInfo>>,
+    },
+    SwitchWindow {
+        index: usize,
+        response: mpsc::Sender<Result<(), PageError>>,
+    },
     PageUrl {
         page_id: u32,
         response: mpsc::Sender<Option<String>>,
@@ -207,9 +441,56 @@ enum Command {
         page_id: u32,
         response: mpsc::Sender<Option<String>>,
     },
+    ReclaimMemory {
+        response: mpsc::Sender<()>,
+    },
     Shutdown,
 }
 
+/// A live `Page`'s command channel, for process-wide operations.
+struct LivePage {
+    id: u64,
+    sender: mpsc::Sender<Command>,
+    engine_thread: thread::ThreadId,
+}
+
+static LIVE_PAGES: Mutex<Vec<LivePage>> = Mutex::new(Vec::new());
+
+/// How long [`Page::reclaim_memory`] waits for pages, in total, before
+/// trimming the heap without the busy ones.
+const RECLAIM_WAIT: Duration = Duration::from_millis(500);
+static NEXT_HANDLE_ID: AtomicU64 = AtomicU64::new(0);
+
+/// An operation started by one of `Page`'s `*_async` methods.
+///
+/// The operation is queued on the engine thread like a blocking call (so
+/// operations on one `Page` still run in submission order); the job only
+/// carries its result back. The result is handed out once — later calls
+/// return `ChannelClosed`, as they do if the `Page` is dropped first.
+pub struct PageJob<T> {
+    response: mpsc::Receiver<Result<T, PageError>>,
+}
+
+impl<T> PageJob<T> {
+    /// The result if the operation has finished, without blocking.
+    pub fn try_result(&self) -> Option<Result<T, PageError>> {
+        match self.response.try_recv() {
+            Ok(result) => Some(result),
+            Err(mpsc::TryRecvError::Empty) => None,
+            Err(mpsc::TryRecvError::Disconnected) => Some(Err(PageError::ChannelClosed)),
+        }
+    }
+
+    /// Wait up to `timeout` for the result. `None` if it is still running.
+    pub fn wait_timeout(&self, timeout: Duration) -> Option<Result<T, PageError>> {
+        match self.response.recv_timeout(timeout) {
+            Ok(result) => Some(result),
+            Err(mpsc::RecvTimeoutError::Timeout) => None,
+            Err(mpsc::RecvTimeoutError::Disconnected) => Some(Err(PageError::ChannelClosed)),
+        }
+    }
+}
+
 /// Thread-safe page handle. `Send + Sync` — safe for FFI.
 ///
 /// Spawns a dedicated background thread running a [`PageEngine`].
@@ -217,6 +498,8 @@ enum Command {
 pub struct Page {
     sender: Mutex<mpsc::Sender<Command>>,
     thread: Mutex<Option<thread::JoinHandle<()>>>,
+    engine_thread: thread::ThreadId,
+    handle_id: u64,
 }
 
 unsafe impl Send for Page {}
@@ -245,24 +528,102 @@ impl Page {
                     Command::Open { url, response } => {
                         let _ = response.send(engine.open(&url));
                     }
-                    Command::Evaluate { script, response } => {
-                        let _ = response.send(engine.evaluate(&script));
+                    Command::LoadHtml {
+                        html,
+                        base_url,
+                        response,
+                    } => {
+                        let _ = response.send(engine.load_html(&html, base_url.as_deref()));
+                    }
+                    Command::SetBaseUrl { url, response } => {
+                        let _ = response.send(engine.set_base_url(&url));
+                    }
+                    Command::Evaluate {
+                        script,
+                        world,
+                        response,
+                    } => {
+                        let _ = response.send(engine.evaluate_in_world(&script, world));
+                    }
+                    Command::LastJsError { response } => {
+                        let _ = response.send(engine.last_js_error());
+                    }
+                    Command::ScreenshotScales { factors, response } => {
+                        let _ = response.send(engine.screenshot_scales(&factors));
+                    }
+                    Command::SetZoom { factor, response } => {
+                        let _ = response.send(engine.set_zoom(factor));
+                    }
+                    Command::Zoom { response } => {
+                        let _ = response.send(engine.zoom());
+                    }
+                    Command::ScreenshotFilmstrip { step_px, response } => {
+                        let _ = response.send(engine.screenshot_filmstrip(step_px));
+                    }
+                    Command::ExportLayers { response } => {
+                        let _ = response.send(engine.export_layers());
                     }
                     Command::Screenshot { response } => {
                         let _ = response.send(engine.screenshot());
                     }
+                    Command::ScreenshotBetween {
+                        start_selector,
+                        end_selector,
+                        response,
+                    } => {
+                        let _ = response
+                            .send(engine.screenshot_between(&start_selector, &end_selector));
+                    }
+                    Command::ScreenshotPhash { response } => {
+                        let _ = response.send(engine.screenshot_phash());
+                    }
+                    Command::ScreenshotRaw { response } => {
+                        let _ = response.send(engine.screenshot_raw());
+                    }
+                    Command::ScreenshotViewport { response } => {
+                        let _ = response.send(engine.screenshot_viewport());
+                    }
                     Command::ScreenshotFullpage { response } => {
                         let _ = response.send(engine.screenshot_fullpage());
                     }
                     Command::Html { response } => {
                         let _ = response.send(engine.html());
                     }
+                    Command::DomSnapshot { response } => {
+                        let _ = response.send(engine.dom_snapshot());
+                    }
+                    Command::SingleFile {
+                        max_asset_bytes,
+                        response,
+                    } => {
+                        let _ = response.send(engine.single_file(max_asset_bytes));
+                    }
                     Command::Url { response } => {
                         let _ = response.send(engine.url());
                     }
                     Command::Title { response } => {
                         let _ = response.send(engine.title());
                     }
+                    Command::Charset { response } => {
+                        let _ = response.send(engine.charset());
+                    }
+                    Command::PaintTiming { response } => {
+                        let _ = response.send(engine.paint_timing());
+                    }
+                    Command::SetRenderModeTracking { enabled, response } => {
+                        engine.set_render_mode_tracking(enabled);
+                        let _ = response.send(());
+                    }
+                    Command::RenderMode { response } => {
+                        let _ = response.send(engine.render_mode());
+                    }
+                    Command::SetServiceWorkerTracking { enabled, response } => {
+                        engine.set_service_worker_tracking(enabled);
+                        let _ = response.send(());
+                    }
+                    Command::HasServiceWorker { response } => {
+                        let _ = response.send(engine.has_service_worker());
+                    }
                     Command::ConsoleMessages { response } => {
                         let _ = response.send(engine.console_messages());
                     }
@@ -291,6 +652,31 @@ impl Page {
                     } => {
                         let _ = response.send(engine.wait_for_condition(&js_expr, timeout));
                     }
+                    Command::WaitForText {
+                        text,
+                        case_sensitive,
+                        timeout_ms,
+                        response,
+                    } => {
+                        let _ =
+                            response.send(engine.wait_for_text(&text, case_sensitive, timeout_ms));
+                    }
+                    Command::SetDownloadCapture { enabled, response } => {
+                        engine.set_download_capture(enabled);
+                        let _ = response.send(());
+                    }
+                    Command::WaitForDownload {
+                        timeout_ms,
+                        response,
+                    } => {
+                        let _ = response.send(engine.wait_for_download(timeout_ms));
+                    }
+                    Command::WaitForImages {
+                        timeout_ms,
+                        response,
+                    } => {
+                        let _ = response.send(engine.wait_for_images(timeout_ms));
+                    }
                     Command::Wait { seconds, response } => {
                         engine.wait(seconds);
                         let _ = response.send(());
@@ -320,6 +706,12 @@ impl Page {
                     Command::MouseMove { x, y, response } => {
                         let _ = response.send(engine.mouse_move(x, y));
                     }
+                    Command::ElementAt { x, y, response } => {
+                        let _ = response.send(engine.element_at(x, y));
+                    }
+                    Command::SelectorTarget { selector, response } => {
+                        let _ = response.send(engine.selector_target(&selector));
+                    }
                     Command::Scroll {
                         delta_x,
                         delta_y,
@@ -330,6 +722,9 @@ impl Page {
                     Command::ScrollToSelector { selector, response } => {
                         let _ = response.send(engine.scroll_to_selector(&selector));
                     }
+                    Command::ScrollMetrics { response } => {
+                        let _ = response.send(engine.scroll_metrics());
+                    }
                     Command::SelectOption {
                         selector,
                         value,
@@ -350,9 +745,20 @@ impl Page {
                     Command::SetCookie { cookie, response } => {
                         let _ = response.send(engine.set_cookie(&cookie));
                     }
+                    Command::SetCookieSameSite {
+                        cookie,
+                        same_site,
+                        response,
+                    } => {
+                        let _ = response.send(engine.set_cookie_same_site(&cookie, same_site));
+                    }
                     Command::ClearCookies { response } => {
                         let _ = response.send(engine.clear_cookies());
                     }
+                    Command::SetCookiePolicy { policy, response } => {
+                        engine.set_cookie_policy(policy);
+                        let _ = response.send(());
+                    }
                     Command::BlockUrls { patterns, response } => {
                         engine.block_urls(patterns);
                         let _ = response.send(());
@@ -361,6 +767,76 @@ impl Page {
                         engine.clear_blocked_urls();
                         let _ = response.send(());
                     }
+                    Command::SetRequestInterceptor {
+                        interceptor,
+                        response,
+                    } => {
+                        engine
+                            .set_request_interceptor(interceptor.map(|f| f as RequestInterceptor));
+                        let _ = response.send(());
+                    }
+                    Command::SetProgressCallback { callback, response } => {
+                        engine.set_progress_callback(callback.map(|f| f as ProgressCallback));
+                        let _ = response.send(());
+                    }
+                    Command::SetHtmlStreamCallback { callback, response } => {
+                        engine.set_html_stream_callback(callback.map(|f| f as HtmlStreamCallback));
+                        let _ = response.send(());
+                    }
+                    Command::SetAccept { value, response } => {
+                        let _ = response.send(engine.set_accept(value.as_deref()));
+                    }
+                    Command::SetAcceptEncoding { value, response } => {
+                        let _ = response.send(engine.set_accept_encoding(value.as_deref()));
+                    }
+                    Command::SetCsp { policy, response } => {
+                        let _ = response.send(engine.set_csp(policy.as_deref()));
+                    }
+                    Command::SetFetchMetadata {
+                        site,
+                        mode,
+                        dest,
+                        response,
+                    } => {
+                        let _ = response.send(engine.set_fetch_metadata(
+                            site.as_deref(),
+                            mode.as_deref(),
+                            dest.as_deref(),
+                        ));
+                    }
+                    Command::SetOrigin { origin, response } => {
+                        let _ = response.send(engine.set_origin(origin.as_deref()));
+                    }
+                    Command::AddHeaderRule {
+                        url_prefix,
+                        name,
+                        value,
+                        response,
+                    } => {
+                        let _ = response.send(engine.add_header_rule(
+                            &url_prefix,
+                            &name,
+                            value.as_deref(),
+                        ));
+                    }
+                    Command::ClearHeaderRules { response } => {
+                        let _ = response.send(engine.clear_header_rules());
+                    }
+                    Command::SetConnectionType {
+                        connection_type,
+                        response,
+                    } => {
+                        engine.set_connection_type(connection_type);
+                        let _ = response.send(());
+                    }
+                    Command::SetFeatureFlags { flags, response } => {
+                        engine.set_feature_flags(flags);
+                        let _ = response.send(());
+                    }
+                    Command::SetRandomSeed { seed, response } => {
+                        engine.set_random_seed(seed);
+                        let _ = response.send(());
+                    }
                     Command::Reload { response } => {
                         let _ = response.send(engine.reload());
                     }
@@ -373,6 +849,33 @@ impl Page {
                     Command::ElementRect { selector, response } => {
                         let _ = response.send(engine.element_rect(&selector));
                     }
+                    Command::ElementRects { selector, response } => {
+                        let _ = response.send(engine.element_rects(&selector));
+                    }
+                    Command::ValidateSelector { selector, response } => {
+                        let _ = response.send(engine.validate_selector(&selector));
+                    }
+                    Command::ValidateScript { script, response } => {
+                        let _ = response.send(engine.validate_script(&script));
+                    }
+                    Command::LinksDetailed { response } => {
+                        let _ = response.send(engine.links_detailed());
+                    }
+                    Command::QueryXpath { xpath, response } => {
+                        let _ = response.send(engine.query_xpath(&xpath));
+                    }
+                    Command::Resources { types, response } => {
+                        let _ = response.send(engine.resources(&types));
+                    }
+                    Command::UsedFonts { response } => {
+                        let _ = response.send(engine.used_fonts());
+                    }
+                    Command::RenderBlocking { response } => {
+                        let _ = response.send(engine.render_blocking());
+                    }
+                    Command::IsClickable { selector, response } => {
+                        let _ = response.send(engine.is_clickable(&selector));
+                    }
                     Command::ElementText { selector, response } => {
                         let _ = response.send(engine.element_text(&selector));
                     }
@@ -416,15 +919,37 @@ impl Page {
                         engine.set_popup_handling(enabled);
                         let _ = response.send(());
                     }
+                    Command::SetAllowFileAccess { enabled, response } => {
+                        engine.set_allow_file_access(enabled);
+                        let _ = response.send(());
+                    }
+                    Command::SetMaxImagePixels { pixels, response } => {
+                        engine.set_max_image_pixels(pixels);
+                        let _ = response.send(());
+                    }
+                    Command::SetMaxConnectionsPerHost { n, response } => {
+                        engine.set_max_connections_per_host(n);
+                        let _ = response.send(());
+                    }
                     Command::PopupPages { response } => {
                         let _ = response.send(engine.popup_pages());
                     }
+                    Command::Windows { response } => {
+                        let _ = response.send(engine.windows());
+                    }
+                    Command::SwitchWindow { index, response } => {
+                        let _ = response.send(engine.switch_window(index));
+                    }
                     Command::PageUrl { page_id, response } => {
                         let _ = response.send(engine.page_url(page_id));
                     }
                     Command::PageTitle { page_id, response } => {
                         let _ = response.send(engine.page_title(page_id));
                     }
+                    Command::ReclaimMemory { response } => {
+                        engine.reclaim_memory();
+                        let _ = response.send(());
+                    }
                     Command::Shutdown => break,
                 }
             }
@@ -434,23 +959,99 @@ impl Page {
             .recv()
             .map_err(|_| PageError::InitFailed("background thread panicked".into()))??;
 
+        let handle_id = NEXT_HANDLE_ID.fetch_add(1, Ordering::Relaxed);
+        let engine_thread = thread.thread().id();
+        LIVE_PAGES
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .push(LivePage {
+                id: handle_id,
+                sender: cmd_tx.clone(),
+                engine_thread,
+            });
+
         Ok(Self {
             sender: Mutex::new(cmd_tx),
+            engine_thread,
             thread: Mutex::new(Some(thread)),
+            handle_id,
         })
     }
 
+    /// Number of `Page` handles created and not yet dropped, across the process.
+    ///
+    /// Unlike [`page_count()`](Self::page_count), which counts the pages open
+    /// inside one handle, this counts the handles themselves — useful to detect
+    /// leaked handles.
+    pub fn live_handles() -> usize {
+        LIVE_PAGES.lock().unwrap_or_else(|e| e.into_inner()).len()
+    }
+
+    /// Ask every live page to release the memory it no longer needs, then
+    /// return freed heap memory to the OS. This is buffer shrinking and
+    /// allocator trimming only; Servo offers embedders no way to force a JS
+    /// garbage collection or flush its caches.
+    ///
+    /// Safe while pages are open: only unused memory is reclaimed — documents,
+    /// cookies and buffered messages are kept. Each page's thread is busy for a
+    /// few tens of milliseconds. Pages whose engine thread is the caller (e.g.
+    /// from the request interceptor) are skipped.
+    ///
+    /// Returns within about half a second even if a page is busy, e.g. in a
+    /// long `open()`: such a page still shrinks its buffers once it gets to
+    /// the request, but after the heap has been trimmed.
+    pub fn reclaim_memory() {
+        let targets: Vec<(mpsc::Sender<Command>, thread::ThreadId)> = LIVE_PAGES
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .iter()
+            .map(|p| (p.sender.clone(), p.engine_thread))
+            .collect();
+        let current = thread::current().id();
+        // Queue on every page first so they all work in parallel.
+        let pending: Vec<mpsc::Receiver<()>> = targets
+            .into_iter()
+            .filter(|(_, engine_thread)| *engine_thread != current)
+            .filter_map(|(sender, _)| {
+                let (resp_tx, resp_rx) = mpsc::channel();
+                sender
+                    .send(Command::ReclaimMemory { response: resp_tx })
+                    .ok()
+                    .map(|()| resp_rx)
+            })
+            .collect();
+        let deadline = Instant::now() + RECLAIM_WAIT;
+        for resp_rx in pending {
+            let _ = resp_rx.recv_timeout(deadline.saturating_duration_since(Instant::now()));
+        }
+        crate::engine::trim_process_heap();
+    }
+
     fn send_cmd<T>(
         &self,
         make_cmd: impl FnOnce(mpsc::Sender<T>) -> Command,
     ) -> Result<T, PageError> {
+        // A callback running on the engine thread (e.g. the request
+        // interceptor) would wait on itself forever.
+        if thread::current().id() == self.engine_thread {
+            return Err(PageError::ChannelClosed);
+        }
+        self.queue_cmd(make_cmd)?
+            .recv()
+            .map_err(|_| PageError::ChannelClosed)
+    }
+
+    /// Send a command without waiting for its response.
+    fn queue_cmd<T>(
+        &self,
+        make_cmd: impl FnOnce(mpsc::Sender<T>) -> Command,
+    ) -> Result<mpsc::Receiver<T>, PageError> {
         let (resp_tx, resp_rx) = mpsc::channel();
         let sender = self.sender.lock().map_err(|_| PageError::ChannelClosed)?;
         sender
             .send(make_cmd(resp_tx))
             .map_err(|_| PageError::ChannelClosed)?;
-        drop(sender);
-        resp_rx.recv().map_err(|_| PageError::ChannelClosed)
+        Ok(resp_rx)
     }
 
     pub fn open(&self, url: &str) -> Result<(), PageError> {
@@ -460,25 +1061,162 @@ impl Page {
         })?
     }
 
+    pub fn load_html(&self, html: &str, base_url: Option<&str>) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::LoadHtml {
+            html: html.to_string(),
+            base_url: base_url.map(str::to_string),
+            response,
+        })?
+    }
+
+    pub fn set_base_url(&self, url: &str) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::SetBaseUrl {
+            url: url.to_string(),
+            response,
+        })?
+    }
+
+    /// Start [`open()`](Self::open) and return without waiting for the load.
+    pub fn open_async(&self, url: &str) -> Result<PageJob<()>, PageError> {
+        let response = self.queue_cmd(|response| Command::Open {
+            url: url.to_string(),
+            response,
+        })?;
+        Ok(PageJob { response })
+    }
+
+    /// Start [`evaluate()`](Self::evaluate) and return without waiting for the result.
+    pub fn evaluate_async(&self, script: &str) -> Result<PageJob<String>, PageError> {
+        let response = self.queue_cmd(|response| Command::Evaluate {
+            script: script.to_string(),
+            world: JsWorld::Main,
+            response,
+        })?;
+        Ok(PageJob { response })
+    }
+
     pub fn evaluate(&self, script: &str) -> Result<String, PageError> {
+        self.evaluate_in_world(script, JsWorld::Main)
+    }
+
+    pub fn evaluate_in_world(&self, script: &str, world: JsWorld) -> Result<String, PageError> {
         self.send_cmd(|response| Command::Evaluate {
             script: script.to_string(),
+            world,
             response,
         })?
     }
 
+    /// Details of the exception that made the last `evaluate()` fail.
+    pub fn last_js_error(&self) -> Option<JsErrorDetails> {
+        self.send_cmd(|response| Command::LastJsError { response })
+            .ok()
+            .flatten()
+    }
+
     pub fn screenshot(&self) -> Result<Vec<u8>, PageError> {
         self.send_cmd(|response| Command::Screenshot { response })?
     }
 
+    pub fn screenshot_between(
+        &self,
+        start_selector: &str,
+        end_selector: &str,
+    ) -> Result<Vec<u8>, PageError> {
+        self.send_cmd(|response| Command::ScreenshotBetween {
+            start_selector: start_selector.to_string(),
+            end_selector: end_selector.to_string(),
+            response,
+        })?
+    }
+
+    pub fn screenshot_phash(&self) -> Result<u64, PageError> {
+        self.send_cmd(|response| Command::ScreenshotPhash { response })?
+    }
+
+    pub fn screenshot_raw(&self) -> Result<RawImage, PageError> {
+        self.send_cmd(|response| Command::ScreenshotRaw { response })?
+    }
+
+    pub fn screenshot_viewport(&self) -> Result<Vec<u8>, PageError> {
+        self.send_cmd(|response| Command::ScreenshotViewport { response })?
+    }
+
     pub fn screenshot_fullpage(&self) -> Result<Vec<u8>, PageError> {
         self.send_cmd(|response| Command::ScreenshotFullpage { response })?
     }
 
+    pub fn screenshot_scales(&self, factors: &[f32]) -> Result<Vec<Vec<u8>>, PageError> {
+        self.send_cmd(|response| Command::ScreenshotScales {
+            factors: factors.to_vec(),
+            response,
+        })?
+    }
+
+    pub fn set_zoom(&self, factor: f32) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::SetZoom { factor, response })?
+    }
+
+    pub fn zoom(&self) -> Result<f32, PageError> {
+        self.send_cmd(|response| Command::Zoom { response })?
+    }
+
+    pub fn screenshot_filmstrip(&self, step_px: u32) -> Result<Vec<Vec<u8>>, PageError> {
+        self.send_cmd(|response| Command::ScreenshotFilmstrip { step_px, response })?
+    }
+
+    pub fn export_layers(&self) -> Result<Vec<ImageLayer>, PageError> {
+        self.send_cmd(|response| Command::ExportLayers { response })?
+    }
+
     pub fn html(&self) -> Result<String, PageError> {
         self.send_cmd(|response| Command::Html { response })?
     }
 
+    pub fn dom_snapshot(&self) -> Result<String, PageError> {
+        self.send_cmd(|response| Command::DomSnapshot { response })?
+    }
+
+    /// Compare two [`dom_snapshot`](Self::dom_snapshot) outputs; see
+    /// [`PageEngine::diff_dom`]. Needs no page and runs on the calling thread.
+    pub fn diff_dom(a: &str, b: &str, ignored_attributes: &[&str]) -> Result<String, PageError> {
+        PageEngine::diff_dom(a, b, ignored_attributes)
+    }
+
+    /// Log every request of every page to `path`; see
+    /// [`PageEngine::set_access_log`]. Process-wide and needs no page.
+    pub fn set_access_log(path: Option<&std::path::Path>) -> Result<(), PageError> {
+        PageEngine::set_access_log(path)
+    }
+
+    /// Export the document as a self-contained HTML file; see
+    /// [`PageEngine::single_file`]. `max_asset_bytes` of 0 means no limit.
+    pub fn single_file(&self, max_asset_bytes: u64) -> Result<String, PageError> {
+        self.send_cmd(|response| Command::SingleFile {
+            max_asset_bytes,
+            response,
+        })?
+    }
+
+    /// Capture the page HTML gzip-compressed at `level` (0 = store only,
+    /// 9 = smallest). Compression runs on the calling thread, not the engine
+    /// thread.
+    pub fn html_gzip(&self, level: u32) -> Result<Vec<u8>, PageError> {
+        if level > 9 {
+            return Err(PageError::InvalidArgument(format!(
+                "gzip level must be 0-9, got {level}"
+            )));
+        }
+        let html = self.html()?;
+        let mut encoder = flate2::write::GzEncoder::new(
+            Vec::with_capacity(html.len() / 4),
+            flate2::Compression::new(level),
+        );
+        std::io::Write::write_all(&mut encoder, html.as_bytes())
+            .and_then(|()| encoder.finish())
+            .map_err(|e| PageError::JsError(format!("gzip compression failed: {e}")))
+    }
+
     pub fn url(&self) -> Option<String> {
         self.send_cmd(|response| Command::Url { response })
             .ok()
@@ -491,6 +1229,36 @@ impl Page {
             .flatten()
     }
 
+    pub fn charset(&self) -> Option<String> {
+        self.send_cmd(|response| Command::Charset { response })
+            .ok()
+            .flatten()
+    }
+
+    pub fn paint_timing(&self) -> Result<PaintTiming, PageError> {
+        self.send_cmd(|response| Command::PaintTiming { response })?
+    }
+
+    /// Measure documents at `DOMContentLoaded` for `render_mode()` (off by
+    /// default).
+    pub fn set_render_mode_tracking(&self, enabled: bool) {
+        let _ = self.send_cmd(|response| Command::SetRenderModeTracking { enabled, response });
+    }
+
+    pub fn render_mode(&self) -> Result<RenderMode, PageError> {
+        self.send_cmd(|response| Command::RenderMode { response })?
+    }
+
+    /// Note service worker registrations for `has_service_worker()` (off by
+    /// default).
+    pub fn set_service_worker_tracking(&self, enabled: bool) {
+        let _ = self.send_cmd(|response| Command::SetServiceWorkerTracking { enabled, response });
+    }
+
+    pub fn has_service_worker(&self) -> Result<bool, PageError> {
+        self.send_cmd(|response| Command::HasServiceWorker { response })?
+    }
+
     pub fn console_messages(&self) -> Vec<ConsoleMessage> {
         self.send_cmd(|response| Command::ConsoleMessages { response })
             .unwrap_or_default()
@@ -525,6 +1293,40 @@ impl Page {
         })?
     }
 
+    pub fn wait_for_text(
+        &self,
+        text: &str,
+        case_sensitive: bool,
+        timeout_ms: u64,
+    ) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::WaitForText {
+            text: text.to_string(),
+            case_sensitive,
+            timeout_ms,
+            response,
+        })?
+    }
+
+    /// Capture `<a download>` clicks and attachment navigations for
+    /// `wait_for_download()` (off by default).
+    pub fn set_download_capture(&self, enabled: bool) {
+        let _ = self.send_cmd(|response| Command::SetDownloadCapture { enabled, response });
+    }
+
+    pub fn wait_for_download(&self, timeout_ms: u64) -> Result<Download, PageError> {
+        self.send_cmd(|response| Command::WaitForDownload {
+            timeout_ms,
+            response,
+        })?
+    }
+
+    pub fn wait_for_images(&self, timeout_ms: u64) -> Result<ImageLoadCounts, PageError> {
+        self.send_cmd(|response| Command::WaitForImages {
+            timeout_ms,
+            response,
+        })?
+    }
+
     pub fn wait(&self, seconds: f64) {
         let _ = self.send_cmd(|response| Command::Wait { seconds, response });
     }
@@ -570,6 +1372,17 @@ impl Page {
         self.send_cmd(|response| Command::MouseMove { x, y, response })?
     }
 
+    pub fn element_at(&self, x: f32, y: f32) -> Result<Option<ElementTarget>, PageError> {
+        self.send_cmd(|response| Command::ElementAt { x, y, response })?
+    }
+
+    pub fn selector_target(&self, selector: &str) -> Result<Option<ElementTarget>, PageError> {
+        self.send_cmd(|response| Command::SelectorTarget {
+            selector: selector.to_string(),
+            response,
+        })?
+    }
+
     pub fn scroll(&self, delta_x: f64, delta_y: f64) -> Result<(), PageError> {
         self.send_cmd(|response| Command::Scroll {
             delta_x,
@@ -585,6 +1398,10 @@ impl Page {
         })?
     }
 
+    pub fn scroll_metrics(&self) -> Result<ScrollMetrics, PageError> {
+        self.send_cmd(|response| Command::ScrollMetrics { response })?
+    }
+
     pub fn select_option(&self, selector: &str, value: &str) -> Result<(), PageError> {
         self.send_cmd(|response| Command::SelectOption {
             selector: selector.to_string(),
@@ -612,10 +1429,22 @@ impl Page {
         })?
     }
 
+    pub fn set_cookie_same_site(&self, cookie: &str, same_site: SameSite) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::SetCookieSameSite {
+            cookie: cookie.to_string(),
+            same_site,
+            response,
+        })?
+    }
+
     pub fn clear_cookies(&self) -> Result<(), PageError> {
         self.send_cmd(|response| Command::ClearCookies { response })?
     }
 
+    pub fn set_cookie_policy(&self, policy: CookiePolicy) {
+        let _ = self.send_cmd(|response| Command::SetCookiePolicy { policy, response });
+    }
+
     pub fn block_urls(&self, patterns: Vec<String>) {
         let _ = self.send_cmd(|response| Command::BlockUrls { patterns, response });
     }
@@ -624,6 +1453,102 @@ impl Page {
         let _ = self.send_cmd(|response| Command::ClearBlockedUrls { response });
     }
 
+    /// Install (or with `None`, remove) the request interceptor. The callback
+    /// runs on the background thread; calling back into this `Page` from it
+    /// returns `Err(ChannelClosed)` instead of deadlocking.
+    pub fn set_request_interceptor(&self, interceptor: Option<SendRequestInterceptor>) {
+        let _ = self.send_cmd(|response| Command::SetRequestInterceptor {
+            interceptor,
+            response,
+        });
+    }
+
+    /// Install (or with `None`, remove) the navigation progress callback. Like
+    /// the request interceptor, it runs on the background thread and must not
+    /// call back into this `Page`.
+    pub fn set_progress_callback(&self, callback: Option<SendProgressCallback>) {
+        let _ = self.send_cmd(|response| Command::SetProgressCallback { callback, response });
+    }
+
+    pub fn set_html_stream_callback(&self, callback: Option<SendHtmlStreamCallback>) {
+        let _ = self.send_cmd(|response| Command::SetHtmlStreamCallback { callback, response });
+    }
+
+    pub fn set_accept(&self, value: Option<&str>) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::SetAccept {
+            value: value.map(str::to_string),
+            response,
+        })?
+    }
+
+    pub fn set_accept_encoding(&self, value: Option<&str>) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::SetAcceptEncoding {
+            value: value.map(str::to_string),
+            response,
+        })?
+    }
+
+    pub fn set_csp(&self, policy: Option<&str>) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::SetCsp {
+            policy: policy.map(str::to_string),
+            response,
+        })?
+    }
+
+    pub fn set_fetch_metadata(
+        &self,
+        site: Option<&str>,
+        mode: Option<&str>,
+        dest: Option<&str>,
+    ) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::SetFetchMetadata {
+            site: site.map(str::to_string),
+            mode: mode.map(str::to_string),
+            dest: dest.map(str::to_string),
+            response,
+        })?
+    }
+
+    pub fn set_origin(&self, origin: Option<&str>) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::SetOrigin {
+            origin: origin.map(str::to_string),
+            response,
+        })?
+    }
+
+    pub fn add_header_rule(
+        &self,
+        url_prefix: &str,
+        name: &str,
+        value: Option<&str>,
+    ) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::AddHeaderRule {
+            url_prefix: url_prefix.to_string(),
+            name: name.to_string(),
+            value: value.map(str::to_string),
+            response,
+        })?
+    }
+
+    pub fn clear_header_rules(&self) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::ClearHeaderRules { response })?
+    }
+
+    pub fn set_connection_type(&self, connection_type: ConnectionType) {
+        let _ = self.send_cmd(|response| Command::SetConnectionType {
+            connection_type,
+            response,
+        });
+    }
+
+    pub fn set_feature_flags(&self, flags: FeatureFlags) {
+        let _ = self.send_cmd(|response| Command::SetFeatureFlags { flags, response });
+    }
+
+    pub fn set_random_seed(&self, seed: u64) {
+        let _ = self.send_cmd(|response| Command::SetRandomSeed { seed, response });
+    }
+
     pub fn reload(&self) -> Result<(), PageError> {
         self.send_cmd(|response| Command::Reload { response })?
     }
@@ -643,6 +1568,60 @@ impl Page {
         })?
     }
 
+    pub fn resources(&self, types: &[ResourceType]) -> Result<Vec<PageResource>, PageError> {
+        self.send_cmd(|response| Command::Resources {
+            types: types.to_vec(),
+            response,
+        })?
+    }
+
+    pub fn used_fonts(&self) -> Result<Vec<UsedFont>, PageError> {
+        self.send_cmd(|response| Command::UsedFonts { response })?
+    }
+
+    pub fn render_blocking(&self) -> Result<Vec<BlockingResource>, PageError> {
+        self.send_cmd(|response| Command::RenderBlocking { response })?
+    }
+
+    pub fn is_clickable(&self, selector: &str) -> Result<bool, PageError> {
+        self.send_cmd(|response| Command::IsClickable {
+            selector: selector.to_string(),
+            response,
+        })?
+    }
+
+    pub fn element_rects(&self, selector: &str) -> Result<Vec<ElementRect>, PageError> {
+        self.send_cmd(|response| Command::ElementRects {
+            selector: selector.to_string(),
+            response,
+        })?
+    }
+
+    pub fn validate_selector(&self, selector: &str) -> Result<Validation, PageError> {
+        self.send_cmd(|response| Command::ValidateSelector {
+            selector: selector.to_string(),
+            response,
+        })?
+    }
+
+    pub fn validate_script(&self, script: &str) -> Result<Validation, PageError> {
+        self.send_cmd(|response| Command::ValidateScript {
+            script: script.to_string(),
+            response,
+        })?
+    }
+
+    pub fn links_detailed(&self) -> Result<Vec<Link>, PageError> {
+        self.send_cmd(|response| Command::LinksDetailed { response })?
+    }
+
+    pub fn query_xpath(&self, xpath: &str) -> Result<Vec<String>, PageError> {
+        self.send_cmd(|response| Command::QueryXpath {
+            xpath: xpath.to_string(),
+            response,
+        })?
+    }
+
     pub fn element_text(&self, selector: &str) -> Result<String, PageError> {
         self.send_cmd(|response| Command::ElementText {
             selector: selector.to_string(),
@@ -719,12 +1698,39 @@ impl Page {
         let _ = self.send_cmd(|response| Command::SetPopupHandling { enabled, response });
     }
 
+    /// Allow or forbid `file:` URLs (off by default).
+    pub fn set_allow_file_access(&self, enabled: bool) {
+        let _ = self.send_cmd(|response| Command::SetAllowFileAccess { enabled, response });
+    }
+
+    /// Skip HTTP(S) images larger than `pixels` (width × height; 100
+    /// megapixels by default); `0` disables the limit. See
+    /// [`PageEngine::set_max_image_pixels`].
+    pub fn set_max_image_pixels(&self, pixels: u64) {
+        let _ = self.send_cmd(|response| Command::SetMaxImagePixels { pixels, response });
+    }
+
+    pub fn set_max_connections_per_host(&self, n: usize) {
+        let _ = self.send_cmd(|response| Command::SetMaxConnectionsPerHost { n, response });
+    }
+
     /// Drain pending popup WebViews and return their page IDs.
     pub fn popup_pages(&self) -> Vec<u32> {
         self.send_cmd(|response| Command::PopupPages { response })
             .unwrap_or_default()
     }
 
+    /// List open pages and popups with their index, ID, URL and title.
+    pub fn windows(&self) -> Vec<WindowInfo> {
+        self.send_cmd(|response| Command::Windows { response })
+            .unwrap_or_default()
+    }
+
+    /// Activate the window at `index` in [`windows()`](Self::windows).
+    pub fn switch_window(&self, index: usize) -> Result<(), PageError> {
+        self.send_cmd(|response| Command::SwitchWindow { index, response })?
+    }
+
     /// Get the URL of a specific page by ID (without switching).
     pub fn page_url(&self, page_id: u32) -> Option<String> {
         self.send_cmd(|response| Command::PageUrl { page_id, response })
@@ -742,6 +1748,10 @@ impl Page {
 
 impl Drop for Page {
     fn drop(&mut self) {
+        LIVE_PAGES
+            .lock()
+            .unwrap_or_else(|e| e.into_inner())
+            .retain(|p| p.id != self.handle_id);
         let sender = self.sender.lock().unwrap_or_else(|e| e.into_inner());
         let _ = sender.send(Command::Shutdown);
         drop(sender);
@@ -4,11 +4,16 @@
 
 //! Shared public types used across all layers.
 
+use std::collections::BTreeMap;
 use std::fmt;
+use std::path::PathBuf;
 
 use serde::Serialize;
 
 /// Options for configuring a page session.
+///
+/// Fields are added over time (`cache_dir` was), which breaks struct literals
+/// that list every field; fill the rest with `..PageOptions::default()`.
 #[derive(Debug, Clone)]
 pub struct PageOptions {
     /// Viewport width in pixels (default: 1280).
@@ -23,6 +28,18 @@ pub struct PageOptions {
     pub fullpage: bool,
     /// Custom User-Agent string. `None` uses Servo's default.
     pub user_agent: Option<String>,
+    /// Directory for Servo's on-disk state (HTTP cache, cookies, HSTS and
+    /// `localStorage`). Created if missing; must be writable. `None` uses
+    /// Servo's default.
+    ///
+    /// Reusing a directory resumes the previous session, so it doubles as a
+    /// persistent profile: e.g. log in once and later runs start authenticated.
+    /// Use one directory per profile, and one process per directory at a time.
+    ///
+    /// Servo's options are process-wide: every engine in a process shares the
+    /// first engine's directory, and creating one with a different value fails
+    /// with `InitFailed`. Run one process per profile.
+    pub cache_dir: Option<PathBuf>,
 }
 
 impl Default for PageOptions {
@@ -34,6 +51,7 @@ impl Default for PageOptions {
             wait: 2.0,
             fullpage: false,
             user_agent: None,
+            cache_dir: None,
         }
     }
 }
@@ -47,6 +65,208 @@ pub struct ElementRect {
     pub height: f64,
 }
 
+/// Scrollable size and scroll offset of the document, in CSS pixels.
+#[derive(Debug, Clone, Copy, Serialize)]
+pub struct ScrollMetrics {
+    pub scroll_height: f64,
+    pub scroll_width: f64,
+    pub scroll_top: f64,
+    pub scroll_left: f64,
+}
+
+/// Outcome of waiting for the document's images: how many decoded and how
+/// many failed (broken, blocked or undecodable).
+#[derive(Debug, Clone, Copy, Default, Serialize)]
+pub struct ImageLoadCounts {
+    pub loaded: u32,
+    pub failed: u32,
+}
+
+/// Paint milestones of the current document, in milliseconds since navigation
+/// start. `None` until the engine has reported the paint.
+#[derive(Debug, Clone, Copy, Default, Serialize)]
+pub struct PaintTiming {
+    /// First Contentful Paint.
+    pub first_contentful_paint: Option<f64>,
+    /// Largest Contentful Paint (latest candidate so far).
+    pub largest_contentful_paint: Option<f64>,
+}
+
+/// How a page builds its content, as guessed by
+/// [`render_mode`](crate::PageEngine::render_mode). Advisory only.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum RenderMode {
+    /// Most content was in the document by `DOMContentLoaded`.
+    ServerRendered,
+    /// Most content was added by scripts after `DOMContentLoaded`.
+    ClientRendered,
+    /// Somewhere in between, e.g. a server-rendered shell hydrated with data.
+    Hybrid,
+}
+
+impl fmt::Display for RenderMode {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            RenderMode::ServerRendered => "server-rendered",
+            RenderMode::ClientRendered => "client-rendered",
+            RenderMode::Hybrid => "hybrid",
+        })
+    }
+}
+
+/// The element an input event lands on, as reported by
+/// [`element_at`](crate::PageEngine::element_at).
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct ElementTarget {
+    /// Lowercase tag name, e.g. `button`.
+    pub tag: String,
+    /// A CSS selector matching only this element, built from the nearest
+    /// unique `id` and `:nth-of-type()` steps.
+    pub selector: String,
+}
+
+/// Progress of a navigation, as reported to the
+/// [`set_progress_callback`](crate::PageEngine::set_progress_callback) callback.
+#[derive(Debug, Clone, Copy, PartialEq, Serialize)]
+pub struct LoadProgress {
+    /// Coarse estimate from the document's load status: 10 once loading has
+    /// started, 50 after `<head>` is parsed, 90 at the `load` event and 100
+    /// once the post-load wait is over.
+    pub percent: f64,
+    /// Requests started since the navigation began. Servo does not report
+    /// request completion, so outstanding requests cannot be counted.
+    pub requests: u32,
+}
+
+/// Result of [`validate_selector`](crate::PageEngine::validate_selector) or
+/// [`validate_script`](crate::PageEngine::validate_script).
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Validation {
+    pub valid: bool,
+    /// The parser's message when `valid` is false.
+    pub error: Option<String>,
+    /// Elements the selector matches in the current document (selectors only).
+    pub matches: Option<usize>,
+}
+
+/// Uncompressed screenshot from
+/// [`screenshot_raw`](crate::PageEngine::screenshot_raw): 8-bit RGBA, not
+/// premultiplied, rows top to bottom with no padding between them.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RawImage {
+    pub width: u32,
+    pub height: u32,
+    /// Bytes per row, always `width * 4`.
+    pub stride: usize,
+    /// `stride * height` bytes.
+    pub data: Vec<u8>,
+}
+
+/// One layer of [`export_layers`](crate::PageEngine::export_layers).
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ImageLayer {
+    /// `background`, `text`, `images` or `overlays`.
+    pub name: String,
+    /// PNG-encoded viewport-sized image; all but `background` are transparent.
+    pub png: Vec<u8>,
+}
+
+/// A hyperlink (`<a href>` or `<area href>`) in the document, as returned by
+/// [`links_detailed`](crate::PageEngine::links_detailed).
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Link {
+    /// Absolute URL.
+    pub url: String,
+    /// Anchor text with whitespace collapsed.
+    pub text: String,
+    /// Raw `rel` attribute.
+    pub rel: Option<String>,
+    /// Raw `target` attribute.
+    pub target: Option<String>,
+    /// `rel` contains `nofollow`.
+    pub nofollow: bool,
+    /// `rel` contains `sponsored`.
+    pub sponsored: bool,
+    /// `rel` contains `ugc`.
+    pub ugc: bool,
+}
+
+/// Kind of resource reported by [`resources`](crate::PageEngine::resources).
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum ResourceType {
+    /// `<link rel="stylesheet">`
+    Stylesheet,
+    /// `<script src>`
+    Script,
+    /// `<img>` (the source actually chosen from `srcset`, if any)
+    Image,
+}
+
+/// An open page, as listed by [`windows`](crate::PageEngine::windows).
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct WindowInfo {
+    /// Position in the list, for [`switch_window`](crate::PageEngine::switch_window).
+    pub index: usize,
+    /// Page ID, as used by `switch_to()` and `close_page()`.
+    pub id: u32,
+    pub url: Option<String>,
+    pub title: Option<String>,
+    /// Opened by a page rather than `new_page()`.
+    pub popup: bool,
+    /// The active page.
+    pub active: bool,
+}
+
+/// A resource declared by the document.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct PageResource {
+    #[serde(rename = "type")]
+    pub kind: ResourceType,
+    /// Absolute URL.
+    pub url: String,
+}
+
+/// A font family the document renders text with, or a web font it declares,
+/// as returned by [`used_fonts`](crate::PageEngine::used_fonts).
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct UsedFont {
+    /// Family name as written in CSS (lowercase for generic families);
+    /// `None` for the browser default, used when no family of a stack renders.
+    pub family: Option<String>,
+    /// `web` (declared by `@font-face` or `document.fonts`), `system`,
+    /// `generic` or `default`.
+    pub source: String,
+    /// Web fonts only: `loaded`, `error`, `loading` or `unloaded` as reported
+    /// by `document.fonts`, otherwise `loaded` or `unavailable` by measurement.
+    pub status: Option<String>,
+    /// Rendered elements whose own text resolves to this family; 0 for web
+    /// fonts that are declared but unused or failed.
+    pub elements: u32,
+    /// Families listed before this one in those elements' `font-family` that
+    /// were skipped: failed web fonts or fonts missing on this host.
+    pub fallback_for: Vec<String>,
+}
+
+/// A stylesheet or script that held up the first paint, as returned by
+/// [`render_blocking`](crate::PageEngine::render_blocking).
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct BlockingResource {
+    #[serde(rename = "type")]
+    pub kind: ResourceType,
+    /// Absolute URL.
+    pub url: String,
+    /// Fetch duration from Resource Timing; `None` without a timing entry
+    /// (e.g. `data:` URLs).
+    pub duration_ms: Option<f64>,
+    /// `<script async>`
+    #[serde(rename = "async")]
+    pub is_async: bool,
+    /// `<script defer>`
+    pub defer: bool,
+}
+
 /// A console message captured from the page.
 #[derive(Debug, Clone, Serialize)]
 pub struct ConsoleMessage {
@@ -62,6 +282,61 @@ pub struct NetworkRequest {
     pub is_main_frame: bool,
 }
 
+/// A request passed to the request interceptor before it is sent.
+#[derive(Debug, Clone, Serialize)]
+pub struct InterceptedRequest {
+    pub method: String,
+    pub url: String,
+    /// Request headers (lowercase names; repeated headers are joined with `", "`).
+    pub headers: BTreeMap<String, String>,
+    pub is_main_frame: bool,
+}
+
+/// What the request interceptor wants done with a request.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum RequestAction {
+    /// Let the request proceed unchanged.
+    Continue,
+    /// Cancel the request; the page sees it as a failed load.
+    Abort,
+    /// Answer with a `307` redirect to another URL (e.g. to strip tracking params).
+    Redirect(String),
+    /// Send the request with this header set instead of the original headers.
+    ContinueWithHeaders(BTreeMap<String, String>),
+}
+
+/// Details of a JavaScript exception raised by [`evaluate`](crate::PageEngine::evaluate).
+#[derive(Debug, Clone, Serialize)]
+pub struct JsErrorDetails {
+    /// Servo's failure kind, e.g. `CompilationFailure` (syntax error) or
+    /// `EvaluationFailure` (thrown exception).
+    pub kind: String,
+    /// Exception name (`SyntaxError`, `TypeError`, ...). `None` when the
+    /// thrown value is not an `Error` (e.g. `throw 'x'`).
+    pub name: Option<String>,
+    pub message: String,
+    /// The exception's `stack`, with the same caveat as `name`.
+    pub stack: Option<String>,
+}
+
+/// JavaScript context a script is evaluated in.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum JsWorld {
+    /// The page's own global scope, shared with page scripts.
+    #[default]
+    Main,
+    /// A scope private to the scraper. Servo has no isolated realms, so this
+    /// is emulated: top-level declarations stay local to the call, and state
+    /// meant to outlive it goes on the per-document `world` object, which page
+    /// code does not use. Built-ins are still shared with the page.
+    ///
+    /// This is scope isolation only, not a security boundary: the script runs
+    /// through the page's `eval` (a page that replaces it sees the script),
+    /// page code can read `world`, and a Content-Security-Policy without
+    /// `'unsafe-eval'` makes every isolated call fail.
+    Isolated,
+}
+
 /// Errors that can occur during page operations.
 #[derive(Debug)]
 pub enum PageError {
@@ -81,6 +356,8 @@ pub enum PageError {
     NoPage,
     /// CSS selector matched nothing.
     SelectorNotFound(String),
+    /// An argument was outside the accepted set of values.
+    InvalidArgument(String),
 }
 
 impl fmt::Display for PageError {
@@ -94,12 +371,126 @@ impl fmt::Display for PageError {
             PageError::ChannelClosed => write!(f, "internal channel closed"),
             PageError::NoPage => write!(f, "no page open"),
             PageError::SelectorNotFound(sel) => write!(f, "selector not found: {sel}"),
+            PageError::InvalidArgument(msg) => write!(f, "invalid argument: {msg}"),
         }
     }
 }
 
 impl std::error::Error for PageError {}
 
+/// Network connection type to emulate via [`set_connection_type`](crate::PageEngine::set_connection_type).
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ConnectionType {
+    Wifi,
+    Cellular4g,
+    Cellular3g,
+    Cellular2g,
+    Offline,
+}
+
+impl std::str::FromStr for ConnectionType {
+    type Err = PageError;
+
+    /// Parse `wifi`, `4g`, `3g`, `2g`, or `offline`.
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s {
+            "wifi" => Ok(ConnectionType::Wifi),
+            "4g" => Ok(ConnectionType::Cellular4g),
+            "3g" => Ok(ConnectionType::Cellular3g),
+            "2g" => Ok(ConnectionType::Cellular2g),
+            "offline" => Ok(ConnectionType::Offline),
+            other => Err(PageError::InvalidArgument(format!(
+                "unknown connection type: {other}"
+            ))),
+        }
+    }
+}
+
+/// Which cookies pages may set, for
+/// [`set_cookie_policy`](crate::PageEngine::set_cookie_policy).
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub enum CookiePolicy {
+    #[default]
+    AcceptAll,
+    BlockThirdParty,
+    BlockAll,
+}
+
+impl std::str::FromStr for CookiePolicy {
+    type Err = PageError;
+
+    /// Parse `accept_all`, `block_third_party`, or `block_all`.
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s {
+            "accept_all" => Ok(CookiePolicy::AcceptAll),
+            "block_third_party" => Ok(CookiePolicy::BlockThirdParty),
+            "block_all" => Ok(CookiePolicy::BlockAll),
+            other => Err(PageError::InvalidArgument(format!(
+                "unknown cookie policy: {other}"
+            ))),
+        }
+    }
+}
+
+/// Web-platform features that can be switched off to avoid interference or
+/// save resources. The default enables everything the engine provides.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct FeatureFlags {
+    /// WebGL canvas contexts (default: enabled).
+    pub webgl: bool,
+    /// The `WebAssembly` global (default: enabled).
+    pub webassembly: bool,
+    /// `navigator.serviceWorker` (default: left as the engine provides it;
+    /// Servo ships with service workers disabled, so it is usually absent).
+    pub service_workers: bool,
+}
+
+impl Default for FeatureFlags {
+    fn default() -> Self {
+        Self {
+            webgl: true,
+            webassembly: true,
+            service_workers: true,
+        }
+    }
+}
+
+/// `SameSite` attribute of a cookie.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum SameSite {
+    /// Sent on cross-site requests too; browsers require `Secure` with it.
+    None,
+    Lax,
+    Strict,
+}
+
+impl std::str::FromStr for SameSite {
+    type Err = PageError;
+
+    /// Parse `None`, `Lax`, or `Strict` (case-insensitive).
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        match s.to_ascii_lowercase().as_str() {
+            "none" => Ok(SameSite::None),
+            "lax" => Ok(SameSite::Lax),
+            "strict" => Ok(SameSite::Strict),
+            _ => Err(PageError::InvalidArgument(format!(
+                "unknown SameSite value: {s}"
+            ))),
+        }
+    }
+}
+
+/// A file downloaded by the page, as returned by
+/// [`wait_for_download`](crate::PageEngine::wait_for_download).
+#[derive(Debug, Clone)]
+pub struct Download {
+    pub url: String,
+    /// From the link's `download` attribute, the `Content-Disposition`
+    /// header, or the last URL path segment, in that order.
+    pub filename: String,
+    pub data: Vec<u8>,
+}
+
 /// A file to inject into an `<input type="file">` element.
 pub struct InputFile {
     pub name: String,
@@ -4,17 +4,25 @@
 
 //! Integration tests for `PageEngine` (tested through the `Page` wrapper).
 //!
-//! All tests use `data:text/html,...` URIs for fully self-contained, offline,
-//! deterministic behavior. Must run single-threaded (`--test-threads=1`)
-//! because Servo allows only one instance per process.
+//! Tests use `data:text/html,...` URIs for fully self-contained, offline,
+//! deterministic behavior; those that need real HTTP requests (header
+//! overrides, cookies, CSP) use a loopback `TestServer`. Must run
+//! single-threaded (`--test-threads=1`) because Servo allows only one
+//! instance per process.
 //!
 //! A global `Page` singleton is shared across all tests. Each test calls
 //! `page.close()` first to reset state (drop the WebView), then `page.open()`
 //! as needed.
 
-use servo_scraper::{InputFile, Page, PageError, PageOptions};
-use std::sync::OnceLock;
-use std::time::Instant;
+use servo_scraper::{
+    ConnectionType, CookiePolicy, FeatureFlags, InputFile, JsWorld, Page, PageError, PageOptions,
+    RenderMode, RequestAction, ResourceType, SameSite,
+};
+use std::io::{BufRead, BufReader, Read, Write};
+use std::net::TcpListener;
+use std::sync::atomic::{AtomicBool, AtomicUsize, Ordering};
+use std::sync::{Arc, Mutex, OnceLock};
+use std::time::{Duration, Instant};
 
 // ---------------------------------------------------------------------------
 // Test HTML constants
@@ -115,15 +123,19 @@ document.getElementById('upload').addEventListener('change', function() {\
 
 static PAGE: OnceLock<Page> = OnceLock::new();
 
+/// Seconds `open()` waits for a load. Short enough for
+/// `test_open_timeout_keeps_partial_page` to hit it quickly, ample for the
+/// data: and loopback pages everything else loads.
+const PAGE_TIMEOUT: u64 = 10;
+
 fn page() -> &'static Page {
     PAGE.get_or_init(|| {
         let opts = PageOptions {
             width: 800,
             height: 600,
-            timeout: 30,
+            timeout: PAGE_TIMEOUT,
             wait: 0.5,
-            fullpage: false,
-            user_agent: None,
+            ..PageOptions::default()
         };
         Page::new(opts).expect("Page init failed")
     })
@@ -145,6 +157,126 @@ fn reset_and_open(html: &str) {
     p.open(&data_url(html)).expect("open data: URI failed");
 }
 
+// ---------------------------------------------------------------------------
+// Loopback HTTP server
+// ---------------------------------------------------------------------------
+
+/// One `TestServer` route: path, extra response header lines (each ending in
+/// `\r\n`) and body. `{port}` in the body is replaced by the server's port.
+type Route = (&'static str, &'static str, &'static str);
+
+/// A minimal HTTP/1.1 server on 127.0.0.1 that answers every request on its
+/// own connection and records what it received. Unknown paths get a 404.
+/// Cookies are per host, not per port, so tests sharing `127.0.0.1` use
+/// distinct cookie names.
+struct TestServer {
+    port: u16,
+    requests: Arc<Mutex<Vec<RecordedRequest>>>,
+}
+
+/// A request as `TestServer` received it. Header names are lower-cased.
+#[derive(Clone, Debug)]
+struct RecordedRequest {
+    method: String,
+    path: String,
+    headers: Vec<(String, String)>,
+    body: String,
+}
+
+impl RecordedRequest {
+    fn header(&self, name: &str) -> Option<&str> {
+        self.headers
+            .iter()
+            .find(|(n, _)| n == name)
+            .map(|(_, v)| v.as_str())
+    }
+}
+
+impl TestServer {
+    fn start(routes: &'static [Route]) -> TestServer {
+        let listener = TcpListener::bind("127.0.0.1:0").expect("bind loopback");
+        let port = listener.local_addr().unwrap().port();
+        let requests = Arc::new(Mutex::new(Vec::new()));
+        let log = requests.clone();
+        std::thread::spawn(move || {
+            for stream in listener.incoming() {
+                let Ok(mut stream) = stream else { continue };
+                let Some(request) = read_request(&mut stream) else {
+                    continue;
+                };
+                let route = routes
+                    .iter()
+                    .find(|(path, _, _)| *path == request.path.split('?').next().unwrap());
+                let (status, extra, body) = match route {
+                    Some((_, extra, body)) => {
+                        ("200 OK", *extra, body.replace("{port}", &port.to_string()))
+                    }
+                    None => ("404 Not Found", "", String::new()),
+                };
+                let content_type = if extra.to_ascii_lowercase().contains("content-type:") {
+                    ""
+                } else {
+                    "Content-Type: text/html; charset=utf-8\r\n"
+                };
+                log.lock().unwrap().push(request);
+                let _ = write!(
+                    stream,
+                    "HTTP/1.1 {status}\r\n{content_type}{extra}Content-Length: {}\r\n\
+                     Connection: close\r\n\r\n{body}",
+                    body.len()
+                );
+            }
+        });
+        TestServer { port, requests }
+    }
+
+    fn url(&self, path: &str) -> String {
+        format!("http://127.0.0.1:{}{path}", self.port)
+    }
+
+    /// Requests received for `path` (query included), oldest first.
+    fn requests(&self, path: &str) -> Vec<RecordedRequest> {
+        self.requests
+            .lock()
+            .unwrap()
+            .iter()
+            .filter(|r| r.path == path)
+            .cloned()
+            .collect()
+    }
+}
+
+fn read_request(stream: &mut std::net::TcpStream) -> Option<RecordedRequest> {
+    let mut reader = BufReader::new(stream);
+    let mut line = String::new();
+    reader.read_line(&mut line).ok()?;
+    let mut parts = line.split_whitespace();
+    let method = parts.next()?.to_string();
+    let path = parts.next()?.to_string();
+    let mut headers = Vec::new();
+    loop {
+        line.clear();
+        reader.read_line(&mut line).ok()?;
+        let Some((name, value)) = line.trim_end().split_once(':') else {
+            break;
+        };
+        headers.push((name.trim().to_ascii_lowercase(), value.trim().to_string()));
+    }
+    let length = headers
+        .iter()
+        .find(|(n, _)| n == "content-length")
+        .and_then(|(_, v)| v.parse().ok())
+        .unwrap_or(0);
+    let mut body = vec![0; length];
+    reader.read_exact(&mut body).ok()?;
+    Some(RecordedRequest {
+        method,
+        path,
+        headers,
+        body: String::from_utf8_lossy(&body).into_owned(),
+    })
+}
+
 // ---------------------------------------------------------------------------
 // Group 1: Engine Lifecycle
 // ---------------------------------------------------------------------------
@@ -163,6 +295,35 @@ fn test_engine_new_default() {
 // Custom options (user_agent, width, height, etc.) are tested indirectly
 // through the engine's behavior with the fast_options preset.
 
+#[test]
+fn test_cache_dir_is_process_wide() {
+    // The singleton claimed Servo's default directory for the process; both
+    // checks fail before a second engine would be started.
+    page();
+    let dir = std::env::temp_dir().join(format!("servo-scraper-cache-{}", std::process::id()));
+    let result = Page::new(PageOptions {
+        cache_dir: Some(dir.clone()),
+        ..PageOptions::default()
+    });
+    let _ = std::fs::remove_dir_all(&dir);
+    match result {
+        Err(PageError::InitFailed(msg)) => assert!(msg.contains("process-wide"), "{msg}"),
+        other => panic!("expected InitFailed, got {:?}", other.err()),
+    }
+
+    let file = std::env::temp_dir().join(format!("servo-scraper-file-{}", std::process::id()));
+    std::fs::write(&file, b"").unwrap();
+    let result = Page::new(PageOptions {
+        cache_dir: Some(file.join("cache")),
+        ..PageOptions::default()
+    });
+    let _ = std::fs::remove_file(&file);
+    assert!(
+        matches!(result, Err(PageError::InitFailed(_))),
+        "unwritable cache directory accepted"
+    );
+}
+
 // ---------------------------------------------------------------------------
 // Group 2: Navigation
 // ---------------------------------------------------------------------------
@@ -190,6 +351,105 @@ fn test_open_invalid_url() {
     }
 }
 
+#[test]
+fn test_open_file_url_disabled_by_default() {
+    reset();
+    match page().open("file:///etc/hostname") {
+        Err(PageError::LoadFailed(msg)) => assert!(msg.contains("file:"), "msg: {msg}"),
+        other => panic!("expected LoadFailed, got: {other:?}"),
+    }
+}
+
+#[test]
+fn test_open_timeout_keeps_partial_page() {
+    // Accepts connections and never answers, so the iframe holds back the
+    // load event until open() gives up.
+    let stall = TcpListener::bind("127.0.0.1:0").expect("bind loopback");
+    let stall_port = stall.local_addr().unwrap().port();
+    std::thread::spawn(move || {
+        let _held: Vec<_> = stall.incoming().collect();
+    });
+
+    reset();
+    let p = page();
+    let html = format!(
+        "<html><body style='margin:0; background: rgb(255, 0, 0)'>\
+         <p id='partial'>partial content</p>\
+         <iframe src='http://127.0.0.1:{stall_port}/never'></iframe>\
+         </body></html>"
+    );
+    let started = Instant::now();
+    match p.open(&data_url(&html)) {
+        Err(PageError::Timeout) => {}
+        other => panic!("expected Timeout, got: {other:?}"),
+    }
+    assert!(started.elapsed() >= Duration::from_secs(PAGE_TIMEOUT));
+
+    let html = p.html().expect("html() failed after timeout");
+    assert!(html.contains("partial content"), "html: {html}");
+    let png = p.screenshot().expect("screenshot() failed after timeout");
+    assert_eq!(&png[..4], &PNG_MAGIC);
+    let image = p
+        .screenshot_raw()
+        .expect("screenshot_raw() failed after timeout");
+    assert_eq!(&image.data[..4], &[255, 0, 0, 255]);
+}
+
+#[test]
+fn test_max_image_pixels_ignores_data_images() {
+    reset();
+    let p = page();
+
+    // Only http(s): images are checked, so a data: image still decodes.
+    p.set_max_image_pixels(1);
+    let img = "data:image/gif;base64,R0lGODlhAQABAIAAAP///wAAACwAAAAAAQABAAACAkQBADs=";
+    let html = format!(r#"<img id="i" src="{img}">"#);
+    p.open(&data_url(&html)).expect("open failed");
+
+    let loaded = p
+        .evaluate("document.getElementById('i').naturalWidth === 1")
+        .unwrap();
+    assert_eq!(loaded, "true");
+}
+
+#[test]
+fn test_max_connections_per_host_ignores_data_urls() {
+    reset();
+    let p = page();
+
+    // Only http(s) requests are counted, so data: loads are never queued.
+    p.set_max_connections_per_host(1);
+    let result = p.open(&data_url(BASIC_HTML));
+    p.set_max_connections_per_host(0);
+    result.expect("open failed");
+    assert_eq!(p.evaluate("document.title").unwrap(), "\"Test Page\"");
+}
+
+#[test]
+fn test_open_file_url_when_allowed() {
+    reset();
+    let p = page();
+
+    let path = std::env::temp_dir().join("servo_scraper_file_access.html");
+    std::fs::write(&path, BASIC_HTML).unwrap();
+    p.set_allow_file_access(true);
+    let file_url = url::Url::from_file_path(&path).unwrap();
+    let result = p.open(file_url.as_str());
+    p.set_allow_file_access(false);
+    result.expect("open file: URL failed");
+
+    assert_eq!(p.title().as_deref(), Some("Test Page"));
+}
+
+#[test]
+fn test_open_unsupported_scheme() {
+    reset();
+    match page().open("ftp://example.com/") {
+        Err(PageError::LoadFailed(msg)) => assert!(msg.contains("scheme"), "msg: {msg}"),
+        other => panic!("expected LoadFailed, got: {other:?}"),
+    }
+}
+
 #[test]
 fn test_open_reuses_webview() {
     let p = page();
@@ -209,6 +469,118 @@ fn test_url_and_title_before_open() {
     assert!(p.title().is_none());
 }
 
+#[test]
+fn test_charset_from_meta() {
+    reset_and_open(
+        "<html><head><meta charset=\"windows-1252\"><title>Legacy</title></head>\
+         <body>text</body></html>",
+    );
+    assert_eq!(page().charset().as_deref(), Some("windows-1252"));
+}
+
+#[test]
+fn test_charset_from_content_type() {
+    let p = page();
+    p.reset();
+    p.open("data:text/html;charset=utf-8,<p>hi</p>").unwrap();
+    assert_eq!(p.charset().as_deref(), Some("UTF-8"));
+}
+
+#[test]
+fn test_paint_timing() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+    // The paint entry is queued after the frame that follows the load.
+    p.wait_for_condition(
+        "performance.getEntriesByName('first-contentful-paint').length > 0",
+        5,
+    )
+    .expect("no first-contentful-paint entry");
+
+    let timing = p.paint_timing().expect("paint_timing failed");
+    let fcp = timing
+        .first_contentful_paint
+        .expect("BASIC_HTML has text, so FCP must be reported");
+    assert!(fcp >= 0.0);
+    if let Some(lcp) = timing.largest_contentful_paint {
+        assert!(lcp >= fcp, "LCP {lcp} before FCP {fcp}");
+    }
+}
+
+#[test]
+fn test_has_service_worker_none_registered() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+    assert!(!p.has_service_worker().expect("has_service_worker failed"));
+
+    p.set_service_worker_tracking(true);
+    p.open(&data_url(BASIC_HTML)).unwrap();
+    assert!(!p.has_service_worker().unwrap());
+}
+
+#[test]
+fn test_service_worker_tracking_off_by_default() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+    let installed = "typeof ServiceWorkerContainer === 'undefined' ? null : \
+        ServiceWorkerContainer.prototype.register.toString().indexOf('__servoScraperSwRegistered') >= 0";
+
+    let before = p.evaluate(installed).unwrap();
+    if before == "null" {
+        // Service workers are disabled in this Servo build: nothing to wrap.
+        return;
+    }
+    assert_eq!(before, "false");
+    p.set_service_worker_tracking(true);
+    p.open(&data_url(BASIC_HTML)).unwrap();
+    assert_eq!(p.evaluate(installed).unwrap(), "true");
+    p.reset();
+    p.open(&data_url(BASIC_HTML)).unwrap();
+    assert_eq!(p.evaluate(installed).unwrap(), "false");
+}
+
+#[test]
+fn test_render_mode() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+    assert!(matches!(
+        p.render_mode(),
+        Err(PageError::InvalidArgument(_))
+    ));
+
+    p.set_render_mode_tracking(true);
+    p.open(&data_url(BASIC_HTML)).unwrap();
+    assert_eq!(p.render_mode().unwrap(), RenderMode::ServerRendered);
+
+    let spa = "<html><body><div id=\"app\"></div><script>\
+        setTimeout(function() { \
+            var app = document.getElementById('app'); \
+            for (var i = 0; i < 50; i++) { \
+                var p = document.createElement('p'); \
+                p.textContent = 'Client-rendered paragraph number ' + i; \
+                app.appendChild(p); \
+            } \
+        }, 50);\
+        </script></body></html>";
+    p.open(&data_url(spa)).unwrap();
+    p.wait_for_condition("document.querySelectorAll('#app p').length === 50", 5)
+        .unwrap();
+    assert_eq!(p.render_mode().unwrap(), RenderMode::ClientRendered);
+    assert_eq!(RenderMode::ClientRendered.to_string(), "client-rendered");
+}
+
+#[test]
+fn test_paint_timing_no_page() {
+    reset();
+    assert!(matches!(page().paint_timing(), Err(PageError::NoPage)));
+}
+
+#[test]
+fn test_charset_before_open() {
+    reset();
+    assert!(page().charset().is_none());
+}
+
 #[test]
 fn test_close_then_url_returns_none() {
     reset_and_open(BASIC_HTML);
@@ -234,6 +606,27 @@ fn test_html_capture() {
     assert!(html.contains("heading"), "html missing heading id");
 }
 
+#[test]
+fn test_html_gzip() {
+    use std::io::Read;
+
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    let gz = p.html_gzip(9).expect("html_gzip failed");
+    assert_eq!(&gz[..2], &[0x1f, 0x8b]);
+    let mut html = String::new();
+    flate2::read::GzDecoder::new(&gz[..])
+        .read_to_string(&mut html)
+        .expect("invalid gzip");
+    assert_eq!(html, p.html().unwrap());
+
+    assert!(matches!(
+        p.html_gzip(10),
+        Err(PageError::InvalidArgument(_))
+    ));
+}
+
 #[test]
 fn test_html_before_open() {
     reset();
@@ -281,6 +674,105 @@ fn test_evaluate_object() {
     );
 }
 
+#[test]
+fn test_last_js_error_thrown_exception() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    let result = p.evaluate("throw new TypeError('boom')");
+    assert!(
+        matches!(result, Err(PageError::JsError(_))),
+        "got: {result:?}"
+    );
+
+    let details = p.last_js_error().expect("details expected after JsError");
+    assert!(!details.kind.is_empty());
+    assert_eq!(details.name.as_deref(), Some("TypeError"));
+    assert!(
+        details.message.contains("boom"),
+        "message: {}",
+        details.message
+    );
+    assert!(
+        details.stack.as_deref().is_some_and(|s| !s.is_empty()),
+        "stack: {:?}",
+        details.stack
+    );
+}
+
+#[test]
+fn test_last_js_error_syntax_error() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    assert!(p.evaluate("1 +* 2").is_err());
+    let details = p.last_js_error().expect("details expected after JsError");
+    assert!(
+        details.kind.contains("Compilation"),
+        "kind: {}",
+        details.kind
+    );
+}
+
+#[test]
+fn test_last_js_error_cleared_on_success() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    let _ = p.evaluate("throw new Error('x')");
+    p.evaluate("1").unwrap();
+    assert!(p.last_js_error().is_none());
+}
+
+#[test]
+fn test_last_js_error_ignores_stale_page_error() {
+    reset_and_open(
+        "<html><body><script>\
+         setTimeout(function() { window.thrown = true; throw new Error('stale'); }, 0);\
+         </script></body></html>",
+    );
+    let p = page();
+    p.wait_for_condition("window.thrown === true", 5).unwrap();
+
+    assert!(p.evaluate("1 +* 2").is_err());
+    let details = p.last_js_error().expect("details expected after JsError");
+    assert!(
+        !details.message.contains("stale"),
+        "stale page error reported: {}",
+        details.message
+    );
+}
+
+#[test]
+fn test_evaluate_isolated_world_keeps_globals_apart() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    p.evaluate("var helper = 'page'; true").unwrap();
+    let result = p
+        .evaluate_in_world("var helper = 'scraper'; helper", JsWorld::Isolated)
+        .unwrap();
+    assert_eq!(result, "\"scraper\"");
+    assert_eq!(p.evaluate("helper").unwrap(), "\"page\"");
+}
+
+#[test]
+fn test_evaluate_isolated_world_state_persists() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    p.evaluate_in_world(
+        "world.heading = function() { return document.querySelector('h1').textContent; }; true",
+        JsWorld::Isolated,
+    )
+    .unwrap();
+    let result = p
+        .evaluate_in_world("world.heading()", JsWorld::Isolated)
+        .unwrap();
+    assert_eq!(result, "\"Hello World\"");
+    assert_eq!(p.evaluate("typeof world").unwrap(), "\"undefined\"");
+}
+
 #[test]
 fn test_evaluate_before_open() {
     reset();
@@ -296,6 +788,13 @@ fn test_evaluate_before_open() {
 
 const PNG_MAGIC: [u8; 4] = [0x89, 0x50, 0x4E, 0x47];
 
+/// Width and height from a PNG's IHDR chunk.
+fn png_size(png: &[u8]) -> (u32, u32) {
+    let w = u32::from_be_bytes(png[16..20].try_into().unwrap());
+    let h = u32::from_be_bytes(png[20..24].try_into().unwrap());
+    (w, h)
+}
+
 #[test]
 fn test_screenshot_returns_png() {
     reset_and_open(BASIC_HTML);
@@ -324,92 +823,299 @@ fn test_screenshot_fullpage() {
 }
 
 #[test]
-fn test_screenshot_before_open() {
-    reset();
-    match page().screenshot() {
-        Err(PageError::NoPage) => {}
-        other => panic!("expected NoPage, got: {other:?}"),
-    }
-}
+fn test_screenshot_viewport_after_fullpage() {
+    reset_and_open(TALL_HTML);
+    let p = page();
 
-#[test]
-fn test_screenshot_fullpage_before_open() {
-    reset();
-    match page().screenshot_fullpage() {
-        Err(PageError::NoPage) => {}
-        other => panic!("expected NoPage, got: {other:?}"),
-    }
-}
+    let fullpage_png = p.screenshot_fullpage().unwrap();
+    assert!(png_size(&fullpage_png).1 > 600);
 
-// ---------------------------------------------------------------------------
-// Group 6: Console Messages
-// ---------------------------------------------------------------------------
+    let viewport_png = p.screenshot_viewport().expect("screenshot_viewport failed");
+    assert_eq!(png_size(&viewport_png), (800, 600));
+}
 
 #[test]
-fn test_console_messages() {
-    reset_and_open(CONSOLE_HTML);
-
-    let messages = page().console_messages();
-    assert!(
-        messages.len() >= 3,
-        "expected >= 3 console messages, got {}",
-        messages.len()
-    );
+fn test_screenshot_viewport_under_zoom() {
+    reset_and_open(TALL_HTML);
+    let p = page();
 
-    let levels: Vec<&str> = messages.iter().map(|m| m.level.as_str()).collect();
-    assert!(levels.contains(&"log"), "missing log level: {levels:?}");
-    assert!(levels.contains(&"warn"), "missing warn level: {levels:?}");
-    assert!(levels.contains(&"error"), "missing error level: {levels:?}");
+    p.set_zoom(2.0).unwrap();
+    let unchanged = p.screenshot_viewport();
+    p.screenshot_fullpage().unwrap();
+    let after_fullpage = p.screenshot_viewport();
+    p.set_zoom(1.0).unwrap();
 
-    let texts: Vec<&str> = messages.iter().map(|m| m.message.as_str()).collect();
-    assert!(
-        texts.iter().any(|t| t.contains("log message")),
-        "missing log message: {texts:?}"
-    );
-    assert!(
-        texts.iter().any(|t| t.contains("warn message")),
-        "missing warn message: {texts:?}"
-    );
-    assert!(
-        texts.iter().any(|t| t.contains("error message")),
-        "missing error message: {texts:?}"
+    assert_eq!(
+        png_size(&unchanged.expect("screenshot_viewport failed")),
+        (800, 600)
     );
+    assert_eq!(png_size(&after_fullpage.unwrap()), (800, 600));
 }
 
 #[test]
-fn test_console_messages_drain() {
-    reset_and_open(CONSOLE_HTML);
-
+fn test_screenshot_between() {
+    reset_and_open(
+        "<html><body style='margin:0'>\
+         <h2 id='a' style='margin:0;height:100px'>A</h2>\
+         <div style='height:1000px'></div>\
+         <h2 id='b' style='margin:0;height:50px'>B</h2>\
+         </body></html>",
+    );
     let p = page();
-    let first = p.console_messages();
-    assert!(!first.is_empty(), "first drain should have messages");
 
-    let second = p.console_messages();
-    assert!(second.is_empty(), "second drain should be empty");
+    let png = p
+        .screenshot_between("#a", "#b")
+        .expect("screenshot_between failed");
+    assert_eq!(png_size(&png), (800, 1150));
+    let swapped = p.screenshot_between("#b", "#a").unwrap();
+    assert_eq!(png_size(&swapped), (800, 1150));
+
+    match p.screenshot_between("#a", "#missing") {
+        Err(PageError::SelectorNotFound(sel)) => assert_eq!(sel, "#missing"),
+        other => panic!("expected SelectorNotFound, got: {other:?}"),
+    }
 }
 
-// ---------------------------------------------------------------------------
-// Group 7: Network Requests
-// ---------------------------------------------------------------------------
+#[test]
+fn test_screenshot_between_viewport_units() {
+    // #a sits at 25vh, which moves when the capture resizes the viewport to
+    // the 2000px document.
+    reset_and_open(
+        "<html><body style='margin:0;position:relative;height:2000px'>\
+         <h2 id='a' style='margin:0;position:absolute;top:25vh;height:100px'>A</h2>\
+         <h2 id='b' style='margin:0;position:absolute;top:1500px;height:50px'>B</h2>\
+         </body></html>",
+    );
+
+    let png = page()
+        .screenshot_between("#a", "#b")
+        .expect("screenshot_between failed");
+    assert_eq!(png_size(&png), (800, 1050));
+}
 
 #[test]
-fn test_network_requests() {
-    reset_and_open(BASIC_HTML);
+fn test_screenshot_raw() {
+    reset_and_open("<html><body style='margin:0; background: rgb(255, 0, 0)'></body></html>");
 
-    let requests = page().network_requests();
-    assert!(
-        !requests.is_empty(),
-        "at least one network request expected"
-    );
+    let image = page().screenshot_raw().expect("screenshot_raw failed");
+    assert_eq!(image.width, 800);
+    assert_eq!(image.stride, image.width as usize * 4);
+    assert_eq!(image.data.len(), image.stride * image.height as usize);
+    assert_eq!(&image.data[..4], &[255, 0, 0, 255]);
 }
 
 #[test]
-fn test_network_requests_drain() {
+fn test_screenshot_phash() {
     reset_and_open(BASIC_HTML);
-
     let p = page();
-    let first = p.network_requests();
-    assert!(!first.is_empty(), "first drain should have requests");
+
+    let hash = p.screenshot_phash().expect("screenshot_phash failed");
+    assert_eq!(p.screenshot_phash().unwrap(), hash, "hash not stable");
+
+    p.evaluate("document.querySelector('p').textContent += '!'")
+        .unwrap();
+    let tweaked = p.screenshot_phash().unwrap();
+    assert!((hash ^ tweaked).count_ones() <= 10);
+
+    p.open(&data_url(TALL_HTML)).unwrap();
+    assert_ne!(p.screenshot_phash().unwrap(), hash);
+}
+
+#[test]
+fn test_screenshot_scales() {
+    reset_and_open(BASIC_HTML);
+
+    let shots = page()
+        .screenshot_scales(&[1.0, 2.0])
+        .expect("screenshot_scales failed");
+    assert_eq!(shots.len(), 2);
+    assert_eq!(&shots[0][..4], &PNG_MAGIC);
+    assert_eq!(&shots[1][..4], &PNG_MAGIC);
+    let (w1, h1) = png_size(&shots[0]);
+    let (w2, h2) = png_size(&shots[1]);
+    assert_eq!((w2, h2), (w1 * 2, h1 * 2));
+    // Back at the previous 1x size.
+    assert_eq!(png_size(&page().screenshot().unwrap()), (w1, h1));
+}
+
+#[test]
+fn test_screenshot_scales_invalid_factor() {
+    reset_and_open(BASIC_HTML);
+
+    let result = page().screenshot_scales(&[1.0, 0.0]);
+    assert!(matches!(result, Err(PageError::InvalidArgument(_))));
+    let result = page().screenshot_scales(&[100.0]);
+    assert!(matches!(result, Err(PageError::InvalidArgument(_))));
+}
+
+#[test]
+fn test_set_zoom() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    assert_eq!(p.zoom().unwrap(), 1.0);
+    p.set_zoom(2.0).expect("set_zoom failed");
+    let width = p.evaluate("window.innerWidth").unwrap();
+    let png = p.screenshot().unwrap();
+    p.set_zoom(1.0).unwrap();
+
+    assert_eq!(width, "400");
+    assert_eq!(png_size(&png), (800, 600));
+    assert!(matches!(
+        p.set_zoom(0.0),
+        Err(PageError::InvalidArgument(_))
+    ));
+}
+
+#[test]
+fn test_screenshot_filmstrip() {
+    reset_and_open(TALL_HTML);
+    let p = page();
+
+    let frames = p
+        .screenshot_filmstrip(1000)
+        .expect("screenshot_filmstrip failed");
+    assert!(
+        frames.len() >= 3,
+        "expected several frames, got {}",
+        frames.len()
+    );
+    for png in &frames {
+        assert_eq!(&png[..4], &PNG_MAGIC, "not a valid PNG");
+    }
+
+    // A step past the bottom yields the top and the bottom frame.
+    assert_eq!(p.screenshot_filmstrip(100_000).unwrap().len(), 2);
+    assert_eq!(p.evaluate("window.scrollY === 0").unwrap(), "true");
+}
+
+#[test]
+fn test_screenshot_filmstrip_short_page() {
+    reset_and_open(BASIC_HTML);
+
+    let frames = page().screenshot_filmstrip(200).unwrap();
+    assert_eq!(frames.len(), 1);
+}
+
+#[test]
+fn test_screenshot_filmstrip_zero_step() {
+    reset_and_open(BASIC_HTML);
+
+    let result = page().screenshot_filmstrip(0);
+    assert!(matches!(result, Err(PageError::InvalidArgument(_))));
+}
+
+#[test]
+fn test_export_layers() {
+    reset_and_open(
+        "<html><body style='background:#fc0'>\
+         <h1>Layers</h1>\
+         <div style='position:fixed;top:0;right:0;width:50px;height:50px;background:red'></div>\
+         </body></html>",
+    );
+
+    let layers = page().export_layers().expect("export_layers failed");
+    let names: Vec<&str> = layers.iter().map(|l| l.name.as_str()).collect();
+    assert_eq!(names, ["background", "text", "images", "overlays"]);
+    for layer in &layers {
+        assert_eq!(&layer.png[..4], &PNG_MAGIC);
+        assert_eq!(png_size(&layer.png), (800, 600));
+    }
+    assert_eq!(
+        page()
+            .evaluate("document.querySelectorAll('[data-servo-scraper-overlay]').length")
+            .unwrap(),
+        "0"
+    );
+}
+
+#[test]
+fn test_screenshot_before_open() {
+    reset();
+    match page().screenshot() {
+        Err(PageError::NoPage) => {}
+        other => panic!("expected NoPage, got: {other:?}"),
+    }
+}
+
+#[test]
+fn test_screenshot_fullpage_before_open() {
+    reset();
+    match page().screenshot_fullpage() {
+        Err(PageError::NoPage) => {}
+        other => panic!("expected NoPage, got: {other:?}"),
+    }
+}
+
+// ---------------------------------------------------------------------------
+// Group 6: Console Messages
+// ---------------------------------------------------------------------------
+
+#[test]
+fn test_console_messages() {
+    reset_and_open(CONSOLE_HTML);
+
+    let messages = page().console_messages();
+    assert!(
+        messages.len() >= 3,
+        "expected >= 3 console messages, got {}",
+        messages.len()
+    );
+
+    let levels: Vec<&str> = messages.iter().map(|m| m.level.as_str()).collect();
+    assert!(levels.contains(&"log"), "missing log level: {levels:?}");
+    assert!(levels.contains(&"warn"), "missing warn level: {levels:?}");
+    assert!(levels.contains(&"error"), "missing error level: {levels:?}");
+
+    let texts: Vec<&str> = messages.iter().map(|m| m.message.as_str()).collect();
+    assert!(
+        texts.iter().any(|t| t.contains("log message")),
+        "missing log message: {texts:?}"
+    );
+    assert!(
+        texts.iter().any(|t| t.contains("warn message")),
+        "missing warn message: {texts:?}"
+    );
+    assert!(
+        texts.iter().any(|t| t.contains("error message")),
+        "missing error message: {texts:?}"
+    );
+}
+
+#[test]
+fn test_console_messages_drain() {
+    reset_and_open(CONSOLE_HTML);
+
+    let p = page();
+    let first = p.console_messages();
+    assert!(!first.is_empty(), "first drain should have messages");
+
+    let second = p.console_messages();
+    assert!(second.is_empty(), "second drain should be empty");
+}
+
+// ---------------------------------------------------------------------------
+// Group 7: Network Requests
+// ---------------------------------------------------------------------------
+
+#[test]
+fn test_network_requests() {
+    reset_and_open(BASIC_HTML);
+
+    let requests = page().network_requests();
+    assert!(
+        !requests.is_empty(),
+        "at least one network request expected"
+    );
+}
+
+#[test]
+fn test_network_requests_drain() {
+    reset_and_open(BASIC_HTML);
+
+    let p = page();
+    let first = p.network_requests();
+    assert!(!first.is_empty(), "first drain should have requests");
 
     let second = p.network_requests();
     assert!(second.is_empty(), "second drain should be empty");
@@ -456,6 +1162,149 @@ fn test_wait_for_condition() {
         .expect("condition should become truthy");
 }
 
+#[test]
+fn test_wait_for_text_found() {
+    reset_and_open(BASIC_HTML);
+
+    page()
+        .wait_for_text("Some paragraph", true, 5000)
+        .expect("text should be found immediately");
+}
+
+#[test]
+fn test_wait_for_text_delayed() {
+    reset_and_open(DYNAMIC_HTML);
+
+    page()
+        .wait_for_text("I appeared", true, 10_000)
+        .expect("text should appear after setTimeout");
+}
+
+#[test]
+fn test_wait_for_text_case_insensitive() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    p.wait_for_text("hello world", false, 5000)
+        .expect("case-insensitive match should succeed");
+
+    match p.wait_for_text("hello world", true, 500) {
+        Err(PageError::Timeout) => {}
+        other => panic!("expected Timeout for case-sensitive mismatch, got: {other:?}"),
+    }
+}
+
+#[test]
+fn test_wait_for_download_link() {
+    reset();
+    let p = page();
+    p.set_download_capture(true);
+    p.open(&data_url(
+        "<html><body>\
+         <a id='dl' download='report.csv' href='data:text/csv,a%2Cb%0A1%2C2'>Export</a>\
+         </body></html>",
+    ))
+    .expect("open failed");
+
+    p.click_selector("#dl").unwrap();
+    let download = p.wait_for_download(5000).expect("download should complete");
+    assert_eq!(download.filename, "report.csv");
+    assert_eq!(download.data, b"a,b\n1,2");
+}
+
+#[test]
+fn test_wait_for_download_detached_anchor() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+    p.set_download_capture(true);
+
+    p.evaluate(
+        "var a = document.createElement('a'); \
+         a.href = 'data:text/plain,hello'; a.download = 'hello.txt'; a.click(); true",
+    )
+    .unwrap();
+    let download = p.wait_for_download(5000).expect("download should complete");
+    assert_eq!(download.filename, "hello.txt");
+    assert_eq!(download.data, b"hello");
+}
+
+#[test]
+fn test_wait_for_download_timeout() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+    p.set_download_capture(true);
+    match p.wait_for_download(300) {
+        Err(PageError::Timeout) => {}
+        other => panic!("expected Timeout, got: {other:?}"),
+    }
+}
+
+#[test]
+fn test_wait_for_download_attachment_navigation() {
+    static ROUTES: &[Route] = &[
+        (
+            "/page",
+            "",
+            "<title>list</title><a id='dl' href='/export'>Export</a>",
+        ),
+        (
+            "/export",
+            "Content-Type: text/csv\r\nContent-Disposition: attachment; filename=\"data.csv\"\r\n",
+            "a,b\n1,2",
+        ),
+    ];
+    let server = TestServer::start(ROUTES);
+    reset();
+    let p = page();
+    p.set_download_capture(true);
+    p.open(&server.url("/page")).expect("open failed");
+
+    p.click_selector("#dl").unwrap();
+    let download = p.wait_for_download(5000).expect("download should complete");
+    assert_eq!(download.url, server.url("/export"));
+    assert_eq!(download.filename, "data.csv");
+    assert_eq!(download.data, b"a,b\n1,2");
+    // The navigation ended on the page that started it.
+    assert_eq!(p.evaluate("document.title").unwrap(), "\"list\"");
+}
+
+#[test]
+fn test_download_capture_off_by_default() {
+    reset_and_open("<html><body><a id='dl' download href='data:text/plain,x'>x</a></body></html>");
+    let p = page();
+
+    assert_eq!(
+        p.evaluate("typeof window.__servoScraperDownloads").unwrap(),
+        "\"undefined\""
+    );
+    assert!(matches!(
+        p.wait_for_download(300),
+        Err(PageError::InvalidArgument(_))
+    ));
+}
+
+#[test]
+fn test_wait_for_images() {
+    // A 1x1 GIF, a broken image and an image without a source.
+    reset_and_open(
+        "<html><body>\
+         <img src='data:image/gif;base64,R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7'>\
+         <img src='data:image/png;base64,AAAA'><img>\
+         </body></html>",
+    );
+    let counts = page().wait_for_images(5000).expect("images should settle");
+    assert_eq!((counts.loaded, counts.failed), (1, 1));
+}
+
+#[test]
+fn test_wait_for_text_no_page() {
+    reset();
+    match page().wait_for_text("anything", false, 100) {
+        Err(PageError::NoPage) => {}
+        other => panic!("expected NoPage, got: {other:?}"),
+    }
+}
+
 #[test]
 fn test_wait_fixed() {
     reset_and_open(BASIC_HTML);
@@ -546,145 +1395,926 @@ fn test_reload_before_open() {
 // ---------------------------------------------------------------------------
 
 #[test]
-fn test_click_coordinates() {
-    reset_and_open(FORM_HTML);
+fn test_click_coordinates() {
+    reset_and_open(FORM_HTML);
+    let p = page();
+
+    let rect = p.element_rect("#submit-btn").expect("button rect failed");
+    let cx = (rect.x + rect.width / 2.0) as f32;
+    let cy = (rect.y + rect.height / 2.0) as f32;
+
+    p.click(cx, cy).expect("click failed");
+    p.wait(0.3);
+
+    let result = p.element_text("#result").unwrap();
+    assert_eq!(result, "clicked", "button click should have fired onclick");
+}
+
+#[test]
+fn test_click_selector() {
+    reset_and_open(FORM_HTML);
+    let p = page();
+
+    p.click_selector("#submit-btn")
+        .expect("click_selector failed");
+    p.wait(0.3);
+
+    let result = p.element_text("#result").unwrap();
+    assert_eq!(result, "clicked");
+}
+
+#[test]
+fn test_click_selector_not_found() {
+    reset_and_open(BASIC_HTML);
+
+    match page().click_selector("#nonexistent") {
+        Err(PageError::SelectorNotFound(sel)) => {
+            assert_eq!(sel, "#nonexistent");
+        }
+        other => panic!("expected SelectorNotFound, got: {other:?}"),
+    }
+}
+
+#[test]
+fn test_selector_target_reports_overlay() {
+    reset_and_open(
+        "<button id='buy' style='position:absolute;left:0;top:0;width:100px;height:40px'>Buy</button>\
+         <div style='position:absolute;left:0;top:0;width:200px;height:200px'><p>cover</p><p>banner</p></div>",
+    );
+    let p = page();
+
+    let target = p
+        .selector_target("#buy")
+        .expect("selector_target failed")
+        .expect("no element at the button's center");
+    assert_eq!(target.tag, "div");
+    assert_eq!(target.selector, "html > body > div");
+
+    let button = p.element_at(50.0, 20.0).unwrap().unwrap();
+    assert_eq!(button, target);
+    assert_eq!(p.element_at(5000.0, 5000.0).unwrap(), None);
+    assert!(matches!(
+        p.selector_target("#missing"),
+        Err(PageError::SelectorNotFound(_))
+    ));
+}
+
+#[test]
+fn test_type_text() {
+    reset_and_open(FORM_HTML);
+    let p = page();
+
+    // Focus the input by clicking it
+    p.click_selector("#name-input").expect("click input failed");
+    p.wait(0.2);
+
+    p.type_text("hello").expect("type_text failed");
+    p.wait(0.2);
+
+    let value = p
+        .evaluate("document.getElementById('name-input').value")
+        .unwrap();
+    assert!(
+        value.contains("hello"),
+        "input value should contain 'hello': {value}"
+    );
+}
+
+#[test]
+fn test_key_press() {
+    reset_and_open(BASIC_HTML);
+
+    let p = page();
+    for key in &["Enter", "Tab", "Escape", "Backspace", "ArrowUp", "a"] {
+        p.key_press(key)
+            .unwrap_or_else(|e| panic!("key_press({key}) failed: {e}"));
+    }
+}
+
+// ---------------------------------------------------------------------------
+// Group 11: Mouse Move
+// ---------------------------------------------------------------------------
+
+#[test]
+fn test_mouse_move() {
+    reset_and_open(BASIC_HTML);
+
+    let p = page();
+    p.mouse_move(100.0, 100.0)
+        .expect("mouse_move(100,100) failed");
+    p.mouse_move(200.0, 300.0)
+        .expect("mouse_move(200,300) failed");
+}
+
+// ---------------------------------------------------------------------------
+// Group 12: Cookies
+// ---------------------------------------------------------------------------
+
+#[test]
+fn test_get_cookies() {
+    reset_and_open(BASIC_HTML);
+
+    // data: URIs have opaque origin, so document.cookie returns empty string
+    let cookies = page().get_cookies().expect("get_cookies failed");
+    assert!(
+        cookies.is_empty() || cookies.len() < 1000,
+        "cookies: {cookies}"
+    );
+}
+
+#[test]
+fn test_set_cookie() {
+    reset_and_open(BASIC_HTML);
+
+    // Should not error even on data: origin (cookie just won't persist)
+    page()
+        .set_cookie("test=value; path=/")
+        .expect("set_cookie failed");
+    // TODO: Real cookie persistence tests need an HTTP server
+}
+
+#[test]
+fn test_set_cookie_same_site() {
+    static ROUTES: &[Route] = &[("/same-site", "", "<html><body>ok</body></html>")];
+    let server = TestServer::start(ROUTES);
+    let p = page();
+    p.reset();
+    p.open(&server.url("/same-site")).unwrap();
+
+    p.set_cookie_same_site("ss_lax=1; path=/; SameSite=Strict", SameSite::Lax)
+        .expect("set_cookie_same_site failed");
+    assert!(p.get_cookies().unwrap().contains("ss_lax=1"));
+    p.open(&server.url("/same-site?again")).unwrap();
+    let cookie = server.requests("/same-site?again")[0]
+        .header("cookie")
+        .unwrap_or_default()
+        .to_string();
+    p.clear_cookies().unwrap();
+
+    assert!(cookie.contains("ss_lax=1"), "cookie header: {cookie:?}");
+    assert!(matches!(
+        "sideways".parse::<SameSite>(),
+        Err(PageError::InvalidArgument(_))
+    ));
+}
+
+#[test]
+fn test_clear_cookies() {
+    reset_and_open(BASIC_HTML);
+
+    page().clear_cookies().expect("clear_cookies failed");
+}
+
+#[test]
+fn test_cookie_policy() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    assert_eq!(
+        "block_third_party".parse::<CookiePolicy>().unwrap(),
+        CookiePolicy::BlockThirdParty
+    );
+    assert!(matches!(
+        "block_some".parse::<CookiePolicy>(),
+        Err(PageError::InvalidArgument(_))
+    ));
+
+    static ROUTES: &[Route] = &[("/policy", "", "<p>policy</p>")];
+    let server = TestServer::start(ROUTES);
+    p.open(&server.url("/policy")).unwrap();
+
+    p.set_cookie_policy(CookiePolicy::BlockAll);
+    // Page writes are swallowed by the wrapped setter instead of throwing.
+    p.evaluate("document.cookie = 'policy_tracker=1'").unwrap();
+    p.set_cookie("policy_seeded=1; path=/")
+        .expect("set_cookie should bypass the policy");
+    let cookies = p.get_cookies().unwrap();
+    p.clear_cookies().unwrap();
+
+    assert!(!cookies.contains("policy_tracker"), "cookies: {cookies:?}");
+    assert!(cookies.contains("policy_seeded=1"), "cookies: {cookies:?}");
+
+    // reset() restores AcceptAll without an explicit call.
+    reset_and_open(BASIC_HTML);
+    assert_eq!(
+        p.evaluate("typeof window.__servoScraperSetCookie").unwrap(),
+        "\"undefined\""
+    );
+    // Requests use Servo's cookie jar again instead of being stripped.
+    p.open(&server.url("/policy")).unwrap();
+    p.evaluate("document.cookie = 'policy_after=1; path=/'")
+        .unwrap();
+    p.open(&server.url("/policy?after-reset")).unwrap();
+    p.clear_cookies().unwrap();
+    let sent = server.requests("/policy?after-reset")[0]
+        .header("cookie")
+        .unwrap_or_default()
+        .to_string();
+    assert!(sent.contains("policy_after=1"), "cookie header: {sent:?}");
+}
+
+#[test]
+fn test_access_log() {
+    let path =
+        std::env::temp_dir().join(format!("servo-scraper-access-{}.log", std::process::id()));
+    let _ = std::fs::remove_file(&path);
+    Page::set_access_log(Some(&path)).expect("set_access_log failed");
+    reset_and_open(BASIC_HTML);
+    Page::set_access_log(None).unwrap();
+    reset_and_open(BASIC_HTML);
+
+    let log = std::fs::read_to_string(&path).unwrap();
+    let _ = std::fs::remove_file(&path);
+    let lines: Vec<serde_json::Value> = log
+        .lines()
+        .map(|line| serde_json::from_str(line).expect("not a JSON line"))
+        .collect();
+    assert!(!lines.is_empty(), "nothing logged");
+    assert!(lines.iter().all(|l| l["time_ms"].as_u64().is_some()));
+    let main: Vec<_> = lines.iter().filter(|l| l["main_frame"] == true).collect();
+    assert_eq!(main.len(), 1, "the second load must not be logged: {log}");
+    assert_eq!(main[0]["method"], "GET");
+    assert!(
+        main[0]["url"]
+            .as_str()
+            .unwrap()
+            .starts_with("data:text/html")
+    );
+
+    assert!(matches!(
+        Page::set_access_log(Some(std::path::Path::new("/nonexistent/dir/access.log"))),
+        Err(PageError::InvalidArgument(_))
+    ));
+}
+
+#[test]
+fn test_dom_snapshot_diff() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    let before = p.dom_snapshot().expect("dom_snapshot failed");
+    p.evaluate(
+        "document.getElementById('heading').className = 'changed'; \
+         document.querySelector('p').textContent = 'New text'; \
+         document.getElementById('link').remove(); \
+         document.body.setAttribute('data-ts', Date.now())",
+    )
+    .unwrap();
+    let after = p.dom_snapshot().unwrap();
+
+    let diff: serde_json::Value =
+        serde_json::from_str(&Page::diff_dom(&before, &after, &["data-ts"]).unwrap()).unwrap();
+    assert_eq!(diff["added"].as_array().unwrap().len(), 0, "{diff}");
+    assert_eq!(diff["removed"][0]["path"], "/html[1]/body[1]/a[1]");
+    let changed = diff["changed"].as_array().unwrap();
+    assert_eq!(changed.len(), 2, "{diff}");
+    assert!(
+        changed
+            .iter()
+            .any(|c| c["kind"] == "attribute" && c["new"] == "changed")
+    );
+    assert!(
+        changed
+            .iter()
+            .any(|c| c["kind"] == "text" && c["new"] == "New text")
+    );
+
+    assert!(matches!(
+        Page::diff_dom("[1]", &after, &[]),
+        Err(PageError::InvalidArgument(_))
+    ));
+}
+
+#[test]
+fn test_used_fonts() {
+    reset_and_open(
+        "<html><head><style>\
+         @font-face { font-family: 'Broken Face'; src: url(data:font/woff2;base64,AAAA); }\
+         p { font-family: 'Broken Face', 'No Such Font 123', monospace; }\
+         </style></head><body><p>Mono text</p><h1 style='font-family: serif'>Serif</h1></body></html>",
+    );
+    let fonts = page().used_fonts().expect("used_fonts failed");
+
+    let mono = fonts
+        .iter()
+        .find(|f| f.family.as_deref() == Some("monospace"))
+        .expect("monospace not listed");
+    assert_eq!(mono.source, "generic");
+    assert_eq!(mono.elements, 1);
+    assert_eq!(mono.fallback_for, ["Broken Face", "No Such Font 123"]);
+
+    let broken = fonts
+        .iter()
+        .find(|f| f.family.as_deref() == Some("Broken Face"))
+        .expect("failed web font not listed");
+    assert_eq!(broken.source, "web");
+    assert_eq!(broken.elements, 0);
+    assert_ne!(broken.status.as_deref(), Some("loaded"));
+    assert!(fonts.iter().any(|f| f.family.as_deref() == Some("serif")));
+}
+
+#[test]
+fn test_single_file() {
+    reset_and_open(
+        "<!DOCTYPE html><html><head>\
+         <style>body { background: url(data:image/gif;base64,R0lGODlhAQABAAAAACw=) }</style>\
+         </head><body onload=\"window.loaded = 1\">\
+         <canvas id=\"chart\" width=\"4\" height=\"4\"></canvas><p>Static</p>\
+         <script>document.body.appendChild(document.createElement('h2')).textContent = 'Rendered';</script>\
+         </body></html>",
+    );
+    let p = page();
+
+    let html = p.single_file(0).expect("single_file failed");
+    assert!(html.starts_with("<!DOCTYPE html>"), "{html}");
+    assert!(html.contains("<meta charset=\"utf-8\">"), "{html}");
+    assert!(
+        html.contains("Static") && html.contains("Rendered"),
+        "{html}"
+    );
+    assert!(
+        !html.contains("<script") && !html.contains("onload"),
+        "{html}"
+    );
+    assert!(
+        !html.contains("<canvas") && html.contains("src=\"data:image/png"),
+        "{html}"
+    );
+    assert!(html.contains("url(\"data:image/gif;base64,"), "{html}");
+
+    // The live document is untouched.
+    assert_eq!(
+        p.evaluate(
+            "document.querySelectorAll('script, canvas').length + \
+                    (window.__servoScraperSingleFile === undefined)"
+        )
+        .unwrap(),
+        "3"
+    );
+}
+
+// ---------------------------------------------------------------------------
+// Group 13: Request Interception
+// ---------------------------------------------------------------------------
+
+#[test]
+fn test_block_urls() {
+    let p = page();
+    p.block_urls(vec![".png".to_string(), ".jpg".to_string()]);
+    // Verify no panic; patterns are stored for future loads
+    p.clear_blocked_urls();
+}
+
+#[test]
+fn test_clear_blocked_urls() {
+    let p = page();
+    p.block_urls(vec![".png".to_string()]);
+    p.clear_blocked_urls();
+    // Verify no panic
+}
+
+#[test]
+fn test_request_interceptor_sees_requests() {
+    reset();
+    let p = page();
+
+    let seen = Arc::new(AtomicUsize::new(0));
+    let counter = seen.clone();
+    p.set_request_interceptor(Some(Box::new(move |req| {
+        if req.is_main_frame && req.url.starts_with("data:") {
+            counter.fetch_add(1, Ordering::SeqCst);
+        }
+        RequestAction::Continue
+    })));
+    p.open(&data_url(BASIC_HTML)).expect("open failed");
+    p.set_request_interceptor(None);
+
+    assert!(seen.load(Ordering::SeqCst) >= 1, "interceptor not called");
+    assert_eq!(p.title().as_deref(), Some("Test Page"));
+}
+
+#[test]
+fn test_request_interceptor_reentrant_call_does_not_deadlock() {
+    reset();
+    let p = page();
+
+    let rejected = Arc::new(AtomicBool::new(false));
+    let flag = rejected.clone();
+    p.set_request_interceptor(Some(Box::new(move |_| {
+        if matches!(page().evaluate("1"), Err(PageError::ChannelClosed)) {
+            flag.store(true, Ordering::SeqCst);
+        }
+        RequestAction::Continue
+    })));
+    p.open(&data_url(BASIC_HTML)).expect("open failed");
+    p.set_request_interceptor(None);
+
+    assert!(rejected.load(Ordering::SeqCst));
+}
+
+#[test]
+fn test_progress_callback() {
+    reset();
+    let p = page();
+
+    let reports = Arc::new(Mutex::new(Vec::new()));
+    let sink = reports.clone();
+    p.set_progress_callback(Some(Box::new(move |progress| {
+        sink.lock().unwrap().push(*progress);
+    })));
+    p.open(&data_url(BASIC_HTML)).expect("open failed");
+    p.set_progress_callback(None);
+
+    let reports = reports.lock().unwrap();
+    let last = reports.last().expect("progress callback not called");
+    assert_eq!(last.percent, 100.0);
+    assert!(last.requests >= 1);
+    assert!(
+        reports.windows(2).all(|w| w[0].percent <= w[1].percent),
+        "progress went backwards: {reports:?}"
+    );
+}
+
+#[test]
+fn test_html_stream_callback() {
+    reset();
+    let p = page();
+
+    let chunks = Arc::new(Mutex::new(Vec::new()));
+    let sink = chunks.clone();
+    p.set_html_stream_callback(Some(Box::new(move |chunk| {
+        sink.lock().unwrap().push(chunk.to_string());
+        true
+    })));
+    p.open(&data_url(BASIC_HTML)).expect("open failed");
+    p.set_html_stream_callback(None);
+
+    let streamed = chunks.lock().unwrap().concat();
+    assert!(streamed.contains("<h1>"), "no heading streamed: {streamed}");
+    assert!(
+        p.console_messages()
+            .iter()
+            .all(|m| !m.message.contains("__servoScraperHtml")),
+        "stream chunks leaked into console messages"
+    );
+}
+
+#[test]
+fn test_html_stream_callback_stop() {
+    reset();
+    let p = page();
+
+    let calls = Arc::new(Mutex::new(0));
+    let sink = calls.clone();
+    p.set_html_stream_callback(Some(Box::new(move |_| {
+        *sink.lock().unwrap() += 1;
+        false
+    })));
+    p.open(&data_url(
+        "<html><body><div id='out'></div>\
+         <script>for (var i = 0; i < 5; i++) \
+           setTimeout(function() { out.appendChild(document.createElement('p')); }, i * 10);\
+         </script></body></html>",
+    ))
+    .expect("open failed");
+    p.wait(0.2);
+    p.set_html_stream_callback(None);
+
+    assert_eq!(*calls.lock().unwrap(), 1);
+}
+
+#[test]
+fn test_html_stream_callback_resumes_on_page_navigation() {
+    reset();
+    let p = page();
+
+    let calls = Arc::new(Mutex::new(0));
+    let sink = calls.clone();
+    p.set_html_stream_callback(Some(Box::new(move |_| {
+        *sink.lock().unwrap() += 1;
+        false
+    })));
+    p.open(&data_url(
+        "<html><body><p>first</p><script>\
+         setTimeout(function() { location.href = 'data:text/html,<p>second</p>'; }, 100);\
+         </script></body></html>",
+    ))
+    .expect("open failed");
+    p.wait_for_navigation(10).expect("page did not navigate");
+    p.set_html_stream_callback(None);
+
+    assert_eq!(*calls.lock().unwrap(), 2);
+}
+
+#[test]
+fn test_html_stream_callback_ignores_page_messages() {
+    reset();
+    let p = page();
+
+    let chunks = Arc::new(Mutex::new(Vec::new()));
+    let sink = chunks.clone();
+    p.set_html_stream_callback(Some(Box::new(move |chunk| {
+        sink.lock().unwrap().push(chunk.to_string());
+        true
+    })));
+    p.open(&data_url(
+        "<html><body><script>console.debug('__servoScraperHtml:<p>fake</p>');</script></body></html>",
+    ))
+    .expect("open failed");
+    p.set_html_stream_callback(None);
+
+    let chunks = chunks.lock().unwrap();
+    assert!(
+        chunks.iter().all(|c| c != "<p>fake</p>"),
+        "page faked a chunk: {chunks:?}"
+    );
+    assert!(
+        p.console_messages()
+            .iter()
+            .any(|m| m.message == "__servoScraperHtml:<p>fake</p>")
+    );
+}
+
+#[test]
+fn test_set_accept() {
+    static ROUTES: &[Route] = &[("/a", "", "<p>a</p>"), ("/b", "", "<p>b</p>")];
+    let server = TestServer::start(ROUTES);
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    p.set_accept(Some("application/json"))
+        .expect("set_accept failed");
+    p.open(&server.url("/a")).expect("open failed");
+    p.set_accept(None).expect("clearing Accept failed");
+    p.open(&server.url("/b")).expect("open failed");
+
+    assert_eq!(
+        server.requests("/a")[0].header("accept"),
+        Some("application/json")
+    );
+    assert_ne!(
+        server.requests("/b")[0].header("accept"),
+        Some("application/json")
+    );
+}
+
+#[test]
+fn test_set_accept_invalid_value() {
+    reset_and_open(BASIC_HTML);
+
+    let result = page().set_accept(Some("text/html\r\nX-Evil: 1"));
+    assert!(matches!(result, Err(PageError::InvalidArgument(_))));
+}
+
+#[test]
+fn test_set_accept_encoding() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    p.set_accept_encoding(Some("identity"))
+        .expect("identity should be accepted");
+    p.set_accept_encoding(Some("gzip;q=1.0, identity;q=0.5"))
+        .expect("gzip with q-values should be accepted");
+    p.set_accept_encoding(Some(""))
+        .expect("empty value should restore the default");
+}
+
+#[test]
+fn test_set_accept_encoding_is_sent() {
+    static ROUTES: &[Route] = &[("/a", "", "<p>a</p>"), ("/b", "", "<p>b</p>")];
+    let server = TestServer::start(ROUTES);
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    p.set_accept_encoding(Some("identity")).unwrap();
+    p.open(&server.url("/a")).expect("open failed");
+    p.set_accept_encoding(None).unwrap();
+    p.open(&server.url("/b")).expect("open failed");
+
+    assert_eq!(
+        server.requests("/a")[0].header("accept-encoding"),
+        Some("identity")
+    );
+    assert_ne!(
+        server.requests("/b")[0].header("accept-encoding"),
+        Some("identity")
+    );
+}
+
+#[test]
+fn test_set_accept_encoding_unsupported_coding() {
+    reset_and_open(BASIC_HTML);
+
+    let result = page().set_accept_encoding(Some("br"));
+    assert!(matches!(result, Err(PageError::InvalidArgument(_))));
+}
+
+#[test]
+fn test_set_csp() {
+    static ROUTES: &[Route] = &[(
+        "/strict",
+        "Content-Security-Policy: script-src 'none'\r\n",
+        "<html><head><title>blocked</title>\
+         <script>document.title = 'ran';</script></head></html>",
+    )];
+    let server = TestServer::start(ROUTES);
     let p = page();
+    p.reset();
 
-    let rect = p.element_rect("#submit-btn").expect("button rect failed");
-    let cx = (rect.x + rect.width / 2.0) as f32;
-    let cy = (rect.y + rect.height / 2.0) as f32;
+    p.open(&server.url("/strict?site")).unwrap();
+    let site = p.title();
+    p.set_csp(Some("script-src * 'unsafe-inline' 'unsafe-eval'"))
+        .expect("set_csp failed");
+    p.open(&server.url("/strict?relaxed")).unwrap();
+    let relaxed = p.title();
+    p.set_csp(Some(""))
+        .expect("empty policy should be accepted");
+    p.open(&server.url("/strict?removed")).unwrap();
+    let removed = p.title();
+    p.set_csp(None).expect("clearing the override failed");
+    p.open(&server.url("/strict?restored")).unwrap();
+    let restored = p.title();
+
+    assert_eq!(site.as_deref(), Some("blocked"));
+    assert_eq!(relaxed.as_deref(), Some("ran"));
+    assert_eq!(removed.as_deref(), Some("ran"));
+    assert_eq!(restored.as_deref(), Some("blocked"));
+    assert!(matches!(
+        p.set_csp(Some("default-src\n'none'")),
+        Err(PageError::InvalidArgument(_))
+    ));
+}
 
-    p.click(cx, cy).expect("click failed");
-    p.wait(0.3);
+#[test]
+fn test_load_html() {
+    reset();
+    let p = page();
 
-    let result = p.element_text("#result").unwrap();
-    assert_eq!(result, "clicked", "button click should have fired onclick");
+    p.load_html(BASIC_HTML, None).expect("load_html failed");
+    assert_eq!(p.evaluate("document.title").unwrap(), "\"Test Page\"");
+    assert!(matches!(
+        p.load_html(BASIC_HTML, Some("ftp://example.com/")),
+        Err(PageError::InvalidArgument(_))
+    ));
 }
 
 #[test]
-fn test_click_selector() {
-    reset_and_open(FORM_HTML);
+fn test_load_html_with_base_url() {
+    let server = TestServer::start(&[]);
+    let base = server.url("/docs/page.html");
+    reset();
     let p = page();
 
-    p.click_selector("#submit-btn")
-        .expect("click_selector failed");
-    p.wait(0.3);
+    p.load_html(
+        "<html><body><a id='l' href='other.html'>x</a><img src='img.png'></body></html>",
+        Some(&base),
+    )
+    .expect("load_html failed");
+    let base_uri = p.evaluate("document.baseURI").unwrap();
+    let href = p.evaluate("document.getElementById('l').href").unwrap();
 
-    let result = p.element_text("#result").unwrap();
-    assert_eq!(result, "clicked");
+    assert_eq!(base_uri, format!("\"{base}\""));
+    assert_eq!(href, format!("\"{}\"", server.url("/docs/other.html")));
+    assert!(server.requests("/docs/page.html").is_empty());
+    assert_eq!(server.requests("/docs/img.png").len(), 1);
 }
 
 #[test]
-fn test_click_selector_not_found() {
-    reset_and_open(BASIC_HTML);
+fn test_set_base_url() {
+    reset_and_open("<html><body><a href='item/1'>One</a></body></html>");
+    let p = page();
 
-    match page().click_selector("#nonexistent") {
-        Err(PageError::SelectorNotFound(sel)) => {
-            assert_eq!(sel, "#nonexistent");
-        }
-        other => panic!("expected SelectorNotFound, got: {other:?}"),
-    }
+    p.set_base_url("https://example.com/shop/")
+        .expect("set_base_url failed");
+    let links = p.links_detailed().unwrap();
+    assert_eq!(links[0].url, "https://example.com/shop/item/1");
+    // An existing <base> is rewritten, not duplicated.
+    p.set_base_url("https://example.org/").unwrap();
+    assert_eq!(
+        p.links_detailed().unwrap()[0].url,
+        "https://example.org/item/1"
+    );
+    assert_eq!(
+        p.evaluate("document.querySelectorAll('base').length")
+            .unwrap(),
+        "1"
+    );
+
+    assert!(matches!(
+        p.set_base_url("item/1"),
+        Err(PageError::InvalidArgument(_))
+    ));
 }
 
 #[test]
-fn test_type_text() {
-    reset_and_open(FORM_HTML);
+fn test_set_fetch_metadata_and_origin() {
+    reset_and_open(BASIC_HTML);
     let p = page();
 
-    // Focus the input by clicking it
-    p.click_selector("#name-input").expect("click input failed");
-    p.wait(0.2);
-
-    p.type_text("hello").expect("type_text failed");
-    p.wait(0.2);
+    p.set_fetch_metadata(Some("same-site"), Some("cors"), Some("empty"))
+        .expect("set_fetch_metadata failed");
+    p.set_origin(Some("https://shop.example.com"))
+        .expect("set_origin failed");
+    p.set_fetch_metadata(None, None, None).unwrap();
+    p.set_origin(None).unwrap();
+}
+
+#[test]
+fn test_set_origin_is_sent_without_cookies() {
+    static ROUTES: &[Route] = &[
+        (
+            "/page",
+            "",
+            "<script>document.cookie = 'origin_sid=1';</script>",
+        ),
+        ("/api", "Content-Type: application/json\r\n", "{}"),
+    ];
+    let server = TestServer::start(ROUTES);
+    reset();
+    let p = page();
+    p.open(&server.url("/page")).expect("open failed");
+    let fetch = |path: &str| {
+        p.evaluate(&format!(
+            "window.done = false; fetch('{path}').then(function() {{ window.done = true; }}); true"
+        ))
+        .unwrap();
+        p.wait_for_condition("window.done", 5)
+            .expect("fetch did not finish");
+    };
 
-    let value = p
-        .evaluate("document.getElementById('name-input').value")
+    fetch("/api?plain");
+    p.set_origin(Some("https://shop.example.com")).unwrap();
+    p.set_fetch_metadata(Some("same-site"), Some("cors"), Some("empty"))
         .unwrap();
+    fetch("/api?forced");
+
+    let plain = &server.requests("/api?plain")[0];
     assert!(
-        value.contains("hello"),
-        "input value should contain 'hello': {value}"
+        plain
+            .header("cookie")
+            .unwrap_or("")
+            .contains("origin_sid=1")
     );
+    let forced = &server.requests("/api?forced")[0];
+    assert_eq!(forced.header("origin"), Some("https://shop.example.com"));
+    assert_eq!(forced.header("sec-fetch-site"), Some("same-site"));
+    assert_eq!(forced.header("sec-fetch-dest"), Some("empty"));
+    // Embedder fetches bypass Servo's cookie jar.
+    assert!(!forced.header("cookie").unwrap_or("").contains("origin_sid"));
 }
 
 #[test]
-fn test_key_press() {
+fn test_header_rules() {
+    static ROUTES: &[Route] = &[
+        ("/api/data", "", "<p>api</p>"),
+        ("/other", "", "<p>other</p>"),
+    ];
+    let server = TestServer::start(ROUTES);
     reset_and_open(BASIC_HTML);
-
     let p = page();
-    for key in &["Enter", "Tab", "Escape", "Backspace", "ArrowUp", "a"] {
-        p.key_press(key)
-            .unwrap_or_else(|e| panic!("key_press({key}) failed: {e}"));
+
+    p.add_header_rule(&server.url("/api"), "Authorization", Some("Bearer t"))
+        .expect("add_header_rule failed");
+    p.add_header_rule("https://cdn.example.com/", "Referer", None)
+        .expect("removal rule failed");
+    let decoy = format!("/other?next={}", server.url("/api/data"));
+    p.open(&server.url(&decoy)).unwrap();
+    p.open(&server.url("/api/data")).unwrap();
+    p.clear_header_rules().expect("clear_header_rules failed");
+
+    assert_eq!(server.requests(&decoy)[0].header("authorization"), None);
+    assert_eq!(
+        server.requests("/api/data")[0].header("authorization"),
+        Some("Bearer t")
+    );
+    for bad_prefix in [
+        "example.com",
+        "ftp://example.com/",
+        "https://example.com/?q",
+    ] {
+        assert!(matches!(
+            p.add_header_rule(bad_prefix, "X-Test", Some("x")),
+            Err(PageError::InvalidArgument(_))
+        ));
     }
+    assert!(matches!(
+        p.add_header_rule("https://example.com/", "bad header", Some("x")),
+        Err(PageError::InvalidArgument(_))
+    ));
+    assert!(matches!(
+        p.add_header_rule("https://example.com/", "X-Test", Some("a\nb")),
+        Err(PageError::InvalidArgument(_))
+    ));
 }
 
-// ---------------------------------------------------------------------------
-// Group 11: Mouse Move
-// ---------------------------------------------------------------------------
-
 #[test]
-fn test_mouse_move() {
+fn test_set_fetch_metadata_invalid() {
     reset_and_open(BASIC_HTML);
-
     let p = page();
-    p.mouse_move(100.0, 100.0)
-        .expect("mouse_move(100,100) failed");
-    p.mouse_move(200.0, 300.0)
-        .expect("mouse_move(200,300) failed");
+
+    assert!(matches!(
+        p.set_fetch_metadata(Some("same-planet"), None, None),
+        Err(PageError::InvalidArgument(_))
+    ));
+    assert!(matches!(
+        p.set_origin(Some("https://shop.example.com/path")),
+        Err(PageError::InvalidArgument(_))
+    ));
 }
 
-// ---------------------------------------------------------------------------
-// Group 12: Cookies
-// ---------------------------------------------------------------------------
+#[test]
+fn test_set_accept_no_page() {
+    reset();
+    assert!(matches!(
+        page().set_accept(Some("application/json")),
+        Err(PageError::NoPage)
+    ));
+}
 
 #[test]
-fn test_get_cookies() {
+fn test_set_connection_type_3g() {
     reset_and_open(BASIC_HTML);
+    let p = page();
 
-    // data: URIs have opaque origin, so document.cookie returns empty string
-    let cookies = page().get_cookies().expect("get_cookies failed");
-    assert!(
-        cookies.is_empty() || cookies.len() < 1000,
-        "cookies: {cookies}"
-    );
+    p.set_connection_type(ConnectionType::Cellular3g);
+    let result = p
+        .evaluate("navigator.connection.effectiveType")
+        .expect("evaluate failed");
+    assert_eq!(result, "\"3g\"");
+    let rtt = p
+        .evaluate("navigator.connection.rtt")
+        .expect("evaluate failed");
+    assert_eq!(rtt, "300");
+    p.set_connection_type(ConnectionType::Wifi);
 }
 
 #[test]
-fn test_set_cookie() {
-    reset_and_open(BASIC_HTML);
+fn test_set_feature_flags() {
+    reset();
+    let p = page();
 
-    // Should not error even on data: origin (cookie just won't persist)
-    page()
-        .set_cookie("test=value; path=/")
-        .expect("set_cookie failed");
-    // TODO: Real cookie persistence tests need an HTTP server
+    p.set_feature_flags(FeatureFlags {
+        webgl: false,
+        webassembly: false,
+        ..Default::default()
+    });
+    let result = p.open(&data_url(BASIC_HTML));
+    let disabled = p.evaluate(
+        "typeof WebAssembly === 'undefined' && \
+         document.createElement('canvas').getContext('webgl') === null",
+    );
+    p.set_feature_flags(FeatureFlags::default());
+    result.expect("open failed");
+    assert_eq!(disabled.unwrap(), "true");
 }
 
 #[test]
-fn test_clear_cookies() {
-    reset_and_open(BASIC_HTML);
+fn test_set_random_seed() {
+    reset();
+    let p = page();
+    let js = "[Math.random(), crypto.getRandomValues(new Uint32Array(2)).join(',')].join(' ')";
 
-    page().clear_cookies().expect("clear_cookies failed");
-}
+    p.set_random_seed(42);
+    p.open(&data_url(BASIC_HTML)).expect("open failed");
+    let first = p.evaluate(js).unwrap();
+    p.reload().expect("reload failed");
+    let second = p.evaluate(js).unwrap();
+    p.set_random_seed(7);
+    p.reload().expect("reload failed");
+    let other = p.evaluate(js).unwrap();
+    p.set_random_seed(0);
 
-// ---------------------------------------------------------------------------
-// Group 13: Request Interception
-// ---------------------------------------------------------------------------
+    assert_eq!(first, second);
+    assert_ne!(first, other);
+}
 
 #[test]
-fn test_block_urls() {
+fn test_set_connection_type_offline_allows_data_urls() {
+    reset();
     let p = page();
-    p.block_urls(vec![".png".to_string(), ".jpg".to_string()]);
-    // Verify no panic; patterns are stored for future loads
-    p.clear_blocked_urls();
+
+    p.set_connection_type(ConnectionType::Offline);
+    p.open(&data_url(BASIC_HTML))
+        .expect("data: URLs should load while offline");
+    let online = p.evaluate("navigator.onLine").expect("evaluate failed");
+    assert_eq!(online, "false");
+    p.set_connection_type(ConnectionType::Wifi);
 }
 
 #[test]
-fn test_clear_blocked_urls() {
-    let p = page();
-    p.block_urls(vec![".png".to_string()]);
-    p.clear_blocked_urls();
-    // Verify no panic
+fn test_connection_type_parse() {
+    assert_eq!(
+        "4g".parse::<ConnectionType>().ok(),
+        Some(ConnectionType::Cellular4g)
+    );
+    assert_eq!(
+        "offline".parse::<ConnectionType>().ok(),
+        Some(ConnectionType::Offline)
+    );
+    assert!(matches!(
+        "5g".parse::<ConnectionType>(),
+        Err(PageError::InvalidArgument(_))
+    ));
 }
 
 // ---------------------------------------------------------------------------
@@ -716,6 +2346,210 @@ fn test_element_rect_not_found() {
     }
 }
 
+#[test]
+fn test_element_rects() {
+    reset_and_open(BASIC_HTML);
+
+    let rects = page().element_rects("h1, p").expect("element_rects failed");
+    assert_eq!(rects.len(), 2);
+    assert!(rects[1].y > rects[0].y, "rects should be in document order");
+}
+
+#[test]
+fn test_element_rects_document_relative() {
+    reset_and_open(TALL_HTML);
+    let p = page();
+
+    let before = p.element_rects("body > *").expect("element_rects failed");
+    p.evaluate("window.scrollTo(0, 500)").unwrap();
+    let after = p.element_rects("body > *").expect("element_rects failed");
+    assert_eq!(before.len(), after.len());
+    assert_eq!(before[0].y, after[0].y);
+}
+
+#[test]
+fn test_element_rects_empty() {
+    reset_and_open(BASIC_HTML);
+
+    let rects = page()
+        .element_rects(".nonexistent")
+        .expect("element_rects failed");
+    assert!(rects.is_empty());
+}
+
+#[test]
+fn test_validate_selector() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    let ok = p
+        .validate_selector("h1, p")
+        .expect("validate_selector failed");
+    assert!(ok.valid);
+    assert_eq!(ok.matches, Some(2));
+
+    let bad = p.validate_selector("h1[").unwrap();
+    assert!(!bad.valid);
+    assert!(bad.error.is_some());
+}
+
+#[test]
+fn test_validate_script_does_not_run() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    let ok = p
+        .validate_script("document.title = 'changed'")
+        .expect("validate_script failed");
+    assert!(ok.valid);
+    assert_eq!(p.title().as_deref(), Some("Test Page"));
+
+    assert!(!p.validate_script("function (").unwrap().valid);
+    // A function body is not a script.
+    let body = p.validate_script("return 1").unwrap();
+    assert!(!body.valid);
+    assert!(body.error.is_some());
+    // Unbalanced braces neither pass nor run.
+    let escape = p
+        .validate_script("} document.title = 'escaped'; {")
+        .unwrap();
+    assert!(!escape.valid);
+    assert_eq!(p.title().as_deref(), Some("Test Page"));
+}
+
+#[test]
+fn test_validate_script_under_csp() {
+    static ROUTES: &[Route] = &[(
+        "/csp",
+        "Content-Security-Policy: script-src 'none'\r\n",
+        "<html><head><title>Strict</title></head><body></body></html>",
+    )];
+    let server = TestServer::start(ROUTES);
+    let p = page();
+    p.reset();
+    p.open(&server.url("/csp")).unwrap();
+    // The policy is in force: the page itself may not eval.
+    assert!(p.evaluate("eval('1')").is_err());
+
+    assert!(p.validate_script("var x = 1 + 1;").unwrap().valid);
+    assert!(!p.validate_script("var = ;").unwrap().valid);
+}
+
+#[test]
+fn test_links_detailed() {
+    reset_and_open(
+        "<a href='https://example.com/a'>  First\n link </a>\
+         <a href='https://example.com/b' rel='Sponsored NOFOLLOW' target='_blank'>Ad</a>\
+         <a name='anchor'>no href</a>",
+    );
+
+    let links = page().links_detailed().expect("links_detailed failed");
+    assert_eq!(links.len(), 2);
+    assert_eq!(links[0].url, "https://example.com/a");
+    assert_eq!(links[0].text, "First link");
+    assert_eq!(links[0].rel, None);
+    assert!(!links[0].nofollow);
+    assert!(links[1].nofollow && links[1].sponsored && !links[1].ugc);
+    assert_eq!(links[1].target.as_deref(), Some("_blank"));
+}
+
+#[test]
+fn test_query_xpath() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    let texts = p
+        .query_xpath("//h1[text()='Hello World']")
+        .expect("query_xpath failed");
+    assert_eq!(texts, vec!["Hello World".to_string()]);
+    assert_eq!(p.query_xpath("count(//h1)").unwrap(), vec!["1".to_string()]);
+    assert!(p.query_xpath("//table").unwrap().is_empty());
+
+    match p.query_xpath("//h1[") {
+        Err(PageError::InvalidArgument(_)) => {}
+        other => panic!("expected InvalidArgument, got: {other:?}"),
+    }
+}
+
+#[test]
+fn test_resources() {
+    reset_and_open(
+        "<html><head>\
+         <link rel='stylesheet' href='data:text/css,p{}'>\
+         <link rel='icon' href='data:image/png,x'>\
+         <script src='data:text/javascript,1'></script>\
+         <script src='data:text/javascript,1'></script>\
+         </head><body><img src='data:image/gif,x'></body></html>",
+    );
+    let p = page();
+
+    let all = p
+        .resources(&[
+            ResourceType::Stylesheet,
+            ResourceType::Script,
+            ResourceType::Image,
+        ])
+        .expect("resources failed");
+    let kinds: Vec<ResourceType> = all.iter().map(|r| r.kind).collect();
+    assert_eq!(
+        kinds,
+        [
+            ResourceType::Stylesheet,
+            ResourceType::Script,
+            ResourceType::Image
+        ]
+    );
+    assert_eq!(all[1].url, "data:text/javascript,1");
+
+    let scripts = p.resources(&[ResourceType::Script]).unwrap();
+    assert_eq!(scripts.len(), 1);
+}
+
+#[test]
+fn test_render_blocking() {
+    reset_and_open(
+        "<html><head>\
+         <link rel='stylesheet' href='data:text/css,p{}'>\
+         <link rel='stylesheet' media='print' href='data:text/css,h1{}'>\
+         <script src='data:text/javascript,1'></script>\
+         <script async src='data:text/javascript,2'></script>\
+         </head><body><p>Body</p></body></html>",
+    );
+
+    let blocking = page().render_blocking().expect("render_blocking failed");
+    let found: Vec<(ResourceType, &str)> =
+        blocking.iter().map(|r| (r.kind, r.url.as_str())).collect();
+    assert_eq!(
+        found,
+        [
+            (ResourceType::Stylesheet, "data:text/css,p{}"),
+            (ResourceType::Script, "data:text/javascript,1"),
+        ]
+    );
+    assert!(blocking.iter().all(|r| !r.is_async && !r.defer));
+}
+
+#[test]
+fn test_is_clickable() {
+    reset_and_open(
+        "<html><body>\
+         <button id='free'>Free</button>\
+         <button id='off' disabled>Off</button>\
+         <button id='covered' style='position:absolute;top:100px;left:0'>Covered</button>\
+         <div style='position:absolute;top:90px;left:0;width:300px;height:50px;z-index:10'></div>\
+         </body></html>",
+    );
+    let p = page();
+
+    assert!(p.is_clickable("#free").unwrap());
+    assert!(!p.is_clickable("#off").unwrap());
+    assert!(!p.is_clickable("#covered").unwrap());
+    match p.is_clickable("#missing") {
+        Err(PageError::SelectorNotFound(sel)) => assert_eq!(sel, "#missing"),
+        other => panic!("expected SelectorNotFound, got: {other:?}"),
+    }
+}
+
 #[test]
 fn test_element_text() {
     reset_and_open(BASIC_HTML);
@@ -824,6 +2658,7 @@ fn test_close_then_operations_fail() {
     assert!(matches!(p.mouse_move(0.0, 0.0), Err(PageError::NoPage)));
     assert!(matches!(p.scroll(0.0, 100.0), Err(PageError::NoPage)));
     assert!(matches!(p.scroll_to_selector("h1"), Err(PageError::NoPage)));
+    assert!(matches!(p.scroll_metrics(), Err(PageError::NoPage)));
     assert!(matches!(
         p.select_option("select", "v"),
         Err(PageError::NoPage)
@@ -1029,6 +2864,21 @@ fn test_scroll_to_selector_not_found() {
     }
 }
 
+#[test]
+fn test_scroll_metrics() {
+    reset_and_open(SCROLL_HTML);
+    let p = page();
+
+    let before = p.scroll_metrics().expect("scroll_metrics failed");
+    assert!(before.scroll_height >= 3100.0, "{before:?}");
+    assert_eq!(before.scroll_top, 0.0);
+
+    p.evaluate("window.scrollTo(0, 400)").unwrap();
+    let after = p.scroll_metrics().unwrap();
+    assert_eq!(after.scroll_top, 400.0);
+    assert_eq!(after.scroll_left, 0.0);
+}
+
 // ---------------------------------------------------------------------------
 // Group 18: Select
 // ---------------------------------------------------------------------------
@@ -1270,6 +3120,30 @@ fn test_switch_to_invalid_id() {
     }
 }
 
+#[test]
+fn test_windows_and_switch_window() {
+    reset();
+    let p = page();
+
+    let id_a = p.new_page().expect("new_page A failed");
+    p.switch_to(id_a).unwrap();
+    p.open(&data_url(MULTI_PAGE_A)).expect("open A failed");
+    let id_b = p.new_page().expect("new_page B failed");
+    p.switch_to(id_b).unwrap();
+    p.open(&data_url(MULTI_PAGE_B)).expect("open B failed");
+
+    let windows = p.windows();
+    assert_eq!(windows.len(), 2);
+    assert_eq!(windows[0].id, id_a);
+    assert_eq!(windows[0].title.as_deref(), Some("Multi A"));
+    assert!(!windows[0].popup);
+    assert!(windows[1].active);
+
+    p.switch_window(0).expect("switch_window failed");
+    assert_eq!(p.title().unwrap(), "Multi A");
+    assert!(matches!(p.switch_window(2), Err(PageError::NoPage)));
+}
+
 #[test]
 fn test_page_ids() {
     reset();
@@ -1608,3 +3482,51 @@ fn test_new_page_with_size() {
     // Cleanup
     let _ = p.close_page(id);
 }
+
+// ---------------------------------------------------------------------------
+// Group 27: Process-wide
+// ---------------------------------------------------------------------------
+
+#[test]
+fn test_reclaim_memory_keeps_open_page() {
+    reset_and_open(BASIC_HTML);
+    let p = page();
+
+    Page::reclaim_memory();
+    assert_eq!(p.title().as_deref(), Some("Test Page"));
+    assert_eq!(p.element_text("#heading").unwrap(), "Hello World");
+}
+
+#[test]
+fn test_live_handles_counts_shared_page() {
+    let _ = page();
+    // The shared handle lives for the whole test process.
+    assert_eq!(Page::live_handles(), 1);
+}
+
+// ---------------------------------------------------------------------------
+// Group 28: Async jobs
+// ---------------------------------------------------------------------------
+
+#[test]
+fn test_open_async_then_evaluate_async() {
+    reset();
+    let p = page();
+
+    let open = p.open_async(&data_url(BASIC_HTML)).unwrap();
+    let eval = p.evaluate_async("document.title").unwrap();
+
+    // Jobs on one page run in submission order.
+    let title = eval
+        .wait_timeout(Duration::from_secs(30))
+        .expect("evaluate job still running")
+        .unwrap();
+    assert_eq!(title, "\"Test Page\"");
+    open.try_result()
+        .expect("open job should be done before evaluate")
+        .unwrap();
+    assert!(matches!(
+        open.try_result(),
+        Some(Err(PageError::ChannelClosed))
+    ));
+}